@@ -0,0 +1,100 @@
+// Package analysis measures the tempo, key and loudness of audio files, so
+// library values can be checked against the audio itself.
+package analysis
+
+import (
+	"context"
+	"io"
+
+	"github.com/ilmarkerm/djlibgo/audio"
+)
+
+// analysisRate is the rate the mono signal is reduced to. Nothing above a
+// few kHz matters for the analysis.
+const analysisRate = 11025
+
+// Result is the analysis of one file
+type Result struct {
+	// Duration is the decoded length in seconds
+	Duration float64
+	Tempo    Tempo
+	Key      Key
+	Loudness Loudness
+}
+
+// Analyze decodes a file and analyses it. It returns ctx.Err() when ctx is
+// cancelled before the analysis is done.
+func Analyze(ctx context.Context, path string) (Result, error) {
+	signal, loudness, err := decode(ctx, path, true)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Duration: float64(len(signal.samples)) / signal.rate,
+		Tempo:    DetectTempo(signal.samples, signal.rate),
+		Key:      DetectKey(signal.samples, signal.rate),
+		Loudness: loudness,
+	}, nil
+}
+
+// monoSignal is a downmixed and decimated file
+type monoSignal struct {
+	samples []float32
+	rate    float64
+}
+
+// decode decodes a file into a mono signal at about analysisRate and, when
+// measure is set, measures the loudness of the full signal on the way. Every
+// mono sample is the average of the input frames it replaces, which is
+// enough of a low pass filter for the analysis.
+func decode(ctx context.Context, path string, measure bool) (monoSignal, Loudness, error) {
+	dec, err := audio.Open(path)
+	if err != nil {
+		return monoSignal{}, Loudness{}, err
+	}
+	defer dec.Close()
+
+	format := dec.Format()
+	channels := format.Channels
+	factor := max(format.SampleRate/analysisRate, 1)
+	signal := monoSignal{rate: float64(format.SampleRate) / float64(factor)}
+	if format.Frames > 0 {
+		signal.samples = make([]float32, 0, format.Frames/int64(factor)+1)
+	}
+	var meter *loudnessMeter
+	if measure {
+		meter = newLoudnessMeter(format.SampleRate, channels)
+	}
+	scale := 1 / float32(factor*channels)
+	buf := make([]float32, 4096*channels)
+	var sum float32
+	count := 0
+	for block := 0; ; block++ {
+		if block%64 == 0 {
+			if err := ctx.Err(); err != nil {
+				return monoSignal{}, Loudness{}, err
+			}
+		}
+		n, err := dec.Read(buf)
+		if meter != nil {
+			meter.add(buf[:n*channels])
+		}
+		for _, sample := range buf[:n*channels] {
+			sum += sample
+			count++
+			if count == factor*channels {
+				signal.samples = append(signal.samples, sum*scale)
+				sum, count = 0, 0
+			}
+		}
+		if err == io.EOF {
+			if meter == nil {
+				return signal, Loudness{}, nil
+			}
+			return signal, meter.result(), nil
+		}
+		if err != nil {
+			return monoSignal{}, Loudness{}, err
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package analysis
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/ilmarkerm/djlibgo/fileutil"
+)
+
+// cacheVersion changes whenever the analysis does, which drops old results
+const cacheVersion = 3
+
+// Cache keeps analysis results by the SHA-1 of the file content, so moved
+// and copied files are not analysed again. The size and modification time of
+// every hashed path are remembered, so unchanged files are not hashed again
+// either. The cache is a JSON file that is read on creation and written by Save.
+type Cache struct {
+	path  string
+	mu    sync.Mutex
+	data  cacheData
+	dirty bool
+}
+
+type cacheData struct {
+	Version int
+	Files   map[string]cachedFile
+	Results map[string]Result
+}
+
+type cachedFile struct {
+	Size    int64
+	ModTime int64
+	Hash    string
+}
+
+// NewCache returns a cache stored in the given file. A missing or outdated
+// file starts an empty cache.
+func NewCache(path string) *Cache {
+	c := &Cache{path: path}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &c.data)
+	}
+	if c.data.Version != cacheVersion {
+		c.data = cacheData{Version: cacheVersion}
+	}
+	if c.data.Files == nil {
+		c.data.Files = make(map[string]cachedFile)
+	}
+	if c.data.Results == nil {
+		c.data.Results = make(map[string]Result)
+	}
+	return c
+}
+
+// DefaultCache returns the cache in the user's cache folder
+func DefaultCache() *Cache {
+	return NewCache(fileutil.CachePath("analysis.json"))
+}
+
+// Hash returns the content hash of a file
+func (c *Cache) Hash(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	known, ok := c.data.Files[path]
+	c.mu.Unlock()
+	if ok && known.Size == info.Size() && known.ModTime == info.ModTime().UnixNano() {
+		return known.Hash, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha1.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	c.mu.Lock()
+	c.data.Files[path] = cachedFile{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Hash: sum}
+	c.dirty = true
+	c.mu.Unlock()
+	return sum, nil
+}
+
+// Lookup returns the cached result of a file, if any
+func (c *Cache) Lookup(path string) (Result, bool) {
+	hash, err := c.Hash(path)
+	if err != nil {
+		return Result{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result, ok := c.data.Results[hash]
+	return result, ok
+}
+
+// Analyze returns the cached result of a file, analysing it when needed
+func (c *Cache) Analyze(ctx context.Context, path string) (Result, error) {
+	hash, err := c.Hash(path)
+	if err != nil {
+		return Result{}, err
+	}
+	c.mu.Lock()
+	result, ok := c.data.Results[hash]
+	c.mu.Unlock()
+	if ok {
+		return result, nil
+	}
+	result, err = Analyze(ctx, path)
+	if err != nil {
+		return Result{}, err
+	}
+	c.mu.Lock()
+	c.data.Results[hash] = result
+	c.dirty = true
+	c.mu.Unlock()
+	return result, nil
+}
+
+// Save writes the cache file when anything was added
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	// Forget paths that no longer exist
+	for path := range c.data.Files {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			delete(c.data.Files, path)
+		}
+	}
+	data, err := json.Marshal(c.data)
+	if err != nil {
+		return err
+	}
+	err = fileutil.WriteAtomic(c.path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
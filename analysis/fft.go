@@ -0,0 +1,75 @@
+package analysis
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// spectrum computes magnitude spectra of Hann windowed frames with a radix-2 FFT
+type spectrum struct {
+	size    int
+	window  []float64
+	twiddle []complex128
+	buf     []complex128
+}
+
+// newSpectrum prepares transforms of size samples, which must be a power of two
+func newSpectrum(size int) *spectrum {
+	s := &spectrum{
+		size:    size,
+		window:  make([]float64, size),
+		twiddle: make([]complex128, size/2),
+		buf:     make([]complex128, size),
+	}
+	// The window is scaled so a full scale sine peaks at magnitude 1
+	for i := range s.window {
+		s.window[i] = 2 * (1 - math.Cos(2*math.Pi*float64(i)/float64(size))) / float64(size)
+	}
+	for i := range s.twiddle {
+		s.twiddle[i] = cmplx.Exp(complex(0, -2*math.Pi*float64(i)/float64(size)))
+	}
+	return s
+}
+
+// magnitudes fills mags with the size/2 magnitudes of the frame starting at
+// samples[0]. Missing samples at the end count as silence.
+func (s *spectrum) magnitudes(samples []float32, mags []float64) {
+	for i := range s.buf {
+		var value float64
+		if i < len(samples) {
+			value = float64(samples[i]) * s.window[i]
+		}
+		s.buf[i] = complex(value, 0)
+	}
+	s.transform(s.buf)
+	for k := range mags[:s.size/2] {
+		mags[k] = cmplx.Abs(s.buf[k])
+	}
+}
+
+// transform runs an in place FFT over x
+func (s *spectrum) transform(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		half := size / 2
+		stride := n / size
+		for start := 0; start < n; start += size {
+			for k := 0; k < half; k++ {
+				a := x[start+k]
+				b := x[start+k+half] * s.twiddle[k*stride]
+				x[start+k] = a + b
+				x[start+k+half] = a - b
+			}
+		}
+	}
+}
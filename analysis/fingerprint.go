@@ -0,0 +1,224 @@
+package analysis
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+// Fingerprint parameters. Every file is resampled to fingerprintRate first,
+// so copies at other sample rates give the same hashes.
+const (
+	fingerprintRate   = 11025
+	fingerprintWindow = 2048
+	fingerprintHop    = 512
+	// Peaks are picked between these frequencies in Hz
+	fingerprintLow  = 250.0
+	fingerprintHigh = 4000.0
+	// A peak is the loudest point within this many frames and bins around it
+	peakFrames = 10
+	peakBins   = 24
+	// spectrumFloor skips silence, in log10 magnitude
+	spectrumFloor = -4.0
+	// peakDensity is the number of peaks kept per second
+	peakDensity = 6
+	// Every peak is paired with up to pairFanout later peaks at most
+	// pairFrames frames and pairBins bins away
+	pairFanout = 4
+	pairFrames = 63
+	pairBins   = 255
+)
+
+// Fingerprint is the hashed spectral peaks of a file. Each hash pairs a
+// peak with a later one by their frequencies and distance, which survives
+// lossy encoding, gain changes and resampling.
+type Fingerprint struct {
+	// Duration is the decoded length in seconds
+	Duration float64
+	Hashes   []FingerprintHash
+}
+
+// FingerprintHash is one peak pair and the frame of its first peak
+type FingerprintHash struct {
+	Hash  uint32
+	Frame uint32
+}
+
+// FrameSeconds is the length of a fingerprint frame in seconds
+const FrameSeconds = float64(fingerprintHop) / fingerprintRate
+
+// spectralPeak is a peak of the spectrogram
+type spectralPeak struct {
+	frame, bin int
+	level      float32
+}
+
+// ComputeFingerprint decodes a file and hashes its spectral peaks. It
+// returns ctx.Err() when ctx is cancelled first.
+func ComputeFingerprint(ctx context.Context, path string) (Fingerprint, error) {
+	signal, _, err := decode(ctx, path, false)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	samples := resample(signal.samples, signal.rate, fingerprintRate)
+	return Fingerprint{
+		Duration: float64(len(samples)) / fingerprintRate,
+		Hashes:   hashPeaks(spectralPeaks(samples)),
+	}, nil
+}
+
+// resample converts a signal to another rate by linear interpolation
+func resample(samples []float32, from, to float64) []float32 {
+	if from == to || len(samples) == 0 {
+		return samples
+	}
+	step := from / to
+	out := make([]float32, int(float64(len(samples)-1)/step)+1)
+	for i := range out {
+		position := float64(i) * step
+		j := int(position)
+		fraction := float32(position - float64(j))
+		out[i] = samples[j]
+		if j+1 < len(samples) {
+			out[i] += fraction * (samples[j+1] - samples[j])
+		}
+	}
+	return out
+}
+
+// spectralPeaks finds the local maxima of the log spectrogram and keeps the
+// strongest peakDensity of them per second, in time order
+func spectralPeaks(samples []float32) []spectralPeak {
+	low := int(math.Round(fingerprintLow * fingerprintWindow / fingerprintRate))
+	high := int(math.Round(fingerprintHigh * fingerprintWindow / fingerprintRate))
+	bins := high - low
+	spec := newSpectrum(fingerprintWindow)
+	mags := make([]float64, fingerprintWindow/2)
+	var levels [][]float32
+	for start := 0; start+fingerprintWindow <= len(samples); start += fingerprintHop {
+		spec.magnitudes(samples[start:], mags)
+		frame := make([]float32, bins)
+		for b := range frame {
+			frame[b] = float32(math.Log10(mags[low+b] + 1e-10))
+		}
+		levels = append(levels, frame)
+	}
+
+	// The neighbourhood maximum is taken over frequency, then over time
+	across := make([][]float32, len(levels))
+	for t, frame := range levels {
+		across[t] = make([]float32, bins)
+		windowMax(frame, across[t], peakBins)
+	}
+	var peaks []spectralPeak
+	for t, frame := range levels {
+		for b, level := range frame {
+			if level <= spectrumFloor || level < across[t][b] {
+				continue
+			}
+			peak := true
+			for u := max(t-peakFrames, 0); u <= min(t+peakFrames, len(levels)-1) && peak; u++ {
+				peak = across[u][b] <= level
+			}
+			if peak {
+				peaks = append(peaks, spectralPeak{frame: t, bin: low + b, level: level})
+			}
+		}
+	}
+
+	// Keep the strongest peaks of every second
+	second := fingerprintRate / fingerprintHop
+	var kept []spectralPeak
+	for from := 0; from < len(peaks); {
+		to := from
+		for to < len(peaks) && peaks[to].frame/second == peaks[from].frame/second {
+			to++
+		}
+		block := peaks[from:to]
+		sort.SliceStable(block, func(i, j int) bool { return block[i].level > block[j].level })
+		kept = append(kept, block[:min(len(block), peakDensity)]...)
+		from = to
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		if kept[i].frame != kept[j].frame {
+			return kept[i].frame < kept[j].frame
+		}
+		return kept[i].bin < kept[j].bin
+	})
+	return kept
+}
+
+// windowMax sets out[i] to the maximum of in within radius of i
+func windowMax(in, out []float32, radius int) {
+	for i := range in {
+		best := in[i]
+		for _, value := range in[max(i-radius, 0):min(i+radius+1, len(in))] {
+			best = max(best, value)
+		}
+		out[i] = best
+	}
+}
+
+// hashPeaks pairs every peak with the next peaks in its target zone. A hash
+// holds the first peak's bin in 10 bits, the bin distance in 9 bits and the
+// frame distance in 6 bits.
+func hashPeaks(peaks []spectralPeak) []FingerprintHash {
+	var hashes []FingerprintHash
+	for i, anchor := range peaks {
+		paired := 0
+		for _, target := range peaks[i+1:] {
+			frames := target.frame - anchor.frame
+			if frames > pairFrames || paired == pairFanout {
+				break
+			}
+			bins := target.bin - anchor.bin
+			if frames == 0 || bins < -pairBins || bins > pairBins {
+				continue
+			}
+			hash := uint32(anchor.bin)<<15 | uint32(bins+pairBins)<<6 | uint32(frames)
+			hashes = append(hashes, FingerprintHash{Hash: hash, Frame: uint32(anchor.frame)})
+			paired++
+		}
+	}
+	return hashes
+}
+
+// hashTable indexes the hashes of a fingerprint by hash
+type hashTable map[uint32][]uint32
+
+// newHashTable indexes the hashes of a fingerprint
+func newHashTable(hashes []FingerprintHash) hashTable {
+	table := make(hashTable, len(hashes))
+	for _, h := range hashes {
+		table[h.Hash] = append(table[h.Hash], h.Frame)
+	}
+	return table
+}
+
+// align counts the hashes of other that match the table at a common time
+// offset, and returns the best count with its offset in frames from the
+// table's fingerprint to other. Neighbouring offsets count together, as
+// peaks can move by a frame between encodings.
+func (t hashTable) align(other []FingerprintHash) (int, int) {
+	offsets := make(map[int]int)
+	for _, h := range other {
+		for _, frame := range t[h.Hash] {
+			offsets[int(h.Frame)-int(frame)]++
+		}
+	}
+	best, bestOffset := 0, 0
+	for offset, count := range offsets {
+		count += offsets[offset-1] + offsets[offset+1]
+		if count > best || (count == best && abs(offset) < abs(bestOffset)) {
+			best, bestOffset = count, offset
+		}
+	}
+	return best, bestOffset
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
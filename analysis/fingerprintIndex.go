@@ -0,0 +1,437 @@
+package analysis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ilmarkerm/djlibgo/fileutil"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// indexVersion changes whenever the fingerprint does, which drops old indexes
+const indexVersion = 1
+
+// indexMagic starts every fingerprint index file
+var indexMagic = []byte("DJFI")
+
+// Matching thresholds. A match needs MinFingerprintMatches hashes at one
+// offset, and a duplicate shares DuplicateScore of the sampled hashes of the
+// shorter file.
+const (
+	MinFingerprintMatches = 20
+	DuplicateScore        = 0.2
+	// duplicateSample is the share of hashes used to find duplicate
+	// candidates, as 1 in duplicateSample
+	duplicateSample = 4
+	// commonHash is the number of files a hash can appear in before it is
+	// ignored for duplicates, as it says nothing about the audio
+	commonHash = 200
+)
+
+// FingerprintIndex keeps the fingerprints of many files, such as all
+// collection tracks. Files are fingerprinted again when their size or
+// modification time changes. The index is a binary file that is read on
+// opening and written by Save.
+type FingerprintIndex struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]indexEntry
+	dirty   bool
+}
+
+type indexEntry struct {
+	size        int64
+	modTime     int64
+	fingerprint Fingerprint
+}
+
+// FingerprintMatch is an indexed file that contains a query fingerprint
+type FingerprintMatch struct {
+	Path string
+	// Matches is the number of query hashes found at one offset, Score the
+	// share of the query hashes they are
+	Matches int
+	Score   float64
+	// Offset is where the query starts in the indexed file, in seconds
+	Offset float64
+}
+
+// FingerprintIndexPath returns the index file stored next to the
+// collection, collection.fingerprints for collection.nml
+func FingerprintIndexPath(collection *traktor.TraktorCollection) string {
+	path := collection.Path()
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".fingerprints"
+}
+
+// OpenFingerprintIndex reads an index file. A missing or outdated file
+// starts an empty index.
+func OpenFingerprintIndex(path string) (*FingerprintIndex, error) {
+	x := &FingerprintIndex{path: path, entries: make(map[string]indexEntry)}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return x, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := x.read(bufio.NewReader(file)); err != nil && !errors.Is(err, errOutdatedIndex) {
+		return nil, err
+	}
+	return x, nil
+}
+
+// errOutdatedIndex is returned for index files of another version
+var errOutdatedIndex = errors.New("outdated fingerprint index")
+
+// read loads the entries written by write
+func (x *FingerprintIndex) read(r io.Reader) error {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	if !bytes.Equal(header[:4], indexMagic) {
+		return errors.New("not a fingerprint index")
+	}
+	if binary.LittleEndian.Uint32(header[4:]) != indexVersion {
+		return errOutdatedIndex
+	}
+	count := binary.LittleEndian.Uint32(header[8:])
+	fixed := make([]byte, 4+8+8+8+4)
+	for i := uint32(0); i < count; i++ {
+		if _, err := io.ReadFull(r, fixed[:4]); err != nil {
+			return err
+		}
+		name := make([]byte, binary.LittleEndian.Uint32(fixed))
+		if _, err := io.ReadFull(r, name); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r, fixed[4:]); err != nil {
+			return err
+		}
+		entry := indexEntry{
+			size:    int64(binary.LittleEndian.Uint64(fixed[4:])),
+			modTime: int64(binary.LittleEndian.Uint64(fixed[12:])),
+		}
+		entry.fingerprint.Duration = math.Float64frombits(binary.LittleEndian.Uint64(fixed[20:]))
+		hashes := make([]byte, 8*int(binary.LittleEndian.Uint32(fixed[28:])))
+		if _, err := io.ReadFull(r, hashes); err != nil {
+			return err
+		}
+		entry.fingerprint.Hashes = make([]FingerprintHash, len(hashes)/8)
+		for j := range entry.fingerprint.Hashes {
+			entry.fingerprint.Hashes[j] = FingerprintHash{
+				Hash:  binary.LittleEndian.Uint32(hashes[j*8:]),
+				Frame: binary.LittleEndian.Uint32(hashes[j*8+4:]),
+			}
+		}
+		x.entries[string(name)] = entry
+	}
+	return nil
+}
+
+// write stores the magic, version and entry count, then every entry as
+// its path, size, modification time, duration and hashes
+func (x *FingerprintIndex) write(w io.Writer) error {
+	paths := make([]string, 0, len(x.entries))
+	for path := range x.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	header := append([]byte(nil), indexMagic...)
+	header = binary.LittleEndian.AppendUint32(header, indexVersion)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(paths)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	for _, path := range paths {
+		entry := x.entries[path]
+		data := binary.LittleEndian.AppendUint32(nil, uint32(len(path)))
+		data = append(data, path...)
+		data = binary.LittleEndian.AppendUint64(data, uint64(entry.size))
+		data = binary.LittleEndian.AppendUint64(data, uint64(entry.modTime))
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(entry.fingerprint.Duration))
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(entry.fingerprint.Hashes)))
+		for _, h := range entry.fingerprint.Hashes {
+			data = binary.LittleEndian.AppendUint32(data, h.Hash)
+			data = binary.LittleEndian.AppendUint32(data, h.Frame)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Len returns the number of indexed files
+func (x *FingerprintIndex) Len() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return len(x.entries)
+}
+
+// Update makes the index cover exactly the given files: new and changed
+// files are fingerprinted with a pool of workers, one per CPU when workers
+// is 0, and files not in paths are dropped. progress, when set, is called
+// after every fingerprinted file, one call at a time. The files that could
+// not be fingerprinted are returned, with ctx.Err() when cancelled.
+func (x *FingerprintIndex) Update(ctx context.Context, paths []string, workers int, progress func(done, total int)) (map[string]error, error) {
+	wanted := make(map[string]bool)
+	var stale []string
+	x.mu.Lock()
+	for _, path := range paths {
+		if wanted[path] {
+			continue
+		}
+		wanted[path] = true
+		entry, ok := x.entries[path]
+		info, err := os.Stat(path)
+		if !ok || err != nil || entry.size != info.Size() || entry.modTime != info.ModTime().UnixNano() {
+			stale = append(stale, path)
+		}
+	}
+	for path := range x.entries {
+		if !wanted[path] {
+			delete(x.entries, path)
+			x.dirty = true
+		}
+	}
+	x.mu.Unlock()
+
+	failed := make(map[string]error)
+	var mu sync.Mutex
+	finished := 0
+	runWorkers(ctx, stale, workers, func(path string) {
+		err := x.add(ctx, path)
+		if ctx.Err() != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failed[path] = err
+		}
+		finished++
+		if progress != nil {
+			progress(finished, len(stale))
+		}
+	})
+	return failed, ctx.Err()
+}
+
+// add fingerprints one file into the index
+func (x *FingerprintIndex) add(ctx context.Context, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := ComputeFingerprint(ctx, path)
+	if err != nil {
+		return err
+	}
+	x.mu.Lock()
+	x.entries[path] = indexEntry{size: info.Size(), modTime: info.ModTime().UnixNano(), fingerprint: fingerprint}
+	x.dirty = true
+	x.mu.Unlock()
+	return nil
+}
+
+// Save writes the index file when anything changed
+func (x *FingerprintIndex) Save() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.dirty {
+		return nil
+	}
+	if err := fileutil.WriteAtomic(x.path, x.write); err != nil {
+		return err
+	}
+	x.dirty = false
+	return nil
+}
+
+// Match returns the indexed files containing the query fingerprint, best
+// first. The query can be a whole file or an excerpt.
+func (x *FingerprintIndex) Match(query Fingerprint) []FingerprintMatch {
+	if len(query.Hashes) == 0 {
+		return nil
+	}
+	table := newHashTable(query.Hashes)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var matches []FingerprintMatch
+	for path, entry := range x.entries {
+		count, offset := table.align(entry.fingerprint.Hashes)
+		if count < MinFingerprintMatches {
+			continue
+		}
+		matches = append(matches, FingerprintMatch{
+			Path:    path,
+			Matches: count,
+			Score:   math.Min(float64(count)/float64(len(query.Hashes)), 1),
+			Offset:  float64(offset) * FrameSeconds,
+		})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Matches != matches[j].Matches {
+			return matches[i].Matches > matches[j].Matches
+		}
+		return matches[i].Path < matches[j].Path
+	})
+	return matches
+}
+
+// Duplicates returns groups of indexed files with the same audio, such as
+// copies in other formats or bitrates. Candidates are found through a
+// sample of the hashes and confirmed when the sampled hashes of the shorter
+// file line up with the other one.
+func (x *FingerprintIndex) Duplicates() [][]string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	paths := make([]string, 0, len(x.entries))
+	for path := range x.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	type posting struct {
+		file  int
+		frame uint32
+	}
+	samples := make([][]FingerprintHash, len(paths))
+	postings := make(map[uint32][]posting)
+	for i, path := range paths {
+		for _, h := range x.entries[path].fingerprint.Hashes {
+			// Sample by a mix of all hash bits, the low bits alone are the frame distance
+			if ((h.Hash*2654435761)>>24)%duplicateSample == 0 {
+				samples[i] = append(samples[i], h)
+				postings[h.Hash] = append(postings[h.Hash], posting{file: i, frame: h.Frame})
+			}
+		}
+	}
+
+	parent := make([]int, len(paths))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if parent[i] != i {
+			parent[i] = root(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range paths {
+		offsets := make(map[int]map[int]int)
+		for _, h := range samples[i] {
+			list := postings[h.Hash]
+			if len(list) > commonHash {
+				continue
+			}
+			for _, p := range list {
+				if p.file <= i {
+					continue
+				}
+				if offsets[p.file] == nil {
+					offsets[p.file] = make(map[int]int)
+				}
+				offsets[p.file][int(p.frame)-int(h.Frame)]++
+			}
+		}
+		for j, counts := range offsets {
+			best := 0
+			for offset, count := range counts {
+				best = max(best, count+counts[offset-1]+counts[offset+1])
+			}
+			shorter := min(len(samples[i]), len(samples[j]))
+			if shorter > 0 && float64(best)/float64(shorter) >= DuplicateScore {
+				parent[root(j)] = root(i)
+			}
+		}
+	}
+
+	groups := make(map[int][]string)
+	for i, path := range paths {
+		groups[root(i)] = append(groups[root(i)], path)
+	}
+	var result [][]string
+	for _, group := range groups {
+		if len(group) > 1 {
+			result = append(result, group)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i][0] < result[j][0] })
+	return result
+}
+
+// TrackMatch is a collection track matching a query file
+type TrackMatch struct {
+	Track *traktor.Track
+	FingerprintMatch
+}
+
+// CollectionPaths returns the file paths of collection tracks
+func CollectionPaths(collection *traktor.TraktorCollection) []string {
+	paths := make([]string, 0, len(collection.Tracks))
+	for _, track := range collection.Tracks {
+		if track.FilePath != "" {
+			paths = append(paths, track.FilePath)
+		}
+	}
+	return paths
+}
+
+// tracksByPath indexes the collection tracks by file path
+func tracksByPath(collection *traktor.TraktorCollection) map[string]*traktor.Track {
+	tracks := make(map[string]*traktor.Track)
+	for i := range collection.Tracks {
+		tracks[collection.Tracks[i].FilePath] = &collection.Tracks[i]
+	}
+	return tracks
+}
+
+// FindMatchingTracks fingerprints a file and returns the collection tracks
+// with the same audio, best first. The index should be updated with the
+// collection paths first.
+func FindMatchingTracks(ctx context.Context, collection *traktor.TraktorCollection, index *FingerprintIndex, path string) ([]TrackMatch, error) {
+	query, err := ComputeFingerprint(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	tracks := tracksByPath(collection)
+	var matches []TrackMatch
+	for _, match := range index.Match(query) {
+		if track := tracks[match.Path]; track != nil {
+			matches = append(matches, TrackMatch{Track: track, FingerprintMatch: match})
+		}
+	}
+	return matches, nil
+}
+
+// FindDuplicateTracks returns groups of collection tracks with the same audio
+func FindDuplicateTracks(collection *traktor.TraktorCollection, index *FingerprintIndex) [][]*traktor.Track {
+	tracks := tracksByPath(collection)
+	var result [][]*traktor.Track
+	for _, group := range index.Duplicates() {
+		var found []*traktor.Track
+		for _, path := range group {
+			if track := tracks[path]; track != nil {
+				found = append(found, track)
+			}
+		}
+		if len(found) > 1 {
+			result = append(result, found)
+		}
+	}
+	return result
+}
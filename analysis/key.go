@@ -0,0 +1,138 @@
+package analysis
+
+import (
+	"math"
+)
+
+// Chroma analysis frames. At analysisRate a window is about 0.75 s, which
+// separates semitones down to the bass range.
+const (
+	chromaWindow = 8192
+	chromaHop    = 4096
+)
+
+// Pitches taken into the chroma vector, A1 to A6
+const (
+	chromaLowHz  = 55
+	chromaHighHz = 1760
+)
+
+// Krumhansl-Kessler key profiles, from the tonic upwards
+var (
+	majorProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+	minorProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+// keyMargin is the correlation lead over the second best key that counts as
+// a clear result
+const keyMargin = 0.1
+
+// Key is a detected key
+type Key struct {
+	// Value is the key as a Traktor MUSICAL_KEY value, -1 when unknown
+	Value int
+	// Confidence is 0..1: the correlation with the key profile, reduced when
+	// another key fits almost as well
+	Confidence float64
+}
+
+// DetectKey estimates the key of a mono signal. The spectrum of every frame
+// is folded into the 12 pitch classes, the frames are summed, and the sum is
+// correlated with the major and minor key profiles in all 12 transpositions.
+func DetectKey(samples []float32, rate float64) Key {
+	chroma, ok := chromaVector(samples, rate)
+	if !ok {
+		return Key{Value: -1}
+	}
+	var scores [24]float64
+	for tonic := 0; tonic < 12; tonic++ {
+		scores[tonic] = correlate(chroma, majorProfile, tonic)
+		scores[12+tonic] = correlate(chroma, minorProfile, tonic)
+	}
+	best, second := 0, -1
+	for value, score := range scores {
+		if score > scores[best] {
+			best = value
+		}
+	}
+	for value, score := range scores {
+		if value != best && (second < 0 || score > scores[second]) {
+			second = value
+		}
+	}
+	if scores[best] <= 0 {
+		return Key{Value: -1}
+	}
+	return Key{
+		Value:      best,
+		Confidence: math.Min(scores[best], 1) * math.Min((scores[best]-scores[second])/keyMargin, 1),
+	}
+}
+
+// chromaVector returns the energy of each pitch class over the whole signal.
+// Every frame is normalised first, so loud passages do not dominate.
+func chromaVector(samples []float32, rate float64) ([12]float64, bool) {
+	var chroma [12]float64
+	frames := (len(samples)-chromaWindow)/chromaHop + 1
+	if frames < 1 {
+		return chroma, false
+	}
+	// The pitch class of every bin in the analysed range, -1 outside it
+	classes := make([]int, chromaWindow/2)
+	for k := range classes {
+		classes[k] = -1
+		hz := float64(k) * rate / chromaWindow
+		if hz >= chromaLowHz && hz <= chromaHighHz {
+			// MIDI note numbers put A at 9 modulo 12
+			note := int(math.Round(12*math.Log2(hz/440))) + 69
+			classes[k] = note % 12
+		}
+	}
+
+	spec := newSpectrum(chromaWindow)
+	mags := make([]float64, chromaWindow/2)
+	used := 0
+	for f := 0; f < frames; f++ {
+		spec.magnitudes(samples[f*chromaHop:], mags)
+		var frame [12]float64
+		var peak float64
+		for k, class := range classes {
+			if class < 0 {
+				continue
+			}
+			frame[class] += mags[k]
+			peak = math.Max(peak, frame[class])
+		}
+		// Skip silence, about -80 dB
+		if peak < 1e-4 {
+			continue
+		}
+		for class := range frame {
+			chroma[class] += frame[class] / peak
+		}
+		used++
+	}
+	return chroma, used > 0
+}
+
+// correlate returns the Pearson correlation of a chroma vector with a key
+// profile transposed to the tonic
+func correlate(chroma, profile [12]float64, tonic int) float64 {
+	var meanChroma, meanProfile float64
+	for i := 0; i < 12; i++ {
+		meanChroma += chroma[i] / 12
+		meanProfile += profile[i] / 12
+	}
+	var sum, chromaSquares, profileSquares float64
+	for i := 0; i < 12; i++ {
+		c := chroma[(tonic+i)%12] - meanChroma
+		p := profile[i] - meanProfile
+		sum += c * p
+		chromaSquares += c * c
+		profileSquares += p * p
+	}
+	if chromaSquares == 0 {
+		return 0
+	}
+	return sum / math.Sqrt(chromaSquares*profileSquares)
+}
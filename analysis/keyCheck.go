@@ -0,0 +1,141 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/tags"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// KeyVerdict says how a library key relates to the detected key
+type KeyVerdict int
+
+const (
+	// KeyUnknown means the library has no key or none was detected
+	KeyUnknown KeyVerdict = iota
+	KeyMatch
+	// KeyRelative means the library has the relative major or minor key,
+	// the same Open Key number
+	KeyRelative
+	// KeyNeighbour means the library key is a fifth away, the next number
+	// on the Open Key wheel
+	KeyNeighbour
+	KeyMismatch
+)
+
+// String returns the verdict as shown in reports
+func (v KeyVerdict) String() string {
+	switch v {
+	case KeyMatch:
+		return "match"
+	case KeyRelative:
+		return "relative"
+	case KeyNeighbour:
+		return "neighbour"
+	case KeyMismatch:
+		return "mismatch"
+	}
+	return "unknown"
+}
+
+// CompareKey compares a library key with a detected one, both MUSICAL_KEY values
+func CompareKey(library, detected int) KeyVerdict {
+	libraryNumber, libraryMinor := traktor.OpenKey(library)
+	detectedNumber, detectedMinor := traktor.OpenKey(detected)
+	switch {
+	case libraryNumber == 0 || detectedNumber == 0:
+		return KeyUnknown
+	case library == detected:
+		return KeyMatch
+	case libraryNumber == detectedNumber:
+		return KeyRelative
+	case libraryMinor == detectedMinor && (libraryNumber%12+1 == detectedNumber || detectedNumber%12+1 == libraryNumber):
+		return KeyNeighbour
+	}
+	return KeyMismatch
+}
+
+// KeyCheck is the detected key of a collection track
+type KeyCheck struct {
+	Track    *traktor.Track
+	Detected Key
+	// Library is the key Traktor uses, from MUSICAL_KEY or else the key text
+	Library int
+	// Text is the key parsed from the INFO KEY text, -1 when there is none
+	Text    int
+	Verdict KeyVerdict
+	// Err is set when the file could not be analysed
+	Err error
+}
+
+// CheckKey compares the key of a track in the collection with the analysis
+// of its file
+func CheckKey(track *traktor.Track, result Result, err error) KeyCheck {
+	check := KeyCheck{Track: track, Detected: Key{Value: -1}, Library: -1, Err: err}
+	if value, ok := traktor.TrackKeyValue(track); ok {
+		check.Library = value
+	}
+	check.Text, _ = traktor.ParseKey(track.Key)
+	if err == nil {
+		check.Detected = result.Key
+		check.Verdict = CompareKey(check.Library, result.Key.Value)
+	}
+	return check
+}
+
+// TextDiffers tells whether the key text names another key than MUSICAL_KEY
+func (c KeyCheck) TextDiffers() bool {
+	return c.Text >= 0 && c.Text != c.Library
+}
+
+// Disagrees tells whether the check should be looked at: the keys differ,
+// the key text contradicts MUSICAL_KEY, or the collection has no key that
+// the analysis could fill
+func (c KeyCheck) Disagrees() bool {
+	return c.Err != nil || c.Verdict != KeyMatch || c.TextDiffers()
+}
+
+// Acceptable tells whether the detected key can replace the library key
+func (c KeyCheck) Acceptable() bool {
+	return c.Err == nil && c.Detected.Value >= 0 && c.Disagrees()
+}
+
+// KeyReport formats checks as a table with keys in the given notation.
+// Matching tracks are left out unless all is set.
+func KeyReport(checks []KeyCheck, all bool, notation traktor.KeyNotation) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-50s %7s %7s %8s %10s  %s\n", "Track", "Traktor", "Text", "Detected", "Confidence", "Verdict")
+	for _, check := range checks {
+		if !all && !check.Disagrees() {
+			continue
+		}
+		library := traktor.KeyValueToNotation(check.Library, notation)
+		text := strings.TrimSpace(check.Track.Key)
+		if check.Err != nil {
+			fmt.Fprintf(&b, "%-50s %7s %7s %8s %10s  %v\n", reportName(check.Track), library, text, "", "", check.Err)
+			continue
+		}
+		verdict := check.Verdict.String()
+		if check.TextDiffers() {
+			verdict += ", text differs"
+		}
+		fmt.Fprintf(&b, "%-50s %7s %7s %8s %9.0f%%  %s\n", reportName(check.Track), library, text,
+			traktor.KeyValueToNotation(check.Detected.Value, notation), check.Detected.Confidence*100, verdict)
+	}
+	return b.String()
+}
+
+// AcceptKey stores a detected key in the collection entry of a track, as
+// MUSICAL_KEY and as key text in the given notation. The collection still
+// has to be saved.
+func AcceptKey(collection *traktor.TraktorCollection, track *traktor.Track, key int, notation traktor.KeyNotation) error {
+	track.MusicalKey = key
+	track.Key = traktor.KeyValueToNotation(key, notation)
+	return collection.UpdateTrack(track)
+}
+
+// WriteKeyTag writes a key into the tag of an audio file in the given notation
+func WriteKeyTag(path string, key int, notation traktor.KeyNotation) error {
+	return tags.WriteFields(path, tags.FieldValues{tags.FieldKey: traktor.KeyValueToNotation(key, notation)})
+}
@@ -0,0 +1,318 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+)
+
+// Loudness gates and levels from ITU-R BS.1770 and EBU Tech 3342
+const (
+	absoluteGate = -70.0
+	// relativeGate is below the ungated loudness, for integrated loudness
+	relativeGate = -10.0
+	// rangeGate is the relative gate of the loudness range
+	rangeGate = -20.0
+	// silence is reported for files without a block above the absolute gate
+	silence = -70.0
+	// peakFloor is the lowest peak reported, the level of digital silence
+	peakFloor = -120.0
+)
+
+// Loudness histogram steps, used to gate several tracks together
+const (
+	histogramStep = 0.25
+	histogramTop  = 5.0
+)
+
+// Loudness is the loudness of a file per ITU-R BS.1770
+type Loudness struct {
+	// Integrated is the gated loudness of the whole file in LUFS
+	Integrated float64
+	// Range is the loudness range in LU, per EBU Tech 3342
+	Range float64
+	// TruePeak is the peak of the 4x oversampled signal in dBTP
+	TruePeak float64
+	// Blocks counts the 400 ms gating blocks per quarter LU from the absolute
+	// gate upwards, so an album can be gated as one
+	Blocks []int `json:",omitempty"`
+}
+
+// GainTo returns the gain in dB that brings the file to a target loudness
+func (l Loudness) GainTo(target float64) float64 {
+	return target - l.Integrated
+}
+
+// AlbumLoudness returns the integrated loudness of tracks played as one
+// program, gated together as BS.1770 does for a single file
+func AlbumLoudness(tracks []Loudness) float64 {
+	var blocks []int
+	for _, track := range tracks {
+		for len(blocks) < len(track.Blocks) {
+			blocks = append(blocks, 0)
+		}
+		for i, count := range track.Blocks {
+			blocks[i] += count
+		}
+	}
+	// Every block counts at the centre of its histogram step
+	level := func(i int) float64 {
+		return absoluteGate + (float64(i)+0.5)*histogramStep
+	}
+	var energy float64
+	count := 0
+	for i, n := range blocks {
+		energy += float64(n) * loudnessEnergy(level(i))
+		count += n
+	}
+	if count == 0 {
+		return silence
+	}
+	gate := energyLoudness(energy/float64(count)) + relativeGate
+	energy, count = 0, 0
+	for i, n := range blocks {
+		if level(i) > gate {
+			energy += float64(n) * loudnessEnergy(level(i))
+			count += n
+		}
+	}
+	if count == 0 {
+		return silence
+	}
+	return energyLoudness(energy / float64(count))
+}
+
+// energyLoudness converts a mean square to LUFS
+func energyLoudness(energy float64) float64 {
+	if energy <= 0 {
+		return math.Inf(-1)
+	}
+	return -0.691 + 10*math.Log10(energy)
+}
+
+// loudnessEnergy converts LUFS to a mean square
+func loudnessEnergy(loudness float64) float64 {
+	return math.Pow(10, (loudness+0.691)/10)
+}
+
+// biquad is a second order IIR filter in direct form I
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kWeighting returns the high shelf and high pass of the BS.1770 K
+// weighting for a sample rate. The parameters reproduce the coefficients
+// the standard gives for 48 kHz.
+func kWeighting(rate float64) (biquad, biquad) {
+	k := math.Tan(math.Pi * 1681.974450955533 / rate)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	k = math.Tan(math.Pi * 38.13547087602444 / rate)
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1, b1: -2, b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return shelf, highPass
+}
+
+// True peak oversampling filter: taps per phase of the polyphase interpolator
+const peakTaps = 12
+
+// loudnessMeter measures loudness while a file is decoded. The K weighted
+// energy is summed in 100 ms steps; gating blocks of 400 ms and short term
+// windows of 3 s are made of consecutive steps.
+type loudnessMeter struct {
+	channels int
+	weights  []float64
+	shelf    []biquad
+	highPass []biquad
+	// step is the number of frames in 100 ms
+	step   int
+	frames int
+	sum    float64
+	steps  []float64
+	// oversample is the true peak factor, phases its interpolation filters
+	oversample int
+	phases     [][]float64
+	history    [][]float64
+	peak       float64
+}
+
+// newLoudnessMeter prepares a meter for interleaved samples
+func newLoudnessMeter(rate, channels int) *loudnessMeter {
+	m := &loudnessMeter{
+		channels: channels,
+		weights:  make([]float64, channels),
+		shelf:    make([]biquad, channels),
+		highPass: make([]biquad, channels),
+		step:     max(rate/10, 1),
+		history:  make([][]float64, channels),
+	}
+	for c := range m.weights {
+		m.weights[c] = 1
+		m.shelf[c], m.highPass[c] = kWeighting(float64(rate))
+		m.history[c] = make([]float64, peakTaps)
+	}
+	// 5.1 layouts: no LFE, surrounds weighted +1.5 dB
+	if channels == 6 {
+		m.weights[3] = 0
+		m.weights[4], m.weights[5] = 1.41, 1.41
+	}
+
+	// Oversample up to about 192 kHz
+	m.oversample = max(1, min(4, 192000/max(rate, 1)))
+	m.phases = make([][]float64, m.oversample)
+	length := peakTaps * m.oversample
+	centre := float64(length-1) / 2
+	for p := range m.phases {
+		m.phases[p] = make([]float64, peakTaps)
+		var sum float64
+		for k := range m.phases[p] {
+			// Tap k of phase p is tap k*oversample+p of a windowed sinc low
+			// pass at the original Nyquist frequency
+			n := float64(k*m.oversample + p)
+			x := (n - centre) / float64(m.oversample)
+			tap := 1.0
+			if x != 0 {
+				tap = math.Sin(math.Pi*x) / (math.Pi * x)
+			}
+			window := 0.42 - 0.5*math.Cos(2*math.Pi*(n+0.5)/float64(length)) + 0.08*math.Cos(4*math.Pi*(n+0.5)/float64(length))
+			m.phases[p][k] = tap * window
+			sum += m.phases[p][k]
+		}
+		for k := range m.phases[p] {
+			m.phases[p][k] /= sum
+		}
+	}
+	return m
+}
+
+// add measures interleaved samples
+func (m *loudnessMeter) add(samples []float32) {
+	for i := 0; i+m.channels <= len(samples); i += m.channels {
+		for c := 0; c < m.channels; c++ {
+			x := float64(samples[i+c])
+			y := m.highPass[c].process(m.shelf[c].process(x))
+			m.sum += m.weights[c] * y * y
+			m.truePeak(c, x)
+		}
+		m.frames++
+		if m.frames == m.step {
+			m.steps = append(m.steps, m.sum/float64(m.step))
+			m.frames, m.sum = 0, 0
+		}
+	}
+}
+
+// truePeak runs one sample of a channel through the interpolator
+func (m *loudnessMeter) truePeak(channel int, x float64) {
+	history := m.history[channel]
+	copy(history[1:], history[:peakTaps-1])
+	history[0] = x
+	m.peak = math.Max(m.peak, math.Abs(x))
+	if m.oversample == 1 {
+		return
+	}
+	for _, phase := range m.phases {
+		var y float64
+		for k, tap := range phase {
+			y += tap * history[k]
+		}
+		m.peak = math.Max(m.peak, math.Abs(y))
+	}
+}
+
+// result computes the loudness of everything added so far
+func (m *loudnessMeter) result() Loudness {
+	result := Loudness{Integrated: silence, TruePeak: peakFloor}
+	if m.peak > 0 {
+		result.TruePeak = math.Max(20*math.Log10(m.peak), peakFloor)
+	}
+
+	// Gating blocks of four steps overlap by 75%
+	blocks := windowLoudness(m.steps, 4)
+	bins := int((histogramTop - absoluteGate) / histogramStep)
+	for _, block := range blocks {
+		if block > absoluteGate {
+			i := min(int((block-absoluteGate)/histogramStep), bins-1)
+			for len(result.Blocks) <= i {
+				result.Blocks = append(result.Blocks, 0)
+			}
+			result.Blocks[i]++
+		}
+	}
+	if ungated, ok := meanAbove(blocks, absoluteGate); ok {
+		result.Integrated, _ = meanAbove(blocks, math.Max(ungated+relativeGate, absoluteGate))
+	}
+
+	// Short term windows of 3 s, the loudness range is the spread between
+	// their 10th and 95th percentile after gating
+	shortTerm := windowLoudness(m.steps, 30)
+	if ungated, ok := meanAbove(shortTerm, absoluteGate); ok {
+		gate := math.Max(ungated+rangeGate, absoluteGate)
+		var gated []float64
+		for _, level := range shortTerm {
+			if level > gate {
+				gated = append(gated, level)
+			}
+		}
+		sort.Float64s(gated)
+		if len(gated) > 1 {
+			low := gated[int(math.Round(0.10*float64(len(gated)-1)))]
+			high := gated[int(math.Round(0.95*float64(len(gated)-1)))]
+			result.Range = high - low
+		}
+	}
+	return result
+}
+
+// windowLoudness returns the loudness of every window of n consecutive steps
+func windowLoudness(steps []float64, n int) []float64 {
+	var levels []float64
+	var sum float64
+	for i, energy := range steps {
+		sum += energy
+		if i >= n {
+			sum -= steps[i-n]
+		}
+		if i >= n-1 {
+			levels = append(levels, energyLoudness(sum/float64(n)))
+		}
+	}
+	return levels
+}
+
+// meanAbove returns the loudness of the mean energy of the levels above a gate
+func meanAbove(levels []float64, gate float64) (float64, bool) {
+	var energy float64
+	count := 0
+	for _, level := range levels {
+		if level > gate {
+			energy += loudnessEnergy(level)
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return energyLoudness(energy / float64(count)), true
+}
@@ -0,0 +1,68 @@
+package analysis
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// Run analyses files with a pool of workers, one per CPU when workers is 0.
+// Results come from the cache where possible and new ones are added to it.
+// done is called from the workers for every file in completion order, one
+// call at a time, but not for files skipped after ctx is cancelled. Run
+// returns once the workers have stopped, with ctx.Err() when cancelled or
+// the error saving the cache.
+func Run(ctx context.Context, paths []string, workers int, cache *Cache, done func(path string, result Result, err error)) error {
+	var mu sync.Mutex
+	runWorkers(ctx, paths, workers, func(path string) {
+		var result Result
+		var err error
+		if cache != nil {
+			result, err = cache.Analyze(ctx, path)
+		} else {
+			result, err = Analyze(ctx, path)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		mu.Lock()
+		done(path, result, err)
+		mu.Unlock()
+	})
+
+	if cache != nil {
+		if err := cache.Save(); err != nil && ctx.Err() == nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// runWorkers calls work for every path from a pool of workers, one per CPU
+// when workers is 0, until ctx is cancelled. It returns once all calls are done.
+func runWorkers(ctx context.Context, paths []string, workers int, work func(path string)) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(paths)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				work(path)
+			}
+		}()
+	}
+feed:
+	for _, path := range paths {
+		select {
+		case jobs <- path:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,99 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/tags"
+)
+
+// ReplayGainReference is the ReplayGain 2.0 reference loudness in LUFS
+const ReplayGainReference = -18.0
+
+// QuietGain is the gain in dB from which reports flag a track as quiet
+const QuietGain = 3.0
+
+// LoudnessEntry is the loudness of one file in a report
+type LoudnessEntry struct {
+	Name     string
+	Path     string
+	Loudness Loudness
+	// Err is set when the file could not be analysed
+	Err error
+}
+
+// WriteReplayGain writes ReplayGain track tags to every file and album tags
+// for all of them played as one album, such as a playlist. Files that could
+// not be analysed are skipped. The returned map holds the files that could
+// not be written.
+func WriteReplayGain(entries []LoudnessEntry) map[string]error {
+	var measured []Loudness
+	albumPeak := peakFloor
+	for _, entry := range entries {
+		if entry.Err == nil {
+			measured = append(measured, entry.Loudness)
+			albumPeak = math.Max(albumPeak, entry.Loudness.TruePeak)
+		}
+	}
+	albumGain := ReplayGainReference - AlbumLoudness(measured)
+
+	failed := make(map[string]error)
+	for _, entry := range entries {
+		if entry.Err != nil {
+			continue
+		}
+		values := tags.FieldValues{
+			tags.FieldTrackGain: formatGain(entry.Loudness.GainTo(ReplayGainReference)),
+			tags.FieldTrackPeak: formatPeak(entry.Loudness.TruePeak),
+			tags.FieldAlbumGain: formatGain(albumGain),
+			tags.FieldAlbumPeak: formatPeak(albumPeak),
+		}
+		if err := tags.WriteFields(entry.Path, values); err != nil {
+			failed[entry.Path] = err
+		}
+	}
+	return failed
+}
+
+// formatGain writes a gain the way ReplayGain tags expect it
+func formatGain(gain float64) string {
+	return fmt.Sprintf("%.2f dB", gain)
+}
+
+// formatPeak writes a peak in dB as a linear ReplayGain peak
+func formatPeak(peak float64) string {
+	return fmt.Sprintf("%.6f", math.Pow(10, peak/20))
+}
+
+// LoudnessReport formats the loudness of files as a table with the gain
+// each needs to reach the target loudness. Tracks that would peak above
+// 0 dBTP after the gain, and quiet tracks, are flagged.
+func LoudnessReport(entries []LoudnessEntry, target float64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-50s %7s %6s %9s %8s  %s\n", "Track", "LUFS", "LRA", "True peak", "Gain", "Note")
+	for _, entry := range entries {
+		name := shorten(entry.Name, 50)
+		if entry.Err != nil {
+			fmt.Fprintf(&b, "%-50s %7s %6s %9s %8s  %v\n", name, "", "", "", "", entry.Err)
+			continue
+		}
+		fmt.Fprintf(&b, "%-50s %7.1f %6.1f %9.1f %+8.1f  %s\n", name, entry.Loudness.Integrated, entry.Loudness.Range,
+			entry.Loudness.TruePeak, entry.Loudness.GainTo(target), LoudnessNote(entry.Loudness, target))
+	}
+	return b.String()
+}
+
+// LoudnessNote flags a track that is quiet at the target loudness, or that
+// would peak above 0 dBTP after the gain
+func LoudnessNote(loudness Loudness, target float64) string {
+	gain := loudness.GainTo(target)
+	var notes []string
+	if gain >= QuietGain {
+		notes = append(notes, "quiet")
+	}
+	if over := loudness.TruePeak + gain; over > 0 {
+		notes = append(notes, fmt.Sprintf("peaks %.1f dB over", over))
+	}
+	return strings.Join(notes, ", ")
+}
@@ -0,0 +1,267 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/ilmarkerm/djlibgo/audio"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// DefaultSilenceThreshold is the level in dBFS below which audio counts as
+// silence
+const DefaultSilenceThreshold = -60.0
+
+// MinSilence is the shortest leading or trailing silence in seconds that
+// gets a cue proposed
+const MinSilence = 0.1
+
+// silenceWindow is the length of the windows whose level is compared to the
+// threshold, in seconds. Single clicks in the silence do not end it.
+const silenceWindow = 0.01
+
+// Silence is where the audio of a file starts and ends
+type Silence struct {
+	// Start and End are the first and last audible moments in seconds.
+	// Both are 0 for files that are silent throughout.
+	Start, End float64
+	Duration   float64
+}
+
+// Silent reports whether nothing in the file is above the threshold
+func (s Silence) Silent() bool {
+	return s.End <= s.Start
+}
+
+// Leading returns the length of the silence before the audio in seconds
+func (s Silence) Leading() float64 {
+	return s.Start
+}
+
+// Trailing returns the length of the silence after the audio in seconds
+func (s Silence) Trailing() float64 {
+	if s.Silent() {
+		return s.Duration
+	}
+	return s.Duration - s.End
+}
+
+// DetectSilence decodes a file and finds the leading and trailing silence:
+// everything before the first and after the last 10 ms window whose level
+// reaches the threshold in dBFS. It returns ctx.Err() when ctx is cancelled
+// first.
+func DetectSilence(ctx context.Context, path string, threshold float64) (Silence, error) {
+	dec, err := audio.Open(path)
+	if err != nil {
+		return Silence{}, err
+	}
+	defer dec.Close()
+
+	format := dec.Format()
+	channels := format.Channels
+	rate := float64(format.SampleRate)
+	window := max(int(rate*silenceWindow), 1)
+	// The mean square of a full scale sine is 1/2, so 0 dBFS is a sine at full scale
+	limit := math.Pow(10, threshold/10) / 2
+	first, last := int64(-1), int64(-1)
+	var frame, windowStart int64
+	var sum float64
+	count := 0
+	buf := make([]float32, 4096*channels)
+	for block := 0; ; block++ {
+		if block%64 == 0 {
+			if err := ctx.Err(); err != nil {
+				return Silence{}, err
+			}
+		}
+		n, err := dec.Read(buf)
+		for i := 0; i < n; i++ {
+			for _, sample := range buf[i*channels : (i+1)*channels] {
+				sum += float64(sample) * float64(sample)
+			}
+			count++
+			frame++
+			if count == window {
+				if sum/float64(window*channels) >= limit {
+					if first < 0 {
+						first = windowStart
+					}
+					last = frame
+				}
+				windowStart, sum, count = frame, 0, 0
+			}
+		}
+		if err == io.EOF {
+			if count > 0 && sum/float64(count*channels) >= limit {
+				if first < 0 {
+					first = windowStart
+				}
+				last = frame
+			}
+			silence := Silence{Duration: float64(frame) / rate}
+			if first >= 0 {
+				silence.Start = float64(first) / rate
+				silence.End = float64(last) / rate
+			}
+			return silence, nil
+		}
+		if err != nil {
+			return Silence{}, err
+		}
+	}
+}
+
+// SilenceCues proposes a Load and a Fade In cue where the audio starts and
+// a Fade Out cue where it ends, for silences of at least MinSilence. Cue
+// types the track already has are left out, so cues set by the user are
+// never replaced.
+func SilenceCues(track *traktor.Track, silence Silence) []traktor.CuePoint {
+	if silence.Silent() {
+		return nil
+	}
+	taken := make(map[int]bool)
+	for _, cue := range track.CuePoints {
+		taken[cue.Type] = true
+	}
+	var cues []traktor.CuePoint
+	propose := func(cueType int, seconds float64) {
+		if taken[cueType] {
+			return
+		}
+		cues = append(cues, traktor.CuePoint{
+			Name:    traktor.CuePointTypeToString(cueType),
+			Type:    cueType,
+			Start:   math.Round(seconds * 1000),
+			Repeats: -1,
+			HotCue:  -1,
+		})
+	}
+	if silence.Leading() >= MinSilence {
+		propose(traktor.CueTypeLoad, silence.Start)
+		propose(traktor.CueTypeFadeIn, silence.Start)
+	}
+	if silence.Trailing() >= MinSilence {
+		propose(traktor.CueTypeFadeOut, silence.End)
+	}
+	return cues
+}
+
+// SilenceCheck is the silence detection of one collection track with the
+// cues it proposes
+type SilenceCheck struct {
+	Track   *traktor.Track
+	Silence Silence
+	Cues    []traktor.CuePoint
+	// Err is set when the file could not be analysed
+	Err error
+}
+
+// CheckSilence detects the silence of tracks with a pool of workers, one per
+// CPU when workers is 0. progress, when set, is called after every track,
+// one call at a time. The checks are returned in track order, without the
+// tracks skipped after ctx is cancelled, together with ctx.Err().
+func CheckSilence(ctx context.Context, tracks []*traktor.Track, threshold float64, workers int, progress func(done, total int)) ([]SilenceCheck, error) {
+	byPath := make(map[string][]int)
+	var paths []string
+	for i, track := range tracks {
+		if len(byPath[track.FilePath]) == 0 {
+			paths = append(paths, track.FilePath)
+		}
+		byPath[track.FilePath] = append(byPath[track.FilePath], i)
+	}
+	checks := make([]SilenceCheck, len(tracks))
+	var mu sync.Mutex
+	finished := 0
+	runWorkers(ctx, paths, workers, func(path string) {
+		silence, err := DetectSilence(ctx, path, threshold)
+		if ctx.Err() != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, i := range byPath[path] {
+			checks[i] = SilenceCheck{Track: tracks[i], Silence: silence, Err: err}
+			if err == nil {
+				checks[i].Cues = SilenceCues(tracks[i], silence)
+			}
+		}
+		finished++
+		if progress != nil {
+			progress(finished, len(paths))
+		}
+	})
+
+	var done []SilenceCheck
+	for _, check := range checks {
+		if check.Track != nil {
+			done = append(done, check)
+		}
+	}
+	return done, ctx.Err()
+}
+
+// SilenceReport formats the silence of tracks and the proposed cues as a
+// table. Tracks without proposals are only listed with all set.
+func SilenceReport(checks []SilenceCheck, all bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-50s %8s %8s  %s\n", "Track", "Leading", "Trailing", "Proposed cues")
+	for _, check := range checks {
+		if check.Err == nil && len(check.Cues) == 0 && !all {
+			continue
+		}
+		fmt.Fprintf(&b, "%-50s %s\n", reportName(check.Track), SilenceLine(check))
+	}
+	return b.String()
+}
+
+// SilenceLine describes the silence and proposed cues of a track
+func SilenceLine(check SilenceCheck) string {
+	if check.Err != nil {
+		return fmt.Sprintf("%8s %8s  %v", "", "", check.Err)
+	}
+	if check.Silence.Silent() {
+		return fmt.Sprintf("%8s %8s  silent", "", "")
+	}
+	var cues []string
+	for _, cue := range check.Cues {
+		cues = append(cues, fmt.Sprintf("%s at %s", traktor.CuePointTypeToString(cue.Type), formatCueTime(cue.Start)))
+	}
+	text := strings.Join(cues, ", ")
+	if text == "" {
+		text = "none"
+	}
+	return fmt.Sprintf("%7.2fs %7.2fs  %s", check.Silence.Leading(), check.Silence.Trailing(), text)
+}
+
+// formatCueTime formats a cue position in ms as minutes, seconds and
+// hundredths, as silences are often shorter than a second
+func formatCueTime(ms float64) string {
+	seconds := ms / 1000
+	return fmt.Sprintf("%d:%05.2f", int(seconds)/60, math.Mod(seconds, 60))
+}
+
+// ApplySilenceCues adds the proposed cues of the checks to the collection.
+// Save the collection afterwards. The number of tracks that got cues is
+// returned.
+func ApplySilenceCues(collection *traktor.TraktorCollection, checks []SilenceCheck) (int, error) {
+	changed := 0
+	for _, check := range checks {
+		if check.Err != nil || len(check.Cues) == 0 {
+			continue
+		}
+		// The proposal may be stale when the cues changed since
+		cues := SilenceCues(check.Track, check.Silence)
+		if len(cues) == 0 {
+			continue
+		}
+		if err := collection.AddCuePoints(check.Track, cues); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
@@ -0,0 +1,168 @@
+package analysis
+
+import (
+	"math"
+)
+
+// Tempo search range, the default range of the Traktor analysis. Tracks
+// outside it are reported at half or double tempo.
+const (
+	MinBPM = 88
+	MaxBPM = 175
+)
+
+// Onset analysis frames. At analysisRate a hop is about 12 ms.
+const (
+	onsetWindow = 1024
+	onsetHop    = 128
+)
+
+// Tempo is a detected tempo
+type Tempo struct {
+	BPM float64
+	// Confidence is 0..1: how much stronger the onsets on the beat grid are
+	// than the onsets elsewhere
+	Confidence float64
+}
+
+// DetectTempo estimates the tempo of a mono signal. The onset strength is
+// taken from the spectral flux, its autocorrelation gives the candidate
+// beat periods, and the best candidate is refined by fitting a beat grid
+// over the whole signal. A zero BPM means no tempo was found.
+func DetectTempo(samples []float32, rate float64) Tempo {
+	onsets := onsetEnvelope(samples)
+	if onsets == nil {
+		return Tempo{}
+	}
+	fps := rate / onsetHop
+	coarse := coarseTempo(onsets, fps)
+	if coarse == 0 {
+		return Tempo{}
+	}
+
+	// Search a step around the coarse estimate in hundredths of a BPM
+	best, bestScore := coarse, 0.0
+	for bpm := coarse - 1; bpm <= coarse+1; bpm += 0.01 {
+		if score := gridScore(onsets, 60*fps/bpm); score > bestScore {
+			best, bestScore = bpm, score
+		}
+	}
+	var mean float64
+	for _, o := range onsets {
+		mean += o
+	}
+	mean /= float64(len(onsets))
+	if mean == 0 {
+		return Tempo{}
+	}
+	return Tempo{
+		BPM:        math.Round(best*100) / 100,
+		Confidence: math.Max(0, math.Min(1, (bestScore/mean-1)/3)),
+	}
+}
+
+// onsetEnvelope returns the positive spectral flux of log magnitude spectra,
+// one value per hop, with its slowly changing part removed
+func onsetEnvelope(samples []float32) []float64 {
+	frames := (len(samples)-onsetWindow)/onsetHop + 1
+	if frames < 2 {
+		return nil
+	}
+	spec := newSpectrum(onsetWindow)
+	prev := make([]float64, onsetWindow/2)
+	cur := make([]float64, onsetWindow/2)
+	flux := make([]float64, frames)
+	for f := 0; f < frames; f++ {
+		spec.magnitudes(samples[f*onsetHop:], cur)
+		var sum float64
+		for k, m := range cur {
+			cur[k] = math.Log1p(1000 * m)
+			if f > 0 && cur[k] > prev[k] {
+				sum += cur[k] - prev[k]
+			}
+		}
+		flux[f] = sum
+		prev, cur = cur, prev
+	}
+
+	// Subtract a running mean of about half a second and keep what remains
+	// above it, which leaves the peaks
+	const radius = 20
+	envelope := make([]float64, frames)
+	var window float64
+	for i := 0; i < min(radius, frames); i++ {
+		window += flux[i]
+	}
+	for f := range flux {
+		if f+radius < frames {
+			window += flux[f+radius]
+		}
+		if f-radius-1 >= 0 {
+			window -= flux[f-radius-1]
+		}
+		count := min(f+radius, frames-1) - max(f-radius, 0) + 1
+		envelope[f] = math.Max(0, flux[f]-window/float64(count))
+	}
+	return envelope
+}
+
+// coarseTempo picks the beat period with the strongest autocorrelation at
+// the period and its multiples, weighted towards tempos around 120 BPM
+func coarseTempo(onsets []float64, fps float64) float64 {
+	maxLag := int(4*60*fps/MinBPM) + 2
+	if maxLag >= len(onsets) {
+		return 0
+	}
+	acf := make([]float64, maxLag+1)
+	for lag := range acf {
+		var sum float64
+		for t := 0; t+lag < len(onsets); t++ {
+			sum += onsets[t] * onsets[t+lag]
+		}
+		acf[lag] = sum / float64(len(onsets)-lag)
+	}
+
+	best, bestScore := 0.0, 0.0
+	for bpm := float64(MinBPM); bpm <= MaxBPM; bpm += 0.5 {
+		lag := 60 * fps / bpm
+		var score float64
+		for k := 1; k <= 4; k++ {
+			score += interpolate(acf, float64(k)*lag)
+		}
+		// A log normal preference for moderate tempos, one octave wide
+		octaves := math.Log2(bpm / 120)
+		score *= math.Exp(-0.5 * octaves * octaves)
+		if score > bestScore {
+			best, bestScore = bpm, score
+		}
+	}
+	return best
+}
+
+// gridScore returns the mean onset strength on the best aligned beat grid
+// with the given period in frames
+func gridScore(onsets []float64, period float64) float64 {
+	var best float64
+	for phase := 0.0; phase < period; phase++ {
+		var sum float64
+		count := 0
+		for t := phase; t < float64(len(onsets)-1); t += period {
+			sum += interpolate(onsets, t)
+			count++
+		}
+		if count > 0 && sum/float64(count) > best {
+			best = sum / float64(count)
+		}
+	}
+	return best
+}
+
+// interpolate reads values at a fractional index
+func interpolate(values []float64, index float64) float64 {
+	i := int(index)
+	if i < 0 || i+1 >= len(values) {
+		return 0
+	}
+	frac := index - float64(i)
+	return values[i]*(1-frac) + values[i+1]*frac
+}
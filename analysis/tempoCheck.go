@@ -0,0 +1,125 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// TempoTolerance is the largest BPM difference that still counts as a match
+const TempoTolerance = 0.5
+
+// TempoVerdict says how a library BPM relates to the detected tempo
+type TempoVerdict int
+
+const (
+	// TempoUnknown means the library has no BPM or none was detected
+	TempoUnknown TempoVerdict = iota
+	TempoMatch
+	// TempoHalf means the library BPM is half the detected tempo
+	TempoHalf
+	// TempoDouble means the library BPM is double the detected tempo
+	TempoDouble
+	TempoMismatch
+)
+
+// String returns the verdict as shown in reports
+func (v TempoVerdict) String() string {
+	switch v {
+	case TempoMatch:
+		return "match"
+	case TempoHalf:
+		return "half-time"
+	case TempoDouble:
+		return "double-time"
+	case TempoMismatch:
+		return "mismatch"
+	}
+	return "unknown"
+}
+
+// CompareTempo compares a library BPM with a detected one
+func CompareTempo(library, detected float64) TempoVerdict {
+	switch {
+	case library <= 0 || detected <= 0:
+		return TempoUnknown
+	case math.Abs(library-detected) <= TempoTolerance:
+		return TempoMatch
+	case math.Abs(library*2-detected) <= TempoTolerance:
+		return TempoHalf
+	case math.Abs(library-detected*2) <= TempoTolerance*2:
+		return TempoDouble
+	}
+	return TempoMismatch
+}
+
+// TempoCheck is the detected tempo of a collection track
+type TempoCheck struct {
+	Track    *traktor.Track
+	Detected Tempo
+	Verdict  TempoVerdict
+	// Err is set when the file could not be analysed
+	Err error
+}
+
+// CheckTempo compares the tempo of a track in the collection with the
+// analysis of its file
+func CheckTempo(track *traktor.Track, result Result, err error) TempoCheck {
+	check := TempoCheck{Track: track, Err: err}
+	if err == nil {
+		check.Detected = result.Tempo
+		check.Verdict = CompareTempo(track.BPM, result.Tempo.BPM)
+	}
+	return check
+}
+
+// Disagrees tells whether the check should be looked at: the tempos differ,
+// or the collection has no BPM that the analysis could fill
+func (c TempoCheck) Disagrees() bool {
+	return c.Err != nil || c.Verdict != TempoMatch
+}
+
+// TempoReport formats checks as a table. Matching tracks are left out
+// unless all is set.
+func TempoReport(checks []TempoCheck, all bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-50s %9s %7s %9s %10s  %s\n", "Track", "Traktor", "Quality", "Detected", "Confidence", "Verdict")
+	for _, check := range checks {
+		if !all && !check.Disagrees() {
+			continue
+		}
+		name := reportName(check.Track)
+		if check.Err != nil {
+			fmt.Fprintf(&b, "%-50s %9.2f %7.0f %9s %10s  %v\n", name, check.Track.BPM, check.Track.BPMQuality, "", "", check.Err)
+			continue
+		}
+		fmt.Fprintf(&b, "%-50s %9.2f %7.0f %9.2f %9.0f%%  %s\n", name, check.Track.BPM, check.Track.BPMQuality,
+			check.Detected.BPM, check.Detected.Confidence*100, check.Verdict)
+	}
+	return b.String()
+}
+
+// TrackName names a track as "Artist - Title", or by its file name when
+// both are empty
+func TrackName(track *traktor.Track) string {
+	if track.Artist == "" && track.Title == "" {
+		return filepath.Base(track.FilePath)
+	}
+	return track.Artist + " - " + track.Title
+}
+
+// reportName names a track in a report column of 50 characters
+func reportName(track *traktor.Track) string {
+	return shorten(TrackName(track), 50)
+}
+
+// shorten cuts text to at most width characters
+func shorten(text string, width int) string {
+	if runes := []rune(text); len(runes) > width {
+		return string(runes[:width-1]) + "…"
+	}
+	return text
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/analysis"
+	"github.com/ilmarkerm/djlibgo/tags"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// analyzeOptions are the flags shared by collection and file analysis
+type analyzeOptions struct {
+	workers       int
+	all           bool
+	cache         *analysis.Cache
+	notation      traktor.KeyNotation
+	minConfidence float64
+	// keysToCollection and keysToTags write detected keys that disagree
+	keysToCollection bool
+	keysToTags       bool
+	// reports selects the tempo, key and loudness reports
+	reports map[string]bool
+	// target is the loudness the gain column of the loudness report aims at
+	target     float64
+	replayGain bool
+}
+
+// runAnalyze detects the tempo and key of the collection tracks, or of one
+// playlist, reports where they disagree with Traktor, and lists the gain
+// each track needs to reach a target loudness. Files and folders
+// given as arguments are analysed instead of the collection, for example new
+// downloads before they are imported. Ctrl-C stops the analysis and keeps
+// the finished results in the cache.
+func runAnalyze(args []string) error {
+	flags := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	collectionPath := flags.String("collection", "", "collection.nml to check, defaults to the Traktor collection")
+	playlistName := flags.String("playlist", "", "playlist path or name to limit the tracks to")
+	workers := flags.Int("workers", 0, "number of files analysed in parallel, defaults to the number of CPUs")
+	all := flags.Bool("all", false, "list matching tracks too")
+	noCache := flags.Bool("no-cache", false, "analyse every file again instead of using cached results")
+	notation := flags.String("notation", "camelot", "key notation for reports, key text and tags: musical, openkey or camelot")
+	writeKeys := flags.String("write-keys", "", "write disagreeing detected keys to: collection, tags or collection,tags")
+	minConfidence := flags.Float64("min-confidence", 0.5, "lowest key confidence (0-1) that -write-keys writes")
+	reports := flags.String("report", "tempo,key,loudness", "comma separated reports to print: tempo, key and loudness")
+	target := flags.Float64("target", -14, "target loudness in LUFS for the gain column of the loudness report")
+	replayGain := flags.Bool("replaygain", false, "write ReplayGain tags, with the album gain over all analysed tracks")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	keyNotation, ok := keyNotationNames[strings.ToLower(*notation)]
+	if !ok {
+		return fmt.Errorf("unknown key notation %q", *notation)
+	}
+	opts := analyzeOptions{
+		workers:       *workers,
+		all:           *all,
+		cache:         analysis.DefaultCache(),
+		notation:      keyNotation,
+		minConfidence: *minConfidence,
+		reports:       make(map[string]bool),
+		target:        *target,
+		replayGain:    *replayGain,
+	}
+	for _, report := range strings.Split(*reports, ",") {
+		switch report = strings.TrimSpace(report); report {
+		case "tempo", "key", "loudness":
+			opts.reports[report] = true
+		case "":
+		default:
+			return fmt.Errorf("unknown report %q", report)
+		}
+	}
+	if *noCache {
+		opts.cache = nil
+	}
+	for _, target := range strings.Split(*writeKeys, ",") {
+		switch strings.TrimSpace(target) {
+		case "":
+		case "collection":
+			opts.keysToCollection = true
+		case "tags":
+			opts.keysToTags = true
+		default:
+			return fmt.Errorf("unknown -write-keys target %q", target)
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if flags.NArg() > 0 {
+		if opts.keysToCollection {
+			return fmt.Errorf("files outside the collection can only have their keys written to tags")
+		}
+		return analyzeFiles(ctx, flags.Args(), opts)
+	}
+
+	var collection *traktor.TraktorCollection
+	var err error
+	if *collectionPath != "" {
+		collection, err = traktor.ParseCollectionFromPath(*collectionPath)
+	} else {
+		collection, err = traktor.ParseCollection()
+	}
+	if err != nil {
+		return fmt.Errorf("reading collection: %w", err)
+	}
+	var tracks []*traktor.Track
+	if *playlistName != "" {
+		playlist := collection.GetPlaylistByPath(*playlistName)
+		if playlist == nil {
+			playlist = collection.GetPlaylistByName(*playlistName)
+		}
+		if playlist == nil {
+			return fmt.Errorf("playlist %q not found", *playlistName)
+		}
+		tracks = playlist.Tracks
+	} else {
+		for i := range collection.Tracks {
+			tracks = append(tracks, &collection.Tracks[i])
+		}
+	}
+	return analyzeCollection(ctx, collection, tracks, opts)
+}
+
+// analyzeCollection prints the tempo and key reports of collection tracks
+// and writes the accepted keys
+func analyzeCollection(ctx context.Context, collection *traktor.TraktorCollection, tracks []*traktor.Track, opts analyzeOptions) error {
+	byPath := make(map[string]int)
+	paths := make([]string, len(tracks))
+	for i, track := range tracks {
+		paths[i] = track.FilePath
+		byPath[track.FilePath] = i
+	}
+	tempoChecks := make([]analysis.TempoCheck, len(tracks))
+	keyChecks := make([]analysis.KeyCheck, len(tracks))
+	loudnessEntries := make([]analysis.LoudnessEntry, len(tracks))
+	finished := 0
+	runErr := analysis.Run(ctx, paths, opts.workers, opts.cache, func(path string, result analysis.Result, err error) {
+		i := byPath[path]
+		tempoChecks[i] = analysis.CheckTempo(tracks[i], result, err)
+		keyChecks[i] = analysis.CheckKey(tracks[i], result, err)
+		loudnessEntries[i] = analysis.LoudnessEntry{
+			Name:     analysis.TrackName(tracks[i]),
+			Path:     path,
+			Loudness: result.Loudness,
+			Err:      err,
+		}
+		finished++
+		fmt.Fprintf(os.Stderr, "\ranalysed %d of %d", finished, len(paths))
+	})
+	fmt.Fprintln(os.Stderr)
+
+	var tempos []analysis.TempoCheck
+	var keys []analysis.KeyCheck
+	var loudness []analysis.LoudnessEntry
+	tempoDisagreements, keyDisagreements := 0, 0
+	for i := range tracks {
+		if tempoChecks[i].Track == nil {
+			continue
+		}
+		tempos = append(tempos, tempoChecks[i])
+		keys = append(keys, keyChecks[i])
+		loudness = append(loudness, loudnessEntries[i])
+		if tempoChecks[i].Disagrees() {
+			tempoDisagreements++
+		}
+		if keyChecks[i].Disagrees() {
+			keyDisagreements++
+		}
+	}
+	if opts.reports["tempo"] {
+		fmt.Print(analysis.TempoReport(tempos, opts.all))
+		fmt.Printf("%d of %d tempos disagree with the collection\n\n", tempoDisagreements, len(tempos))
+	}
+	if opts.reports["key"] {
+		fmt.Print(analysis.KeyReport(keys, opts.all, opts.notation))
+		fmt.Printf("%d of %d keys disagree with the collection\n\n", keyDisagreements, len(keys))
+	}
+	if opts.reports["loudness"] {
+		fmt.Print(analysis.LoudnessReport(loudness, opts.target))
+		fmt.Printf("gain to %.1f LUFS\n", opts.target)
+	}
+	if runErr != nil {
+		return runErr
+	}
+	if opts.replayGain {
+		if err := writeReplayGain(loudness); err != nil {
+			return err
+		}
+	}
+	if !opts.keysToCollection && !opts.keysToTags {
+		return nil
+	}
+
+	written, failed := 0, 0
+	for _, check := range keys {
+		if !check.Acceptable() || check.Detected.Confidence < opts.minConfidence {
+			continue
+		}
+		var err error
+		if opts.keysToTags {
+			err = analysis.WriteKeyTag(check.Track.FilePath, check.Detected.Value, opts.notation)
+		}
+		if err == nil && opts.keysToCollection {
+			err = analysis.AcceptKey(collection, check.Track, check.Detected.Value, opts.notation)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", check.Track.FilePath, err)
+			failed++
+			continue
+		}
+		written++
+	}
+	if opts.keysToCollection && written > 0 {
+		if err := collection.Save(); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("wrote %d keys\n", written)
+	if failed > 0 {
+		return fmt.Errorf("%d keys could not be written", failed)
+	}
+	return nil
+}
+
+// analyzeFiles prints the tempo and key of audio files next to the values
+// in their tags, and writes confident keys into the tags on request.
+// Folders are searched recursively.
+func analyzeFiles(ctx context.Context, args []string, opts analyzeOptions) error {
+	var paths []string
+	for _, arg := range args {
+		err := filepath.WalkDir(arg, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && tags.IsAudioFile(path) {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	sort.Strings(paths)
+
+	var lines []string
+	var loudness []analysis.LoudnessEntry
+	failed := 0
+	runErr := analysis.Run(ctx, paths, opts.workers, opts.cache, func(path string, result analysis.Result, err error) {
+		loudness = append(loudness, analysis.LoudnessEntry{Name: path, Path: path, Loudness: result.Loudness, Err: err})
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("%s: %v", path, err))
+			return
+		}
+		var meta tags.Metadata
+		if read, err := tags.ReadMetadata(path); err == nil {
+			meta = *read
+		}
+		tagKey, _ := traktor.ParseKey(meta.Key)
+		keyVerdict := analysis.CompareKey(tagKey, result.Key.Value)
+		line := fmt.Sprintf("%s: %.2f BPM (%.0f%%, tag %.2f, %s), key %s (%.0f%%, tag %q, %s), %.1f LUFS, %.1f dBTP", path,
+			result.Tempo.BPM, result.Tempo.Confidence*100, meta.BPM, analysis.CompareTempo(meta.BPM, result.Tempo.BPM),
+			traktor.KeyValueToNotation(result.Key.Value, opts.notation), result.Key.Confidence*100, meta.Key, keyVerdict,
+			result.Loudness.Integrated, result.Loudness.TruePeak)
+		if opts.keysToTags && keyVerdict != analysis.KeyMatch && result.Key.Value >= 0 && result.Key.Confidence >= opts.minConfidence {
+			if err := analysis.WriteKeyTag(path, result.Key.Value, opts.notation); err != nil {
+				line += fmt.Sprintf(", writing key: %v", err)
+				failed++
+			} else {
+				line += ", key written"
+			}
+		}
+		lines = append(lines, line)
+	})
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	if runErr != nil {
+		return runErr
+	}
+	if opts.replayGain {
+		sort.Slice(loudness, func(i, j int) bool { return loudness[i].Path < loudness[j].Path })
+		if err := writeReplayGain(loudness); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d keys could not be written", failed)
+	}
+	return nil
+}
+
+// writeReplayGain writes the ReplayGain tags of all analysed files as one album
+func writeReplayGain(entries []analysis.LoudnessEntry) error {
+	failed := analysis.WriteReplayGain(entries)
+	for path, err := range failed {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+	}
+	fmt.Printf("wrote ReplayGain tags to %d files\n", countAnalysed(entries)-len(failed))
+	if len(failed) > 0 {
+		return fmt.Errorf("%d files could not be tagged", len(failed))
+	}
+	return nil
+}
+
+// countAnalysed counts the entries without an analysis error
+func countAnalysed(entries []analysis.LoudnessEntry) int {
+	count := 0
+	for _, entry := range entries {
+		if entry.Err == nil {
+			count++
+		}
+	}
+	return count
+}
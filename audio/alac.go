@@ -0,0 +1,400 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+	"os"
+)
+
+// ALAC element types
+const (
+	alacSCE = 0 // single channel
+	alacCPE = 1 // channel pair
+	alacLFE = 3
+	alacDSE = 4 // data stream
+	alacFIL = 6 // fill
+	alacEND = 7
+)
+
+// Constants of the adaptive Golomb coding
+const (
+	alacQBShift   = 9
+	alacMaxPrefix = 9
+	alacRunBits   = 16
+)
+
+// alacConfig is the ALACSpecificConfig of the sample description
+type alacConfig struct {
+	frameLength int
+	bitDepth    int
+	pb, mb, kb  int
+	channels    int
+	sampleRate  int
+}
+
+// alacDecoder decodes the ALAC packets of an MP4 file
+type alacDecoder struct {
+	blockReader
+	file   *os.File
+	track  *mp4Track
+	config alacConfig
+	format Format
+	packet int
+	data   []byte
+	out    []float32
+}
+
+func newALACDecoder(file *os.File, track *mp4Track) (*alacDecoder, error) {
+	// The config is in an alac box inside the sample description, after
+	// the box header and four bytes of version and flags
+	index := bytes.Index(track.entry, []byte("alac"))
+	if index < 4 || index+8+24 > len(track.entry) {
+		return nil, errors.New("missing ALAC config")
+	}
+	cookie := track.entry[index+8:]
+	config := alacConfig{
+		frameLength: int(binary.BigEndian.Uint32(cookie[0:4])),
+		bitDepth:    int(cookie[5]),
+		pb:          int(cookie[6]),
+		mb:          int(cookie[7]),
+		kb:          int(cookie[8]),
+		channels:    int(cookie[9]),
+		sampleRate:  int(binary.BigEndian.Uint32(cookie[20:24])),
+	}
+	if config.frameLength == 0 || config.channels == 0 || config.sampleRate == 0 || config.bitDepth == 0 || config.bitDepth > 32 {
+		return nil, errors.New("invalid ALAC config")
+	}
+	frames := track.frames
+	if track.timescale > 0 && track.timescale != int64(config.sampleRate) {
+		frames = frames * int64(config.sampleRate) / track.timescale
+	}
+	if frames == 0 {
+		frames = -1
+	}
+	d := &alacDecoder{
+		file:   file,
+		track:  track,
+		config: config,
+		format: Format{SampleRate: config.sampleRate, Channels: config.channels, BitDepth: config.bitDepth, Frames: frames},
+	}
+	d.blockReader = blockReader{channels: config.channels, decode: d.decodePacket, end: frames}
+	return d, nil
+}
+
+func (d *alacDecoder) Format() Format { return d.format }
+
+func (d *alacDecoder) Close() error { return d.file.Close() }
+
+// SeekFrame starts decoding at the packet holding the frame, every packet but
+// the last holds frameLength frames
+func (d *alacDecoder) SeekFrame(frame int64) error {
+	packet := min(frame/int64(d.config.frameLength), int64(len(d.track.offsets)))
+	return d.seek(frame, packet*int64(d.config.frameLength), func() error {
+		d.packet = int(packet)
+		return nil
+	})
+}
+
+// decodePacket decodes the next packet into interleaved samples
+func (d *alacDecoder) decodePacket() ([]float32, error) {
+	if d.packet >= len(d.track.offsets) {
+		return nil, io.EOF
+	}
+	size := d.track.sizes[d.packet]
+	if size > 1<<24 {
+		return nil, ErrCorrupt
+	}
+	if int64(cap(d.data)) < size {
+		d.data = make([]byte, size)
+	}
+	data := d.data[:size]
+	if _, err := d.file.ReadAt(data, d.track.offsets[d.packet]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	d.packet++
+
+	channels := d.config.channels
+	count := d.config.frameLength * channels
+	if cap(d.out) < count {
+		d.out = make([]float32, count)
+	}
+	out := d.out[:count]
+	frames := -1
+	channel := 0
+	b := &bitReader{r: bytes.NewReader(data)}
+	for {
+		tag := b.read(3)
+		if b.err != nil {
+			return nil, ErrCorrupt
+		}
+		switch tag {
+		case alacSCE, alacLFE, alacCPE:
+			pair := tag == alacCPE
+			n, err := d.decodeElement(data, b, pair, out, channel)
+			if err != nil {
+				return nil, err
+			}
+			if frames >= 0 && n != frames {
+				return nil, ErrCorrupt
+			}
+			frames = n
+			channel++
+			if pair {
+				channel++
+			}
+		case alacDSE:
+			b.read(4)
+			aligned := b.read(1) == 1
+			length := b.read(8)
+			if length == 255 {
+				length += b.read(8)
+			}
+			if aligned {
+				b.align()
+			}
+			for i := uint64(0); i < length; i++ {
+				b.read(8)
+			}
+		case alacFIL:
+			length := b.read(4)
+			if length == 15 {
+				length += b.read(8) - 1
+			}
+			for i := uint64(0); i < length; i++ {
+				b.read(8)
+			}
+		case alacEND:
+			if frames < 0 || channel != channels {
+				return nil, ErrCorrupt
+			}
+			return out[:frames*channels], nil
+		default:
+			return nil, ErrUnsupported
+		}
+	}
+}
+
+// decodeElement decodes a single channel or channel pair element into out,
+// starting at channel, and returns the number of frames
+func (d *alacDecoder) decodeElement(data []byte, b *bitReader, pair bool, out []float32, channel int) (int, error) {
+	channels := 1
+	if pair {
+		channels = 2
+	}
+	if channel+channels > d.config.channels {
+		return 0, ErrCorrupt
+	}
+	b.read(4)  // element instance
+	b.read(12) // unused
+	partial := b.read(1) == 1
+	shift := uint(b.read(2)) * 8
+	escape := b.read(1) == 1
+	frames := d.config.frameLength
+	if partial {
+		frames = int(b.read(32))
+	}
+	if frames > d.config.frameLength || b.err != nil {
+		return 0, ErrCorrupt
+	}
+
+	depth := uint(d.config.bitDepth)
+	chanBits := depth - shift + uint(channels-1)
+	buffers := [2][]int32{make([]int32, frames), make([]int32, frames)}
+	var mixBits uint
+	var mixRes int32
+	if escape {
+		// Uncompressed samples, interleaved
+		shift = 0
+		for i := 0; i < frames; i++ {
+			for ch := 0; ch < channels; ch++ {
+				buffers[ch][i] = int32(b.readSigned(depth))
+			}
+		}
+	} else {
+		mixBits = uint(b.read(8))
+		mixRes = int32(int8(b.read(8)))
+		var modes, denShifts, pbFactors [2]uint
+		var coefficients [2][]int32
+		for ch := 0; ch < channels; ch++ {
+			modes[ch] = uint(b.read(4))
+			denShifts[ch] = uint(b.read(4))
+			pbFactors[ch] = uint(b.read(3))
+			coefficients[ch] = make([]int32, b.read(5))
+			for i := range coefficients[ch] {
+				coefficients[ch][i] = int32(b.readSigned(16))
+			}
+		}
+		// The low bytes of each sample are stored before the residuals,
+		// remember where they are and skip them
+		var shifted *bitReader
+		if shift > 0 {
+			position := len(data)*8 - b.r.(*bytes.Reader).Len()*8 - int(b.n)
+			shifted = &bitReader{r: bytes.NewReader(data[position/8:])}
+			shifted.read(uint(position % 8))
+			for i := 0; i < frames*channels; i++ {
+				b.read(shift)
+			}
+		}
+		residual := make([]int32, frames)
+		for ch := 0; ch < channels; ch++ {
+			if err := d.decodeResiduals(b, residual, chanBits, d.config.pb*int(pbFactors[ch])/4); err != nil {
+				return 0, err
+			}
+			if modes[ch] != 0 {
+				alacPredict(residual, residual, nil, 31, chanBits, 0)
+			}
+			alacPredict(residual, buffers[ch], coefficients[ch], len(coefficients[ch]), chanBits, denShifts[ch])
+		}
+		if pair && mixRes != 0 {
+			for i := 0; i < frames; i++ {
+				u, v := buffers[0][i], buffers[1][i]
+				left := u + v - (mixRes*v)>>mixBits
+				buffers[0][i], buffers[1][i] = left, left-v
+			}
+		}
+		if shifted != nil {
+			for i := 0; i < frames; i++ {
+				for ch := 0; ch < channels; ch++ {
+					buffers[ch][i] = buffers[ch][i]<<shift | int32(shifted.read(shift))
+				}
+			}
+		}
+	}
+	if b.err != nil {
+		return 0, ErrCorrupt
+	}
+
+	scale := 1 / float32(int64(1)<<(depth-1))
+	total := d.config.channels
+	for ch := 0; ch < channels; ch++ {
+		for i, sample := range buffers[ch][:frames] {
+			out[i*total+channel+ch] = float32(sample) * scale
+		}
+	}
+	return frames, nil
+}
+
+// decodeResiduals reads the adaptive Golomb coded prediction errors
+func (d *alacDecoder) decodeResiduals(b *bitReader, out []int32, chanBits uint, pb int) error {
+	mb := uint32(d.config.mb)
+	kb := uint(d.config.kb)
+	wb := uint32(1)<<kb - 1
+	zero := uint32(0)
+	for i := 0; i < len(out); {
+		k := min(uint(31-bits.LeadingZeros32(mb>>alacQBShift+3)), kb)
+		n := alacGolomb(b, uint32(1)<<k-1, k, chanBits)
+		value := n + zero
+		// The lowest bit is the sign
+		out[i] = int32(value+1) >> 1
+		if value&1 != 0 {
+			out[i] = -out[i]
+		}
+		i++
+		mb = uint32(pb)*value + mb - uint32(pb)*mb>>alacQBShift
+		if n > 0xffff {
+			mb = 0xffff
+		}
+		zero = 0
+		// A small mean starts a run of zeros
+		if mb<<2 < 1<<alacQBShift && i < len(out) {
+			zero = 1
+			k := uint(bits.LeadingZeros32(mb)) - 24 + uint((mb+16)>>6)
+			run := int(alacGolomb(b, (uint32(1)<<k-1)&wb, k, alacRunBits))
+			if i+run > len(out) {
+				return ErrCorrupt
+			}
+			for j := 0; j < run; j++ {
+				out[i] = 0
+				i++
+			}
+			if run >= 0xffff {
+				zero = 0
+			}
+			mb = 0
+		}
+		if b.err != nil {
+			return ErrCorrupt
+		}
+	}
+	return nil
+}
+
+// alacGolomb reads one value: a prefix of ones, then k bits. Long prefixes
+// escape to a raw value of escapeBits bits.
+func alacGolomb(b *bitReader, m uint32, k, escapeBits uint) uint32 {
+	prefix := uint32(b.leadingOnes(alacMaxPrefix))
+	if prefix >= alacMaxPrefix {
+		return uint32(b.read(escapeBits))
+	}
+	if k <= 1 {
+		return prefix * m
+	}
+	// Values below two take one bit less
+	v := uint32(b.read(k - 1))
+	if v < 1 {
+		return prefix * m
+	}
+	v = v<<1 | uint32(b.read(1))
+	return prefix*m + v - 1
+}
+
+// alacPredict reverses the adaptive LPC of a channel. Order 31 is a plain
+// first order difference.
+func alacPredict(residual, out []int32, coefficients []int32, order int, chanBits, denShift uint) {
+	if len(out) == 0 {
+		return
+	}
+	extend := func(v int32) int32 { return v << (32 - chanBits) >> (32 - chanBits) }
+	out[0] = residual[0]
+	if order == 0 {
+		copy(out, residual)
+		return
+	}
+	if order == 31 {
+		for i := 1; i < len(out); i++ {
+			out[i] = extend(out[i-1] + residual[i])
+		}
+		return
+	}
+	for i := 1; i <= order && i < len(out); i++ {
+		out[i] = extend(out[i-1] + residual[i])
+	}
+	coefs := append([]int32(nil), coefficients...)
+	half := int32(1) << denShift >> 1
+	for i := order + 1; i < len(out); i++ {
+		top := out[i-order-1]
+		var sum int32
+		for j := 0; j < order; j++ {
+			sum += coefs[j] * (out[i-1-j] - top)
+		}
+		err := residual[i]
+		out[i] = extend(err + top + (sum+half)>>denShift)
+		// Adapt the coefficients towards the sign of the error
+		sign := int32(0)
+		if err > 0 {
+			sign = 1
+		} else if err < 0 {
+			sign = -1
+		}
+		if sign == 0 {
+			continue
+		}
+		for j := order - 1; j >= 0 && err*sign > 0; j-- {
+			diff := top - out[i-1-j]
+			s := int32(0)
+			if diff > 0 {
+				s = sign
+			} else if diff < 0 {
+				s = -sign
+			}
+			coefs[j] -= s
+			err -= int32(order-j) * ((s * diff) >> denShift)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package audio
+
+import (
+	"io"
+	"math/bits"
+)
+
+// bitReader reads big endian bit fields. The first error is kept and later
+// reads return zero, so callers check err once per frame. The CRCs cover
+// all bytes read since the last resetCRC.
+type bitReader struct {
+	r     io.ByteReader
+	value uint64
+	n     uint
+	err   error
+	crc8  uint8
+	crc16 uint16
+}
+
+// fill makes at least count bits available
+func (b *bitReader) fill(count uint) bool {
+	for b.n < count {
+		c, err := b.r.ReadByte()
+		if err != nil {
+			if b.err == nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				b.err = err
+			}
+			return false
+		}
+		b.crc8 = crc8Table[b.crc8^c]
+		b.crc16 = b.crc16<<8 ^ crc16Table[byte(b.crc16>>8)^c]
+		b.value = b.value<<8 | uint64(c)
+		b.n += 8
+	}
+	return true
+}
+
+// read returns the next count bits, count is at most 56
+func (b *bitReader) read(count uint) uint64 {
+	if count == 0 || !b.fill(count) {
+		return 0
+	}
+	b.n -= count
+	value := b.value >> b.n
+	b.value &= 1<<b.n - 1
+	return value
+}
+
+// readSigned returns the next count bits as a two's complement number
+func (b *bitReader) readSigned(count uint) int64 {
+	if count == 0 {
+		return 0
+	}
+	value := b.read(count)
+	return int64(value<<(64-count)) >> (64 - count)
+}
+
+// unary counts the zero bits before the next one bit
+func (b *bitReader) unary() uint64 {
+	var count uint64
+	for {
+		if b.n == 0 && !b.fill(8) {
+			return count
+		}
+		if b.value == 0 {
+			count += uint64(b.n)
+			b.n = 0
+			continue
+		}
+		zeros := uint(bits.LeadingZeros64(b.value)) - (64 - b.n)
+		count += uint64(zeros)
+		b.n -= zeros + 1
+		b.value &= 1<<b.n - 1
+		return count
+	}
+}
+
+// leadingOnes counts the one bits before the next zero bit, stopping at limit.
+// The zero bit is consumed, the limit is not followed by one.
+func (b *bitReader) leadingOnes(limit int) int {
+	count := 0
+	for count < limit {
+		if b.read(1) == 0 {
+			return count
+		}
+		count++
+	}
+	return count
+}
+
+// align skips the rest of the current byte
+func (b *bitReader) align() {
+	b.n -= b.n % 8
+	b.value &= 1<<b.n - 1
+}
+
+// resetCRC starts the checksums at the next byte. The reader must be byte aligned.
+func (b *bitReader) resetCRC() {
+	b.crc8, b.crc16 = 0, 0
+}
+
+// crc8Table and crc16Table hold the FLAC frame header and frame checksums,
+// polynomials x^8+x^2+x+1 and x^16+x^15+x^2+1
+var crc8Table, crc16Table = func() (t8 [256]uint8, t16 [256]uint16) {
+	for i := 0; i < 256; i++ {
+		c8 := uint8(i)
+		c16 := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if c8&0x80 != 0 {
+				c8 = c8<<1 ^ 0x07
+			} else {
+				c8 <<= 1
+			}
+			if c16&0x8000 != 0 {
+				c16 = c16<<1 ^ 0x8005
+			} else {
+				c16 <<= 1
+			}
+		}
+		t8[i], t16[i] = c8, c16
+	}
+	return
+}()
@@ -0,0 +1,180 @@
+// Package audio decodes audio files into PCM samples for analysis. All
+// decoders are plain Go, so the package builds wherever the toolchain does.
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsupported is returned for file formats and codecs that cannot be decoded
+var ErrUnsupported = errors.New("unsupported audio format")
+
+// ErrCorrupt is returned when the audio data does not decode, for example
+// on a checksum mismatch
+var ErrCorrupt = errors.New("corrupt audio data")
+
+// Format describes the decoded stream
+type Format struct {
+	SampleRate int
+	Channels   int
+	// BitDepth is the sample size of lossless sources, 0 for lossy ones
+	BitDepth int
+	// Frames is the length in sample frames, -1 when unknown
+	Frames int64
+}
+
+// Duration returns the length in seconds, 0 when unknown
+func (f Format) Duration() float64 {
+	if f.Frames <= 0 || f.SampleRate == 0 {
+		return 0
+	}
+	return float64(f.Frames) / float64(f.SampleRate)
+}
+
+// Decoder streams the samples of an audio file. Samples are interleaved by
+// channel and scaled to -1..1.
+type Decoder interface {
+	Format() Format
+	// Read fills samples with whole frames and returns the number of frames
+	// read. io.EOF is returned once all frames have been read.
+	Read(samples []float32) (int, error)
+	// SeekFrame moves to the given frame. Seeking past the end makes Read return io.EOF.
+	SeekFrame(frame int64) error
+	Close() error
+}
+
+// Open returns a decoder for a WAV, AIFF, FLAC, MP3 or ALAC file
+func Open(path string) (Decoder, error) {
+	var dec Decoder
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav", ".wave":
+		dec, err = openWAV(path)
+	case ".aif", ".aiff", ".aifc":
+		dec, err = openAIFF(path)
+	case ".flac":
+		dec, err = openFLAC(path)
+	case ".mp3":
+		dec, err = openMP3(path)
+	case ".m4a", ".mp4", ".alac":
+		dec, err = openMP4(path)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return dec, nil
+}
+
+// id3Length returns the size of an ID3v2 tag at the start of the file, 0
+// when there is none
+func id3Length(file *os.File) int64 {
+	header := make([]byte, 10)
+	if _, err := file.ReadAt(header, 0); err != nil || string(header[:3]) != "ID3" {
+		return 0
+	}
+	size := int64(header[6]&0x7f)<<21 | int64(header[7]&0x7f)<<14 | int64(header[8]&0x7f)<<7 | int64(header[9]&0x7f)
+	// Version 4 tags can have a footer
+	if header[3] == 4 && header[5]&0x10 != 0 {
+		size += 10
+	}
+	return 10 + size
+}
+
+// blockReader serves Read calls from codecs that decode a block of frames
+// at a time, and drops the frames before a seek target
+type blockReader struct {
+	channels int
+	// decode returns the next block of interleaved samples
+	decode func() ([]float32, error)
+	// decoded is the number of frames returned by decode so far
+	decoded int64
+	// end is the number of decoded frames that belong to the stream, -1 for all
+	end     int64
+	pending []float32
+	skip    int64
+}
+
+func (r *blockReader) Read(samples []float32) (int, error) {
+	limit := len(samples) / r.channels * r.channels
+	if limit == 0 {
+		return 0, errors.New("buffer smaller than one frame")
+	}
+	n := 0
+	for n < limit {
+		if len(r.pending) == 0 {
+			block, err := r.next()
+			if err != nil {
+				if err == io.EOF && n > 0 {
+					break
+				}
+				return n / r.channels, err
+			}
+			r.pending = block
+			continue
+		}
+		copied := copy(samples[n:limit], r.pending)
+		r.pending = r.pending[copied:]
+		n += copied
+	}
+	return n / r.channels, nil
+}
+
+// next decodes the next block, with skipped frames and frames past the end removed
+func (r *blockReader) next() ([]float32, error) {
+	for {
+		if r.end >= 0 && r.decoded >= r.end {
+			return nil, io.EOF
+		}
+		block, err := r.decode()
+		if err != nil {
+			return nil, err
+		}
+		frames := int64(len(block) / r.channels)
+		if r.end >= 0 && r.decoded+frames > r.end {
+			frames = r.end - r.decoded
+			block = block[:frames*int64(r.channels)]
+		}
+		r.decoded += frames
+		if r.skip >= frames {
+			r.skip -= frames
+			continue
+		}
+		block = block[r.skip*int64(r.channels):]
+		r.skip = 0
+		return block, nil
+	}
+}
+
+// seek moves to frame. restart is the frame from which the codec can start
+// decoding again after reposition has been called; when the target can be
+// reached by decoding onwards from the current position, no repositioning
+// happens.
+func (r *blockReader) seek(frame, restart int64, reposition func() error) error {
+	if frame < 0 {
+		return errors.New("negative seek position")
+	}
+	start := r.decoded - int64(len(r.pending)/r.channels)
+	switch {
+	case r.skip == 0 && frame >= start && frame < r.decoded:
+		r.pending = r.pending[(frame-start)*int64(r.channels):]
+		return nil
+	case frame >= r.decoded && r.decoded >= restart:
+		r.pending = nil
+		r.skip = frame - r.decoded
+		return nil
+	}
+	if err := reposition(); err != nil {
+		return err
+	}
+	r.pending = nil
+	r.decoded = restart
+	r.skip = frame - restart
+	return nil
+}
@@ -0,0 +1,111 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testSignal returns frames of interleaved samples within -limit..limit-1.
+// The channels differ, so swapped or mixed channels show up.
+func testSignal(frames, channels int, limit int32) []int32 {
+	samples := make([]int32, frames*channels)
+	for i := 0; i < frames; i++ {
+		for ch := 0; ch < channels; ch++ {
+			value := int32((i*(37+ch*11)+ch*1000)%4000) * (limit / 2000)
+			samples[i*channels+ch] = value - limit + int32(i%7)
+		}
+	}
+	return samples
+}
+
+// scaled converts samples to the -1..1 range of the decoders
+func scaled(samples []int32, limit int32) []float32 {
+	out := make([]float32, len(samples))
+	for i, sample := range samples {
+		out[i] = float32(float64(sample) / float64(limit))
+	}
+	return out
+}
+
+// writeTestFile writes data to a file called name in a temporary folder
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readAll reads up to frames frames with a buffer of chunk frames, less at
+// the end of the stream
+func readAll(t *testing.T, dec Decoder, frames, chunk int) []float32 {
+	t.Helper()
+	channels := dec.Format().Channels
+	buf := make([]float32, chunk*channels)
+	var out []float32
+	for len(out) < frames*channels {
+		n, err := dec.Read(buf)
+		out = append(out, buf[:n*channels]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+	}
+	return out[:min(len(out), frames*channels)]
+}
+
+// checkDecoder decodes the file linearly and after seeks and compares the
+// samples with want
+func checkDecoder(t *testing.T, path string, want Format, samples []float32) {
+	t.Helper()
+	dec, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer dec.Close()
+	if got := dec.Format(); got != want {
+		t.Errorf("format %+v, want %+v", got, want)
+	}
+	channels := want.Channels
+	frames := int(want.Frames)
+
+	compare := func(name string, got, want []float32) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Errorf("%s: read %d samples, want %d", name, len(got), len(want))
+			return
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: sample %d is %v, want %v", name, i, got[i], want[i])
+				return
+			}
+		}
+	}
+	// An odd buffer size splits the blocks of the codecs
+	compare("linear read", readAll(t, dec, frames+1, 333), samples)
+	if n, err := dec.Read(make([]float32, channels)); n != 0 || err != io.EOF {
+		t.Errorf("Read after the end returned %d, %v", n, err)
+	}
+
+	for _, target := range []int{1500, 10, 2047, 1024, 0, frames - 5, 1025, 1024} {
+		if err := dec.SeekFrame(int64(target)); err != nil {
+			t.Fatalf("SeekFrame(%d): %v", target, err)
+		}
+		end := min(target+600, frames)
+		got := readAll(t, dec, end-target, 250)
+		compare(fmt.Sprintf("read after seeking to %d", target), got, samples[target*channels:end*channels])
+	}
+	if err := dec.SeekFrame(int64(frames + 10)); err != nil {
+		t.Fatalf("SeekFrame past the end: %v", err)
+	}
+	if n, err := dec.Read(make([]float32, channels)); n != 0 || err != io.EOF {
+		t.Errorf("Read after seeking past the end returned %d, %v", n, err)
+	}
+}
@@ -0,0 +1,453 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// FLAC metadata block types
+const (
+	flacStreamInfo = 0
+	flacSeekTable  = 3
+)
+
+// flacSeekPoint is an entry of the SEEKTABLE block. Offset counts from the first frame.
+type flacSeekPoint struct {
+	sample int64
+	offset int64
+}
+
+// flacDecoder decodes FLAC frames
+type flacDecoder struct {
+	blockReader
+	file       *os.File
+	format     Format
+	bits       bitReader
+	buffered   *bufio.Reader
+	firstFrame int64
+	seekPoints []flacSeekPoint
+	// channel buffers are reused between frames
+	channels [][]int64
+	out      []float32
+}
+
+func openFLAC(path string) (Decoder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := newFLACDecoder(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return dec, nil
+}
+
+func newFLACDecoder(file *os.File) (*flacDecoder, error) {
+	dec := &flacDecoder{file: file}
+	if err := dec.readMetadata(); err != nil {
+		return nil, err
+	}
+	dec.blockReader = blockReader{channels: dec.format.Channels, decode: dec.decodeFrame, end: -1}
+	if err := dec.reposition(dec.firstFrame); err != nil {
+		return nil, err
+	}
+	return dec, nil
+}
+
+func (d *flacDecoder) Format() Format { return d.format }
+
+func (d *flacDecoder) Close() error { return d.file.Close() }
+
+// readMetadata reads STREAMINFO and SEEKTABLE and finds the first frame.
+// An ID3v2 tag in front of the stream is skipped.
+func (d *flacDecoder) readMetadata() error {
+	header := make([]byte, 4)
+	offset := id3Length(d.file)
+	if _, err := d.file.ReadAt(header, offset); err != nil {
+		return err
+	}
+	if string(header[:4]) != "fLaC" {
+		return ErrUnsupported
+	}
+	offset += 4
+
+	haveInfo := false
+	for last := false; !last; {
+		if _, err := d.file.ReadAt(header[:4], offset); err != nil {
+			return err
+		}
+		last = header[0]&0x80 != 0
+		kind := header[0] & 0x7f
+		size := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		offset += 4
+		switch {
+		case kind == flacStreamInfo && size >= 34:
+			data := make([]byte, 34)
+			if _, err := d.file.ReadAt(data, offset); err != nil {
+				return err
+			}
+			d.format.SampleRate = int(data[10])<<12 | int(data[11])<<4 | int(data[12])>>4
+			d.format.Channels = int(data[12]>>1&0x07) + 1
+			d.format.BitDepth = int(data[12]&0x01)<<4 | int(data[13]>>4) + 1
+			d.format.Frames = int64(data[13]&0x0f)<<32 | int64(binary.BigEndian.Uint32(data[14:18]))
+			if d.format.Frames == 0 {
+				d.format.Frames = -1
+			}
+			haveInfo = true
+		case kind == flacSeekTable:
+			data := make([]byte, size)
+			if _, err := d.file.ReadAt(data, offset); err != nil {
+				return err
+			}
+			for i := 0; i+18 <= len(data); i += 18 {
+				sample := binary.BigEndian.Uint64(data[i:])
+				// Placeholder points are all ones
+				if sample == 1<<64-1 {
+					continue
+				}
+				d.seekPoints = append(d.seekPoints, flacSeekPoint{
+					sample: int64(sample),
+					offset: int64(binary.BigEndian.Uint64(data[i+8:])),
+				})
+			}
+		}
+		offset += size
+	}
+	if !haveInfo || d.format.SampleRate == 0 {
+		return errors.New("missing FLAC STREAMINFO")
+	}
+	d.firstFrame = offset
+	return nil
+}
+
+// reposition continues reading at a file offset
+func (d *flacDecoder) reposition(offset int64) error {
+	if _, err := d.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if d.buffered == nil {
+		d.buffered = bufio.NewReaderSize(d.file, 64*1024)
+	} else {
+		d.buffered.Reset(d.file)
+	}
+	d.bits = bitReader{r: d.buffered}
+	return nil
+}
+
+func (d *flacDecoder) SeekFrame(frame int64) error {
+	point := flacSeekPoint{}
+	for _, p := range d.seekPoints {
+		if p.sample <= frame && p.sample >= point.sample {
+			point = p
+		}
+	}
+	return d.seek(frame, point.sample, func() error {
+		return d.reposition(d.firstFrame + point.offset)
+	})
+}
+
+// flacFrame is the decoded frame header
+type flacFrame struct {
+	blockSize  int
+	sampleRate int
+	channels   int
+	// assignment is 8 for left/side, 9 for side/right, 10 for mid/side
+	assignment int
+	bitDepth   int
+}
+
+// decodeFrame decodes the next frame into interleaved samples
+func (d *flacDecoder) decodeFrame() ([]float32, error) {
+	frame, err := d.readFrameHeader()
+	if err != nil {
+		return nil, err
+	}
+	b := &d.bits
+	for len(d.channels) < frame.channels {
+		d.channels = append(d.channels, nil)
+	}
+	for ch := 0; ch < frame.channels; ch++ {
+		if cap(d.channels[ch]) < frame.blockSize {
+			d.channels[ch] = make([]int64, frame.blockSize)
+		}
+		d.channels[ch] = d.channels[ch][:frame.blockSize]
+		depth := frame.bitDepth
+		// The side channel needs one extra bit
+		if (frame.assignment == 8 || frame.assignment == 10) && ch == 1 || frame.assignment == 9 && ch == 0 {
+			depth++
+		}
+		if err := d.decodeSubframe(d.channels[ch], depth); err != nil {
+			return nil, err
+		}
+	}
+	b.align()
+	crc := b.crc16
+	if expected := uint16(b.read(16)); b.err != nil {
+		return nil, b.err
+	} else if expected != crc {
+		return nil, ErrCorrupt
+	}
+
+	left, right := d.channels[0], d.channels[min(1, frame.channels-1)]
+	switch frame.assignment {
+	case 8:
+		for i := range right {
+			right[i] = left[i] - right[i]
+		}
+	case 9:
+		for i := range left {
+			left[i] += right[i]
+		}
+	case 10:
+		for i := range left {
+			mid := left[i]<<1 | right[i]&1
+			side := right[i]
+			left[i] = (mid + side) >> 1
+			right[i] = (mid - side) >> 1
+		}
+	}
+
+	count := frame.blockSize * frame.channels
+	if cap(d.out) < count {
+		d.out = make([]float32, count)
+	}
+	out := d.out[:count]
+	scale := 1 / float32(int64(1)<<(frame.bitDepth-1))
+	for ch := 0; ch < frame.channels; ch++ {
+		for i, sample := range d.channels[ch] {
+			out[i*frame.channels+ch] = float32(sample) * scale
+		}
+	}
+	return out, nil
+}
+
+// readFrameHeader finds the next frame sync code and decodes the frame
+// header. Headers with a wrong checksum are skipped.
+func (d *flacDecoder) readFrameHeader() (flacFrame, error) {
+	b := &d.bits
+	for {
+		b.align()
+		// Search the sync code byte by byte
+		c, err := d.buffered.ReadByte()
+		if err != nil {
+			return flacFrame{}, err
+		}
+		if c != 0xff {
+			continue
+		}
+		next, err := d.buffered.Peek(1)
+		if err != nil {
+			return flacFrame{}, err
+		}
+		if next[0]&0xfe != 0xf8 {
+			continue
+		}
+		b.resetCRC()
+		b.crc8 = crc8Table[0xff]
+		b.crc16 = crc16Table[0xff]
+		if frame, ok := d.parseFrameHeader(); ok {
+			return frame, nil
+		}
+		if b.err != nil {
+			if b.err == io.ErrUnexpectedEOF {
+				return flacFrame{}, io.EOF
+			}
+			return flacFrame{}, b.err
+		}
+	}
+}
+
+// parseFrameHeader decodes the header after the first sync byte
+func (d *flacDecoder) parseFrameHeader() (flacFrame, bool) {
+	b := &d.bits
+	b.read(8)
+	sizeCode := b.read(4)
+	rateCode := b.read(4)
+	assignment := int(b.read(4))
+	depthCode := b.read(3)
+	reserved := b.read(1)
+	// The UTF-8 style coded frame or sample number
+	first := b.read(8)
+	for mask := uint64(0x40); first&0x80 != 0 && first&mask != 0; mask >>= 1 {
+		b.read(8)
+	}
+
+	frame := flacFrame{sampleRate: d.format.SampleRate, assignment: assignment}
+	switch {
+	case sizeCode == 1:
+		frame.blockSize = 192
+	case sizeCode >= 2 && sizeCode <= 5:
+		frame.blockSize = 576 << (sizeCode - 2)
+	case sizeCode == 6:
+		frame.blockSize = int(b.read(8)) + 1
+	case sizeCode == 7:
+		frame.blockSize = int(b.read(16)) + 1
+	case sizeCode >= 8:
+		frame.blockSize = 256 << (sizeCode - 8)
+	}
+	switch rateCode {
+	case 12:
+		frame.sampleRate = int(b.read(8)) * 1000
+	case 13:
+		frame.sampleRate = int(b.read(16))
+	case 14:
+		frame.sampleRate = int(b.read(16)) * 10
+	}
+	crc := b.crc8
+	if uint8(b.read(8)) != crc || b.err != nil || reserved != 0 || frame.blockSize == 0 || rateCode == 15 {
+		return flacFrame{}, false
+	}
+
+	switch {
+	case assignment < 8:
+		frame.channels = assignment + 1
+	case assignment <= 10:
+		frame.channels = 2
+	default:
+		return flacFrame{}, false
+	}
+	frame.bitDepth = [8]int{d.format.BitDepth, 8, 12, 0, 16, 20, 24, 32}[depthCode]
+	if frame.bitDepth == 0 || frame.channels != d.format.Channels {
+		return flacFrame{}, false
+	}
+	return frame, true
+}
+
+// decodeSubframe decodes one channel of a frame
+func (d *flacDecoder) decodeSubframe(samples []int64, depth int) error {
+	b := &d.bits
+	if b.read(1) != 0 {
+		return ErrCorrupt
+	}
+	kind := int(b.read(6))
+	wasted := 0
+	if b.read(1) == 1 {
+		wasted = int(b.unary()) + 1
+		depth -= wasted
+	}
+	if depth <= 0 {
+		return ErrCorrupt
+	}
+
+	switch {
+	case kind == 0:
+		value := b.readSigned(uint(depth))
+		for i := range samples {
+			samples[i] = value
+		}
+	case kind == 1:
+		for i := range samples {
+			samples[i] = b.readSigned(uint(depth))
+		}
+	case kind >= 8 && kind <= 12:
+		order := kind - 8
+		if order > len(samples) {
+			return ErrCorrupt
+		}
+		for i := 0; i < order; i++ {
+			samples[i] = b.readSigned(uint(depth))
+		}
+		if err := d.decodeResidual(samples, order); err != nil {
+			return err
+		}
+		fixedPrediction(samples, order)
+	case kind >= 32:
+		order := kind - 31
+		if order > len(samples) {
+			return ErrCorrupt
+		}
+		for i := 0; i < order; i++ {
+			samples[i] = b.readSigned(uint(depth))
+		}
+		precision := uint(b.read(4)) + 1
+		shift := b.readSigned(5)
+		if precision == 16 || shift < 0 {
+			return ErrCorrupt
+		}
+		coefficients := make([]int64, order)
+		for i := range coefficients {
+			coefficients[i] = b.readSigned(precision)
+		}
+		if err := d.decodeResidual(samples, order); err != nil {
+			return err
+		}
+		for i := order; i < len(samples); i++ {
+			var sum int64
+			for j, c := range coefficients {
+				sum += c * samples[i-j-1]
+			}
+			samples[i] += sum >> shift
+		}
+	default:
+		return ErrCorrupt
+	}
+	if b.err != nil {
+		return b.err
+	}
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= wasted
+		}
+	}
+	return nil
+}
+
+// decodeResidual reads the Rice coded prediction errors into samples[order:]
+func (d *flacDecoder) decodeResidual(samples []int64, order int) error {
+	b := &d.bits
+	method := b.read(2)
+	if method > 1 {
+		return ErrCorrupt
+	}
+	paramBits, escape := uint(4), uint64(15)
+	if method == 1 {
+		paramBits, escape = 5, 31
+	}
+	partitions := 1 << b.read(4)
+	size := len(samples) / partitions
+	if size*partitions != len(samples) || size < order {
+		return ErrCorrupt
+	}
+	i := order
+	for p := 0; p < partitions; p++ {
+		end := (p + 1) * size
+		param := b.read(paramBits)
+		if param == escape {
+			width := uint(b.read(5))
+			for ; i < end; i++ {
+				samples[i] = b.readSigned(width)
+			}
+			continue
+		}
+		k := uint(param)
+		for ; i < end; i++ {
+			value := b.unary()<<k | b.read(k)
+			samples[i] = int64(value>>1) ^ -int64(value&1)
+		}
+		if b.err != nil {
+			return b.err
+		}
+	}
+	return nil
+}
+
+// fixedPrediction adds the fixed polynomial predictions to the residuals
+func fixedPrediction(s []int64, order int) {
+	for i := order; i < len(s); i++ {
+		switch order {
+		case 1:
+			s[i] += s[i-1]
+		case 2:
+			s[i] += 2*s[i-1] - s[i-2]
+		case 3:
+			s[i] += 3*s[i-1] - 3*s[i-2] + s[i-3]
+		case 4:
+			s[i] += 4*s[i-1] - 6*s[i-2] + 4*s[i-3] - s[i-4]
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package audio
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// bitWriter writes big endian bit fields
+type bitWriter struct {
+	data []byte
+	n    uint
+}
+
+func (w *bitWriter) write(value uint64, count uint) {
+	for i := count; i > 0; i-- {
+		if w.n%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if value>>(i-1)&1 == 1 {
+			w.data[len(w.data)-1] |= 0x80 >> (w.n % 8)
+		}
+		w.n++
+	}
+}
+
+func (w *bitWriter) align() {
+	w.n += (8 - w.n%8) % 8
+}
+
+// testFLACBlock is the block size of the encoded frames
+const testFLACBlock = 1024
+
+// encodeTestFLAC encodes 16 bit samples as a FLAC stream. The frames use
+// every stereo decorrelation and alternate between verbatim and fixed
+// prediction subframes with Rice coded residuals. A seek table points at
+// the third frame.
+func encodeTestFLAC(samples []int32, channels int) []byte {
+	frames := len(samples) / channels
+	var encoded [][]byte
+	for start := 0; start < frames; start += testFLACBlock {
+		size := min(testFLACBlock, frames-start)
+		assignment := channels - 1
+		if channels == 2 {
+			assignment = []int{1, 8, 9, 10}[len(encoded)%4]
+		}
+		encoded = append(encoded, encodeTestFrame(samples[start*channels:(start+size)*channels], channels, len(encoded), assignment))
+	}
+
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint16(info[0:], testFLACBlock)
+	binary.BigEndian.PutUint16(info[2:], testFLACBlock)
+	binary.BigEndian.PutUint64(info[10:], 44100<<44|uint64(channels-1)<<41|15<<36|uint64(frames))
+	seek := binary.BigEndian.AppendUint64(nil, 2*testFLACBlock)
+	seek = binary.BigEndian.AppendUint64(seek, uint64(len(encoded[0])+len(encoded[1])))
+	seek = binary.BigEndian.AppendUint16(seek, testFLACBlock)
+	// A placeholder point follows
+	seek = binary.BigEndian.AppendUint64(seek, ^uint64(0))
+	seek = append(seek, make([]byte, 10)...)
+
+	out := []byte("fLaC")
+	out = append(out, flacStreamInfo, 0, 0, 34)
+	out = append(out, info...)
+	out = append(out, 0x80|flacSeekTable, 0, 0, byte(len(seek)))
+	out = append(out, seek...)
+	for _, frame := range encoded {
+		out = append(out, frame...)
+	}
+	return out
+}
+
+// encodeTestFrame encodes one frame with a fixed block size
+func encodeTestFrame(samples []int32, channels, number, assignment int) []byte {
+	size := len(samples) / channels
+	w := &bitWriter{}
+	w.write(0xfff8, 16)
+	sizeCode := uint64(10) // 1024
+	if size != testFLACBlock {
+		sizeCode = 7
+	}
+	w.write(sizeCode<<4, 8) // sample rate from STREAMINFO
+	w.write(uint64(assignment)<<4|4<<1, 8)
+	w.write(uint64(number), 8)
+	if sizeCode == 7 {
+		w.write(uint64(size-1), 16)
+	}
+	var crc8 uint8
+	for _, b := range w.data {
+		crc8 = crc8Table[crc8^b]
+	}
+	w.write(uint64(crc8), 8)
+
+	channel := func(ch int) []int64 {
+		out := make([]int64, size)
+		for i := range out {
+			out[i] = int64(samples[i*channels+ch])
+		}
+		return out
+	}
+	subframes := make([][]int64, channels)
+	for ch := range subframes {
+		subframes[ch] = channel(ch)
+	}
+	depths := []uint{16, 16}
+	if channels == 2 {
+		left, right := subframes[0], subframes[1]
+		side := make([]int64, size)
+		mid := make([]int64, size)
+		for i := range side {
+			side[i] = left[i] - right[i]
+			mid[i] = (left[i] + right[i]) >> 1
+		}
+		switch assignment {
+		case 8:
+			subframes[1], depths[1] = side, 17
+		case 9:
+			subframes[0], depths[0] = side, 17
+		case 10:
+			subframes[0], subframes[1], depths[1] = mid, side, 17
+		}
+	}
+	for ch, subframe := range subframes {
+		if (number+ch)%2 == 0 {
+			encodeVerbatim(w, subframe, depths[ch])
+		} else {
+			encodeFixed(w, subframe, depths[ch])
+		}
+	}
+	w.align()
+	var crc16 uint16
+	for _, b := range w.data {
+		crc16 = crc16<<8 ^ crc16Table[byte(crc16>>8)^b]
+	}
+	w.write(uint64(crc16), 16)
+	return w.data
+}
+
+func encodeVerbatim(w *bitWriter, samples []int64, depth uint) {
+	w.write(1<<1, 8)
+	for _, sample := range samples {
+		w.write(uint64(sample)&(1<<depth-1), depth)
+	}
+}
+
+// encodeFixed writes a second order fixed prediction subframe with one Rice
+// partition
+func encodeFixed(w *bitWriter, samples []int64, depth uint) {
+	const order = 2
+	w.write(uint64(8+order)<<1, 8)
+	for _, sample := range samples[:order] {
+		w.write(uint64(sample)&(1<<depth-1), depth)
+	}
+	const k = 9
+	w.write(0, 2) // 4 bit Rice parameters
+	w.write(0, 4) // one partition
+	w.write(k, 4)
+	for i := order; i < len(samples); i++ {
+		residual := samples[i] - (2*samples[i-1] - samples[i-2])
+		value := uint64(residual<<1) ^ uint64(residual>>63)
+		for q := value >> k; q > 0; q-- {
+			w.write(0, 1)
+		}
+		w.write(1, 1)
+		w.write(value&(1<<k-1), k)
+	}
+}
+
+func TestDecodeFLAC(t *testing.T) {
+	const frames = 4500
+	for _, channels := range []int{1, 2} {
+		signal := testSignal(frames, channels, 1<<15)
+		path := writeTestFile(t, "test.flac", encodeTestFLAC(signal, channels))
+		want := Format{SampleRate: 44100, Channels: channels, BitDepth: 16, Frames: frames}
+		checkDecoder(t, path, want, scaled(signal, 1<<15))
+	}
+}
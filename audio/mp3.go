@@ -0,0 +1,143 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/ilmarkerm/djlibgo/audioformat"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// mp3DecoderDelay is the delay of the MP3 synthesis filter bank in frames
+const mp3DecoderDelay = 529
+
+// mp3SeekPreroll is decoded and dropped before a seek target, so the bit
+// reservoir and filter bank are in the same state as without seeking
+const mp3SeekPreroll = 4 * 1152
+
+// mp3Decoder wraps go-mp3, which always produces 16 bit stereo. The encoder
+// delay and padding from a LAME header are removed for gapless playback.
+type mp3Decoder struct {
+	file     *os.File
+	dec      *mp3.Decoder
+	format   Format
+	start    int64
+	position int64
+	buf      []byte
+}
+
+func openMP3(path string) (Decoder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := newMP3Decoder(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return dec, nil
+}
+
+func newMP3Decoder(file *os.File) (*mp3Decoder, error) {
+	start, padding := mp3Gapless(file)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	dec, err := mp3.NewDecoder(file)
+	if err != nil {
+		return nil, err
+	}
+	total := dec.Length() / 4
+	if start+padding >= total {
+		start, padding = 0, 0
+	}
+	d := &mp3Decoder{
+		file:   file,
+		dec:    dec,
+		format: Format{SampleRate: dec.SampleRate(), Channels: 2, Frames: total - start - padding},
+		start:  start,
+	}
+	return d, d.SeekFrame(0)
+}
+
+func (d *mp3Decoder) Format() Format { return d.format }
+
+func (d *mp3Decoder) Close() error { return d.file.Close() }
+
+func (d *mp3Decoder) SeekFrame(frame int64) error {
+	if frame < 0 {
+		return errors.New("negative seek position")
+	}
+	d.position = min(frame, d.format.Frames)
+	if d.position == d.format.Frames {
+		return nil
+	}
+	target := d.start + d.position
+	from := max(target-mp3SeekPreroll, 0)
+	if _, err := d.dec.Seek(from*4, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.CopyN(io.Discard, d.dec, (target-from)*4)
+	return err
+}
+
+func (d *mp3Decoder) Read(samples []float32) (int, error) {
+	frames := min(int64(len(samples)/2), d.format.Frames-d.position)
+	if frames <= 0 {
+		if len(samples) < 2 {
+			return 0, errors.New("buffer smaller than one frame")
+		}
+		return 0, io.EOF
+	}
+	size := int(frames * 4)
+	if cap(d.buf) < size {
+		d.buf = make([]byte, size)
+	}
+	n, err := io.ReadFull(d.dec, d.buf[:size])
+	if n < size {
+		// Fewer frames than counted, the last frame was cut off
+		d.format.Frames = d.position + int64(n/4)
+		if n < 4 {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return 0, err
+		}
+	}
+	count := n / 4 * 2
+	for i := 0; i < count; i++ {
+		samples[i] = float32(int16(binary.LittleEndian.Uint16(d.buf[i*2:]))) / 32768
+	}
+	d.position += int64(n / 4)
+	return n / 4, nil
+}
+
+// mp3Gapless reads the frames to drop at the start and end from the Xing and
+// LAME headers of the first frame. The Xing frame itself decodes to silence.
+func mp3Gapless(file *os.File) (start, padding int64) {
+	offset := id3Length(file)
+	data := make([]byte, 4096)
+	n, _ := file.ReadAt(data, offset)
+	data = data[:n]
+	for i := 0; i+4 <= len(data); i++ {
+		header, ok := audioformat.ParseFrameHeader(data[i:])
+		if !ok {
+			continue
+		}
+		info, ok := audioformat.ParseInfoFrame(data[i:], header)
+		if !ok || info.VBRI {
+			return 0, 0
+		}
+		start = int64(header.SamplesPerFrame())
+		if info.Delay < 0 {
+			return start, 0
+		}
+		start += info.Delay + mp3DecoderDelay
+		return start, max(info.Padding-mp3DecoderDelay, 0)
+	}
+	return 0, 0
+}
@@ -0,0 +1,252 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+// mp4Box is an MP4 box. Offset is the position of the box content.
+type mp4Box struct {
+	kind   string
+	offset int64
+	size   int64
+}
+
+// mp4Track is the sample table of the first sound track
+type mp4Track struct {
+	codec string
+	// entry is the sample description after the box header
+	entry []byte
+	// samples are the offsets and sizes of the coded packets
+	offsets []int64
+	sizes   []int64
+	// frames is the decoded length from the time-to-sample table
+	frames    int64
+	timescale int64
+}
+
+// readMP4Boxes lists the boxes between start and end
+func readMP4Boxes(file *os.File, start, end int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	header := make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		if _, err := file.ReadAt(header[:8], offset); err != nil {
+			return boxes, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if _, err := file.ReadAt(header[8:16], offset+8); err != nil {
+				return boxes, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize || offset+size > end {
+			return boxes, errors.New("invalid MP4 box size")
+		}
+		boxes = append(boxes, mp4Box{kind: string(header[4:8]), offset: offset + headerSize, size: size - headerSize})
+		offset += size
+	}
+	return boxes, nil
+}
+
+// findMP4Box returns the first box of the given kind
+func findMP4Box(boxes []mp4Box, kind string) (mp4Box, bool) {
+	for _, box := range boxes {
+		if box.kind == kind {
+			return box, true
+		}
+	}
+	return mp4Box{}, false
+}
+
+// readBox returns the content of a box
+func readBox(file *os.File, box mp4Box) ([]byte, error) {
+	if box.size > 64<<20 {
+		return nil, errors.New("MP4 box too large")
+	}
+	data := make([]byte, box.size)
+	_, err := file.ReadAt(data, box.offset)
+	return data, err
+}
+
+// readMP4Track finds the first sound track and reads its sample table
+func readMP4Track(file *os.File) (*mp4Track, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	top, err := readMP4Boxes(file, 0, info.Size())
+	moov, ok := findMP4Box(top, "moov")
+	if !ok {
+		if err == nil {
+			err = ErrUnsupported
+		}
+		return nil, err
+	}
+	traks, err := readMP4Boxes(file, moov.offset, moov.offset+moov.size)
+	if err != nil {
+		return nil, err
+	}
+	for _, trak := range traks {
+		if trak.kind != "trak" {
+			continue
+		}
+		mdia, ok := childBox(file, trak, "mdia")
+		if !ok {
+			continue
+		}
+		hdlr, ok := childBox(file, mdia, "hdlr")
+		if !ok {
+			continue
+		}
+		if data, err := readBox(file, hdlr); err != nil || len(data) < 12 || string(data[8:12]) != "soun" {
+			continue
+		}
+		return readSampleTable(file, mdia)
+	}
+	return nil, errors.New("no sound track found")
+}
+
+// childBox returns the first child box of the given kind
+func childBox(file *os.File, parent mp4Box, kind string) (mp4Box, bool) {
+	children, _ := readMP4Boxes(file, parent.offset, parent.offset+parent.size)
+	return findMP4Box(children, kind)
+}
+
+// readSampleTable reads the codec and packet positions of a media box
+func readSampleTable(file *os.File, mdia mp4Box) (*mp4Track, error) {
+	track := &mp4Track{}
+	if mdhd, ok := childBox(file, mdia, "mdhd"); ok {
+		if data, err := readBox(file, mdhd); err == nil && len(data) >= 24 {
+			if data[0] == 1 && len(data) >= 32 {
+				track.timescale = int64(binary.BigEndian.Uint32(data[20:24]))
+			} else {
+				track.timescale = int64(binary.BigEndian.Uint32(data[12:16]))
+			}
+		}
+	}
+	minf, ok := childBox(file, mdia, "minf")
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	stbl, ok := childBox(file, minf, "stbl")
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	boxes, err := readMP4Boxes(file, stbl.offset, stbl.offset+stbl.size)
+	if err != nil {
+		return nil, err
+	}
+	table := make(map[string][]byte)
+	for _, box := range boxes {
+		data, err := readBox(file, box)
+		if err != nil {
+			return nil, err
+		}
+		table[box.kind] = data
+	}
+
+	// The first sample description, after version, flags and entry count
+	stsd := table["stsd"]
+	if len(stsd) < 16 {
+		return nil, ErrUnsupported
+	}
+	entrySize := int(binary.BigEndian.Uint32(stsd[8:12]))
+	if entrySize < 8 || 8+entrySize > len(stsd) {
+		return nil, ErrUnsupported
+	}
+	track.codec = string(stsd[12:16])
+	track.entry = stsd[16 : 8+entrySize]
+
+	stsz := table["stsz"]
+	if len(stsz) < 12 {
+		return nil, errors.New("missing MP4 sample sizes")
+	}
+	fixed := int64(binary.BigEndian.Uint32(stsz[4:8]))
+	count := int(binary.BigEndian.Uint32(stsz[8:12]))
+	if fixed == 0 && 12+count*4 > len(stsz) {
+		return nil, errors.New("invalid MP4 sample sizes")
+	}
+	track.sizes = make([]int64, count)
+	for i := range track.sizes {
+		if fixed != 0 {
+			track.sizes[i] = fixed
+		} else {
+			track.sizes[i] = int64(binary.BigEndian.Uint32(stsz[12+i*4:]))
+		}
+	}
+
+	var chunks []int64
+	if stco := table["stco"]; len(stco) >= 8 {
+		n := int(binary.BigEndian.Uint32(stco[4:8]))
+		for i := 0; i < n && 8+i*4+4 <= len(stco); i++ {
+			chunks = append(chunks, int64(binary.BigEndian.Uint32(stco[8+i*4:])))
+		}
+	} else if co64 := table["co64"]; len(co64) >= 8 {
+		n := int(binary.BigEndian.Uint32(co64[4:8]))
+		for i := 0; i < n && 8+i*8+8 <= len(co64); i++ {
+			chunks = append(chunks, int64(binary.BigEndian.Uint64(co64[8+i*8:])))
+		}
+	}
+
+	// Sample to chunk runs: first chunk (from 1) and samples per chunk
+	stsc := table["stsc"]
+	if len(stsc) < 8 {
+		return nil, errors.New("missing MP4 sample to chunk table")
+	}
+	runs := int(binary.BigEndian.Uint32(stsc[4:8]))
+	sample := 0
+	for r := 0; r < runs && 8+r*12+12 <= len(stsc); r++ {
+		first := int(binary.BigEndian.Uint32(stsc[8+r*12:])) - 1
+		perChunk := int(binary.BigEndian.Uint32(stsc[8+r*12+4:]))
+		last := len(chunks)
+		if r+1 < runs && 8+(r+1)*12+4 <= len(stsc) {
+			last = int(binary.BigEndian.Uint32(stsc[8+(r+1)*12:])) - 1
+		}
+		for c := max(first, 0); c < last && c < len(chunks); c++ {
+			offset := chunks[c]
+			for i := 0; i < perChunk && sample < count; i++ {
+				track.offsets = append(track.offsets, offset)
+				offset += track.sizes[sample]
+				sample++
+			}
+		}
+	}
+	track.sizes = track.sizes[:len(track.offsets)]
+
+	if stts := table["stts"]; len(stts) >= 8 {
+		n := int(binary.BigEndian.Uint32(stts[4:8]))
+		for i := 0; i < n && 8+i*8+8 <= len(stts); i++ {
+			track.frames += int64(binary.BigEndian.Uint32(stts[8+i*8:])) * int64(binary.BigEndian.Uint32(stts[12+i*8:]))
+		}
+	}
+	return track, nil
+}
+
+// openMP4 decodes the sound track of an MP4 file. Only ALAC is supported.
+func openMP4(path string) (Decoder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	track, err := readMP4Track(file)
+	if err == nil && track.codec != "alac" {
+		err = ErrUnsupported
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	dec, err := newALACDecoder(file, track)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return dec, nil
+}
@@ -0,0 +1,256 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+
+	"github.com/ilmarkerm/djlibgo/audioformat"
+)
+
+// WAV format tags
+const (
+	wavPCM        = 1
+	wavFloat      = 3
+	wavExtensible = 0xfffe
+)
+
+// pcmDecoder reads uncompressed samples from WAV and AIFF files
+type pcmDecoder struct {
+	file   *os.File
+	format Format
+	order  binary.ByteOrder
+	// width is the size of one sample in bytes
+	width    int
+	float    bool
+	unsigned bool
+	data     int64
+	position int64
+	buf      []byte
+}
+
+func (d *pcmDecoder) Format() Format { return d.format }
+
+func (d *pcmDecoder) Close() error { return d.file.Close() }
+
+func (d *pcmDecoder) SeekFrame(frame int64) error {
+	if frame < 0 {
+		return errors.New("negative seek position")
+	}
+	d.position = min(frame, d.format.Frames)
+	return nil
+}
+
+func (d *pcmDecoder) Read(samples []float32) (int, error) {
+	channels := d.format.Channels
+	frames := min(int64(len(samples)/channels), d.format.Frames-d.position)
+	if frames <= 0 {
+		if len(samples) < channels {
+			return 0, errors.New("buffer smaller than one frame")
+		}
+		return 0, io.EOF
+	}
+	frameSize := int64(channels * d.width)
+	size := int(frames * frameSize)
+	if cap(d.buf) < size {
+		d.buf = make([]byte, size)
+	}
+	buf := d.buf[:size]
+	n, err := d.file.ReadAt(buf, d.data+d.position*frameSize)
+	if n < size {
+		// The data chunk claims more than the file holds
+		frames = int64(n) / frameSize
+		d.format.Frames = d.position + frames
+		if frames == 0 {
+			if err == nil || err == io.EOF {
+				err = io.EOF
+			}
+			return 0, err
+		}
+	}
+	count := int(frames) * channels
+	for i := 0; i < count; i++ {
+		samples[i] = d.sample(buf[i*d.width:])
+	}
+	d.position += frames
+	return int(frames), nil
+}
+
+// sample converts one sample to -1..1
+func (d *pcmDecoder) sample(b []byte) float32 {
+	if d.float {
+		if d.width == 8 {
+			return float32(math.Float64frombits(d.order.Uint64(b)))
+		}
+		return math.Float32frombits(d.order.Uint32(b))
+	}
+	var value int32
+	switch d.width {
+	case 1:
+		if d.unsigned {
+			return float32(int(b[0])-128) / 128
+		}
+		return float32(int8(b[0])) / 128
+	case 2:
+		return float32(int16(d.order.Uint16(b))) / 32768
+	case 3:
+		if d.order == binary.LittleEndian {
+			value = int32(uint32(b[0])<<8 | uint32(b[1])<<16 | uint32(b[2])<<24)
+		} else {
+			value = int32(uint32(b[2])<<8 | uint32(b[1])<<16 | uint32(b[0])<<24)
+		}
+	default:
+		value = int32(d.order.Uint32(b))
+	}
+	return float32(float64(value) / (1 << 31))
+}
+
+// readChunks lists the top level chunks of a WAV or AIFF file, which must
+// have one of the given form types
+func readChunks(file *os.File, types ...string) ([]audioformat.Chunk, string, error) {
+	form, chunks, err := audioformat.ReadChunks(file)
+	if errors.Is(err, audioformat.ErrNoForm) {
+		return nil, "", ErrUnsupported
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	for _, t := range types {
+		if form.Type == t {
+			return chunks, form.Type, nil
+		}
+	}
+	return nil, "", ErrUnsupported
+}
+
+// openWAV reads the fmt chunk and locates the samples of a WAV file
+func openWAV(path string) (Decoder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := newWAVDecoder(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return dec, nil
+}
+
+func newWAVDecoder(file *os.File) (*pcmDecoder, error) {
+	chunks, _, err := readChunks(file, "WAVE")
+	if err != nil {
+		return nil, err
+	}
+	dec := &pcmDecoder{file: file, order: binary.LittleEndian, data: -1}
+	var tag uint16
+	var dataSize int64
+	for _, c := range chunks {
+		switch {
+		case c.ID == "fmt " && c.Size >= 16:
+			data := make([]byte, min(c.Size, 40))
+			if _, err := file.ReadAt(data, c.Offset); err != nil {
+				return nil, err
+			}
+			tag = binary.LittleEndian.Uint16(data[0:2])
+			if tag == wavExtensible && len(data) >= 26 {
+				// The sub format GUID starts with the format tag
+				tag = binary.LittleEndian.Uint16(data[24:26])
+			}
+			dec.format.Channels = int(binary.LittleEndian.Uint16(data[2:4]))
+			dec.format.SampleRate = int(binary.LittleEndian.Uint32(data[4:8]))
+			dec.format.BitDepth = int(binary.LittleEndian.Uint16(data[14:16]))
+			if dec.format.Channels > 0 {
+				dec.width = int(binary.LittleEndian.Uint16(data[12:14])) / dec.format.Channels
+			}
+		case c.ID == "data" && dec.data < 0:
+			dec.data = c.Offset
+			dataSize = c.Size
+		}
+	}
+	switch {
+	case tag == 0 || dec.data < 0:
+		return nil, errors.New("missing WAV fmt or data chunk")
+	case tag == wavPCM && dec.width >= 1 && dec.width <= 4:
+		dec.unsigned = dec.width == 1
+	case tag == wavFloat && (dec.width == 4 || dec.width == 8):
+		dec.float = true
+	default:
+		return nil, ErrUnsupported
+	}
+	if dec.format.Channels == 0 || dec.format.SampleRate == 0 {
+		return nil, errors.New("invalid WAV format")
+	}
+	dec.format.Frames = dataSize / int64(dec.width*dec.format.Channels)
+	return dec, nil
+}
+
+// openAIFF reads the COMM chunk and locates the samples of an AIFF or AIFC file
+func openAIFF(path string) (Decoder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := newAIFFDecoder(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return dec, nil
+}
+
+func newAIFFDecoder(file *os.File) (*pcmDecoder, error) {
+	chunks, kind, err := readChunks(file, "AIFF", "AIFC")
+	if err != nil {
+		return nil, err
+	}
+	dec := &pcmDecoder{file: file, order: binary.BigEndian, data: -1}
+	compression := "NONE"
+	for _, c := range chunks {
+		switch {
+		case c.ID == "COMM" && c.Size >= 18:
+			data := make([]byte, min(c.Size, 22))
+			if _, err := file.ReadAt(data, c.Offset); err != nil {
+				return nil, err
+			}
+			dec.format.Channels = int(binary.BigEndian.Uint16(data[0:2]))
+			dec.format.Frames = int64(binary.BigEndian.Uint32(data[2:6]))
+			dec.format.BitDepth = int(binary.BigEndian.Uint16(data[6:8]))
+			dec.format.SampleRate = int(audioformat.ExtendedFloat(data[8:18]))
+			if kind == "AIFC" && len(data) >= 22 {
+				compression = string(data[18:22])
+			}
+		case c.ID == "SSND" && c.Size >= 8:
+			// The sound data starts after an offset and block size
+			data := make([]byte, 4)
+			if _, err := file.ReadAt(data, c.Offset); err != nil {
+				return nil, err
+			}
+			dec.data = c.Offset + 8 + int64(binary.BigEndian.Uint32(data))
+		}
+	}
+	if dec.format.Channels == 0 || dec.format.SampleRate == 0 || dec.data < 0 {
+		return nil, errors.New("missing AIFF COMM or SSND chunk")
+	}
+	dec.width = (dec.format.BitDepth + 7) / 8
+	switch compression {
+	case "NONE", "twos":
+	case "sowt":
+		dec.order = binary.LittleEndian
+	case "fl32", "FL32":
+		dec.float, dec.width = true, 4
+	case "fl64", "FL64":
+		dec.float, dec.width = true, 8
+	default:
+		return nil, ErrUnsupported
+	}
+	if dec.width < 1 || dec.width > 8 || (!dec.float && dec.width > 4) {
+		return nil, ErrUnsupported
+	}
+	if dec.float {
+		dec.format.BitDepth = dec.width * 8
+	}
+	return dec, nil
+}
@@ -0,0 +1,71 @@
+package audio
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// testChunk encodes a chunk with its padding byte
+func testChunk(order binary.AppendByteOrder, id string, data []byte) []byte {
+	out := order.AppendUint32([]byte(id), uint32(len(data)))
+	out = append(out, data...)
+	if len(data)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+// testForm wraps chunks into a RIFF or IFF file
+func testForm(magic, formType string, order binary.AppendByteOrder, chunks ...[]byte) []byte {
+	body := []byte(formType)
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	out := order.AppendUint32([]byte(magic), uint32(len(body)))
+	return append(out, body...)
+}
+
+func TestDecodeWAV(t *testing.T) {
+	const frames, channels = 2500, 2
+	signal := testSignal(frames, channels, 1<<15)
+	format := binary.LittleEndian.AppendUint16(nil, wavPCM)
+	format = binary.LittleEndian.AppendUint16(format, channels)
+	format = binary.LittleEndian.AppendUint32(format, 44100)
+	format = binary.LittleEndian.AppendUint32(format, 44100*channels*2)
+	format = binary.LittleEndian.AppendUint16(format, channels*2)
+	format = binary.LittleEndian.AppendUint16(format, 16)
+	var data []byte
+	for _, sample := range signal {
+		data = binary.LittleEndian.AppendUint16(data, uint16(int16(sample)))
+	}
+	// A chunk before the samples must be skipped
+	path := writeTestFile(t, "test.wav", testForm("RIFF", "WAVE", binary.LittleEndian,
+		testChunk(binary.LittleEndian, "fmt ", format),
+		testChunk(binary.LittleEndian, "LIST", []byte("INFOodd")),
+		testChunk(binary.LittleEndian, "data", data)))
+
+	want := Format{SampleRate: 44100, Channels: channels, BitDepth: 16, Frames: frames}
+	checkDecoder(t, path, want, scaled(signal, 1<<15))
+}
+
+func TestDecodeAIFF(t *testing.T) {
+	const frames = 2500
+	signal := testSignal(frames, 1, 1<<23)
+	common := binary.BigEndian.AppendUint16(nil, 1)
+	common = binary.BigEndian.AppendUint32(common, frames)
+	common = binary.BigEndian.AppendUint16(common, 24)
+	// 48000 as an 80 bit extended float
+	common = append(common, 0x40, 0x0e, 0xbb, 0x80, 0, 0, 0, 0, 0, 0)
+	// The sound data starts after an offset of 4 bytes
+	data := make([]byte, 12)
+	binary.BigEndian.PutUint32(data, 4)
+	for _, sample := range signal {
+		data = append(data, byte(sample>>16), byte(sample>>8), byte(sample))
+	}
+	path := writeTestFile(t, "test.aiff", testForm("FORM", "AIFF", binary.BigEndian,
+		testChunk(binary.BigEndian, "COMM", common),
+		testChunk(binary.BigEndian, "SSND", data)))
+
+	want := Format{SampleRate: 48000, Channels: 1, BitDepth: 24, Frames: frames}
+	checkDecoder(t, path, want, scaled(signal, 1<<23))
+}
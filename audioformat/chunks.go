@@ -0,0 +1,91 @@
+// Package audioformat reads the parts of audio files that the tag reader, the
+// decoders and the waveform code all need: the chunks of WAV and AIFF files
+// and the frame headers at the start of MP3 files
+package audioformat
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+// ErrNoForm is returned for files that are neither RIFF WAVE nor IFF AIFF
+var ErrNoForm = errors.New("not a WAV or AIFF file")
+
+// Form is the header of a WAV (little endian RIFF) or AIFF (big endian IFF)
+// file. Type is "WAVE", "AIFF" or "AIFC".
+type Form struct {
+	Order binary.ByteOrder
+	Type  string
+}
+
+// Chunk is a RIFF or IFF chunk. Offset is the position of the chunk data.
+type Chunk struct {
+	ID     string
+	Offset int64
+	Size   int64
+}
+
+// ReadForm reads the file header of a WAV or AIFF file
+func ReadForm(file io.ReaderAt) (Form, error) {
+	header := make([]byte, 12)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		if err == io.EOF {
+			return Form{}, ErrNoForm
+		}
+		return Form{}, err
+	}
+	kind := string(header[8:12])
+	switch {
+	case string(header[:4]) == "RIFF" && kind == "WAVE":
+		return Form{Order: binary.LittleEndian, Type: kind}, nil
+	case string(header[:4]) == "FORM" && (kind == "AIFF" || kind == "AIFC"):
+		return Form{Order: binary.BigEndian, Type: kind}, nil
+	}
+	return Form{}, ErrNoForm
+}
+
+// ReadChunks reads the file header and lists the top level chunks of a WAV
+// or AIFF file
+func ReadChunks(file *os.File) (Form, []Chunk, error) {
+	form, err := ReadForm(file)
+	if err != nil {
+		return Form{}, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return Form{}, nil, err
+	}
+	var chunks []Chunk
+	offset := int64(12)
+	header := make([]byte, 8)
+	for offset+8 <= info.Size() {
+		if _, err := file.ReadAt(header, offset); err != nil {
+			return Form{}, nil, err
+		}
+		size := int64(form.Order.Uint32(header[4:8]))
+		// Streamed files leave the size open, the data then runs to the end
+		size = min(size, info.Size()-offset-8)
+		chunks = append(chunks, Chunk{ID: string(header[:4]), Offset: offset + 8, Size: size})
+		// Chunks are padded to an even size
+		offset += 8 + size + size%2
+	}
+	return form, chunks, nil
+}
+
+// ExtendedFloat decodes the 80 bit IEEE 754 extended precision number AIFF
+// uses for the sample rate
+func ExtendedFloat(b []byte) float64 {
+	exponent := int(binary.BigEndian.Uint16(b[0:2]) & 0x7fff)
+	mantissa := binary.BigEndian.Uint64(b[2:10])
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+	value := math.Ldexp(float64(mantissa), exponent-16383-63)
+	if b[0]&0x80 != 0 {
+		value = -value
+	}
+	return value
+}
@@ -0,0 +1,129 @@
+package audioformat
+
+import "encoding/binary"
+
+// sampleRates holds the sample rates by MPEG version bits and rate index
+var sampleRates = map[byte][3]int{
+	3: {44100, 48000, 32000}, // MPEG 1
+	2: {22050, 24000, 16000}, // MPEG 2
+	0: {11025, 12000, 8000},  // MPEG 2.5
+}
+
+// bitrates holds the bitrates in kbit/s by table and bitrate index.
+// Tables are MPEG 1 layer 1, 2 and 3 followed by MPEG 2 layer 1 and layers 2/3.
+var bitrates = [5][15]int{
+	{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+// FrameHeader is the decoded header of an MPEG audio frame
+type FrameHeader struct {
+	Version    byte // 3 is MPEG 1, 2 is MPEG 2, 0 is MPEG 2.5
+	Layer      int
+	Bitrate    int // bit/s
+	SampleRate int
+	Mono       bool
+}
+
+// ParseFrameHeader decodes the four byte header at the start of b
+func ParseFrameHeader(b []byte) (FrameHeader, bool) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return FrameHeader{}, false
+	}
+	header := FrameHeader{
+		Version: (b[1] >> 3) & 0x03,
+		Layer:   4 - int((b[1]>>1)&0x03),
+		Mono:    b[3]>>6 == 3,
+	}
+	rates, valid := sampleRates[header.Version]
+	rateIndex := (b[2] >> 2) & 0x03
+	bitrateIndex := b[2] >> 4
+	if !valid || header.Layer == 4 || rateIndex == 3 || bitrateIndex == 0 || bitrateIndex == 15 {
+		return FrameHeader{}, false
+	}
+	table := header.Layer - 1
+	if header.Version != 3 {
+		table = min(header.Layer+2, 4)
+	}
+	header.Bitrate = bitrates[table][bitrateIndex] * 1000
+	header.SampleRate = rates[rateIndex]
+	return header, true
+}
+
+// SamplesPerFrame returns the number of samples each frame decodes to
+func (h FrameHeader) SamplesPerFrame() int {
+	switch {
+	case h.Layer == 1:
+		return 384
+	case h.Layer == 3 && h.Version != 3:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+// sideInfoSize returns the size of the layer 3 side information that follows
+// the frame header
+func (h FrameHeader) sideInfoSize() int {
+	switch {
+	case h.Version == 3 && h.Mono:
+		return 17
+	case h.Version != 3 && !h.Mono:
+		return 17
+	case h.Version != 3:
+		return 9
+	}
+	return 32
+}
+
+// InfoFrame is the Xing, Info or VBRI header encoders write into the first
+// frame of an MP3. The frame itself decodes to silence.
+type InfoFrame struct {
+	// VBRI is set for Fraunhofer VBRI headers, Xing and Info headers leave it unset
+	VBRI bool
+	// Frames is the number of audio frames, -1 when the header leaves it out
+	Frames int64
+	// Delay and Padding are the encoder delay and padding in samples from a
+	// LAME header, -1 without one
+	Delay   int64
+	Padding int64
+}
+
+// ParseInfoFrame reads the info header of the frame at the start of b
+func ParseInfoFrame(b []byte, header FrameHeader) (InfoFrame, bool) {
+	info := InfoFrame{Frames: -1, Delay: -1, Padding: -1}
+	// The Xing header follows the side information
+	xing := 4 + header.sideInfoSize()
+	if len(b) >= xing+8 && (string(b[xing:xing+4]) == "Xing" || string(b[xing:xing+4]) == "Info") {
+		flags := binary.BigEndian.Uint32(b[xing+4:])
+		lame := xing + 8
+		if flags&1 != 0 && len(b) >= lame+4 {
+			info.Frames = int64(binary.BigEndian.Uint32(b[lame:]))
+		}
+		// Frame count, byte count, seek table and quality come before the LAME header
+		for bit, size := range []int{4, 4, 100, 4} {
+			if flags&(1<<bit) != 0 {
+				lame += size
+			}
+		}
+		if len(b) >= lame+24 {
+			switch string(b[lame : lame+4]) {
+			case "LAME", "Lavf", "Lavc":
+				// 12 bits each of encoder delay and padding
+				info.Delay = int64(b[lame+21])<<4 | int64(b[lame+22])>>4
+				info.Padding = int64(b[lame+22]&0x0f)<<8 | int64(b[lame+23])
+			}
+		}
+		return info, true
+	}
+	// VBRI sits at a fixed place after 32 bytes of side information
+	if len(b) >= 36+18 && string(b[36:40]) == "VBRI" {
+		info.VBRI = true
+		info.Frames = int64(binary.BigEndian.Uint32(b[36+14:]))
+		return info, true
+	}
+	return InfoFrame{}, false
+}
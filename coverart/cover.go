@@ -0,0 +1,111 @@
+package coverart
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/tags"
+)
+
+// ErrNoCover is returned when no cover art is found for a track
+var ErrNoCover = errors.New("no cover art found")
+
+// errCacheFormat is returned for Traktor cache files without an image we can decode
+var errCacheFormat = errors.New("no JPEG or PNG image in cover art cache file")
+
+// imageSignatures start the JPEG and PNG streams looked for in cache files
+var imageSignatures = [][]byte{{0xff, 0xd8, 0xff}, []byte("\x89PNG\r\n\x1a\n")}
+
+// folderImages are the image names looked for next to audio files, in order
+var folderImages = []string{"folder.jpg", "cover.jpg", "front.jpg", "albumart.jpg", "folder.png", "cover.png", "front.png"}
+
+// Source tells where to look for the cover of a track
+type Source struct {
+	// CoverArtFile is the cover in Traktor's cache, tried first
+	CoverArtFile string
+	// AudioFile is read for embedded pictures, and its folder for cover images
+	AudioFile string
+}
+
+// Load finds and decodes the cover: Traktor's cached cover, then the picture
+// embedded in the audio file, then a folder.jpg or similar image next to it
+func Load(source Source) (image.Image, error) {
+	if source.CoverArtFile != "" {
+		if img, err := decodeCacheFile(source.CoverArtFile); err == nil {
+			return img, nil
+		}
+	}
+	if source.AudioFile == "" {
+		return nil, ErrNoCover
+	}
+	if picture, err := tags.ReadPicture(source.AudioFile); err == nil {
+		if img, _, err := image.Decode(bytes.NewReader(picture.Data)); err == nil {
+			return img, nil
+		}
+	}
+	if path := findFolderImage(filepath.Dir(source.AudioFile)); path != "" {
+		if img, err := decodeFile(path); err == nil {
+			return img, nil
+		}
+	}
+	return nil, ErrNoCover
+}
+
+// findFolderImage returns the first of folderImages in dir, ignoring case
+func findFolderImage(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	names := make(map[string]string)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names[strings.ToLower(entry.Name())] = entry.Name()
+		}
+	}
+	for _, name := range folderImages {
+		if actual, exists := names[name]; exists {
+			return filepath.Join(dir, actual)
+		}
+	}
+	return ""
+}
+
+func decodeFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// decodeCacheFile decodes a file of Traktor's cover art cache. The format is
+// not documented: plain images decode as they are, and files with a header
+// before a JPEG or PNG stream are decoded from the start of the stream.
+// Anything else fails, and Load goes on to the other sources.
+func decodeCacheFile(path string) (image.Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+		return img, nil
+	}
+	for _, signature := range imageSignatures {
+		if i := bytes.Index(data, signature); i > 0 {
+			if img, _, err := image.Decode(bytes.NewReader(data[i:])); err == nil {
+				return img, nil
+			}
+		}
+	}
+	return nil, errCacheFormat
+}
@@ -0,0 +1,132 @@
+package coverart
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ilmarkerm/djlibgo/fileutil"
+)
+
+// Thumbnail sizes used by the GUI
+const (
+	SizeRow     = 32
+	SizeDetails = 256
+)
+
+// Cache stores scaled covers as JPEG files, so each cover is only decoded
+// once. Covers that were not found are remembered for the session.
+type Cache struct {
+	dir     string
+	mu      sync.Mutex
+	missing map[string]bool
+}
+
+// NewCache returns a cache that keeps its thumbnails in dir
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir, missing: make(map[string]bool)}
+}
+
+// DefaultCache returns a cache in the user's cache folder
+func DefaultCache() *Cache {
+	return NewCache(fileutil.CachePath("covers"))
+}
+
+// Thumbnail returns the path of a JPEG of the cover scaled to fit size x size
+// pixels, creating it when needed. ErrNoCover is returned for tracks without
+// cover art. Thumbnails of earlier versions of the cover are removed.
+func (c *Cache) Thumbnail(source Source, size int) (string, error) {
+	item, version := cacheKey(source)
+	key := item + "-" + version
+	path := filepath.Join(c.dir, item[:2], fmt.Sprintf("%s-%d.jpg", key, size))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	c.mu.Lock()
+	missing := c.missing[key]
+	c.mu.Unlock()
+	if missing {
+		return "", ErrNoCover
+	}
+
+	img, err := Load(source)
+	if err != nil {
+		c.mu.Lock()
+		c.missing[key] = true
+		c.mu.Unlock()
+		return "", err
+	}
+	err = fileutil.WriteAtomic(path, func(w io.Writer) error {
+		return jpeg.Encode(w, scale(img, size), &jpeg.Options{Quality: 85})
+	})
+	if err != nil {
+		return "", err
+	}
+	// All sizes of the current version are kept
+	fileutil.PruneCache(filepath.Dir(path), item+"-", key+"-")
+	return path, nil
+}
+
+// cacheKey identifies a cover by its source paths, and its version by their
+// modification times, so retagged files and new Traktor covers get new
+// thumbnails
+func cacheKey(source Source) (string, string) {
+	item := sha1.New()
+	version := sha1.New()
+	for _, path := range []string{source.CoverArtFile, source.AudioFile} {
+		fmt.Fprintf(item, "%s\x00", path)
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(version, "%d", info.ModTime().UnixNano())
+		}
+		fmt.Fprint(version, "\x00")
+	}
+	return hex.EncodeToString(item.Sum(nil)), hex.EncodeToString(version.Sum(nil))
+}
+
+// scale shrinks the image to fit into size x size pixels, averaging the
+// source pixels that fall on each target pixel. Smaller images are kept.
+func scale(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return src
+	}
+	targetWidth, targetHeight := size, size
+	if width > height {
+		targetHeight = max(1, height*size/width)
+	} else {
+		targetWidth = max(1, width*size/height)
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	out := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	for y := 0; y < targetHeight; y++ {
+		y0, y1 := y*height/targetHeight, max((y+1)*height/targetHeight, y*height/targetHeight+1)
+		for x := 0; x < targetWidth; x++ {
+			x0, x1 := x*width/targetWidth, max((x+1)*width/targetWidth, x*width/targetWidth+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for i := 0; i < 4; i++ {
+						sum[i] += int(row[sx*4+i])
+					}
+				}
+			}
+			count := (y1 - y0) * (x1 - x0)
+			offset := y*out.Stride + x*4
+			for i := 0; i < 4; i++ {
+				out.Pix[offset+i] = uint8(sum[i] / count)
+			}
+		}
+	}
+	return out
+}
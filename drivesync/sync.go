@@ -0,0 +1,223 @@
+package drivesync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/fileutil"
+	"github.com/ilmarkerm/djlibgo/playlistfile"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// Folder layouts for the copied audio files. Placeholders are {artist},
+// {album}, {genre}, {label}, {year}, {playlist} and {file}.
+const (
+	LayoutFlat        = "{file}"
+	LayoutArtist      = "{artist}/{file}"
+	LayoutArtistAlbum = "{artist}/{album}/{file}"
+	LayoutGenre       = "{genre}/{artist} - {file}"
+	LayoutPlaylist    = "{playlist}/{file}"
+)
+
+// Layouts lists the predefined layouts in display order
+var Layouts = []string{LayoutArtistAlbum, LayoutArtist, LayoutGenre, LayoutPlaylist, LayoutFlat}
+
+// ManifestName is the file below the drive root that records what a sync
+// wrote. Only files listed there are ever removed.
+const ManifestName = ".djlibgo-sync.json"
+
+// CollectionName is the standalone Traktor collection written to the drive root
+const CollectionName = "collection.nml"
+
+// Options controls a sync
+type Options struct {
+	// Playlists are copied with all their tracks
+	Playlists []*traktor.Playlist
+	// Layout places the audio files below MusicFolder, LayoutArtistAlbum when empty
+	Layout string
+	// MusicFolder is the folder below the drive root for audio files, "Music" when empty
+	MusicFolder string
+	// PlaylistFolder is the folder below the drive root for M3U8 files, "Playlists" when empty
+	PlaylistFolder string
+}
+
+// Result reports what a sync changed
+type Result struct {
+	Copied    int
+	Skipped   int
+	Removed   int
+	Missing   []string
+	Playlists []string
+}
+
+// Sync copies the tracks of the chosen playlists to the drive at root and
+// writes an M3U8 file per playlist plus a collection.nml whose locations
+// name the volume of the drive, so Traktor finds the files wherever the
+// drive is plugged in. Files whose size and modification time match are not
+// copied again, and files written by an earlier sync that no playlist uses
+// anymore are removed. When the sync fails part-way, the files written so
+// far are recorded with those of earlier syncs, so a later sync cleans
+// them up.
+func Sync(root string, collection *traktor.TraktorCollection, opts Options) (result *Result, err error) {
+	if len(opts.Playlists) == 0 {
+		return nil, errors.New("no playlists to sync")
+	}
+	if opts.Layout == "" {
+		opts.Layout = LayoutArtistAlbum
+	}
+	if opts.MusicFolder == "" {
+		opts.MusicFolder = "Music"
+	}
+	if opts.PlaylistFolder == "" {
+		opts.PlaylistFolder = "Playlists"
+	}
+	if collection == nil {
+		collection = traktor.NewCollection("", nil, nil)
+	}
+	root = filepath.Clean(root)
+
+	previous, err := fileutil.ReadManifest(root, ManifestName)
+	if err != nil {
+		return nil, err
+	}
+	result = &Result{}
+	current := &fileutil.Manifest{}
+	defer func() {
+		if err != nil {
+			if writeErr := previous.Merge(current).Write(root, ManifestName); writeErr != nil {
+				err = errors.Join(err, writeErr)
+			}
+		}
+	}()
+
+	// Place every track once, the first playlist decides {playlist}
+	targets := make(map[*traktor.Track]string)
+	used := make(map[string]bool)
+	for _, playlist := range opts.Playlists {
+		for _, track := range playlist.Tracks {
+			if _, placed := targets[track]; placed {
+				continue
+			}
+			if _, err := os.Stat(track.FilePath); err != nil {
+				result.Missing = append(result.Missing, track.FilePath)
+				continue
+			}
+			relative := fileutil.UniqueFileName(filepath.Join(opts.MusicFolder, expandLayout(opts.Layout, track, playlist)), used)
+			targets[track] = relative
+			// Listed before copying, a partly written file is removed later
+			current.Files = append(current.Files, filepath.ToSlash(relative))
+			copied, err := fileutil.SyncFile(track.FilePath, filepath.Join(root, relative))
+			if err != nil {
+				return result, err
+			}
+			if copied {
+				result.Copied++
+			} else {
+				result.Skipped++
+			}
+		}
+	}
+
+	// Playlists reference the copies on the drive. The copies keep their
+	// primary key, so the NML gets the full entries of the collection.
+	moved := make(map[*traktor.Track]*traktor.Track, len(targets))
+	for track, relative := range targets {
+		driveTrack := *track
+		driveTrack.FilePath = filepath.Join(root, relative)
+		moved[track] = &driveTrack
+	}
+	onDrive := make([]*traktor.Playlist, 0, len(opts.Playlists))
+	for _, playlist := range opts.Playlists {
+		driveList := &traktor.Playlist{Name: playlist.Name, Path: playlist.Path}
+		for _, track := range playlist.Tracks {
+			if driveTrack, exists := moved[track]; exists {
+				driveList.Tracks = append(driveList.Tracks, driveTrack)
+			}
+		}
+		onDrive = append(onDrive, driveList)
+
+		dir := filepath.Join(root, opts.PlaylistFolder)
+		parts := strings.Split(playlist.Path, "/")
+		for _, part := range parts[:len(parts)-1] {
+			dir = filepath.Join(dir, fileutil.SanitizeFileName(part))
+		}
+		path, err := playlistfile.ExportPlaylist(driveList, dir, playlistfile.Options{
+			Format:   playlistfile.FormatM3U8,
+			PathMode: playlistfile.PathRelative,
+		})
+		if err != nil {
+			return result, err
+		}
+		relative, _ := filepath.Rel(root, path)
+		current.Playlists = append(current.Playlists, filepath.ToSlash(relative))
+		result.Playlists = append(result.Playlists, path)
+	}
+
+	volume, volumeDir := driveVolume(root)
+	err = collection.WritePlaylistsNML(filepath.Join(root, CollectionName), onDrive, func(track *traktor.Track) traktor.Location {
+		relative, err := filepath.Rel(root, track.FilePath)
+		if err != nil {
+			return traktor.LocationForPath(track.FilePath)
+		}
+		return traktor.VolumeLocation(volume, strings.TrimSuffix(volumeDir, "/")+"/"+filepath.ToSlash(relative))
+	})
+	if err != nil {
+		return result, err
+	}
+
+	result.Removed = fileutil.RemoveStale(root, previous, current)
+	return result, current.Write(root, ManifestName)
+}
+
+// driveVolume returns the volume name Traktor knows the drive at root by,
+// and the "/" separated folder of root on that volume. A root that is not on
+// a removable drive is taken as the drive itself.
+func driveVolume(root string) (string, string) {
+	driveRoot, name := fileutil.DriveRoot(root)
+	relative, err := filepath.Rel(driveRoot, root)
+	if name == "" || err != nil {
+		return filepath.Base(root), "/"
+	}
+	if relative == "." {
+		return name, "/"
+	}
+	return name, "/" + filepath.ToSlash(relative)
+}
+
+// expandLayout fills the placeholders of a layout for a track. Every folder
+// level is made safe as a file name on its own.
+func expandLayout(layout string, track *traktor.Track, playlist *traktor.Playlist) string {
+	year := ""
+	if date, ok := traktor.ParseDate(track.ReleaseDate); ok {
+		year = fmt.Sprint(date.Year())
+	}
+	replacer := strings.NewReplacer(
+		"{artist}", valueOr(track.Artist, "Unknown Artist"),
+		"{album}", valueOr(track.Album, "Unknown Album"),
+		"{genre}", valueOr(track.Genre, "Unknown Genre"),
+		"{label}", valueOr(track.Label, "Unknown Label"),
+		"{year}", valueOr(year, "Unknown Year"),
+		"{playlist}", playlist.Name,
+		"{file}", filepath.Base(track.FilePath),
+	)
+	var parts []string
+	for _, part := range strings.Split(layout, "/") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, fileutil.SanitizeFileName(replacer.Replace(part)))
+		}
+	}
+	if len(parts) == 0 {
+		return filepath.Base(track.FilePath)
+	}
+	return filepath.Join(parts...)
+}
+
+func valueOr(value, fallback string) string {
+	if strings.TrimSpace(value) == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,212 @@
+package drivesync
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ilmarkerm/djlibgo/fileutil"
+	"github.com/ilmarkerm/djlibgo/internal/testfixture"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// syncPlaylists syncs the playlists of the fixture at the given paths
+func syncPlaylists(t *testing.T, root string, collection *traktor.TraktorCollection, layout string, paths ...string) (*Result, error) {
+	t.Helper()
+	opts := Options{Layout: layout}
+	for _, path := range paths {
+		playlist := collection.GetPlaylistByPath(path)
+		if playlist == nil {
+			t.Fatalf("playlist %s is missing", path)
+		}
+		opts.Playlists = append(opts.Playlists, playlist)
+	}
+	return Sync(root, collection, opts)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestSyncSkipsUnchangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "drive")
+	collection := testfixture.Collection(t, dir)
+	result, err := syncPlaylists(t, root, collection, "", "Set/A")
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if result.Copied != 2 || result.Skipped != 0 {
+		t.Errorf("first sync copied %d and skipped %d, want 2 and 0", result.Copied, result.Skipped)
+	}
+	result, err = syncPlaylists(t, root, collection, "", "Set/A")
+	if err != nil {
+		t.Fatalf("Sync again: %v", err)
+	}
+	if result.Copied != 0 || result.Skipped != 2 || result.Removed != 0 {
+		t.Errorf("re-sync copied %d, skipped %d and removed %d, want 0, 2 and 0",
+			result.Copied, result.Skipped, result.Removed)
+	}
+
+	// A changed source file is copied again
+	if err := os.WriteFile(collection.Tracks[0].FilePath, []byte("changed audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = syncPlaylists(t, root, collection, "", "Set/A")
+	if err != nil {
+		t.Fatalf("Sync after a change: %v", err)
+	}
+	if result.Copied != 1 || result.Skipped != 1 {
+		t.Errorf("sync after a change copied %d and skipped %d, want 1 and 1", result.Copied, result.Skipped)
+	}
+}
+
+func TestSyncRemovesOnlyManifestFiles(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "drive")
+	collection := testfixture.Collection(t, dir)
+	first, err := syncPlaylists(t, root, collection, LayoutFlat, "Set/A", "Set/B")
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	// A file the user put on the drive, and a manifest entry pointing outside
+	// the drive, must both survive
+	own := filepath.Join(root, "Music", "Own.mp3")
+	if err := os.WriteFile(own, []byte("own"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(dir, "Outside.mp3")
+	if err := os.WriteFile(outside, []byte("outside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := fileutil.ReadManifest(root, ManifestName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Files = append(manifest.Files, "../Outside.mp3")
+	if err := manifest.Write(root, ManifestName); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := syncPlaylists(t, root, collection, LayoutFlat, "Set/A")
+	if err != nil {
+		t.Fatalf("Sync without B: %v", err)
+	}
+	if result.Removed != 2 {
+		t.Errorf("removed %d files, want the track and the playlist of B", result.Removed)
+	}
+	if exists(filepath.Join(root, "Music", "Two.mp3")) {
+		t.Error("the track of the removed playlist is still on the drive")
+	}
+	if exists(first.Playlists[1]) {
+		t.Error("the removed playlist is still on the drive")
+	}
+	for _, path := range []string{
+		filepath.Join(root, "Music", "One.mp3"),
+		filepath.Join(root, "Music", "Three.mp3"),
+		first.Playlists[0],
+		own,
+		outside,
+	} {
+		if !exists(path) {
+			t.Errorf("%s was removed", path)
+		}
+	}
+}
+
+func TestSyncFailureMergesManifest(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "drive")
+	collection := testfixture.Collection(t, dir)
+	if _, err := syncPlaylists(t, root, collection, "", "Set/A"); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	// A folder where the flat layout puts track Three stops the second sync
+	// after track Two was copied
+	blocker := filepath.Join(root, "Music", "Three.mp3")
+	if err := os.MkdirAll(filepath.Join(blocker, "keep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := syncPlaylists(t, root, collection, LayoutFlat, "Set/B", "Set/A"); err == nil {
+		t.Fatal("Sync into a blocked file succeeded")
+	}
+	manifest, err := fileutil.ReadManifest(root, ManifestName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := make(map[string]bool)
+	for _, path := range manifest.Files {
+		listed[path] = true
+	}
+	for _, path := range []string{"Music/Two.mp3", "Music/Artist/Album/One.mp3", "Music/Other/Unknown Album/Three.mp3"} {
+		if !listed[path] {
+			t.Errorf("manifest after the failure lacks %s: %v", path, manifest.Files)
+		}
+	}
+
+	// The next sync removes what the failed one left behind
+	if err := os.RemoveAll(blocker); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := syncPlaylists(t, root, collection, LayoutFlat, "Set/A"); err != nil {
+		t.Fatalf("Sync after the failure: %v", err)
+	}
+	for _, path := range []string{"Two.mp3", "Artist", "Other"} {
+		if exists(filepath.Join(root, "Music", path)) {
+			t.Errorf("Music/%s is still on the drive", path)
+		}
+	}
+}
+
+func TestSyncCollectionLocations(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "drive")
+	collection := testfixture.Collection(t, dir)
+	if _, err := syncPlaylists(t, root, collection, "", "Set/A"); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(root, CollectionName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nml traktor.NML
+	if err := xml.Unmarshal(data, &nml); err != nil {
+		t.Fatal(err)
+	}
+	locations := make(map[string]traktor.Location)
+	for _, entry := range nml.Collection.Tracks {
+		locations[entry.Title] = entry.Location
+	}
+	if len(locations) != 2 {
+		t.Fatalf("collection has %d tracks, want 2", len(locations))
+	}
+	// The temporary folder is not a removable drive, so it is taken as one
+	want := traktor.Location{Volume: "drive", Dir: "/:Music/:Artist/:Album/:", File: "One.mp3"}
+	if got := locations["One"]; got.Volume != want.Volume || got.Dir != want.Dir || got.File != want.File {
+		t.Errorf("location of One is %+v, want %+v", got, want)
+	}
+}
+
+func TestDriveVolume(t *testing.T) {
+	if filepath.Separator != '/' {
+		t.Skip("mount points are Unix paths")
+	}
+	for _, test := range []struct {
+		root, volume, dir string
+	}{
+		{"/Volumes/USB", "USB", "/"},
+		{"/Volumes/USB/DJ/Sets", "USB", "/DJ/Sets"},
+		{"/media/dj/STICK/DJ", "STICK", "/DJ"},
+		{"/run/media/dj/STICK", "STICK", "/"},
+		{"/home/dj/export", "export", "/"},
+	} {
+		volume, dir := driveVolume(test.root)
+		if volume != test.volume || dir != test.dir {
+			t.Errorf("driveVolume(%s) = %s, %s, want %s, %s", test.root, volume, dir, test.volume, test.dir)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/trackdump"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// runDump writes the tracks of the Traktor collection or of one playlist as
+// CSV, JSON Lines or YAML without starting the GUI
+func runDump(args []string) error {
+	flags := flag.NewFlagSet("dump", flag.ContinueOnError)
+	collectionPath := flags.String("collection", "", "collection.nml to read, defaults to the Traktor collection")
+	playlistName := flags.String("playlist", "", "playlist path or name to dump instead of the whole collection")
+	format := flags.String("format", string(trackdump.FormatCSV), "output format: csv, jsonl or yaml")
+	columns := flags.String("columns", strings.Join(trackdump.DefaultColumns, ","), "comma separated columns")
+	output := flags.String("o", "", "output file, defaults to standard output")
+	listColumns := flags.Bool("list-columns", false, "list the available columns and exit")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *listColumns {
+		for _, column := range trackdump.Columns {
+			fmt.Printf("%-18s %s\n", column.Name, column.Description)
+		}
+		return nil
+	}
+
+	selected, err := trackdump.ParseColumns([]string{*columns})
+	if err != nil {
+		return err
+	}
+
+	var collection *traktor.TraktorCollection
+	if *collectionPath != "" {
+		collection, err = traktor.ParseCollectionFromPath(*collectionPath)
+	} else {
+		collection, err = traktor.ParseCollection()
+	}
+	if err != nil {
+		return fmt.Errorf("reading collection: %w", err)
+	}
+
+	if *output == "" {
+		return dumpTracks(os.Stdout, trackdump.Format(*format), selected, collection, *playlistName)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := dumpTracks(file, trackdump.Format(*format), selected, collection, *playlistName); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// dumpTracks writes the whole collection, or the playlist with the given path
+// or name
+func dumpTracks(w io.Writer, format trackdump.Format, columns []trackdump.Column, collection *traktor.TraktorCollection, playlistName string) error {
+	if playlistName == "" {
+		return trackdump.WriteCollection(w, format, columns, collection)
+	}
+	playlist := collection.GetPlaylistByPath(playlistName)
+	if playlist == nil {
+		playlist = collection.GetPlaylistByName(playlistName)
+	}
+	if playlist == nil {
+		return fmt.Errorf("playlist %q not found", playlistName)
+	}
+	return trackdump.WriteTracks(w, format, columns, playlist.Tracks)
+}
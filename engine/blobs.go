@@ -0,0 +1,278 @@
+package engine
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image/color"
+	"io"
+	"math"
+)
+
+// slots is the number of hot cues and loops Engine DJ stores per track
+const slots = 8
+
+// errBlob is returned for performance data that cannot be decoded
+var errBlob = errors.New("invalid Engine DJ performance data")
+
+// compress encodes data the way Qt's qCompress does: the uncompressed size as
+// a 32 bit big endian number followed by a zlib stream
+func compress(data []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+	writer := zlib.NewWriter(&buf)
+	writer.Write(data)
+	writer.Close()
+	return buf.Bytes()
+}
+
+// uncompress reverses compress
+func uncompress(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errBlob
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(data[4:]))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// blobReader reads the fixed size values of a performance data blob
+type blobReader struct {
+	data []byte
+	err  error
+}
+
+func (r *blobReader) next(n int) []byte {
+	if r.err != nil || len(r.data) < n {
+		r.err = errBlob
+		return make([]byte, n)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *blobReader) byte() byte { return r.next(1)[0] }
+
+func (r *blobReader) float(order binary.ByteOrder) float64 {
+	return math.Float64frombits(order.Uint64(r.next(8)))
+}
+
+func (r *blobReader) int64(order binary.ByteOrder) int64 {
+	return int64(order.Uint64(r.next(8)))
+}
+
+func (r *blobReader) int32(order binary.ByteOrder) int32 {
+	return int32(order.Uint32(r.next(4)))
+}
+
+func (r *blobReader) label() string {
+	return string(r.next(int(r.byte())))
+}
+
+func appendFloat(b []byte, order binary.AppendByteOrder, value float64) []byte {
+	return order.AppendUint64(b, math.Float64bits(value))
+}
+
+// appendLabel writes a label prefixed by its length, truncated to 255 bytes
+func appendLabel(b []byte, label string) []byte {
+	if len(label) > 255 {
+		label = label[:255]
+	}
+	b = append(b, byte(len(label)))
+	return append(b, label...)
+}
+
+// trackData is the decoded trackData blob
+type trackData struct {
+	SampleRate float64
+	Samples    int64
+	Loudness   float64
+	Key        int32
+}
+
+func (d trackData) encode() []byte {
+	b := appendFloat(nil, binary.BigEndian, d.SampleRate)
+	b = binary.BigEndian.AppendUint64(b, uint64(d.Samples))
+	b = appendFloat(b, binary.BigEndian, d.Loudness)
+	b = binary.BigEndian.AppendUint32(b, uint32(d.Key))
+	return compress(b)
+}
+
+func decodeTrackData(blob []byte) (trackData, error) {
+	data, err := uncompress(blob)
+	if err != nil {
+		return trackData{}, err
+	}
+	r := &blobReader{data: data}
+	d := trackData{
+		SampleRate: r.float(binary.BigEndian),
+		Samples:    r.int64(binary.BigEndian),
+		Loudness:   r.float(binary.BigEndian),
+		Key:        r.int32(binary.BigEndian),
+	}
+	return d, r.err
+}
+
+// beatMarker is a beat grid marker. Beats counts the beats up to the next marker.
+type beatMarker struct {
+	Offset float64
+	Beat   int64
+	Beats  int32
+}
+
+// beatData is the decoded beatData blob. Engine DJ keeps the analysed and the
+// user adjusted grid; we write the same grid to both.
+type beatData struct {
+	SampleRate float64
+	Samples    float64
+	Default    []beatMarker
+	Adjusted   []beatMarker
+}
+
+func appendMarkers(b []byte, markers []beatMarker) []byte {
+	b = binary.BigEndian.AppendUint64(b, uint64(len(markers)))
+	for _, marker := range markers {
+		// The markers themselves are little endian
+		b = appendFloat(b, binary.LittleEndian, marker.Offset)
+		b = binary.LittleEndian.AppendUint64(b, uint64(marker.Beat))
+		b = binary.LittleEndian.AppendUint32(b, uint32(marker.Beats))
+		b = binary.LittleEndian.AppendUint32(b, 0)
+	}
+	return b
+}
+
+func (d beatData) encode() []byte {
+	b := appendFloat(nil, binary.BigEndian, d.SampleRate)
+	b = appendFloat(b, binary.BigEndian, d.Samples)
+	b = append(b, 1)
+	b = appendMarkers(b, d.Default)
+	b = appendMarkers(b, d.Adjusted)
+	return compress(b)
+}
+
+func readMarkers(r *blobReader) []beatMarker {
+	count := r.int64(binary.BigEndian)
+	if count < 0 || count > int64(len(r.data)/24) {
+		r.err = errBlob
+		return nil
+	}
+	markers := make([]beatMarker, count)
+	for i := range markers {
+		markers[i].Offset = r.float(binary.LittleEndian)
+		markers[i].Beat = r.int64(binary.LittleEndian)
+		markers[i].Beats = r.int32(binary.LittleEndian)
+		r.next(4)
+	}
+	return markers
+}
+
+func decodeBeatData(blob []byte) (beatData, error) {
+	data, err := uncompress(blob)
+	if err != nil {
+		return beatData{}, err
+	}
+	r := &blobReader{data: data}
+	d := beatData{SampleRate: r.float(binary.BigEndian), Samples: r.float(binary.BigEndian)}
+	r.byte()
+	d.Default = readMarkers(r)
+	d.Adjusted = readMarkers(r)
+	return d, r.err
+}
+
+// quickCue is a hot cue. Unset slots have an offset of -1.
+type quickCue struct {
+	Label  string
+	Offset float64
+	Color  color.RGBA
+}
+
+// quickCues is the decoded quickCues blob
+type quickCues struct {
+	Cues    [slots]quickCue
+	MainCue float64
+}
+
+func (q quickCues) encode() []byte {
+	b := binary.BigEndian.AppendUint64(nil, slots)
+	for _, cue := range q.Cues {
+		b = appendLabel(b, cue.Label)
+		b = appendFloat(b, binary.BigEndian, cue.Offset)
+		b = append(b, cue.Color.A, cue.Color.R, cue.Color.G, cue.Color.B)
+	}
+	// Adjusted main cue, whether it was adjusted, and the analysed main cue
+	b = appendFloat(b, binary.BigEndian, q.MainCue)
+	b = append(b, 0)
+	b = appendFloat(b, binary.BigEndian, q.MainCue)
+	return compress(b)
+}
+
+func decodeQuickCues(blob []byte) (quickCues, error) {
+	data, err := uncompress(blob)
+	if err != nil {
+		return quickCues{}, err
+	}
+	r := &blobReader{data: data}
+	var q quickCues
+	count := r.int64(binary.BigEndian)
+	for i := int64(0); i < count && r.err == nil; i++ {
+		cue := quickCue{Label: r.label(), Offset: r.float(binary.BigEndian)}
+		argb := r.next(4)
+		cue.Color = color.RGBA{A: argb[0], R: argb[1], G: argb[2], B: argb[3]}
+		if i < slots {
+			q.Cues[i] = cue
+		}
+	}
+	q.MainCue = r.float(binary.BigEndian)
+	return q, r.err
+}
+
+// loop is a saved loop. Unset slots have start and end of -1.
+type loop struct {
+	Label string
+	Start float64
+	End   float64
+	Color color.RGBA
+}
+
+// loops is the decoded loops blob. Unlike the other blobs it is neither
+// compressed nor big endian.
+type loops [slots]loop
+
+func (l loops) encode() []byte {
+	b := binary.LittleEndian.AppendUint64(nil, slots)
+	for _, lp := range l {
+		b = appendLabel(b, lp.Label)
+		b = appendFloat(b, binary.LittleEndian, lp.Start)
+		b = appendFloat(b, binary.LittleEndian, lp.End)
+		set := byte(0)
+		if lp.Start >= 0 && lp.End >= 0 {
+			set = 1
+		}
+		b = append(b, set, set, lp.Color.A, lp.Color.R, lp.Color.G, lp.Color.B)
+	}
+	return b
+}
+
+func decodeLoops(data []byte) (loops, error) {
+	r := &blobReader{data: data}
+	var l loops
+	count := r.int64(binary.LittleEndian)
+	for i := int64(0); i < count && r.err == nil; i++ {
+		lp := loop{Label: r.label(), Start: r.float(binary.LittleEndian), End: r.float(binary.LittleEndian)}
+		startSet, endSet := r.byte(), r.byte()
+		argb := r.next(4)
+		lp.Color = color.RGBA{A: argb[0], R: argb[1], G: argb[2], B: argb[3]}
+		if startSet == 0 || endSet == 0 {
+			lp.Start, lp.End = -1, -1
+		}
+		if i < slots {
+			l[i] = lp
+		}
+	}
+	return l, r.err
+}
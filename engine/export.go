@@ -0,0 +1,685 @@
+package engine
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ilmarkerm/djlibgo/fileutil"
+	"github.com/ilmarkerm/djlibgo/tags"
+	"github.com/ilmarkerm/djlibgo/traktor"
+
+	_ "modernc.org/sqlite"
+)
+
+// defaultSampleRate is used when the sample rate cannot be read from the file
+const defaultSampleRate = 44100
+
+// Cue colours by Traktor cue type
+var (
+	colorCue  = color.RGBA{R: 0x00, G: 0x66, B: 0xff, A: 0xff}
+	colorFade = color.RGBA{R: 0xff, G: 0x8c, B: 0x00, A: 0xff}
+	colorLoad = color.RGBA{R: 0xff, G: 0xd2, B: 0x00, A: 0xff}
+	colorLoop = color.RGBA{R: 0x00, G: 0xc8, B: 0x3c, A: 0xff}
+)
+
+// ExportOptions controls the Engine DJ export
+type ExportOptions struct {
+	// Playlists limits the export to these playlists and their tracks.
+	// When empty the whole collection and all playlists are exported.
+	Playlists []*traktor.Playlist
+	// CopyFiles copies the audio files into "Engine Library/Music" so the
+	// target drive is self-contained
+	CopyFiles bool
+}
+
+// LibraryPath returns the Engine Library folder on a drive or in a folder
+func LibraryPath(root string) string {
+	return filepath.Join(root, libraryDir)
+}
+
+// DatabasePath returns the location of the main database on a drive or in a folder
+func DatabasePath(root string) string {
+	return filepath.Join(LibraryPath(root), databaseDir, databaseFile)
+}
+
+// Export writes the tracks and playlists into the Engine DJ database in the
+// Engine Library folder below root, which is usually the top folder of a USB
+// drive. An existing database is merged into: tracks with the same path are
+// updated, playlists with the same path get their tracks replaced, and
+// everything else is kept. The database before the export is kept as
+// m.db.bak.
+func Export(root string, collection *traktor.TraktorCollection, opts ExportOptions) (err error) {
+	playlists, tracks := exportSelection(collection, opts)
+
+	dbPath := DatabasePath(root)
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return err
+	}
+	_, statErr := os.Stat(dbPath)
+	exists := statErr == nil
+	if exists {
+		if err := fileutil.Backup(dbPath); err != nil {
+			return err
+		}
+	} else {
+		// Do not leave an empty database behind when the export fails
+		defer func() {
+			if err != nil {
+				os.Remove(dbPath)
+			}
+		}()
+	}
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var uuid string
+	if exists {
+		if err := tx.QueryRow(`SELECT uuid FROM Information ORDER BY id LIMIT 1`).Scan(&uuid); err != nil {
+			return fmt.Errorf("reading %s: %w", dbPath, err)
+		}
+	} else {
+		for _, statement := range schema {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+		if uuid, err = newUUID(); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO Information (uuid, schemaVersionMajor, schemaVersionMinor,
+			schemaVersionPatch, currentPlayedIndiciator, lastRekordBoxLibraryImportReadCounter)
+			VALUES (?, ?, ?, ?, 0, 0)`, uuid, schemaMajor, schemaMinor, schemaPatch); err != nil {
+			return err
+		}
+	}
+
+	var lastID int64
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM Track`).Scan(&lastID); err != nil {
+		return err
+	}
+	files := &fileCopier{libraryDir: LibraryPath(root), copy: opts.CopyFiles}
+	trackIDs := make(map[*traktor.Track]int64, len(tracks))
+	for _, track := range tracks {
+		path, err := files.place(track.FilePath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", track.FilePath, err)
+		}
+		var id int64
+		err = tx.QueryRow(`SELECT id FROM Track WHERE path = ?`, path).Scan(&id)
+		stored := err == nil
+		if err == sql.ErrNoRows {
+			lastID++
+			id = lastID
+		} else if err != nil {
+			return err
+		}
+		if err := writeTrack(tx, id, stored, uuid, path, track); err != nil {
+			return fmt.Errorf("%s: %w", track.FilePath, err)
+		}
+		trackIDs[track] = id
+	}
+
+	if err := writePlaylists(tx, uuid, playlists, trackIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Verify reads the database below root back and checks that an export with
+// the same options arrived: every playlist is there with its tracks in order,
+// and the tracks kept their key and BPM.
+func Verify(root string, collection *traktor.TraktorCollection, opts ExportOptions) error {
+	library, err := ReadLibrary(root)
+	if err != nil {
+		return err
+	}
+	playlists, _ := exportSelection(collection, opts)
+	var problems []string
+	for _, playlist := range playlists {
+		path := playlist.Path
+		if path == "" {
+			path = playlist.Name
+		}
+		var want []*traktor.Track
+		seen := make(map[string]bool)
+		for _, track := range playlist.Tracks {
+			if !seen[track.FilePath] {
+				seen[track.FilePath] = true
+				want = append(want, track)
+			}
+		}
+		exported := library.GetPlaylistByPath(path)
+		if exported == nil {
+			if len(want) > 0 {
+				problems = append(problems, fmt.Sprintf("playlist %s is missing", path))
+			}
+			continue
+		}
+		if len(exported.Tracks) != len(want) {
+			problems = append(problems, fmt.Sprintf("playlist %s has %d tracks instead of %d", path, len(exported.Tracks), len(want)))
+			continue
+		}
+		for i, track := range want {
+			got := exported.Tracks[i]
+			if got.Title != track.Title {
+				problems = append(problems, fmt.Sprintf("playlist %s has %q at position %d instead of %q", path, got.Title, i+1, track.Title))
+				break
+			}
+			key, hasKey := traktor.TrackKeyValue(track)
+			if hasKey && got.MusicalKey != key {
+				problems = append(problems, fmt.Sprintf("%s: key %s instead of %s", track.Title, got.Key,
+					traktor.KeyValueToNotation(key, traktor.NotationOpenKey)))
+			}
+			if bpm := exportedBPM(track); bpm > 0 && math.Abs(got.BPM-bpm) > 0.01 {
+				problems = append(problems, fmt.Sprintf("%s: %.2f BPM instead of %.2f", track.Title, got.BPM, bpm))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("the exported library differs: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// exportedBPM returns the BPM an export writes for a track, which is the
+// tempo of its grid cue when it has one
+func exportedBPM(track *traktor.Track) float64 {
+	for _, cue := range track.CuePoints {
+		if cue.Type == traktor.CueTypeGrid && cue.Grid != nil && cue.Grid.Bpm > 0 {
+			return cue.Grid.Bpm
+		}
+	}
+	return track.BPM
+}
+
+// exportSelection returns the playlists and tracks an export writes
+func exportSelection(collection *traktor.TraktorCollection, opts ExportOptions) ([]*traktor.Playlist, []*traktor.Track) {
+	playlists := opts.Playlists
+	var tracks []*traktor.Track
+	if len(playlists) == 0 {
+		for i := range collection.Playlists {
+			playlists = append(playlists, &collection.Playlists[i])
+		}
+		for i := range collection.Tracks {
+			tracks = append(tracks, &collection.Tracks[i])
+		}
+		return playlists, tracks
+	}
+	seen := make(map[*traktor.Track]bool)
+	for _, playlist := range playlists {
+		for _, track := range playlist.Tracks {
+			if !seen[track] {
+				seen[track] = true
+				tracks = append(tracks, track)
+			}
+		}
+	}
+	return playlists, tracks
+}
+
+// fileCopier decides where the tracks live relative to the Engine Library
+// folder, copying them into its Music folder when requested
+type fileCopier struct {
+	libraryDir string
+	copy       bool
+}
+
+// place returns the path stored in the database for a track file
+func (f *fileCopier) place(path string) (string, error) {
+	if f.copy {
+		target := copyTarget(f.libraryDir, path)
+		if _, err := fileutil.SyncFile(path, target); err != nil {
+			return "", err
+		}
+		path = target
+	}
+	if rel, err := filepath.Rel(f.libraryDir, path); err == nil {
+		return filepath.ToSlash(rel), nil
+	}
+	// Files on another Windows drive can only be referenced absolutely
+	return filepath.ToSlash(path), nil
+}
+
+// copyTarget returns where a track file is copied to. Files are kept in a
+// folder named by a hash of their source folder, so a file always gets the
+// same copy and files of the same name from different folders never share
+// one, whatever else is exported.
+func copyTarget(libraryDir, path string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(filepath.Dir(path)))
+	return filepath.Join(libraryDir, "Music", fmt.Sprintf("%08x", hash.Sum32()), filepath.Base(path))
+}
+
+// writeTrack writes the Track row including the performance data blobs. The
+// row is inserted, or updated when stored is set.
+func writeTrack(tx *sql.Tx, id int64, stored bool, uuid, path string, track *traktor.Track) error {
+	sampleRate := float64(defaultSampleRate)
+	if rate, err := tags.SampleRate(track.FilePath); err == nil && rate > 0 {
+		sampleRate = float64(rate)
+	}
+	samples := int64(math.Round(track.Duration * sampleRate))
+
+	key := int32(-1)
+	var keyColumn interface{}
+	if value, ok := traktor.TrackKeyValue(track); ok {
+		key = int32(toEngineKey(value))
+		keyColumn = key
+	}
+
+	var year interface{}
+	if date, ok := traktor.ParseDate(track.ReleaseDate); ok {
+		year = date.Year()
+	}
+	now := time.Now().Unix()
+	dateAdded := now
+	if date, ok := traktor.ParseDate(track.ImportDate); ok {
+		dateAdded = date.Unix()
+	}
+	var lastPlayed interface{}
+	if date, ok := traktor.ParseDate(track.LastPlayed); ok {
+		lastPlayed = date.Unix()
+	}
+
+	// The collection size is in bytes too, but the file itself is current
+	fileBytes := int64(track.FileSize)
+	if info, err := os.Stat(track.FilePath); err == nil {
+		fileBytes = info.Size()
+	}
+
+	data := trackData{SampleRate: sampleRate, Samples: samples, Key: key}
+	cues, loopSlots := convertCuePoints(track.CuePoints, sampleRate)
+	beats, gridBPM := convertGrid(track, sampleRate, samples)
+	bpm := track.BPM
+	if gridBPM > 0 {
+		bpm = gridBPM
+	}
+
+	columns := []columnValue{
+		{"length", int64(math.Round(track.Duration))},
+		{"bpm", int64(math.Round(bpm))},
+		{"year", year},
+		{"path", path},
+		{"filename", filepath.Base(path)},
+		{"bitrate", track.Bitrate / 1000},
+		{"bpmAnalyzed", bpm},
+		{"fileBytes", fileBytes},
+		{"title", track.Title},
+		{"artist", track.Artist},
+		{"album", track.Album},
+		{"genre", track.Genre},
+		{"comment", track.Comment},
+		{"label", track.Label},
+		{"composer", track.Producer},
+		{"remixer", track.Remixer},
+		{"key", keyColumn},
+		{"rating", traktor.RatingToStars(track.Rating) * 20},
+		{"timeLastPlayed", lastPlayed},
+		{"isPlayed", track.PlayCount > 0},
+		{"fileType", strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")},
+		{"isAnalyzed", true},
+		{"dateAdded", dateAdded},
+		{"isAvailable", true},
+		{"isBeatGridLocked", len(beats.Adjusted) > 0},
+		{"trackData", data.encode()},
+		{"beatData", beats.encode()},
+		{"quickCues", cues.encode()},
+		{"loops", loopSlots.encode()},
+		{"lastEditTime", now},
+	}
+	if stored {
+		return updateRow(tx, "Track", id, columns)
+	}
+	columns = append(columns, []columnValue{
+		{"id", id},
+		{"albumArtId", 1},
+		{"dateCreated", now},
+		{"isMetadataOfPackedTrackChanged", false},
+		{"isPerfomanceDataOfPackedTrackChanged", false},
+		{"isMetadataImported", true},
+		{"pdbImportKey", 0},
+		{"originDatabaseUuid", uuid},
+		{"originTrackId", id},
+		{"streamingFlags", 0},
+		{"explicitLyrics", false},
+	}...)
+	return insertRow(tx, "Track", columns)
+}
+
+// columnValue is a column of a row with its value
+type columnValue struct {
+	name  string
+	value interface{}
+}
+
+// insertRow inserts a row with the given columns
+func insertRow(tx *sql.Tx, table string, columns []columnValue) error {
+	names := make([]string, len(columns))
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		names[i] = column.name
+		values[i] = column.value
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	_, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(names, ", "), placeholders), values...)
+	return err
+}
+
+// updateRow sets the given columns of the row with the id. Columns that are
+// not given, such as the waveform Engine DJ computed, keep their value.
+func updateRow(tx *sql.Tx, table string, id int64, columns []columnValue) error {
+	assignments := make([]string, len(columns))
+	values := make([]interface{}, len(columns), len(columns)+1)
+	for i, column := range columns {
+		assignments[i] = column.name + " = ?"
+		values[i] = column.value
+	}
+	_, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", table, strings.Join(assignments, ", ")), append(values, id)...)
+	return err
+}
+
+// toEngineKey converts a Traktor MUSICAL_KEY value. Engine DJ numbers keys
+// around the circle of fifths: even values are major keys starting at C,
+// odd values their relative minor keys.
+func toEngineKey(value int) int {
+	number, minor := traktor.OpenKey(value)
+	key := (number - 1) * 2
+	if minor {
+		key++
+	}
+	return key
+}
+
+// fromEngineKey converts an Engine DJ key back into a MUSICAL_KEY value
+func fromEngineKey(key int) (int, bool) {
+	if key < 0 || key >= 24 {
+		return -1, false
+	}
+	suffix := "d"
+	if key%2 == 1 {
+		suffix = "m"
+	}
+	return traktor.ParseKey(fmt.Sprintf("%d%s", key/2+1, suffix))
+}
+
+// cueColor returns the colour for a Traktor cue type
+func cueColor(cueType int) color.RGBA {
+	switch cueType {
+	case traktor.CueTypeFadeIn, traktor.CueTypeFadeOut:
+		return colorFade
+	case traktor.CueTypeLoad:
+		return colorLoad
+	case traktor.CueTypeLoop:
+		return colorLoop
+	default:
+		return colorCue
+	}
+}
+
+// convertCuePoints maps Traktor hot cues 1-8 to Engine DJ hot cues and loops
+// to the loop slots. Loops on a hot cue keep their slot number, other loops
+// fill the free slots. The load cue, or else the first hot cue, becomes the
+// main cue.
+func convertCuePoints(cuePoints []traktor.CuePoint, sampleRate float64) (quickCues, loops) {
+	var cues quickCues
+	var loopSlots loops
+	for i := range cues.Cues {
+		cues.Cues[i].Offset = -1
+		loopSlots[i] = loop{Start: -1, End: -1}
+	}
+	toSamples := func(ms float64) float64 { return ms / 1000 * sampleRate }
+
+	mainCue := -1.0
+	var freeLoops []traktor.CuePoint
+	for _, cue := range cuePoints {
+		switch {
+		case cue.Type == traktor.CueTypeGrid:
+			continue
+		case cue.Type == traktor.CueTypeLoop && cue.Len > 0:
+			if cue.HotCue < 0 || cue.HotCue >= slots {
+				freeLoops = append(freeLoops, cue)
+				continue
+			}
+			loopSlots[cue.HotCue] = loop{
+				Label: cue.Name,
+				Start: toSamples(cue.Start),
+				End:   toSamples(cue.Start + cue.Len),
+				Color: colorLoop,
+			}
+		case cue.HotCue >= 0 && cue.HotCue < slots:
+			cues.Cues[cue.HotCue] = quickCue{Label: cue.Name, Offset: toSamples(cue.Start), Color: cueColor(cue.Type)}
+			if mainCue < 0 {
+				mainCue = toSamples(cue.Start)
+			}
+		}
+		if cue.Type == traktor.CueTypeLoad {
+			mainCue = toSamples(cue.Start)
+		}
+	}
+	for _, cue := range freeLoops {
+		for i := range loopSlots {
+			if loopSlots[i].Start < 0 {
+				loopSlots[i] = loop{Label: cue.Name, Start: toSamples(cue.Start), End: toSamples(cue.Start + cue.Len), Color: colorLoop}
+				break
+			}
+		}
+	}
+	cues.MainCue = math.Max(mainCue, 0)
+	return cues, loopSlots
+}
+
+// convertGrid creates a constant tempo beat grid from the Traktor grid cue.
+// The grid starts four beats before the anchor's first beat in the track and
+// runs past the end. Returns the grid and its BPM, or an empty grid.
+func convertGrid(track *traktor.Track, sampleRate float64, samples int64) (beatData, float64) {
+	grid := beatData{SampleRate: sampleRate, Samples: float64(samples)}
+	for _, cue := range track.CuePoints {
+		if cue.Type != traktor.CueTypeGrid {
+			continue
+		}
+		bpm := track.BPM
+		if cue.Grid != nil && cue.Grid.Bpm > 0 {
+			bpm = cue.Grid.Bpm
+		}
+		if bpm <= 0 {
+			break
+		}
+		samplesPerBeat := 60 / bpm * sampleRate
+		anchor := cue.Start / 1000 * sampleRate
+		first := anchor - math.Floor(anchor/samplesPerBeat)*samplesPerBeat - 4*samplesPerBeat
+		beats := int64(math.Ceil((float64(samples)-first)/samplesPerBeat)) + 1
+		grid.Default = []beatMarker{
+			{Offset: first, Beat: -4, Beats: int32(beats)},
+			{Offset: first + float64(beats)*samplesPerBeat, Beat: beats - 4},
+		}
+		grid.Adjusted = grid.Default
+		return grid, bpm
+	}
+	return grid, 0
+}
+
+// listNode is a playlist row. Engine DJ keeps siblings and playlist entries as
+// linked lists, so ids are assigned before anything is written.
+type listNode struct {
+	id       int64
+	title    string
+	parent   int64
+	next     int64
+	stored   bool // the row is already in the database
+	exported bool // the entries are replaced by the export
+	children []*listNode
+	tracks   []int64
+	members  map[int64]bool
+}
+
+// writePlaylists recreates the playlist folders from the playlist paths in
+// the playlist tree already in the database. Playlists with the same path get
+// their entries replaced, new ones are added after their siblings. Engine DJ
+// playlists can hold tracks and sub playlists at the same time, so folders
+// become playlists without tracks.
+func writePlaylists(tx *sql.Tx, uuid string, playlists []*traktor.Playlist, trackIDs map[*traktor.Track]int64) error {
+	root, lastID, err := loadPlaylistTree(tx)
+	if err != nil {
+		return err
+	}
+	child := func(parent *listNode, title string) *listNode {
+		for _, node := range parent.children {
+			if node.title == title {
+				return node
+			}
+		}
+		lastID++
+		node := &listNode{id: lastID, title: title, parent: parent.id, members: make(map[int64]bool)}
+		parent.children = append(parent.children, node)
+		return node
+	}
+
+	for _, playlist := range playlists {
+		path := playlist.Path
+		if path == "" {
+			path = playlist.Name
+		}
+		node := root
+		for _, part := range strings.Split(path, "/") {
+			node = child(node, part)
+		}
+		node.exported = true
+		for _, track := range playlist.Tracks {
+			// A track can be in an Engine DJ playlist only once
+			if id, exists := trackIDs[track]; exists && !node.members[id] {
+				node.members[id] = true
+				node.tracks = append(node.tracks, id)
+			}
+		}
+	}
+
+	var entityID int64
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM PlaylistEntity`).Scan(&entityID); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	var write func(nodes []*listNode) error
+	write = func(nodes []*listNode) error {
+		for i, node := range nodes {
+			var next int64
+			if i+1 < len(nodes) {
+				next = nodes[i+1].id
+			}
+			switch {
+			case !node.stored:
+				if _, err := tx.Exec(`INSERT INTO Playlist (id, title, parentListId, isPersisted,
+					nextListId, lastEditTime, isExplicitlyExported) VALUES (?, ?, ?, 1, ?, ?, 1)`,
+					node.id, node.title, node.parent, next, now); err != nil {
+					return fmt.Errorf("playlist %s: %w", node.title, err)
+				}
+			case node.next != next:
+				// The last sibling now points to the playlists added after it
+				if _, err := tx.Exec(`UPDATE Playlist SET nextListId = ? WHERE id = ?`, next, node.id); err != nil {
+					return fmt.Errorf("playlist %s: %w", node.title, err)
+				}
+			}
+			if node.exported {
+				if err := writeEntries(tx, uuid, node, &entityID, now); err != nil {
+					return fmt.Errorf("playlist %s: %w", node.title, err)
+				}
+			}
+			if err := write(node.children); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return write(root.children)
+}
+
+// loadPlaylistTree reads the playlists already in the database in their
+// sibling order. It returns the root of the tree and the highest playlist id.
+func loadPlaylistTree(tx *sql.Tx) (*listNode, int64, error) {
+	rows, err := tx.Query(`SELECT id, COALESCE(parentListId, 0), COALESCE(nextListId, 0), title FROM Playlist`)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	children := make(map[int64][]*engineList)
+	var lastID int64
+	for rows.Next() {
+		list := &engineList{}
+		if err := rows.Scan(&list.id, &list.parent, &list.next, &list.title); err != nil {
+			return nil, 0, err
+		}
+		children[list.parent] = append(children[list.parent], list)
+		lastID = max(lastID, list.id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	root := &listNode{}
+	seen := make(map[int64]bool)
+	var build func(parent *listNode)
+	build = func(parent *listNode) {
+		for _, list := range orderLists(children[parent.id]) {
+			if seen[list.id] {
+				continue
+			}
+			seen[list.id] = true
+			node := &listNode{id: list.id, title: list.title, parent: list.parent, next: list.next,
+				stored: true, members: make(map[int64]bool)}
+			parent.children = append(parent.children, node)
+			build(node)
+		}
+	}
+	build(root)
+	return root, lastID, nil
+}
+
+// writeEntries replaces the entries of an exported playlist with its tracks
+func writeEntries(tx *sql.Tx, uuid string, node *listNode, entityID *int64, now int64) error {
+	if _, err := tx.Exec(`DELETE FROM PlaylistEntity WHERE listId = ?`, node.id); err != nil {
+		return err
+	}
+	for j, trackID := range node.tracks {
+		*entityID++
+		var nextEntity int64
+		if j+1 < len(node.tracks) {
+			nextEntity = *entityID + 1
+		}
+		if _, err := tx.Exec(`INSERT INTO PlaylistEntity (id, listId, trackId, databaseUuid,
+			nextEntityId, membershipReference) VALUES (?, ?, ?, ?, ?, 0)`,
+			*entityID, node.id, trackID, uuid, nextEntity); err != nil {
+			return err
+		}
+	}
+	if node.stored {
+		_, err := tx.Exec(`UPDATE Playlist SET lastEditTime = ? WHERE id = ?`, now, node.id)
+		return err
+	}
+	return nil
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
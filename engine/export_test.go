@@ -0,0 +1,345 @@
+package engine
+
+import (
+	"bytes"
+	"compress/zlib"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ilmarkerm/djlibgo/internal/testfixture"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// readBack reads the exported library and indexes its tracks by title and
+// its playlists by path
+func readBack(t *testing.T, root string) (map[string]*traktor.Track, map[string]*traktor.Playlist) {
+	t.Helper()
+	library, err := ReadLibrary(root)
+	if err != nil {
+		t.Fatalf("ReadLibrary: %v", err)
+	}
+	return testfixture.Index(library)
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "drive")
+	collection := testfixture.Collection(t, dir)
+	if err := Export(root, collection, ExportOptions{CopyFiles: true}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if err := Verify(root, collection, ExportOptions{CopyFiles: true}); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	tracks, playlists := readBack(t, root)
+	if len(tracks) != 3 {
+		t.Fatalf("read %d tracks, want 3", len(tracks))
+	}
+
+	one := tracks["One"]
+	if one == nil {
+		t.Fatal("track One is missing")
+	}
+	if one.FilePath != copyTarget(LibraryPath(root), collection.Tracks[0].FilePath) {
+		t.Errorf("path %s is not in the drive's Music folder", one.FilePath)
+	}
+	if one.MusicalKey != 21 {
+		t.Errorf("key %d, want 21", one.MusicalKey)
+	}
+	if math.Abs(one.BPM-124) > 0.001 {
+		t.Errorf("BPM %.3f, want 124", one.BPM)
+	}
+	if tracks["Three"].MusicalKey != -1 {
+		t.Errorf("track without key read back with key %d", tracks["Three"].MusicalKey)
+	}
+
+	grid := testfixture.FindCue(one, traktor.CueTypeGrid, -1)
+	if grid == nil || grid.Grid == nil {
+		t.Fatal("beat grid is missing")
+	}
+	if math.Abs(grid.Grid.Bpm-124) > 0.001 {
+		t.Errorf("grid BPM %.3f, want 124", grid.Grid.Bpm)
+	}
+	// The grid is anchored on the first beat of the track
+	beat := 60000 / 124.0
+	if offset := math.Mod(1250-grid.Start, beat); math.Abs(offset) > 0.1 && math.Abs(offset-beat) > 0.1 {
+		t.Errorf("grid anchor %.2f ms is not on the beat of 1250 ms", grid.Start)
+	}
+
+	for _, want := range []struct {
+		hotCue int
+		start  float64
+		name   string
+	}{{0, 61000, "Drop"}, {3, 122500, "Break"}} {
+		cue := testfixture.FindCue(one, traktor.CueTypeCue, want.hotCue)
+		if cue == nil {
+			t.Errorf("hot cue %d is missing", want.hotCue+1)
+			continue
+		}
+		if math.Abs(cue.Start-want.start) > 0.1 || cue.Name != want.name {
+			t.Errorf("hot cue %d is %q at %.2f, want %q at %.0f", want.hotCue+1, cue.Name, cue.Start, want.name, want.start)
+		}
+	}
+	loop := testfixture.FindCue(one, traktor.CueTypeLoop, 5)
+	if loop == nil {
+		t.Fatal("loop in slot 6 is missing")
+	}
+	if math.Abs(loop.Start-90000) > 0.1 || math.Abs(loop.Len-7741.935) > 0.1 {
+		t.Errorf("loop at %.2f for %.2f ms, want 90000 for 7741.935", loop.Start, loop.Len)
+	}
+
+	testfixture.CheckTitles(t, playlists, "Set/A", "Three", "One")
+	testfixture.CheckTitles(t, playlists, "Set/B", "Two")
+}
+
+func TestExportMerges(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "drive")
+	collection := testfixture.Collection(t, dir)
+	a := collection.GetPlaylistByPath("Set/A")
+	b := collection.GetPlaylistByPath("Set/B")
+
+	if err := Export(root, collection, ExportOptions{Playlists: []*traktor.Playlist{a}}); err != nil {
+		t.Fatalf("Export A: %v", err)
+	}
+	if err := Export(root, collection, ExportOptions{Playlists: []*traktor.Playlist{b}}); err != nil {
+		t.Fatalf("Export B: %v", err)
+	}
+	tracks, playlists := readBack(t, root)
+	if len(tracks) != 3 {
+		t.Errorf("read %d tracks after two exports, want 3", len(tracks))
+	}
+	testfixture.CheckTitles(t, playlists, "Set/A", "Three", "One")
+	testfixture.CheckTitles(t, playlists, "Set/B", "Two")
+
+	// Exporting a playlist again replaces its entries and updates its tracks
+	a.Tracks = []*traktor.Track{a.Tracks[1], b.Tracks[0]}
+	a.Tracks[0].BPM = 125
+	a.Tracks[0].CuePoints[0].Grid.Bpm = 125
+	if err := Export(root, collection, ExportOptions{Playlists: []*traktor.Playlist{a}}); err != nil {
+		t.Fatalf("Export A again: %v", err)
+	}
+	if err := Verify(root, collection, ExportOptions{Playlists: []*traktor.Playlist{a}}); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	tracks, playlists = readBack(t, root)
+	if len(tracks) != 3 {
+		t.Errorf("read %d tracks after the update, want 3", len(tracks))
+	}
+	if math.Abs(tracks["One"].BPM-125) > 0.001 {
+		t.Errorf("updated BPM %.3f, want 125", tracks["One"].BPM)
+	}
+	testfixture.CheckTitles(t, playlists, "Set/A", "One", "Two")
+	testfixture.CheckTitles(t, playlists, "Set/B", "Two")
+	if len(playlists) != 2 {
+		t.Errorf("read %d playlists, want 2", len(playlists))
+	}
+	if _, err := os.Stat(DatabasePath(root) + ".bak"); err != nil {
+		t.Errorf("no backup of the previous database: %v", err)
+	}
+}
+
+func TestExportFailureKeepsDatabase(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "drive")
+	collection := testfixture.Collection(t, dir)
+
+	// A missing file fails the export of a new database without leaving it behind
+	missing := collection.Tracks[1].FilePath
+	if err := os.Rename(missing, missing+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Export(root, collection, ExportOptions{CopyFiles: true}); err == nil {
+		t.Fatal("Export with a missing file succeeded")
+	}
+	if _, err := os.Stat(DatabasePath(root)); !os.IsNotExist(err) {
+		t.Errorf("failed export left a database behind: %v", err)
+	}
+
+	// A failed export into an existing database keeps its contents
+	if err := os.Rename(missing+".moved", missing); err != nil {
+		t.Fatal(err)
+	}
+	if err := Export(root, collection, ExportOptions{CopyFiles: true}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if err := os.Remove(missing); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(copyTarget(LibraryPath(root), missing))
+	if err := Export(root, collection, ExportOptions{CopyFiles: true}); err == nil {
+		t.Fatal("Export with a missing file succeeded")
+	}
+	tracks, playlists := readBack(t, root)
+	if len(tracks) != 3 {
+		t.Errorf("read %d tracks after a failed export, want 3", len(tracks))
+	}
+	testfixture.CheckTitles(t, playlists, "Set/A", "Three", "One")
+}
+
+func TestExportCopiesSameNamedFiles(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "drive")
+	collection := testfixture.Collection(t, dir)
+	// A file of the same name and size from another folder
+	other := filepath.Join(dir, "other", "One.mp3")
+	if err := os.MkdirAll(filepath.Dir(other), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(other, []byte("audio Six"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	two := &collection.Tracks[1]
+	two.FilePath = other
+
+	// Each export order gives every file the same copy
+	for _, order := range [][]*traktor.Track{{&collection.Tracks[0], two}, {two, &collection.Tracks[0]}} {
+		playlist := &traktor.Playlist{Name: "Order", Path: "Order", Tracks: order}
+		if err := Export(root, collection, ExportOptions{Playlists: []*traktor.Playlist{playlist}, CopyFiles: true}); err != nil {
+			t.Fatalf("Export: %v", err)
+		}
+		tracks, _ := readBack(t, root)
+		for _, track := range order {
+			data, err := os.ReadFile(tracks[track.Title].FilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, _ := os.ReadFile(track.FilePath); string(data) != string(want) {
+				t.Errorf("%s plays %q, want %q", track.Title, data, want)
+			}
+		}
+	}
+
+	// A changed source of the same size is copied again
+	if err := os.WriteFile(other, []byte("audio Ten"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(other, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := Export(root, collection, ExportOptions{CopyFiles: true}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if data, _ := os.ReadFile(copyTarget(LibraryPath(root), other)); string(data) != "audio Ten" {
+		t.Errorf("copy has %q after the source changed", data)
+	}
+}
+
+// TestExportBlobLayout compares the performance data of track One with bytes
+// built by hand from the blob layouts documented by libdjinterop, so a
+// mistake shared by the writer and the reader does not go unnoticed
+func TestExportBlobLayout(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "drive")
+	if err := Export(root, testfixture.Collection(t, dir), ExportOptions{}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	db, err := sql.Open("sqlite", DatabasePath(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var trackBlob, beatBlob, cueBlob, loopBlob []byte
+	err = db.QueryRow("SELECT trackData, beatData, quickCues, loops FROM Track WHERE title = 'One'").
+		Scan(&trackBlob, &beatBlob, &cueBlob, &loopBlob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The placeholder file cannot be decoded, so the sample rate is 44100 and
+	// the track 300 s long. Samples are counted at 44100 per second.
+	const (
+		rate      = "40e5888000000000" // 44100.0
+		noOffset  = "bff0000000000000" // -1.0
+		drop      = "4144861a00000000" // 61 s
+		breakDown = "41549ba280000000" // 122.5 s
+	)
+	wantTrack := rate +
+		"0000000000c9dfb0" + // 13230000 samples
+		"0000000000000000" + // loudness
+		"00000001" // A minor, Engine DJ counts keys along the circle of fifths
+	emptyCue := "00" + noOffset + "00000000"
+	wantCues := "0000000000000008" +
+		"04" + hex.EncodeToString([]byte("Drop")) + drop + "ff0066ff" + // ARGB
+		emptyCue + emptyCue +
+		"05" + hex.EncodeToString([]byte("Break")) + breakDown + "ff0066ff" +
+		emptyCue + emptyCue + emptyCue + emptyCue +
+		drop + "00" + drop // main cue, not adjusted, analysed main cue
+	// Offsets are little endian
+	wantMarkers := "0000000000000002" +
+		"11420821b4ccf1c0" + "fcffffffffffffff" + "71020000" + "00000000" + // -72907.26, beat -4, 625 beats
+		"95524a49754c6941" + "6d02000000000000" + "00000000" + "00000000" // 13263786.29, beat 621
+	wantBeats := rate +
+		"41693bf600000000" + // 13230000.0 samples
+		"01" + wantMarkers + wantMarkers
+	// The loops blob is uncompressed and little endian throughout
+	emptyLoop := "00" + "000000000000f0bf" + "000000000000f0bf" + "0000" + "00000000"
+	wantLoops := "0800000000000000" +
+		emptyLoop + emptyLoop + emptyLoop + emptyLoop + emptyLoop +
+		"04" + hex.EncodeToString([]byte("Loop")) +
+		"00000000f4474e41" + "621058d564715041" + // 3969000 to 4310419.33
+		"0101" + "ff00c83c" +
+		emptyLoop + emptyLoop
+
+	for _, blob := range []struct {
+		name string
+		data []byte
+		want string
+	}{{"trackData", trackBlob, wantTrack}, {"quickCues", cueBlob, wantCues}, {"beatData", beatBlob, wantBeats}} {
+		// qCompress: the uncompressed length, big endian, and a zlib stream
+		if len(blob.data) < 4 {
+			t.Errorf("%s is %d bytes", blob.name, len(blob.data))
+			continue
+		}
+		reader, err := zlib.NewReader(bytes.NewReader(blob.data[4:]))
+		if err != nil {
+			t.Errorf("%s is not zlib compressed: %v", blob.name, err)
+			continue
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Errorf("%s: %v", blob.name, err)
+			continue
+		}
+		if size := binary.BigEndian.Uint32(blob.data); int(size) != len(data) {
+			t.Errorf("%s gives its size as %d, it is %d bytes", blob.name, size, len(data))
+		}
+		if got := hex.EncodeToString(data); got != blob.want {
+			t.Errorf("%s is\n%s\nwant\n%s", blob.name, got, blob.want)
+		}
+	}
+	if got := hex.EncodeToString(loopBlob); got != wantLoops {
+		t.Errorf("loops is\n%s\nwant\n%s", got, wantLoops)
+	}
+}
+
+func TestExportFileSize(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "drive")
+	collection := testfixture.Collection(t, dir)
+	for i := range collection.Tracks {
+		collection.Tracks[i].FileSize = 5 << 20
+	}
+	// Without its audio file the track keeps the size from the collection
+	if err := os.Remove(collection.Tracks[1].FilePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := Export(root, collection, ExportOptions{}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	tracks, _ := readBack(t, root)
+	if got := tracks["Two"].FileSize; got != 5<<20 {
+		t.Errorf("missing file exported with size %d, want %d", got, 5<<20)
+	}
+	if got, want := tracks["One"].FileSize, len("audio One"); got != want {
+		t.Errorf("file exported with size %d, want %d from the disk", got, want)
+	}
+}
@@ -0,0 +1,287 @@
+package engine
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// ReadLibrary reads the Engine DJ database below root, e.g. a prepared USB
+// drive, into the common collection model. Hot cues, loops and the beat grid
+// are converted back into Traktor cue points.
+func ReadLibrary(root string) (*traktor.TraktorCollection, error) {
+	db, err := sql.Open("sqlite", "file:"+filepath.ToSlash(DatabasePath(root))+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var major, minor, patch int
+	if err := db.QueryRow(`SELECT schemaVersionMajor, schemaVersionMinor, schemaVersionPatch
+		FROM Information`).Scan(&major, &minor, &patch); err != nil {
+		return nil, err
+	}
+
+	tracks, keys, err := readTracks(db, LibraryPath(root))
+	if err != nil {
+		return nil, err
+	}
+	playlists, err := readPlaylists(db, keys)
+	if err != nil {
+		return nil, err
+	}
+	version := fmt.Sprintf("Engine DJ %d.%d.%d", major, minor, patch)
+	return traktor.NewCollection(version, tracks, playlists), nil
+}
+
+// readTracks reads all tracks and returns them with their primary keys by id
+func readTracks(db *sql.DB, libraryDir string) ([]traktor.Track, map[int64]string, error) {
+	rows, err := db.Query(`SELECT id, path, COALESCE(title, ''), COALESCE(artist, ''),
+		COALESCE(album, ''), COALESCE(genre, ''), COALESCE(comment, ''), COALESCE(label, ''),
+		COALESCE(composer, ''), COALESCE(remixer, ''), COALESCE(key, -1), COALESCE(rating, 0),
+		COALESCE(length, 0), COALESCE(bitrate, 0), COALESCE(fileBytes, 0),
+		COALESCE(bpmAnalyzed, 0), year, dateAdded, trackData, beatData, quickCues, loops
+		FROM Track ORDER BY id`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var tracks []traktor.Track
+	keys := make(map[int64]string)
+	for rows.Next() {
+		var id, key, rating, length, bitrate, fileBytes int64
+		var path string
+		var year, dateAdded sql.NullInt64
+		var data, beats, cues, loopData []byte
+		track := traktor.Track{}
+		if err := rows.Scan(&id, &path, &track.Title, &track.Artist, &track.Album,
+			&track.Genre, &track.Comment, &track.Label, &track.Producer, &track.Remixer,
+			&key, &rating, &length, &bitrate, &fileBytes, &track.BPM, &year, &dateAdded,
+			&data, &beats, &cues, &loopData); err != nil {
+			return nil, nil, err
+		}
+
+		if !filepath.IsAbs(path) && !strings.Contains(path, ":") {
+			path = filepath.Join(libraryDir, filepath.FromSlash(path))
+		}
+		track.FilePath = path
+		track.FileName = filepath.Base(path)
+		track.PrimaryKey = path
+		track.Duration = float64(length)
+		track.Bitrate = int(bitrate) * 1000
+		track.FileSize = int(fileBytes)
+		track.Rating = int(rating) / 20 * 51
+		track.MusicalKey, _ = fromEngineKey(int(key))
+		track.Key = traktor.KeyValueToNotation(track.MusicalKey, traktor.NotationOpenKey)
+		if year.Valid && year.Int64 > 0 {
+			track.ReleaseDate = fmt.Sprintf("%d/1/1", year.Int64)
+		}
+		if dateAdded.Valid {
+			track.ImportDate = time.Unix(dateAdded.Int64, 0).Format("2006/1/2")
+		}
+		track.CuePoints = readCuePoints(data, beats, cues, loopData)
+
+		keys[id] = track.PrimaryKey
+		tracks = append(tracks, track)
+	}
+	return tracks, keys, rows.Err()
+}
+
+// readCuePoints converts the performance data blobs into Traktor cue points.
+// Blobs that cannot be decoded are skipped.
+func readCuePoints(data, beats, cues, loopData []byte) []traktor.CuePoint {
+	info, err := decodeTrackData(data)
+	if err != nil || info.SampleRate <= 0 {
+		return nil
+	}
+	toMillis := func(samples float64) float64 { return samples / info.SampleRate * 1000 }
+
+	var points []traktor.CuePoint
+	if grid, err := decodeBeatData(beats); err == nil && len(grid.Adjusted) >= 2 {
+		first, last := grid.Adjusted[0], grid.Adjusted[len(grid.Adjusted)-1]
+		if span := last.Beat - first.Beat; span > 0 {
+			samplesPerBeat := (last.Offset - first.Offset) / float64(span)
+			// Anchor the grid on the first beat at or after the track start
+			anchor := first.Offset - float64(first.Beat)*samplesPerBeat
+			anchor -= math.Floor(anchor/samplesPerBeat) * samplesPerBeat
+			points = append(points, traktor.CuePoint{
+				Name:    "AutoGrid",
+				Type:    traktor.CueTypeGrid,
+				Start:   toMillis(anchor),
+				Repeats: -1,
+				HotCue:  -1,
+				Grid:    &traktor.Grid{Bpm: 60 * info.SampleRate / samplesPerBeat},
+			})
+		}
+	}
+	if quick, err := decodeQuickCues(cues); err == nil {
+		for i, cue := range quick.Cues {
+			if cue.Offset < 0 {
+				continue
+			}
+			points = append(points, traktor.CuePoint{
+				Name:    cue.Label,
+				Type:    traktor.CueTypeCue,
+				Start:   toMillis(cue.Offset),
+				Repeats: -1,
+				HotCue:  i,
+			})
+		}
+	}
+	if saved, err := decodeLoops(loopData); err == nil {
+		for i, lp := range saved {
+			if lp.Start < 0 || lp.End < lp.Start {
+				continue
+			}
+			points = append(points, traktor.CuePoint{
+				Name:    lp.Label,
+				Type:    traktor.CueTypeLoop,
+				Start:   toMillis(lp.Start),
+				Len:     toMillis(lp.End - lp.Start),
+				Repeats: -1,
+				HotCue:  i,
+			})
+		}
+	}
+	return points
+}
+
+// engineList is a Playlist row while the hierarchy is rebuilt
+type engineList struct {
+	id, parent, next int64
+	title            string
+}
+
+// readPlaylists follows the sibling and entry linked lists to rebuild the
+// playlists in their Engine DJ order. Lists with sub playlists but no tracks are
+// folders and are left out.
+func readPlaylists(db *sql.DB, keys map[int64]string) ([]traktor.Playlist, error) {
+	rows, err := db.Query(`SELECT id, COALESCE(parentListId, 0), COALESCE(nextListId, 0), title FROM Playlist`)
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[int64][]*engineList)
+	for rows.Next() {
+		list := &engineList{}
+		if err := rows.Scan(&list.id, &list.parent, &list.next, &list.title); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		children[list.parent] = append(children[list.parent], list)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	entries, err := readEntries(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var playlists []traktor.Playlist
+	var walk func(parent int64, path string)
+	walk = func(parent int64, path string) {
+		for _, list := range orderLists(children[parent]) {
+			listPath := list.title
+			if path != "" {
+				listPath = path + "/" + list.title
+			}
+			trackIDs := entries[list.id]
+			if len(trackIDs) > 0 || len(children[list.id]) == 0 {
+				playlist := traktor.Playlist{Name: list.title, Path: listPath}
+				for _, id := range trackIDs {
+					if key, exists := keys[id]; exists {
+						playlist.TrackKeys = append(playlist.TrackKeys, key)
+					}
+				}
+				playlists = append(playlists, playlist)
+			}
+			walk(list.id, listPath)
+		}
+	}
+	walk(0, "")
+	return playlists, nil
+}
+
+// orderLists sorts siblings by following nextListId from the list no other
+// sibling points to. Lists outside the chain are appended at the end.
+func orderLists(siblings []*engineList) []*engineList {
+	pointedTo := make(map[int64]bool)
+	byID := make(map[int64]*engineList)
+	for _, list := range siblings {
+		pointedTo[list.next] = true
+		byID[list.id] = list
+	}
+	var ordered []*engineList
+	done := make(map[int64]bool)
+	for _, list := range siblings {
+		if pointedTo[list.id] {
+			continue
+		}
+		for current := list; current != nil && !done[current.id]; current = byID[current.next] {
+			done[current.id] = true
+			ordered = append(ordered, current)
+		}
+	}
+	for _, list := range siblings {
+		if !done[list.id] {
+			ordered = append(ordered, list)
+		}
+	}
+	return ordered
+}
+
+// readEntries returns the track ids of each playlist in playlist order
+func readEntries(db *sql.DB) (map[int64][]int64, error) {
+	rows, err := db.Query(`SELECT id, listId, trackId, COALESCE(nextEntityId, 0) FROM PlaylistEntity`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type entity struct{ id, list, track, next int64 }
+	byList := make(map[int64][]entity)
+	for rows.Next() {
+		var e entity
+		if err := rows.Scan(&e.id, &e.list, &e.track, &e.next); err != nil {
+			return nil, err
+		}
+		byList[e.list] = append(byList[e.list], e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make(map[int64][]int64, len(byList))
+	for list, entities := range byList {
+		byID := make(map[int64]entity, len(entities))
+		pointedTo := make(map[int64]bool, len(entities))
+		for _, e := range entities {
+			byID[e.id] = e
+			pointedTo[e.next] = true
+		}
+		done := make(map[int64]bool, len(entities))
+		for _, e := range entities {
+			if pointedTo[e.id] {
+				continue
+			}
+			for current, ok := e, true; ok && !done[current.id]; current, ok = byID[current.next] {
+				done[current.id] = true
+				result[list] = append(result[list], current.track)
+			}
+		}
+		for _, e := range entities {
+			if !done[e.id] {
+				result[list] = append(result[list], e.track)
+			}
+		}
+	}
+	return result, nil
+}
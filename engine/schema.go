@@ -0,0 +1,132 @@
+package engine
+
+// Schema version of the Engine DJ 2.x database written by the exporter
+const (
+	schemaMajor = 2
+	schemaMinor = 18
+	schemaPatch = 0
+)
+
+// libraryDir is the folder Engine DJ looks for on a drive
+const libraryDir = "Engine Library"
+
+// databaseDir and databaseFile locate the main database inside libraryDir
+const (
+	databaseDir  = "Database2"
+	databaseFile = "m.db"
+)
+
+// schema creates the tables of an Engine DJ 2.x database that hold tracks and
+// playlists
+var schema = []string{
+	`CREATE TABLE Information (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		uuid TEXT,
+		schemaVersionMajor INTEGER,
+		schemaVersionMinor INTEGER,
+		schemaVersionPatch INTEGER,
+		currentPlayedIndiciator INTEGER,
+		lastRekordBoxLibraryImportReadCounter INTEGER)`,
+	`CREATE TABLE AlbumArt (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		hash TEXT,
+		albumArt BLOB)`,
+	`CREATE TABLE Pack (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		packId TEXT,
+		changeLogDatabaseUuid TEXT,
+		changeLogId INTEGER,
+		lastPackTime DATETIME)`,
+	`CREATE TABLE Track (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		playOrder INTEGER,
+		length INTEGER,
+		bpm INTEGER,
+		year INTEGER,
+		path TEXT,
+		filename TEXT,
+		bitrate INTEGER,
+		bpmAnalyzed REAL,
+		albumArtId INTEGER,
+		fileBytes INTEGER,
+		title TEXT,
+		artist TEXT,
+		album TEXT,
+		genre TEXT,
+		comment TEXT,
+		label TEXT,
+		composer TEXT,
+		remixer TEXT,
+		key INTEGER,
+		rating INTEGER,
+		albumArt TEXT,
+		timeLastPlayed DATETIME,
+		isPlayed BOOLEAN,
+		fileType TEXT,
+		isAnalyzed BOOLEAN,
+		dateCreated DATETIME,
+		dateAdded DATETIME,
+		isAvailable BOOLEAN,
+		isMetadataOfPackedTrackChanged BOOLEAN,
+		isPerfomanceDataOfPackedTrackChanged BOOLEAN,
+		playedIndicator INTEGER,
+		isMetadataImported BOOLEAN,
+		pdbImportKey INTEGER,
+		streamingSource TEXT,
+		uri TEXT,
+		isBeatGridLocked BOOLEAN,
+		originDatabaseUuid TEXT,
+		originTrackId INTEGER,
+		trackData BLOB,
+		overviewWaveFormData BLOB,
+		beatData BLOB,
+		quickCues BLOB,
+		loops BLOB,
+		thirdPartySourceId INTEGER,
+		streamingFlags INTEGER,
+		explicitLyrics BOOLEAN,
+		activeOnLoadLoops INTEGER,
+		lastEditTime DATETIME,
+		CONSTRAINT C_originDatabaseUuid_originTrackId UNIQUE (originDatabaseUuid, originTrackId),
+		CONSTRAINT C_path UNIQUE (path),
+		FOREIGN KEY (albumArtId) REFERENCES AlbumArt (id) ON DELETE RESTRICT)`,
+	`CREATE TABLE Playlist (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT,
+		parentListId INTEGER,
+		isPersisted BOOLEAN,
+		nextListId INTEGER,
+		lastEditTime DATETIME,
+		isExplicitlyExported BOOLEAN,
+		CONSTRAINT C_NAME_UNIQUE_FOR_PARENT UNIQUE (title, parentListId),
+		CONSTRAINT C_NEXT_LIST_ID_UNIQUE_FOR_PARENT UNIQUE (parentListId, nextListId))`,
+	`CREATE TABLE PlaylistEntity (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		listId INTEGER,
+		trackId INTEGER,
+		databaseUuid TEXT,
+		nextEntityId INTEGER,
+		membershipReference INTEGER,
+		CONSTRAINT C_NAME_UNIQUE_FOR_LIST UNIQUE (listId, databaseUuid, trackId),
+		FOREIGN KEY (listId) REFERENCES Playlist (id) ON DELETE CASCADE)`,
+	`CREATE TABLE Smartlist (
+		listUuid TEXT NOT NULL PRIMARY KEY,
+		title TEXT,
+		parentPlaylistPath TEXT,
+		nextPlaylistPath TEXT,
+		nextListUuid TEXT,
+		rules TEXT,
+		lastEditTime DATETIME,
+		CONSTRAINT C_NAME_UNIQUE_FOR_PARENT UNIQUE (title, parentPlaylistPath),
+		CONSTRAINT C_NEXT_LIST_UNIQUE_FOR_PARENT UNIQUE (parentPlaylistPath, nextPlaylistPath, nextListUuid))`,
+	`CREATE TABLE PreparelistEntity (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		trackId INTEGER,
+		trackNumber INTEGER,
+		FOREIGN KEY (trackId) REFERENCES Track (id) ON DELETE CASCADE)`,
+	`CREATE INDEX index_Track_filename ON Track (filename)`,
+	`CREATE INDEX index_Track_albumArtId ON Track (albumArtId)`,
+	`CREATE INDEX index_PlaylistEntity_nextEntityId_listId ON PlaylistEntity(nextEntityId, listId)`,
+	// Tracks refer to album art 1 when they have no cover
+	`INSERT INTO AlbumArt (id, hash, albumArt) VALUES (1, '', NULL)`,
+}
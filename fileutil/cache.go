@@ -0,0 +1,67 @@
+package fileutil
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CachePath returns the path of name in the djlibgo folder of the user's
+// cache folder, or of the temporary folder when there is none
+func CachePath(name string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "djlibgo", name)
+}
+
+// WriteAtomic writes a file through a temporary file next to it, which is
+// renamed over path once complete, so readers in other goroutines never see
+// a partly written file. The folder is created when missing.
+func WriteAtomic(path string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*"+filepath.Ext(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	buffered := bufio.NewWriter(tmp)
+	if err := write(buffered); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// PruneCache removes the files in dir whose names start with prefix but not
+// with keep. Caches name their files by item and version, so this drops the
+// files of older versions of an item. Returns the number of removed files.
+func PruneCache(dir, prefix, keep string) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	removed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || strings.HasPrefix(name, keep) {
+			continue
+		}
+		if os.Remove(filepath.Join(dir, name)) == nil {
+			removed++
+		}
+	}
+	return removed
+}
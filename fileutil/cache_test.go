@@ -0,0 +1,64 @@
+package fileutil
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ab", "item.wf")
+	err := WriteAtomic(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, "data")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WriteAtomic: %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "data" {
+		t.Errorf("read %q, %v", data, err)
+	}
+
+	// A failed write keeps the old file and leaves no temporary file behind
+	failure := errors.New("failed")
+	err = WriteAtomic(path, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("WriteAtomic returned %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "data" {
+		t.Errorf("the failed write changed the file to %q", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("the folder holds %d files, want 1", len(entries))
+	}
+}
+
+func TestPruneCache(t *testing.T) {
+	dir := t.TempDir()
+	kept := map[string]bool{
+		"item-old-32.jpg":  false,
+		"item-old-256.jpg": false,
+		"item-new-32.jpg":  true,
+		"item-new-256.jpg": true,
+		"other-old-32.jpg": true,
+	}
+	for name := range kept {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if removed := PruneCache(dir, "item-", "item-new-"); removed != 2 {
+		t.Errorf("removed %d files, want 2", removed)
+	}
+	for name, want := range kept {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != want {
+			t.Errorf("%s kept: %v, want %v", name, err == nil, want)
+		}
+	}
+}
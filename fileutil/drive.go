@@ -0,0 +1,41 @@
+package fileutil
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// DriveRoot returns the root of the drive path is on and the name the drive
+// is known by. Windows drives are named by their letter. On macOS drives are
+// mounted at /Volumes/<name>, on Linux at /media/<user>/<name> or
+// /run/media/<user>/<name>, so the mount folder gives the name. Other paths
+// are on the system drive, which has the root "/" and no name.
+func DriveRoot(path string) (string, string) {
+	path = filepath.Clean(path)
+	if volume := filepath.VolumeName(path); volume != "" {
+		return volume + string(filepath.Separator), volume
+	}
+	slashed := filepath.ToSlash(path)
+	for _, mounts := range []string{"/Volumes/", "/run/media/", "/media/"} {
+		rest, found := strings.CutPrefix(slashed, mounts)
+		if !found {
+			continue
+		}
+		prefix := mounts
+		if mounts != "/Volumes/" {
+			// Linux mounts drives per user
+			user, after, ok := strings.Cut(rest, "/")
+			if !ok {
+				break
+			}
+			prefix += user + "/"
+			rest = after
+		}
+		name, _, _ := strings.Cut(rest, "/")
+		if name == "" {
+			break
+		}
+		return filepath.FromSlash(prefix + name), name
+	}
+	return string(filepath.Separator), ""
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package fileutil
+
+import "testing"
+
+func TestDriveRoot(t *testing.T) {
+	for _, test := range []struct {
+		path, root, name string
+	}{
+		{"/Volumes/Stick/_Serato_", "/Volumes/Stick", "Stick"},
+		{"/Volumes/Stick", "/Volumes/Stick", "Stick"},
+		{"/media/dj/USB/Music/x.mp3", "/media/dj/USB", "USB"},
+		{"/run/media/dj/USB/_Serato_", "/run/media/dj/USB", "USB"},
+		{"/media/dj", "/", ""},
+		{"/home/dj/Music/_Serato_", "/", ""},
+	} {
+		root, name := DriveRoot(test.path)
+		if root != test.root || name != test.name {
+			t.Errorf("DriveRoot(%q) = %q, %q, want %q, %q", test.path, root, name, test.root, test.name)
+		}
+	}
+}
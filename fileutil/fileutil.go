@@ -0,0 +1,87 @@
+// Package fileutil holds the file copying and naming helpers shared by the
+// exports that write audio files, playlists and libraries to disk, and the
+// file helpers of the caches
+package fileutil
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SanitizeFileName replaces characters that are not allowed in file names
+func SanitizeFileName(name string) string {
+	replacer := strings.NewReplacer(
+		"/", "_", "\\", "_", ":", "_", "*", "_", "?", "_",
+		"\"", "_", "<", "_", ">", "_", "|", "_",
+	)
+	name = strings.TrimSpace(replacer.Replace(name))
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// UniqueFileName returns name, or name with a number added when it is used
+// already, and marks the result as used. Drives are often case insensitive,
+// so case is ignored.
+func UniqueFileName(name string, used map[string]bool) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for n := 2; used[strings.ToLower(candidate)]; n++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// CopyFile copies src to dst, creating the folder of dst when it is missing
+func CopyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// SyncFile copies src to dst unless dst has the same size and modification
+// time, and gives the copy the modification time of src. FAT drives store
+// times in two second steps, so close times match. Returns whether the file
+// was copied.
+func SyncFile(src, dst string) (bool, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return false, err
+	}
+	if existing, err := os.Stat(dst); err == nil && existing.Size() == info.Size() {
+		if diff := existing.ModTime().Sub(info.ModTime()); diff > -2*time.Second && diff < 2*time.Second {
+			return false, nil
+		}
+	}
+	if err := CopyFile(src, dst); err != nil {
+		return false, err
+	}
+	return true, os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// Backup keeps a .bak copy of a file next to it. The file is copied rather
+// than linked, as databases are changed in place.
+func Backup(path string) error {
+	return CopyFile(path, path+".bak")
+}
@@ -0,0 +1,102 @@
+package fileutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Manifest records the files an export wrote below a root folder, so a later
+// export only ever removes files it wrote itself. Paths are "/" separated and
+// relative to the root.
+type Manifest struct {
+	Files []string `json:"files"`
+	// Playlists are the playlist files, kept apart from the audio files
+	Playlists []string `json:"playlists,omitempty"`
+}
+
+// ReadManifest reads the manifest called name below root. A missing manifest
+// is empty.
+func ReadManifest(root, name string) (*Manifest, error) {
+	m := &Manifest{}
+	data, err := os.ReadFile(filepath.Join(root, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return m, nil
+}
+
+// Write writes the manifest as name below root
+func (m *Manifest) Write(root, name string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(root, name), data, 0644)
+}
+
+// Merge returns a manifest with the files of both, each listed once
+func (m *Manifest) Merge(other *Manifest) *Manifest {
+	return &Manifest{
+		Files:     mergePaths(m.Files, other.Files),
+		Playlists: mergePaths(m.Playlists, other.Playlists),
+	}
+}
+
+func mergePaths(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var merged []string
+	for _, path := range append(append([]string{}, a...), b...) {
+		if !seen[strings.ToLower(path)] {
+			seen[strings.ToLower(path)] = true
+			merged = append(merged, path)
+		}
+	}
+	return merged
+}
+
+// RemoveStale deletes the files of the previous manifest that the current
+// one no longer lists, and then the folders left empty. Paths outside root
+// are never touched. Returns the number of removed files.
+func RemoveStale(root string, previous, current *Manifest) int {
+	root = filepath.Clean(root)
+	keep := make(map[string]bool)
+	for _, path := range append(append([]string{}, current.Files...), current.Playlists...) {
+		keep[strings.ToLower(path)] = true
+	}
+	removed := 0
+	dirs := make(map[string]bool)
+	for _, path := range append(append([]string{}, previous.Files...), previous.Playlists...) {
+		if keep[strings.ToLower(path)] || !filepath.IsLocal(filepath.FromSlash(path)) {
+			continue
+		}
+		full := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.Remove(full); err == nil {
+			removed++
+			for dir := filepath.Dir(full); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+				dirs[dir] = true
+			}
+		}
+	}
+
+	// Deepest folders first, os.Remove fails for folders that are not empty
+	ordered := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		ordered = append(ordered, dir)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return len(ordered[i]) > len(ordered[j]) })
+	for _, dir := range ordered {
+		os.Remove(dir)
+	}
+	return removed
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/ilmarkerm/djlibgo/analysis"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// runFingerprint brings the fingerprint index next to the collection up to
+// date, then lists the collection tracks with the same audio as each file
+// given as argument, and with -duplicates the groups of tracks that are
+// copies of each other. Ctrl-C stops indexing and keeps the finished
+// fingerprints.
+func runFingerprint(args []string) error {
+	flags := flag.NewFlagSet("fingerprint", flag.ContinueOnError)
+	collectionPath := flags.String("collection", "", "collection.nml to index, defaults to the Traktor collection")
+	workers := flags.Int("workers", 0, "number of files fingerprinted in parallel, defaults to the number of CPUs")
+	duplicates := flags.Bool("duplicates", false, "list tracks with the same audio, such as copies in other formats")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var collection *traktor.TraktorCollection
+	var err error
+	if *collectionPath != "" {
+		collection, err = traktor.ParseCollectionFromPath(*collectionPath)
+	} else {
+		collection, err = traktor.ParseCollection()
+	}
+	if err != nil {
+		return fmt.Errorf("reading collection: %w", err)
+	}
+	index, err := analysis.OpenFingerprintIndex(analysis.FingerprintIndexPath(collection))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	failed, updateErr := index.Update(ctx, analysis.CollectionPaths(collection), *workers, func(done, total int) {
+		fmt.Fprintf(os.Stderr, "\rfingerprinted %d of %d", done, total)
+	})
+	fmt.Fprintln(os.Stderr)
+	for path, err := range failed {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+	}
+	if err := index.Save(); err != nil {
+		return err
+	}
+	if updateErr != nil {
+		return updateErr
+	}
+	fmt.Printf("%d tracks in the fingerprint index\n", index.Len())
+
+	for _, path := range flags.Args() {
+		matches, err := analysis.FindMatchingTracks(ctx, collection, index, path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Printf("\n%s: %d matching tracks\n", path, len(matches))
+		for _, match := range matches {
+			fmt.Printf("  %s (%.0f%%, from %s) %s\n", analysis.TrackName(match.Track), match.Score*100,
+				traktor.FormatDuration(match.Offset), match.Track.FilePath)
+		}
+	}
+
+	if *duplicates {
+		groups := analysis.FindDuplicateTracks(collection, index)
+		fmt.Printf("\n%d groups of duplicate tracks\n", len(groups))
+		for _, group := range groups {
+			fmt.Println()
+			for _, track := range group {
+				fmt.Printf("  %s %s\n", analysis.TrackName(track), track.FilePath)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Package testfixture holds the collection the export tests write to disk
+// and the helpers they use to look at what they read back
+package testfixture
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// Collection builds a collection of three tracks whose files are small
+// placeholders in dir, with playlists "Set/A" and "Set/B". Track One has a
+// beat grid at 1250 ms, hot cues 1 and 4 and a loop on hot cue 6.
+func Collection(t testing.TB, dir string) *traktor.TraktorCollection {
+	t.Helper()
+	tracks := []traktor.Track{
+		{
+			Title: "One", Artist: "Artist", Album: "Album", BPM: 124, MusicalKey: 21, Duration: 300,
+			CuePoints: []traktor.CuePoint{
+				{Name: "AutoGrid", Type: traktor.CueTypeGrid, Start: 1250, HotCue: -1, Grid: &traktor.Grid{Bpm: 124}},
+				{Name: "Drop", Type: traktor.CueTypeCue, Start: 61000, HotCue: 0},
+				{Name: "Break", Type: traktor.CueTypeCue, Start: 122500, HotCue: 3},
+				{Name: "Loop", Type: traktor.CueTypeLoop, Start: 90000, Len: 7741.935, HotCue: 5},
+			},
+		},
+		{Title: "Two", Artist: "Artist", BPM: 128, MusicalKey: 9, Duration: 240},
+		{Title: "Three", Artist: "Other", BPM: 90.5, MusicalKey: -1, Duration: 200},
+	}
+	for i := range tracks {
+		tracks[i].FilePath = filepath.Join(dir, tracks[i].Title+".mp3")
+		tracks[i].PrimaryKey = tracks[i].FilePath
+		// A stale collection size that exports must not prefer over the file itself
+		tracks[i].FileSize = 1
+		if err := os.WriteFile(tracks[i].FilePath, []byte("audio "+tracks[i].Title), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	playlists := []traktor.Playlist{
+		{Name: "A", Path: "Set/A", TrackKeys: []string{tracks[2].PrimaryKey, tracks[0].PrimaryKey}},
+		{Name: "B", Path: "Set/B", TrackKeys: []string{tracks[1].PrimaryKey}},
+	}
+	return traktor.NewCollection("test", tracks, playlists)
+}
+
+// Index returns the tracks of a library by title and its playlists by path
+func Index(library *traktor.TraktorCollection) (map[string]*traktor.Track, map[string]*traktor.Playlist) {
+	tracks := make(map[string]*traktor.Track)
+	for i := range library.Tracks {
+		tracks[library.Tracks[i].Title] = &library.Tracks[i]
+	}
+	playlists := make(map[string]*traktor.Playlist)
+	for i := range library.Playlists {
+		playlists[library.Playlists[i].Path] = &library.Playlists[i]
+	}
+	return tracks, playlists
+}
+
+// CheckTitles fails the test unless the playlist at path lists the tracks
+// with the given titles in order
+func CheckTitles(t testing.TB, playlists map[string]*traktor.Playlist, path string, want ...string) {
+	t.Helper()
+	playlist := playlists[path]
+	if playlist == nil {
+		t.Errorf("playlist %s is missing", path)
+		return
+	}
+	var got []string
+	for _, track := range playlist.Tracks {
+		got = append(got, track.Title)
+	}
+	if len(got) != len(want) {
+		t.Errorf("playlist %s has %v, want %v", path, got, want)
+		return
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("playlist %s has %v, want %v", path, got, want)
+			return
+		}
+	}
+}
+
+// FindCue returns the cue point of a type on a hot cue, or nil
+func FindCue(track *traktor.Track, cueType, hotCue int) *traktor.CuePoint {
+	for i, cue := range track.CuePoints {
+		if cue.Type == cueType && cue.HotCue == hotCue {
+			return &track.CuePoints[i]
+		}
+	}
+	return nil
+}
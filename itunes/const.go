@@ -0,0 +1,5 @@
+package itunes
+
+const Prefix = "itunes://"
+const PlaylistPrefix = "itunes://playlist"
+const CollectionPrefix = "itunes://collection"
@@ -0,0 +1,71 @@
+package itunes
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// ImportFolder is the Traktor playlist folder copied playlists are created in
+const ImportFolder = "iTunes"
+
+// CopyResult reports the outcome of copying playlists into Traktor
+type CopyResult struct {
+	Created []*traktor.Playlist
+	// Existing lists the paths of playlists Traktor already has
+	Existing []string
+	// Unmatched lists the files that are not in the Traktor collection
+	Unmatched []string
+}
+
+// CopyPlaylists creates Traktor playlists for iTunes playlists below the
+// iTunes folder, keeping their folder structure. Tracks are matched to the
+// collection by location URL, ignoring case when there is no exact match.
+// Playlists that already exist are left unchanged. The collection is not saved.
+func CopyPlaylists(collection *traktor.TraktorCollection, playlists []*traktor.Playlist) (*CopyResult, error) {
+	exact := make(map[string]*traktor.Track, len(collection.Tracks))
+	folded := make(map[string]*traktor.Track, len(collection.Tracks))
+	for i := range collection.Tracks {
+		track := &collection.Tracks[i]
+		location := LocationURL(track.FilePath)
+		exact[location] = track
+		folded[strings.ToLower(location)] = track
+	}
+
+	result := &CopyResult{}
+	unmatched := make(map[string]bool)
+	for _, playlist := range playlists {
+		var keys []string
+		for _, track := range playlist.Tracks {
+			location := LocationURL(track.FilePath)
+			match, exists := exact[location]
+			if !exists {
+				match, exists = folded[strings.ToLower(location)]
+			}
+			if !exists {
+				if !unmatched[track.FilePath] {
+					unmatched[track.FilePath] = true
+					result.Unmatched = append(result.Unmatched, track.FilePath)
+				}
+				continue
+			}
+			keys = append(keys, match.PrimaryKey)
+		}
+
+		folder := ImportFolder
+		if i := strings.LastIndex(playlist.Path, "/"); i >= 0 {
+			folder += "/" + playlist.Path[:i]
+		}
+		created, err := collection.AddPlaylist(folder, playlist.Name, keys)
+		if errors.Is(err, traktor.ErrPlaylistExists) {
+			result.Existing = append(result.Existing, folder+"/"+playlist.Name)
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Created = append(result.Created, created)
+	}
+	return result, nil
+}
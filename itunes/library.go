@@ -0,0 +1,80 @@
+package itunes
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+var library *traktor.TraktorCollection
+var libraryPath string
+var libraryLoaded bool = false
+var libraryErr error
+
+// SetLibraryPath sets the Library.xml file to browse and discards the loaded library
+func SetLibraryPath(path string) {
+	libraryPath = path
+	library = nil
+	libraryErr = nil
+	libraryLoaded = false
+}
+
+// IsAvailable checks if an iTunes library has been configured
+func IsAvailable() bool {
+	if libraryPath == "" {
+		return false
+	}
+	_, err := os.Stat(libraryPath)
+	return err == nil
+}
+
+// GetLibrary returns the parsed iTunes library, or nil if it could not be
+// loaded. LoadError tells why.
+func GetLibrary() *traktor.TraktorCollection {
+	if !libraryLoaded {
+		library, libraryErr = ParseLibrary(libraryPath)
+		libraryLoaded = true
+	}
+	return library
+}
+
+// LoadError returns the error from loading the library, or nil
+func LoadError() error {
+	GetLibrary()
+	return libraryErr
+}
+
+// GetSortedPlaylistNames returns a sorted list of playlist paths like
+// "Clubs/Warmup". Playlists in different folders may share a name.
+func GetSortedPlaylistNames() []string {
+	lib := GetLibrary()
+	if lib == nil {
+		return nil
+	}
+	names := make([]string, len(lib.Playlists))
+	for i, playlist := range lib.Playlists {
+		names[i] = playlist.Path
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetPlaylistByName finds a playlist by the path returned from GetSortedPlaylistNames
+func GetPlaylistByName(name string) *traktor.Playlist {
+	lib := GetLibrary()
+	if lib == nil {
+		return nil
+	}
+	return lib.GetPlaylistByPath(name)
+}
+
+// DefaultLibraryPath returns where iTunes keeps its library export on this system
+func DefaultLibraryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, "Music", "iTunes", "iTunes Music Library.xml")
+}
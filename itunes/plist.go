@@ -0,0 +1,167 @@
+package itunes
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// decodePlist reads an XML property list. Dictionaries become map[string]any,
+// arrays []any, integers int64, reals float64, dates time.Time, data []byte
+// and booleans bool.
+func decodePlist(r io.Reader) (any, error) {
+	decoder := xml.NewDecoder(r)
+	// Library.xml files are UTF-8, but some exports declare other encodings
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) { return input, nil }
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local != "plist" {
+			return nil, fmt.Errorf("not a property list: <%s>", start.Name.Local)
+		}
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			if start, ok := token.(xml.StartElement); ok {
+				return decodeValue(decoder, start)
+			}
+		}
+	}
+}
+
+// decodeValue reads the value started by start, including its end element
+func decodeValue(decoder *xml.Decoder, start xml.StartElement) (any, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := make(map[string]any)
+		var key string
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := token.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					if key, err = readText(decoder); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				value, err := decodeValue(decoder, t)
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = value
+			case xml.EndElement:
+				return dict, nil
+			}
+		}
+	case "array":
+		var array []any
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := token.(type) {
+			case xml.StartElement:
+				value, err := decodeValue(decoder, t)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			case xml.EndElement:
+				return array, nil
+			}
+		}
+	case "true", "false":
+		if err := decoder.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	text, err := readText(decoder)
+	if err != nil {
+		return nil, err
+	}
+	switch start.Name.Local {
+	case "string":
+		return text, nil
+	case "integer":
+		return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	case "real":
+		return strconv.ParseFloat(strings.TrimSpace(text), 64)
+	case "date":
+		return time.Parse(time.RFC3339, strings.TrimSpace(text))
+	case "data":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	}
+	return nil, fmt.Errorf("unknown property list element <%s>", start.Name.Local)
+}
+
+// readText reads the character data up to the end of the current element
+func readText(decoder *xml.Decoder) (string, error) {
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			return text.String(), nil
+		case xml.StartElement:
+			return "", errors.New("unexpected element in property list value")
+		}
+	}
+}
+
+// dict is a property list dictionary with typed accessors
+type dict map[string]any
+
+func (d dict) string(key string) string {
+	value, _ := d[key].(string)
+	return value
+}
+
+func (d dict) int(key string) int {
+	value, _ := d[key].(int64)
+	return int(value)
+}
+
+func (d dict) bool(key string) bool {
+	value, _ := d[key].(bool)
+	return value
+}
+
+func (d dict) date(key string) (time.Time, bool) {
+	value, ok := d[key].(time.Time)
+	return value, ok
+}
+
+func (d dict) dict(key string) dict {
+	value, _ := d[key].(map[string]any)
+	return value
+}
+
+func (d dict) array(key string) []any {
+	value, _ := d[key].([]any)
+	return value
+}
@@ -0,0 +1,195 @@
+package itunes
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// ParseLibrary reads an iTunes or Music app Library.xml into the common
+// collection model. Playlists are named by their folder path, e.g.
+// "Clubs/Berlin/Warmup". The built-in lists like Music or Podcasts, the
+// library itself and folders are left out.
+func ParseLibrary(path string) (*traktor.TraktorCollection, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	value, err := decodePlist(file)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.New("Library.xml has no top level dictionary")
+	}
+	library := dict(root)
+
+	// Keep the library order, the Tracks dictionary is keyed by Track ID
+	trackDicts := library.dict("Tracks")
+	var entries []dict
+	for _, value := range trackDicts {
+		if entry, ok := value.(map[string]any); ok {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].int("Track ID") < entries[j].int("Track ID") })
+
+	tracks := make([]traktor.Track, 0, len(entries))
+	keys := make(map[int]string, len(entries))
+	for _, entry := range entries {
+		track, ok := convertTrack(entry)
+		if !ok {
+			continue
+		}
+		keys[entry.int("Track ID")] = track.PrimaryKey
+		tracks = append(tracks, track)
+	}
+
+	playlists := convertPlaylists(library.array("Playlists"), keys)
+
+	version := "iTunes"
+	if app := library.string("Application Version"); app != "" {
+		version += " " + app
+	}
+	return traktor.NewCollection(version, tracks, playlists), nil
+}
+
+// convertTrack converts a track dictionary. Streams and other entries without
+// a local file are skipped.
+func convertTrack(entry dict) (traktor.Track, bool) {
+	path := LocationPath(entry.string("Location"))
+	if path == "" || entry.string("Track Type") == "URL" {
+		return traktor.Track{}, false
+	}
+	track := traktor.Track{
+		Artist:     entry.string("Artist"),
+		Title:      entry.string("Name"),
+		Album:      entry.string("Album"),
+		Genre:      entry.string("Genre"),
+		Comment:    entry.string("Comments"),
+		Producer:   entry.string("Composer"),
+		Label:      entry.string("Grouping"),
+		BPM:        float64(entry.int("BPM")),
+		MusicalKey: -1,
+		// iTunes ratings are 0-100 in steps of 20 per star
+		Rating:     entry.int("Rating") / 20 * 51,
+		PlayCount:  entry.int("Play Count"),
+		Duration:   float64(entry.int("Total Time")) / 1000,
+		Bitrate:    entry.int("Bit Rate") * 1000,
+		FileSize:   entry.int("Size"),
+		FilePath:   path,
+		FileName:   filepath.Base(path),
+		PrimaryKey: path,
+	}
+	if entry.bool("Rating Computed") {
+		// Album ratings inherited by the track are not the DJ's rating
+		track.Rating = 0
+	}
+	if year := entry.int("Year"); year > 0 {
+		track.ReleaseDate = fmt.Sprintf("%d/1/1", year)
+	}
+	if added, ok := entry.date("Date Added"); ok {
+		track.ImportDate = added.Local().Format("2006/1/2")
+	}
+	if played, ok := entry.date("Play Date UTC"); ok {
+		track.LastPlayed = played.Local().Format("2006/1/2")
+	}
+	return track, true
+}
+
+// playlistEntry is a Playlists array entry while the folder tree is rebuilt
+type playlistEntry struct {
+	dict
+	id     string
+	parent string
+}
+
+// convertPlaylists builds the playlists with their folder paths from the
+// persistent ids and parent ids of the entries
+func convertPlaylists(entries []any, keys map[int]string) []traktor.Playlist {
+	byID := make(map[string]*playlistEntry)
+	var ordered []*playlistEntry
+	for _, value := range entries {
+		entry, ok := value.(map[string]any)
+		if !ok {
+			continue
+		}
+		list := &playlistEntry{dict: entry}
+		list.id = list.string("Playlist Persistent ID")
+		list.parent = list.string("Parent Persistent ID")
+		if list.id != "" {
+			byID[list.id] = list
+		}
+		ordered = append(ordered, list)
+	}
+
+	var pathOf func(list *playlistEntry, depth int) string
+	pathOf = func(list *playlistEntry, depth int) string {
+		name := strings.ReplaceAll(list.string("Name"), "/", "-")
+		parent, exists := byID[list.parent]
+		if !exists || depth > 32 {
+			return name
+		}
+		return pathOf(parent, depth+1) + "/" + name
+	}
+
+	var playlists []traktor.Playlist
+	for _, list := range ordered {
+		if list.bool("Master") || list.bool("Folder") || list.int("Distinguished Kind") > 0 {
+			continue
+		}
+		if visible, set := list.dict["Visible"].(bool); set && !visible {
+			continue
+		}
+		playlist := traktor.Playlist{Name: list.string("Name"), Path: pathOf(list, 0)}
+		for _, item := range list.array("Playlist Items") {
+			entry, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			if key, exists := keys[dict(entry).int("Track ID")]; exists {
+				playlist.TrackKeys = append(playlist.TrackKeys, key)
+			}
+		}
+		playlists = append(playlists, playlist)
+	}
+	return playlists
+}
+
+// LocationPath converts an iTunes location URL like
+// file://localhost/Users/dj/Music/a.mp3 or file:///C:/Music/a.mp3 into a
+// file path. An empty string is returned for other URLs.
+func LocationPath(location string) string {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	path := u.Path
+	if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		// Windows drive path
+		return filepath.FromSlash(path[1:])
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		// Network share
+		return filepath.FromSlash("//" + u.Host + path)
+	}
+	return filepath.FromSlash(path)
+}
+
+// LocationURL converts a file path into the location URL iTunes writes
+func LocationURL(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Host: "localhost", Path: path}).String()
+}
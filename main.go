@@ -1,9 +1,31 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/ilmarkerm/djlibgo/windows"
 )
 
+// commands are the command line subcommands, run with the arguments after
+// the subcommand name. Without a subcommand the main window opens.
+var commands = map[string]func(args []string) error{
+	"dump":        runDump,
+	"tags":        runTags,
+	"analyze":     runAnalyze,
+	"fingerprint": runFingerprint,
+	"silence":     runSilence,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 	windows.MainWindow()
 }
@@ -0,0 +1,143 @@
+package mixxx
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Beat grid formats stored in library.beats_version
+const (
+	beatGridVersion = "BeatGrid-2.0"
+	beatMapVersion  = "BeatMap-1.0"
+)
+
+// beatGrid is a constant tempo grid. FirstBeat is in frames.
+type beatGrid struct {
+	BPM       float64
+	FirstBeat float64
+}
+
+// protoField is a decoded protocol buffer field. Varints are kept in value,
+// fixed64 values in bits and length delimited data in data.
+type protoField struct {
+	number int
+	value  uint64
+	data   []byte
+}
+
+var errProto = errors.New("invalid beat data")
+
+// parseProto splits a protocol buffer message into its fields
+func parseProto(data []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errProto
+		}
+		data = data[n:]
+		field := protoField{number: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			field.value, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errProto
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return nil, errProto
+			}
+			field.value = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return nil, errProto
+			}
+			field.data = data[n : n+int(length)]
+			data = data[n+int(length):]
+		case 5:
+			if len(data) < 4 {
+				return nil, errProto
+			}
+			field.value = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			return nil, errProto
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// decodeBeats reads a BeatGrid or a BeatMap. Beat maps are reduced to a
+// constant grid using the average beat length.
+func decodeBeats(version string, data []byte, sampleRate float64) (beatGrid, bool) {
+	fields, err := parseProto(data)
+	if err != nil {
+		return beatGrid{}, false
+	}
+	switch version {
+	case beatGridVersion:
+		var grid beatGrid
+		for _, field := range fields {
+			sub, err := parseProto(field.data)
+			if err != nil {
+				return beatGrid{}, false
+			}
+			for _, f := range sub {
+				switch {
+				case field.number == 1 && f.number == 1:
+					grid.BPM = math.Float64frombits(f.value)
+				case field.number == 2 && f.number == 1:
+					grid.FirstBeat = float64(int32(f.value))
+				}
+			}
+		}
+		return grid, grid.BPM > 0
+	case beatMapVersion:
+		var frames []float64
+		for _, field := range fields {
+			if field.number != 1 {
+				continue
+			}
+			sub, err := parseProto(field.data)
+			if err != nil {
+				return beatGrid{}, false
+			}
+			for _, f := range sub {
+				if f.number == 1 {
+					frames = append(frames, float64(int32(f.value)))
+				}
+			}
+		}
+		if len(frames) < 2 || sampleRate <= 0 {
+			return beatGrid{}, false
+		}
+		beatLength := (frames[len(frames)-1] - frames[0]) / float64(len(frames)-1)
+		if beatLength <= 0 {
+			return beatGrid{}, false
+		}
+		return beatGrid{FirstBeat: frames[0], BPM: 60 * sampleRate / beatLength}, true
+	}
+	return beatGrid{}, false
+}
+
+// encodeBeatGrid writes a BeatGrid-2.0 message
+func encodeBeatGrid(grid beatGrid) []byte {
+	bpm := binary.AppendUvarint(nil, 1<<3|1)
+	bpm = binary.LittleEndian.AppendUint64(bpm, math.Float64bits(grid.BPM))
+	beat := binary.AppendUvarint(nil, 1<<3)
+	// int32 fields are sign extended to 64 bits
+	beat = binary.AppendUvarint(beat, uint64(int64(int32(math.Round(grid.FirstBeat)))))
+
+	var out []byte
+	out = binary.AppendUvarint(out, 1<<3|2)
+	out = binary.AppendUvarint(out, uint64(len(bpm)))
+	out = append(out, bpm...)
+	out = binary.AppendUvarint(out, 2<<3|2)
+	out = binary.AppendUvarint(out, uint64(len(beat)))
+	return append(out, beat...)
+}
@@ -0,0 +1,5 @@
+package mixxx
+
+const Prefix = "mixxx://"
+const PlaylistPrefix = "mixxx://playlist"
+const CollectionPrefix = "mixxx://collection"
@@ -0,0 +1,332 @@
+package mixxx
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ilmarkerm/djlibgo/fileutil"
+	"github.com/ilmarkerm/djlibgo/tags"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// defaultSampleRate is used when neither Mixxx nor the file know the sample rate
+const defaultSampleRate = 44100
+
+// Cue colours by Traktor cue type as 0xRRGGBB
+const (
+	colorCue  = 0x0066ff
+	colorFade = 0xff8c00
+	colorLoad = 0xffd200
+	colorLoop = 0x00c83c
+)
+
+// ExportOptions controls what is written into the Mixxx library
+type ExportOptions struct {
+	// Playlists limits the export to these playlists. When empty all
+	// playlists of the collection are exported.
+	Playlists []*traktor.Playlist
+	// Cues replaces the hot cues, loops, main cue, intro and outro of the
+	// matched tracks with the Traktor cues
+	Cues bool
+	// Beatgrids overwrites beat grids Mixxx already has. Tracks without a
+	// Mixxx beat grid always get the Traktor grid.
+	Beatgrids bool
+	// AddMissing adds tracks Mixxx does not know yet to its library.
+	// Otherwise they are skipped and reported.
+	AddMissing bool
+}
+
+// ExportResult summarizes an export
+type ExportResult struct {
+	Crates    int
+	Matched   int
+	Added     int
+	Unmatched []string
+}
+
+// mixxxTrack is a library row matched to a Traktor track
+type mixxxTrack struct {
+	id         int64
+	sampleRate float64
+	hasBeats   bool
+}
+
+// Export writes Traktor playlists as crates into a Mixxx database. Tracks are
+// matched to existing library rows by file location. Mixxx must not be running
+// while its database is changed. The previous database is kept as .bak.
+func Export(path string, collection *traktor.TraktorCollection, opts ExportOptions) (*ExportResult, error) {
+	playlists := opts.Playlists
+	if len(playlists) == 0 {
+		for i := range collection.Playlists {
+			playlists = append(playlists, &collection.Playlists[i])
+		}
+	}
+
+	db, err := openDatabase(path, true)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	if err := fileutil.Backup(path); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	locations, err := readLocations(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExportResult{}
+	matched := make(map[*traktor.Track]mixxxTrack)
+	for _, playlist := range playlists {
+		var ids []int64
+		for _, track := range playlist.Tracks {
+			row, done := matched[track]
+			if !done {
+				row, err = matchTrack(tx, locations, track, opts, result)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", track.FilePath, err)
+				}
+				matched[track] = row
+				if row.id == 0 {
+					continue
+				}
+				if err := writePerformanceData(tx, row, track, opts); err != nil {
+					return nil, fmt.Errorf("%s: %w", track.FilePath, err)
+				}
+			}
+			if row.id != 0 {
+				ids = append(ids, row.id)
+			}
+		}
+		if err := writeCrate(tx, CrateName(playlist), ids); err != nil {
+			return nil, err
+		}
+		result.Crates++
+	}
+	return result, tx.Commit()
+}
+
+// CrateName returns the crate name for a Traktor playlist. Mixxx has no crate
+// folders, so nested playlists are flattened into names like "Gigs - Friday".
+func CrateName(playlist *traktor.Playlist) string {
+	path := playlist.Path
+	if path == "" {
+		path = playlist.Name
+	}
+	return strings.ReplaceAll(path, "/", " - ")
+}
+
+// locationIndex finds library rows by exact and case-insensitive location
+type locationIndex struct {
+	exact map[string]mixxxTrack
+	fold  map[string]mixxxTrack
+}
+
+// readLocations reads the locations of all library rows, including tracks
+// marked as deleted so they can be brought back instead of duplicated
+func readLocations(tx *sql.Tx) (*locationIndex, error) {
+	rows, err := tx.Query(`SELECT l.id, tl.location, COALESCE(l.samplerate, 0), l.beats IS NOT NULL
+		FROM library l JOIN track_locations tl ON tl.id = l.location`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := &locationIndex{exact: make(map[string]mixxxTrack), fold: make(map[string]mixxxTrack)}
+	for rows.Next() {
+		var row mixxxTrack
+		var location string
+		if err := rows.Scan(&row.id, &location, &row.sampleRate, &row.hasBeats); err != nil {
+			return nil, err
+		}
+		index.exact[location] = row
+		index.fold[strings.ToLower(location)] = row
+	}
+	return index, rows.Err()
+}
+
+// matchTrack finds the library row of a track, adding it when requested.
+// A zero id means the track is not in the library.
+func matchTrack(tx *sql.Tx, index *locationIndex, track *traktor.Track, opts ExportOptions, result *ExportResult) (mixxxTrack, error) {
+	location := filepath.ToSlash(track.FilePath)
+	row, exists := index.exact[location]
+	if !exists {
+		row, exists = index.fold[strings.ToLower(location)]
+	}
+	if exists {
+		result.Matched++
+		_, err := tx.Exec(`UPDATE library SET mixxx_deleted = 0 WHERE id = ?`, row.id)
+		return row, err
+	}
+	if !opts.AddMissing {
+		result.Unmatched = append(result.Unmatched, track.FilePath)
+		return mixxxTrack{}, nil
+	}
+
+	row = mixxxTrack{sampleRate: defaultSampleRate}
+	if rate, err := tags.SampleRate(track.FilePath); err == nil && rate > 0 {
+		row.sampleRate = float64(rate)
+	}
+	var size int64
+	if info, err := os.Stat(track.FilePath); err == nil {
+		size = info.Size()
+	}
+	res, err := tx.Exec(`INSERT INTO track_locations (location, filename, directory, filesize,
+		fs_deleted, needs_verification) VALUES (?, ?, ?, ?, 0, 1)`,
+		location, filepath.Base(location), filepath.ToSlash(filepath.Dir(track.FilePath)), size)
+	if err != nil {
+		return row, err
+	}
+	locationID, err := res.LastInsertId()
+	if err != nil {
+		return row, err
+	}
+
+	keyID := 0
+	if value, ok := traktor.TrackKeyValue(track); ok {
+		keyID = value + 1
+	}
+	var year string
+	if date, ok := traktor.ParseDate(track.ReleaseDate); ok {
+		year = fmt.Sprint(date.Year())
+	}
+	// header_parsed = 0 makes Mixxx read the file tags on next start
+	res, err = tx.Exec(`INSERT INTO library (artist, title, album, year, genre, comment,
+		composer, location, duration, bitrate, samplerate, bpm, key, key_id, rating,
+		timesplayed, played, datetime_added, filetype, channels, mixxx_deleted, header_parsed)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 2, 0, 0)`,
+		track.Artist, track.Title, track.Album, year, track.Genre, track.Comment,
+		track.Producer, locationID, track.Duration, track.Bitrate/1000, int(row.sampleRate),
+		track.BPM, traktor.KeyValueToNotation(keyID-1, traktor.NotationMusical), keyID,
+		traktor.RatingToStars(track.Rating), track.PlayCount, track.PlayCount > 0,
+		time.Now().UTC().Format(dateFormats[0]),
+		strings.TrimPrefix(strings.ToLower(filepath.Ext(location)), "."))
+	if err != nil {
+		return row, err
+	}
+	row.id, err = res.LastInsertId()
+	if err != nil {
+		return row, err
+	}
+	index.exact[location] = row
+	index.fold[strings.ToLower(location)] = row
+	result.Added++
+	return row, nil
+}
+
+// writePerformanceData stores the Traktor cues and beat grid of a track
+func writePerformanceData(tx *sql.Tx, row mixxxTrack, track *traktor.Track, opts ExportOptions) error {
+	sampleRate := row.sampleRate
+	if sampleRate <= 0 {
+		sampleRate = defaultSampleRate
+	}
+	// Cue positions count interleaved stereo samples
+	toSamples := func(ms float64) int64 { return int64(math.Round(ms / 1000 * sampleRate * 2)) }
+
+	if opts.Beatgrids || !row.hasBeats {
+		for _, cue := range track.CuePoints {
+			if cue.Type != traktor.CueTypeGrid || cue.Grid == nil || cue.Grid.Bpm <= 0 {
+				continue
+			}
+			grid := beatGrid{BPM: cue.Grid.Bpm, FirstBeat: cue.Start / 1000 * sampleRate}
+			if _, err := tx.Exec(`UPDATE library SET beats = ?, beats_version = ?, bpm = ? WHERE id = ?`,
+				encodeBeatGrid(grid), beatGridVersion, grid.BPM, row.id); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	if !opts.Cues || len(track.CuePoints) == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(`DELETE FROM cues WHERE track_id = ? AND type IN (?, ?, ?, ?, ?)`,
+		row.id, cueHotCue, cueMainCue, cueLoop, cueIntro, cueOutro); err != nil {
+		return err
+	}
+	for _, cue := range track.CuePoints {
+		position := toSamples(cue.Start)
+		color := colorCue
+		switch cue.Type {
+		case traktor.CueTypeCue:
+		case traktor.CueTypeLoop:
+			// Saved loops without a hot cue button stay available as loops
+			if cue.Len <= 0 {
+				continue
+			}
+			hotcue := cue.HotCue
+			if hotcue < 0 || hotcue > 7 {
+				hotcue = -1
+			}
+			if err := insertCue(tx, row.id, cueLoop, position, toSamples(cue.Len), hotcue, cue.Name, colorLoop); err != nil {
+				return err
+			}
+			continue
+		case traktor.CueTypeLoad:
+			if _, err := tx.Exec(`UPDATE library SET cuepoint = ? WHERE id = ?`, position, row.id); err != nil {
+				return err
+			}
+			if err := insertCue(tx, row.id, cueMainCue, position, 0, -1, cue.Name, colorLoad); err != nil {
+				return err
+			}
+			color = colorLoad
+		case traktor.CueTypeFadeIn, traktor.CueTypeFadeOut:
+			cueType := cueIntro
+			if cue.Type == traktor.CueTypeFadeOut {
+				cueType = cueOutro
+			}
+			if err := insertCue(tx, row.id, cueType, position, 0, -1, cue.Name, colorFade); err != nil {
+				return err
+			}
+			color = colorFade
+		default:
+			continue
+		}
+		// Special cues on a Traktor hot cue button also get a Mixxx hot cue
+		if cue.HotCue < 0 || cue.HotCue > 7 {
+			continue
+		}
+		if err := insertCue(tx, row.id, cueHotCue, position, 0, cue.HotCue, cue.Name, color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertCue(tx *sql.Tx, trackID int64, cueType int, position, length int64, hotcue int, label string, color int) error {
+	_, err := tx.Exec(`INSERT INTO cues (track_id, type, position, length, hotcue, label, color)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, trackID, cueType, position, length, hotcue, label, color)
+	return err
+}
+
+// writeCrate creates or replaces the crate with the given tracks
+func writeCrate(tx *sql.Tx, name string, trackIDs []int64) error {
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO crates (name) VALUES (?)`, name); err != nil {
+		return err
+	}
+	var crateID int64
+	if err := tx.QueryRow(`SELECT id FROM crates WHERE name = ?`, name).Scan(&crateID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM crate_tracks WHERE crate_id = ?`, crateID); err != nil {
+		return err
+	}
+	for _, id := range trackIDs {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO crate_tracks (crate_id, track_id) VALUES (?, ?)`, crateID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
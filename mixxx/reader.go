@@ -0,0 +1,261 @@
+package mixxx
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+
+	_ "modernc.org/sqlite"
+)
+
+// Cue types of the cues table
+const (
+	cueHotCue  = 1
+	cueMainCue = 2
+	cueLoop    = 4
+	cueIntro   = 6
+	cueOutro   = 7
+)
+
+// Playlists.hidden values
+const (
+	playlistNormal = 0
+	playlistSetLog = 2
+)
+
+// Folders the Mixxx crates and playlists are placed in
+const (
+	CratesFolder    = "Crates"
+	PlaylistsFolder = "Playlists"
+	HistoryFolder   = "History"
+)
+
+// dateFormats are the layouts Mixxx versions used for datetime_added
+var dateFormats = []string{"2006-01-02T15:04:05.000Z", "2006-01-02T15:04:05Z", "2006-01-02 15:04:05"}
+
+// openDatabase opens a Mixxx database, read only unless writable is set
+func openDatabase(path string, writable bool) (*sql.DB, error) {
+	// sqlite would create a missing file when opened for writing
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	dsn := "file:" + filepath.ToSlash(path)
+	if !writable {
+		dsn += "?mode=ro"
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// Fail early on files that are not Mixxx databases
+	if _, err := db.Exec(`SELECT 1 FROM library, track_locations LIMIT 1`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("not a Mixxx database: %w", err)
+	}
+	return db, nil
+}
+
+// ParseLibrary reads the tracks, crates and playlists of a mixxxdb.sqlite file.
+// Crates are placed in the Crates folder, playlists in Playlists and the set
+// logs in History. Hot cues, loops, the main cue, intro and outro and the beat
+// grid become Traktor cue points.
+func ParseLibrary(path string) (*traktor.TraktorCollection, error) {
+	db, err := openDatabase(path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tracks, ids, keys, err := readTracks(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := readCues(db, tracks); err != nil {
+		return nil, err
+	}
+
+	var playlists []traktor.Playlist
+	crates, err := readLists(db, `SELECT c.id, c.name, ct.track_id FROM crates c
+		LEFT JOIN crate_tracks ct ON ct.crate_id = c.id ORDER BY c.name, ct.rowid`, CratesFolder, keys)
+	if err != nil {
+		return nil, err
+	}
+	playlists = append(playlists, crates...)
+	for _, folder := range []struct {
+		hidden int
+		name   string
+	}{{playlistNormal, PlaylistsFolder}, {playlistSetLog, HistoryFolder}} {
+		lists, err := readLists(db, fmt.Sprintf(`SELECT p.id, p.name, pt.track_id FROM Playlists p
+			LEFT JOIN PlaylistTracks pt ON pt.playlist_id = p.id
+			WHERE p.hidden = %d ORDER BY p.position, pt.position`, folder.hidden), folder.name, keys)
+		if err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, lists...)
+	}
+
+	result := make([]traktor.Track, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, *tracks[id].Track)
+	}
+	return traktor.NewCollection("Mixxx", result, playlists), nil
+}
+
+// libraryTrack is a track with the Mixxx values needed to convert positions
+type libraryTrack struct {
+	*traktor.Track
+	sampleRate float64
+}
+
+// readTracks reads all tracks that are not deleted, keyed by library id. The
+// ids are also returned in library order.
+func readTracks(db *sql.DB) (map[int64]libraryTrack, []int64, map[int64]string, error) {
+	rows, err := db.Query(`SELECT l.id, tl.location, COALESCE(l.artist, ''), COALESCE(l.title, ''),
+		COALESCE(l.album, ''), COALESCE(l.genre, ''), COALESCE(l.comment, ''),
+		COALESCE(l.composer, ''), COALESCE(l.key, ''), COALESCE(l.key_id, 0),
+		COALESCE(l.year, ''), COALESCE(l.duration, 0), COALESCE(l.bitrate, 0),
+		COALESCE(l.samplerate, 0), COALESCE(l.bpm, 0), COALESCE(l.rating, 0),
+		COALESCE(l.timesplayed, 0), COALESCE(l.datetime_added, ''), COALESCE(tl.filesize, 0),
+		COALESCE(l.beats_version, ''), l.beats
+		FROM library l JOIN track_locations tl ON tl.id = l.location
+		WHERE l.mixxx_deleted = 0 ORDER BY l.id`)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
+
+	tracks := make(map[int64]libraryTrack)
+	var ids []int64
+	keys := make(map[int64]string)
+	for rows.Next() {
+		var id, keyID, rating int64
+		var year, added, beatsVersion string
+		var sampleRate float64
+		var beats []byte
+		track := &traktor.Track{}
+		if err := rows.Scan(&id, &track.FilePath, &track.Artist, &track.Title, &track.Album,
+			&track.Genre, &track.Comment, &track.Producer, &track.Key, &keyID, &year,
+			&track.Duration, &track.Bitrate, &sampleRate, &track.BPM, &rating,
+			&track.PlayCount, &added, &track.FileSize, &beatsVersion, &beats); err != nil {
+			return nil, nil, nil, err
+		}
+		track.FileName = filepath.Base(track.FilePath)
+		track.PrimaryKey = track.FilePath
+		track.Bitrate *= 1000
+		track.Rating = int(rating) * 51
+		// Mixxx key ids count from 1 in the same order as Traktor's MUSICAL_KEY
+		track.MusicalKey = int(keyID) - 1
+		if track.MusicalKey < 0 {
+			track.MusicalKey, _ = traktor.ParseKey(track.Key)
+		} else if track.Key == "" {
+			track.Key = traktor.KeyValueToNotation(track.MusicalKey, traktor.NotationMusical)
+		}
+		if len(year) >= 4 {
+			track.ReleaseDate = year[:4] + "/1/1"
+		}
+		for _, layout := range dateFormats {
+			if date, err := time.Parse(layout, added); err == nil {
+				track.ImportDate = date.Format("2006/1/2")
+				break
+			}
+		}
+		if grid, ok := decodeBeats(beatsVersion, beats, sampleRate); ok && sampleRate > 0 {
+			track.CuePoints = append(track.CuePoints, traktor.CuePoint{
+				Name:    "AutoGrid",
+				Type:    traktor.CueTypeGrid,
+				Start:   grid.FirstBeat / sampleRate * 1000,
+				Repeats: -1,
+				HotCue:  -1,
+				Grid:    &traktor.Grid{Bpm: grid.BPM},
+			})
+		}
+
+		tracks[id] = libraryTrack{Track: track, sampleRate: sampleRate}
+		ids = append(ids, id)
+		keys[id] = track.PrimaryKey
+	}
+	return tracks, ids, keys, rows.Err()
+}
+
+// readCues adds the cues table entries to the tracks. Mixxx positions count
+// interleaved stereo samples, so one frame is two samples.
+func readCues(db *sql.DB, tracks map[int64]libraryTrack) error {
+	rows, err := db.Query(`SELECT track_id, type, position, length, hotcue, COALESCE(label, '')
+		FROM cues ORDER BY track_id, hotcue, position`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var trackID, cueType, hotcue int64
+		var position, length float64
+		var label string
+		if err := rows.Scan(&trackID, &cueType, &position, &length, &hotcue, &label); err != nil {
+			return err
+		}
+		track, exists := tracks[trackID]
+		if !exists || track.sampleRate <= 0 || position < 0 {
+			continue
+		}
+		toMillis := func(samples float64) float64 { return samples / 2 / track.sampleRate * 1000 }
+
+		cue := traktor.CuePoint{Name: label, Start: toMillis(position), Repeats: -1, HotCue: int(hotcue)}
+		switch cueType {
+		case cueHotCue:
+			cue.Type = traktor.CueTypeCue
+		case cueLoop:
+			cue.Type = traktor.CueTypeLoop
+			cue.Len = toMillis(length)
+		case cueMainCue:
+			cue.Type = traktor.CueTypeLoad
+		case cueIntro:
+			cue.Type = traktor.CueTypeFadeIn
+		case cueOutro:
+			// The outro start is where the fade begins
+			cue.Type = traktor.CueTypeFadeOut
+		default:
+			continue
+		}
+		if cue.HotCue < 0 || cue.HotCue > 7 {
+			cue.HotCue = -1
+		}
+		track.CuePoints = append(track.CuePoints, cue)
+	}
+	return rows.Err()
+}
+
+// readLists reads crates or playlists from a query returning the list id, its
+// name and one track id per row
+func readLists(db *sql.DB, query, folder string, keys map[int64]string) ([]traktor.Playlist, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var playlists []traktor.Playlist
+	index := make(map[int64]int)
+	for rows.Next() {
+		var id int64
+		var name string
+		var trackID sql.NullInt64
+		if err := rows.Scan(&id, &name, &trackID); err != nil {
+			return nil, err
+		}
+		i, exists := index[id]
+		if !exists {
+			i = len(playlists)
+			index[id] = i
+			playlists = append(playlists, traktor.Playlist{Name: name, Path: folder + "/" + name})
+		}
+		if key, exists := keys[trackID.Int64]; trackID.Valid && exists {
+			playlists[i].TrackKeys = append(playlists[i].TrackKeys, key)
+		}
+	}
+	return playlists, rows.Err()
+}
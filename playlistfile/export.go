@@ -0,0 +1,209 @@
+package playlistfile
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/fileutil"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// Format is a playlist file format
+type Format string
+
+const (
+	FormatM3U8 Format = "m3u8"
+	FormatPLS  Format = "pls"
+	FormatXSPF Format = "xspf"
+)
+
+// Formats lists the supported export formats
+var Formats = []Format{FormatM3U8, FormatPLS, FormatXSPF}
+
+// PathMode selects how track locations are written
+type PathMode int
+
+const (
+	// PathAbsolute writes the full path of every track
+	PathAbsolute PathMode = iota
+	// PathRelative writes paths relative to the base directory
+	PathRelative
+)
+
+// Options controls playlist export
+type Options struct {
+	Format   Format
+	PathMode PathMode
+	// BaseDir is the directory relative paths are computed against. When empty
+	// the directory of the written playlist file is used.
+	BaseDir string
+}
+
+// Write writes the playlist to w in the chosen format. Relative paths are
+// computed against opts.BaseDir, which must be set for PathRelative.
+func Write(w io.Writer, playlist *traktor.Playlist, opts Options) error {
+	switch opts.Format {
+	case FormatM3U8:
+		return writeM3U8(w, playlist, opts)
+	case FormatPLS:
+		return writePLS(w, playlist, opts)
+	case FormatXSPF:
+		return writeXSPF(w, playlist, opts)
+	default:
+		return fmt.Errorf("unknown playlist format %q", opts.Format)
+	}
+}
+
+// ExportPlaylist writes the playlist into dir as <name>.<format> and returns the file path
+func ExportPlaylist(playlist *traktor.Playlist, dir string, opts Options) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fileutil.SanitizeFileName(playlist.Name)+"."+string(opts.Format))
+	if opts.BaseDir == "" {
+		opts.BaseDir = dir
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := Write(file, playlist, opts); err != nil {
+		file.Close()
+		return "", err
+	}
+	return path, file.Close()
+}
+
+// ExportFolder writes every playlist below the given Traktor folder path into dir,
+// mirroring the playlist folders as directories. An empty folder exports all playlists.
+func ExportFolder(collection *traktor.TraktorCollection, folder, dir string, opts Options) ([]string, error) {
+	var written []string
+	folder = strings.Trim(folder, "/")
+	for _, playlist := range collection.GetPlaylistsInFolder(folder) {
+		relative := strings.TrimPrefix(strings.TrimPrefix(playlist.Path, folder), "/")
+		parts := strings.Split(relative, "/")
+		targetDir := dir
+		for _, part := range parts[:len(parts)-1] {
+			targetDir = filepath.Join(targetDir, fileutil.SanitizeFileName(part))
+		}
+		path, err := ExportPlaylist(playlist, targetDir, opts)
+		if err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// trackLocation returns the path of the track as it should be written to the playlist
+func trackLocation(track *traktor.Track, opts Options) string {
+	if opts.PathMode == PathRelative && opts.BaseDir != "" {
+		if rel, err := filepath.Rel(opts.BaseDir, track.FilePath); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return track.FilePath
+}
+
+// trackURI returns the track location as a URI for XSPF
+func trackURI(track *traktor.Track, opts Options) string {
+	location := trackLocation(track, opts)
+	if opts.PathMode == PathRelative && !filepath.IsAbs(location) {
+		return (&url.URL{Path: location}).String()
+	}
+	path := filepath.ToSlash(location)
+	if !strings.HasPrefix(path, "/") {
+		// Windows drive paths, file:///C:/Music/...
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// displayTitle returns "Artist - Title" for the playlist title fields
+func displayTitle(track *traktor.Track) string {
+	if track.Artist == "" {
+		return track.Title
+	}
+	return track.Artist + " - " + track.Title
+}
+
+func writeM3U8(w io.Writer, playlist *traktor.Playlist, opts Options) error {
+	if _, err := io.WriteString(w, "#EXTM3U\n#PLAYLIST:"+playlist.Name+"\n"); err != nil {
+		return err
+	}
+	for _, track := range playlist.Tracks {
+		_, err := fmt.Fprintf(w, "#EXTINF:%d,%s\n%s\n", int(track.Duration), displayTitle(track), trackLocation(track, opts))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writePLS(w io.Writer, playlist *traktor.Playlist, opts Options) error {
+	if _, err := io.WriteString(w, "[playlist]\n"); err != nil {
+		return err
+	}
+	for i, track := range playlist.Tracks {
+		n := i + 1
+		_, err := fmt.Fprintf(w, "File%d=%s\nTitle%d=%s\nLength%d=%d\n",
+			n, trackLocation(track, opts), n, displayTitle(track), n, int(track.Duration))
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "NumberOfEntries=%d\nVersion=2\n", len(playlist.Tracks))
+	return err
+}
+
+// xspfPlaylist is the XML shape of an XSPF playlist
+type xspfPlaylist struct {
+	XMLName   xml.Name    `xml:"playlist"`
+	Version   string      `xml:"version,attr"`
+	Namespace string      `xml:"xmlns,attr"`
+	Title     string      `xml:"title,omitempty"`
+	Tracks    []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Album    string `xml:"album,omitempty"`
+	Duration int    `xml:"duration,omitempty"`
+}
+
+func writeXSPF(w io.Writer, playlist *traktor.Playlist, opts Options) error {
+	out := xspfPlaylist{
+		Version:   "1",
+		Namespace: "http://xspf.org/ns/0/",
+		Title:     playlist.Name,
+	}
+	for _, track := range playlist.Tracks {
+		out.Tracks = append(out.Tracks, xspfTrack{
+			Location: trackURI(track, opts),
+			Title:    track.Title,
+			Creator:  track.Artist,
+			Album:    track.Album,
+			// XSPF durations are in milliseconds
+			Duration: int(track.Duration * 1000),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
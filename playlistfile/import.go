@@ -0,0 +1,419 @@
+package playlistfile
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// ImportFolder is the Traktor playlist folder imported playlists are created in
+const ImportFolder = "Imported"
+
+// fuzzyThreshold is the minimum similarity for a tag based match
+const fuzzyThreshold = 0.8
+
+// Item is a single entry read from a playlist file
+type Item struct {
+	Location string
+	Artist   string
+	Title    string
+	Duration float64
+}
+
+// PathMapping rewrites a path prefix, e.g. a Windows music folder to its macOS location
+type PathMapping struct {
+	From string
+	To   string
+}
+
+// ImportOptions controls how playlist entries are matched to the collection
+type ImportOptions struct {
+	Mappings []PathMapping
+	// Folder is the Traktor folder the playlist is created in, defaults to ImportFolder
+	Folder string
+}
+
+// Match links a playlist entry to a collection track
+type Match struct {
+	Item   Item
+	Track  *traktor.Track
+	Method string
+}
+
+// ImportResult lists the matched and unmatched entries of an import
+type ImportResult struct {
+	Playlist  *traktor.Playlist
+	Matched   []Match
+	Unmatched []Item
+}
+
+// FormatFromPath returns the playlist format for a file name extension
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".m3u", ".m3u8":
+		return FormatM3U8, nil
+	case ".pls":
+		return FormatPLS, nil
+	case ".xspf":
+		return FormatXSPF, nil
+	default:
+		return "", fmt.Errorf("unsupported playlist file %s", filepath.Base(path))
+	}
+}
+
+// ParseFile reads a playlist file. Relative locations are resolved against
+// the directory of the file.
+func ParseFile(path string) ([]Item, error) {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	items, err := Parse(file, format)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	for i := range items {
+		items[i].Location = resolveLocation(items[i].Location, dir)
+	}
+	return items, nil
+}
+
+// Parse reads playlist entries in the given format without resolving locations
+func Parse(r io.Reader, format Format) ([]Item, error) {
+	switch format {
+	case FormatM3U8:
+		return parseM3U(r)
+	case FormatPLS:
+		return parsePLS(r)
+	case FormatXSPF:
+		return parseXSPF(r)
+	default:
+		return nil, fmt.Errorf("unknown playlist format %q", format)
+	}
+}
+
+// decodeLine returns the line as UTF-8. Plain .m3u files are often Latin-1.
+func decodeLine(line string) string {
+	line = strings.TrimPrefix(line, "\ufeff")
+	if utf8.ValidString(line) {
+		return line
+	}
+	runes := make([]rune, len(line))
+	for i := 0; i < len(line); i++ {
+		runes[i] = rune(line[i])
+	}
+	return string(runes)
+}
+
+// splitDisplayTitle splits "Artist - Title" as written by EXTINF and PLS titles
+func splitDisplayTitle(title string) (string, string) {
+	if artist, rest, found := strings.Cut(title, " - "); found {
+		return strings.TrimSpace(artist), strings.TrimSpace(rest)
+	}
+	return "", strings.TrimSpace(title)
+}
+
+func parseM3U(r io.Reader) ([]Item, error) {
+	var items []Item
+	var pending Item
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(decodeLine(scanner.Text()))
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXTINF:"):
+			info := strings.TrimPrefix(line, "#EXTINF:")
+			duration, title, _ := strings.Cut(info, ",")
+			// Attributes may follow the duration, e.g. #EXTINF:300 tvg-id="x",Title
+			duration, _, _ = strings.Cut(duration, " ")
+			pending.Duration, _ = strconv.ParseFloat(duration, 64)
+			pending.Artist, pending.Title = splitDisplayTitle(title)
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			pending.Location = line
+			items = append(items, pending)
+			pending = Item{}
+		}
+	}
+	return items, scanner.Err()
+}
+
+func parsePLS(r io.Reader) ([]Item, error) {
+	entries := make(map[int]*Item)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(decodeLine(scanner.Text()))
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(key)
+		var field string
+		for _, prefix := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, prefix) {
+				field = prefix
+				break
+			}
+		}
+		if field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(key, field))
+		if err != nil {
+			continue
+		}
+		item, exists := entries[n]
+		if !exists {
+			item = &Item{}
+			entries[n] = item
+		}
+		switch field {
+		case "file":
+			item.Location = value
+		case "title":
+			item.Artist, item.Title = splitDisplayTitle(value)
+		case "length":
+			item.Duration, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	numbers := make([]int, 0, len(entries))
+	for n := range entries {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	items := make([]Item, 0, len(numbers))
+	for _, n := range numbers {
+		if entries[n].Location != "" {
+			items = append(items, *entries[n])
+		}
+	}
+	return items, nil
+}
+
+func parseXSPF(r io.Reader) ([]Item, error) {
+	var playlist xspfPlaylist
+	if err := xml.NewDecoder(r).Decode(&playlist); err != nil {
+		return nil, err
+	}
+	items := make([]Item, 0, len(playlist.Tracks))
+	for _, track := range playlist.Tracks {
+		location := track.Location
+		if u, err := url.Parse(location); err == nil && (u.Scheme == "file" || u.Scheme == "") {
+			location = filePath(u)
+		}
+		items = append(items, Item{
+			Location: location,
+			Artist:   track.Creator,
+			Title:    track.Title,
+			Duration: float64(track.Duration) / 1000,
+		})
+	}
+	return items, nil
+}
+
+// resolveLocation turns file URLs and relative paths into absolute paths
+func resolveLocation(location, dir string) string {
+	if strings.HasPrefix(location, "file://") {
+		if u, err := url.Parse(location); err == nil {
+			location = filePath(u)
+		}
+	}
+	if isWindowsPath(location) || filepath.IsAbs(location) {
+		return location
+	}
+	return filepath.Join(dir, filepath.FromSlash(strings.ReplaceAll(location, "\\", "/")))
+}
+
+// filePath returns the path of a file URL. Windows drive paths lose the
+// slash before the drive letter, file:///C:/Music becomes C:/Music.
+func filePath(u *url.URL) string {
+	if isWindowsPath(strings.TrimPrefix(u.Path, "/")) {
+		return u.Path[1:]
+	}
+	return u.Path
+}
+
+// isWindowsPath reports whether the location is an absolute Windows path like C:\Music
+func isWindowsPath(location string) bool {
+	return len(location) > 2 && location[1] == ':' && (location[2] == '\\' || location[2] == '/')
+}
+
+// trackMatcher resolves playlist items to collection tracks
+type trackMatcher struct {
+	byPath     map[string]*traktor.Track
+	byFoldPath map[string]*traktor.Track
+	byName     map[string][]*traktor.Track
+	tracks     []*traktor.Track
+	mappings   []PathMapping
+}
+
+func newTrackMatcher(collection *traktor.TraktorCollection, mappings []PathMapping) *trackMatcher {
+	m := &trackMatcher{
+		byPath:     make(map[string]*traktor.Track),
+		byFoldPath: make(map[string]*traktor.Track),
+		byName:     make(map[string][]*traktor.Track),
+		mappings:   mappings,
+	}
+	for i := range collection.Tracks {
+		track := &collection.Tracks[i]
+		m.byPath[track.FilePath] = track
+		m.byFoldPath[strings.ToLower(track.FilePath)] = track
+		name := strings.ToLower(track.FileName)
+		m.byName[name] = append(m.byName[name], track)
+		m.tracks = append(m.tracks, track)
+	}
+	return m
+}
+
+// match finds the collection track for an item and reports how it was found
+func (m *trackMatcher) match(item Item) (*traktor.Track, string) {
+	if track, exists := m.byPath[item.Location]; exists {
+		return track, "path"
+	}
+	for _, mapping := range m.mappings {
+		if mapping.From == "" || !strings.HasPrefix(item.Location, mapping.From) {
+			continue
+		}
+		mapped := mapping.To + strings.TrimPrefix(item.Location, mapping.From)
+		mapped = filepath.FromSlash(strings.ReplaceAll(mapped, "\\", "/"))
+		if track, exists := m.byPath[mapped]; exists {
+			return track, "mapped path"
+		}
+		if track, exists := m.byFoldPath[strings.ToLower(mapped)]; exists {
+			return track, "mapped path"
+		}
+	}
+	if track, exists := m.byFoldPath[strings.ToLower(item.Location)]; exists {
+		return track, "path"
+	}
+
+	// Fuzzy matching: same file name, preferring the candidate whose tags agree
+	base := item.Location
+	if i := strings.LastIndexAny(base, "/\\"); i >= 0 {
+		base = base[i+1:]
+	}
+	candidates := m.byName[strings.ToLower(base)]
+	if len(candidates) == 1 {
+		return candidates[0], "file name"
+	}
+	if len(candidates) > 1 {
+		return bestTagMatch(item, base, candidates, 0), "file name"
+	}
+
+	if track := bestTagMatch(item, base, m.tracks, fuzzyThreshold); track != nil {
+		return track, "tags"
+	}
+	return nil, ""
+}
+
+// bestTagMatch returns the track whose artist and title are most similar to the item
+func bestTagMatch(item Item, fileName string, tracks []*traktor.Track, threshold float64) *traktor.Track {
+	query := tokens(item.Artist + " " + item.Title)
+	if item.Title == "" {
+		query = tokens(strings.TrimSuffix(fileName, filepath.Ext(fileName)))
+	}
+	if len(query) == 0 {
+		return nil
+	}
+
+	var best *traktor.Track
+	bestScore := threshold
+	for _, track := range tracks {
+		score := similarity(query, tokens(track.Artist+" "+track.Title))
+		if score > bestScore || (best == nil && score >= bestScore) {
+			best, bestScore = track, score
+		}
+	}
+	return best
+}
+
+// tokens splits text into lower case words without punctuation
+func tokens(text string) map[string]bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
+
+// similarity is the Jaccard index of two word sets
+func similarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for word := range a {
+		if b[word] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+// Resolve matches playlist items against the collection
+func Resolve(collection *traktor.TraktorCollection, items []Item, opts ImportOptions) *ImportResult {
+	matcher := newTrackMatcher(collection, opts.Mappings)
+	result := &ImportResult{}
+	for _, item := range items {
+		track, method := matcher.match(item)
+		if track == nil {
+			result.Unmatched = append(result.Unmatched, item)
+			continue
+		}
+		result.Matched = append(result.Matched, Match{Item: item, Track: track, Method: method})
+	}
+	return result
+}
+
+// ImportFile reads a playlist file, matches its entries and creates a Traktor
+// playlist named after the file. The collection is not saved.
+func ImportFile(collection *traktor.TraktorCollection, path string, opts ImportOptions) (*ImportResult, error) {
+	items, err := ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	result := Resolve(collection, items, opts)
+
+	keys := make([]string, len(result.Matched))
+	for i, match := range result.Matched {
+		keys[i] = match.Track.PrimaryKey
+	}
+	folder := opts.Folder
+	if folder == "" {
+		folder = ImportFolder
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	result.Playlist, err = collection.AddPlaylist(folder, name, keys)
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
@@ -0,0 +1,328 @@
+package rekordbox
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"unicode/utf16"
+)
+
+// ANLZ files are a PMAI header followed by tagged sections. All values are
+// big-endian.
+const anlzHeaderSize = 28
+
+// Waveform sizes written into the analysis files
+const (
+	previewWidth     = 400
+	tinyPreviewWidth = 100
+	// detailPerSecond is the number of detail waveform columns per second
+	detailPerSecond = 150
+)
+
+// Cue list types of PCOB and PCO2 sections
+const (
+	cueListMemory = 0
+	cueListHot    = 1
+)
+
+// AnlzBeat is a beat of the PQTZ beat grid. Number counts 1 to 4 within the bar.
+type AnlzBeat struct {
+	Number int
+	Tempo  float64
+	Time   float64 // ms
+}
+
+// AnlzCue is a cue or loop of a PCOB or PCO2 section. HotCue is 0 for memory
+// cues and 1 for hot cue A. Loops have a LoopTime after Time.
+type AnlzCue struct {
+	HotCue   int
+	Loop     bool
+	Time     float64 // ms
+	LoopTime float64 // ms
+	Comment  string
+	Color    [3]byte
+}
+
+// Analysis is the content of an ANLZ0000.DAT or .EXT file
+type Analysis struct {
+	Path         string
+	Beats        []AnlzBeat
+	Cues         []AnlzCue
+	ExtendedCues []AnlzCue
+	Preview      []byte
+	TinyPreview  []byte
+	Detail       []byte
+}
+
+// anlzWriter builds an analysis file section by section
+type anlzWriter struct {
+	data []byte
+}
+
+func newAnlzWriter() *anlzWriter {
+	w := &anlzWriter{data: []byte("PMAI")}
+	w.data = binary.BigEndian.AppendUint32(w.data, anlzHeaderSize)
+	w.data = binary.BigEndian.AppendUint32(w.data, 0) // file length, set in bytes
+	w.data = binary.BigEndian.AppendUint32(w.data, 1)
+	w.data = binary.BigEndian.AppendUint32(w.data, 0x10000)
+	w.data = binary.BigEndian.AppendUint32(w.data, 0x10000)
+	w.data = binary.BigEndian.AppendUint32(w.data, 0)
+	return w
+}
+
+// section appends a tag with its header fields and body
+func (w *anlzWriter) section(fourcc string, header, body []byte) {
+	w.data = append(w.data, fourcc...)
+	w.data = binary.BigEndian.AppendUint32(w.data, uint32(12+len(header)))
+	w.data = binary.BigEndian.AppendUint32(w.data, uint32(12+len(header)+len(body)))
+	w.data = append(w.data, header...)
+	w.data = append(w.data, body...)
+}
+
+func (w *anlzWriter) bytes() []byte {
+	binary.BigEndian.PutUint32(w.data[8:], uint32(len(w.data)))
+	return w.data
+}
+
+// path writes the PPTH section naming the audio file on the device
+func (w *anlzWriter) path(path string) {
+	var body []byte
+	for _, unit := range utf16.Encode([]rune(path)) {
+		body = binary.BigEndian.AppendUint16(body, unit)
+	}
+	body = append(body, 0, 0)
+	w.section("PPTH", binary.BigEndian.AppendUint32(nil, uint32(len(body))), body)
+}
+
+// vbr writes an empty PVBR seek index
+func (w *anlzWriter) vbr() {
+	w.section("PVBR", make([]byte, 4), make([]byte, 400*4))
+}
+
+// beatGrid writes the PQTZ section
+func (w *anlzWriter) beatGrid(beats []AnlzBeat) {
+	header := binary.BigEndian.AppendUint32(nil, 0)
+	header = binary.BigEndian.AppendUint32(header, 0x80000)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(beats)))
+	var body []byte
+	for _, beat := range beats {
+		body = binary.BigEndian.AppendUint16(body, uint16(beat.Number))
+		body = binary.BigEndian.AppendUint16(body, uint16(beat.Tempo*100+0.5))
+		body = binary.BigEndian.AppendUint32(body, uint32(beat.Time+0.5))
+	}
+	w.section("PQTZ", header, body)
+}
+
+// cueList writes a PCOB section. Memory cues are chained in time order.
+func (w *anlzWriter) cueList(listType int, cues []AnlzCue) {
+	header := binary.BigEndian.AppendUint32(nil, uint32(listType))
+	header = binary.BigEndian.AppendUint16(header, 0)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(cues)))
+	header = binary.BigEndian.AppendUint32(header, 0xffffffff)
+
+	var body []byte
+	for i, cue := range cues {
+		entry := []byte("PCPT")
+		entry = binary.BigEndian.AppendUint32(entry, 28)
+		entry = binary.BigEndian.AppendUint32(entry, 56)
+		entry = binary.BigEndian.AppendUint32(entry, uint32(cue.HotCue))
+		entry = binary.BigEndian.AppendUint32(entry, 1)
+		entry = binary.BigEndian.AppendUint32(entry, 0x10000)
+		previous, next := uint16(0xffff), uint16(0xffff)
+		if listType == cueListMemory {
+			if i > 0 {
+				previous = uint16(i - 1)
+			}
+			if i+1 < len(cues) {
+				next = uint16(i + 1)
+			}
+		}
+		entry = binary.BigEndian.AppendUint16(entry, previous)
+		entry = binary.BigEndian.AppendUint16(entry, next)
+		entry = append(entry, cueKind(cue), 0)
+		entry = binary.BigEndian.AppendUint16(entry, 1000)
+		entry = binary.BigEndian.AppendUint32(entry, uint32(cue.Time+0.5))
+		entry = binary.BigEndian.AppendUint32(entry, loopTime(cue))
+		entry = append(entry, make([]byte, 16)...)
+		body = append(body, entry...)
+	}
+	w.section("PCOB", header, body)
+}
+
+// extendedCueList writes a PCO2 section with cue comments and colours
+func (w *anlzWriter) extendedCueList(listType int, cues []AnlzCue) {
+	header := binary.BigEndian.AppendUint32(nil, uint32(listType))
+	header = binary.BigEndian.AppendUint16(header, uint16(len(cues)))
+	header = binary.BigEndian.AppendUint16(header, 0)
+
+	var body []byte
+	for _, cue := range cues {
+		var comment []byte
+		if cue.Comment != "" {
+			for _, unit := range utf16.Encode([]rune(cue.Comment)) {
+				comment = binary.BigEndian.AppendUint16(comment, unit)
+			}
+			comment = append(comment, 0, 0)
+		}
+		entry := binary.BigEndian.AppendUint32(nil, uint32(cue.HotCue))
+		entry = append(entry, cueKind(cue), 0)
+		entry = binary.BigEndian.AppendUint16(entry, 1000)
+		entry = binary.BigEndian.AppendUint32(entry, uint32(cue.Time+0.5))
+		entry = binary.BigEndian.AppendUint32(entry, loopTime(cue))
+		entry = append(entry, make([]byte, 8)...)
+		entry = binary.BigEndian.AppendUint16(entry, 0)
+		entry = binary.BigEndian.AppendUint16(entry, 0)
+		entry = binary.BigEndian.AppendUint32(entry, uint32(len(comment)))
+		entry = append(entry, comment...)
+		entry = append(entry, 0, cue.Color[0], cue.Color[1], cue.Color[2])
+		entry = append(entry, make([]byte, (4-(len(entry)+12)%4)%4)...)
+
+		body = append(body, "PCP2"...)
+		body = binary.BigEndian.AppendUint32(body, 16)
+		body = binary.BigEndian.AppendUint32(body, uint32(12+len(entry)))
+		body = append(body, entry...)
+	}
+	w.section("PCO2", header, body)
+}
+
+// preview writes a PWAV or PWV2 overview waveform
+func (w *anlzWriter) preview(fourcc string, data []byte) {
+	header := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	header = binary.BigEndian.AppendUint32(header, 0x10000)
+	w.section(fourcc, header, data)
+}
+
+// detail writes the PWV3 scrolling waveform
+func (w *anlzWriter) detail(data []byte) {
+	header := binary.BigEndian.AppendUint32(nil, 1)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(data)))
+	header = binary.BigEndian.AppendUint32(header, 0x960000)
+	w.section("PWV3", header, data)
+}
+
+func cueKind(cue AnlzCue) byte {
+	if cue.Loop {
+		return 2
+	}
+	return 1
+}
+
+func loopTime(cue AnlzCue) uint32 {
+	if !cue.Loop {
+		return 0xffffffff
+	}
+	return uint32(cue.LoopTime + 0.5)
+}
+
+// ReadAnalysis reads the sections of an ANLZ file that this package writes.
+// Unknown sections are skipped.
+func ReadAnalysis(path string) (*Analysis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < anlzHeaderSize || string(data[:4]) != "PMAI" {
+		return nil, errors.New("not a rekordbox analysis file")
+	}
+	analysis := &Analysis{}
+	pos := int(binary.BigEndian.Uint32(data[4:]))
+	for pos+12 <= len(data) {
+		fourcc := string(data[pos : pos+4])
+		headerLen := int(binary.BigEndian.Uint32(data[pos+4:]))
+		tagLen := int(binary.BigEndian.Uint32(data[pos+8:]))
+		if headerLen < 12 || tagLen < headerLen || pos+tagLen > len(data) {
+			return nil, fmt.Errorf("invalid %s section", fourcc)
+		}
+		header := data[pos+12 : pos+headerLen]
+		body := data[pos+headerLen : pos+tagLen]
+		if err := analysis.readSection(fourcc, header, body); err != nil {
+			return nil, fmt.Errorf("%s section: %w", fourcc, err)
+		}
+		pos += tagLen
+	}
+	return analysis, nil
+}
+
+var errShortSection = errors.New("section too short")
+
+func (a *Analysis) readSection(fourcc string, header, body []byte) error {
+	switch fourcc {
+	case "PPTH":
+		a.Path = decodeUTF16BE(body)
+	case "PQTZ":
+		if len(header) < 12 {
+			return errShortSection
+		}
+		count := int(binary.BigEndian.Uint32(header[8:]))
+		if count*8 > len(body) {
+			return errShortSection
+		}
+		for i := 0; i < count; i++ {
+			entry := body[8*i:]
+			a.Beats = append(a.Beats, AnlzBeat{
+				Number: int(binary.BigEndian.Uint16(entry)),
+				Tempo:  float64(binary.BigEndian.Uint16(entry[2:])) / 100,
+				Time:   float64(binary.BigEndian.Uint32(entry[4:])),
+			})
+		}
+	case "PCOB":
+		for len(body) >= 12 && string(body[:4]) == "PCPT" {
+			size := int(binary.BigEndian.Uint32(body[8:]))
+			if size < 40 || size > len(body) {
+				return errShortSection
+			}
+			a.Cues = append(a.Cues, parseCue(body[12:size], 0))
+			body = body[size:]
+		}
+	case "PCO2":
+		for len(body) >= 12 && string(body[:4]) == "PCP2" {
+			size := int(binary.BigEndian.Uint32(body[8:]))
+			if size < 12+36 || size > len(body) {
+				return errShortSection
+			}
+			entry := body[12:size]
+			cue := parseCue(entry, -12)
+			if commentLen := int(binary.BigEndian.Uint32(entry[28:])); 32+commentLen+4 <= len(entry) {
+				cue.Comment = decodeUTF16BE(entry[32 : 32+commentLen])
+				copy(cue.Color[:], entry[32+commentLen+1:])
+			}
+			a.ExtendedCues = append(a.ExtendedCues, cue)
+			body = body[size:]
+		}
+	case "PWAV":
+		a.Preview = body
+	case "PWV2":
+		a.TinyPreview = body
+	case "PWV3":
+		a.Detail = body
+	}
+	return nil
+}
+
+// parseCue reads the fields shared by PCPT and PCP2 entries. PCP2 entries
+// lack the status and ordering fields, shift is the difference in offset.
+func parseCue(entry []byte, shift int) AnlzCue {
+	cue := AnlzCue{
+		HotCue: int(binary.BigEndian.Uint32(entry)),
+		Loop:   entry[16+shift] == 2,
+		Time:   float64(binary.BigEndian.Uint32(entry[20+shift:])),
+	}
+	if cue.Loop {
+		cue.LoopTime = float64(binary.BigEndian.Uint32(entry[24+shift:]))
+	}
+	return cue
+}
+
+// decodeUTF16BE decodes a null terminated UTF-16BE string
+func decodeUTF16BE(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		unit := binary.BigEndian.Uint16(data[i:])
+		if unit == 0 {
+			break
+		}
+		units = append(units, unit)
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,5 @@
+package rekordbox
+
+const Prefix = "rekordbox://"
+const PlaylistPrefix = "rekordbox://playlist"
+const CollectionPrefix = "rekordbox://collection"
@@ -0,0 +1,572 @@
+package rekordbox
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ilmarkerm/djlibgo/fileutil"
+	"github.com/ilmarkerm/djlibgo/tags"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// DeviceExportOptions controls the USB drive export
+type DeviceExportOptions struct {
+	// Playlists limits the export to these playlists and their tracks.
+	// When empty the whole collection and all playlists are exported.
+	Playlists []*traktor.Playlist
+}
+
+// DeviceManifestName is the file below the drive root that records what the
+// device export wrote. Only files listed there are ever removed, so a
+// library written by rekordbox itself is left alone.
+const DeviceManifestName = ".djlibgo-rekordbox.json"
+
+// PDBPath returns the location of export.pdb below the root of a drive
+func PDBPath(root string) string {
+	return filepath.Join(root, "PIONEER", "rekordbox", "export.pdb")
+}
+
+// cueColors are the RGB colours rekordbox shows for hot cues A to H
+var cueColors = [8][3]byte{
+	{0x28, 0xe2, 0x14}, {0x30, 0x5a, 0xff}, {0xff, 0x12, 0x7b}, {0xff, 0xa0, 0x00},
+	{0x00, 0xe0, 0xff}, {0xa0, 0x5f, 0xff}, {0xff, 0x00, 0x00}, {0xe0, 0xff, 0x00},
+}
+
+// trackColors are the fixed colours of the colors table
+var trackColors = []string{"Pink", "Red", "Orange", "Yellow", "Green", "Aqua", "Blue", "Purple"}
+
+// deviceColumns are the browse categories CDJs offer, with their ids
+var deviceColumns = []struct {
+	id   uint16
+	name string
+}{
+	{0x80, "GENRE"}, {0x81, "ARTIST"}, {0x82, "ALBUM"}, {0x83, "TRACK"}, {0x85, "BPM"},
+	{0x86, "RATING"}, {0x87, "YEAR"}, {0x88, "REMIXER"}, {0x89, "LABEL"},
+	{0x8a, "ORIGINAL ARTIST"}, {0x8b, "KEY"}, {0x8d, "CUE"}, {0x8e, "COLOR"},
+	{0x92, "TIME"}, {0x93, "BITRATE"}, {0x94, "FILE NAME"}, {0x84, "PLAYLIST"},
+	{0x98, "HOT CUE BANK"}, {0x95, "HISTORY"}, {0x91, "SEARCH"}, {0x96, "COMMENTS"},
+	{0x8c, "DATE ADDED"}, {0x97, "DJ PLAY COUNT"}, {0x90, "FOLDER"}, {0xa1, "DEFAULT"},
+	{0xa2, "ALPHABET"}, {0xaa, "MATCHING"},
+}
+
+// deviceTrack is a track placed on the drive
+type deviceTrack struct {
+	id          uint32
+	track       *traktor.Track
+	path        string // device path, e.g. /Contents/Artist/Album/file.mp3
+	analyzePath string // device path of ANLZ0000.DAT
+	sampleRate  int
+	size        int64 // size of the copied file in bytes
+}
+
+// ExportDevice prepares a drive for Pioneer players: the audio files are copied
+// under Contents, and the PIONEER folder gets export.pdb and an analysis file
+// pair per track with the beat grid, cues, loops and a waveform. The export
+// replaces the rekordbox library on the drive and keeps the previous
+// export.pdb as export.pdb.bak. Audio and analysis files that an earlier
+// export wrote and this one no longer uses are removed; files it did not
+// write are never touched.
+func ExportDevice(root string, collection *traktor.TraktorCollection, opts DeviceExportOptions) (err error) {
+	playlists := opts.Playlists
+	var tracks []*traktor.Track
+	if len(playlists) == 0 {
+		for i := range collection.Playlists {
+			playlists = append(playlists, &collection.Playlists[i])
+		}
+		for i := range collection.Tracks {
+			tracks = append(tracks, &collection.Tracks[i])
+		}
+	} else {
+		seen := make(map[*traktor.Track]bool)
+		for _, playlist := range playlists {
+			for _, track := range playlist.Tracks {
+				if !seen[track] {
+					seen[track] = true
+					tracks = append(tracks, track)
+				}
+			}
+		}
+	}
+
+	root = filepath.Clean(root)
+	pdbPath := PDBPath(root)
+	if err := os.MkdirAll(filepath.Dir(pdbPath), 0755); err != nil {
+		return err
+	}
+	previous, err := fileutil.ReadManifest(root, DeviceManifestName)
+	if err != nil {
+		return err
+	}
+	current := &fileutil.Manifest{}
+	defer func() {
+		// Files written by a failed export are recorded too, so a later
+		// export cleans them up
+		if err != nil {
+			if writeErr := previous.Merge(current).Write(root, DeviceManifestName); writeErr != nil {
+				err = errors.Join(err, writeErr)
+			}
+		}
+	}()
+
+	used := make(map[string]bool)
+	devices := make([]*deviceTrack, 0, len(tracks))
+	byTrack := make(map[*traktor.Track]*deviceTrack, len(tracks))
+	for i, track := range tracks {
+		device := &deviceTrack{id: uint32(i + 1), track: track, path: contentsPath(track, used)}
+		device.analyzePath = analyzePath(device.path)
+		for _, path := range []string{device.path, device.analyzePath, extPath(device.analyzePath)} {
+			current.Files = append(current.Files, strings.TrimPrefix(path, "/"))
+		}
+		target := filepath.Join(root, filepath.FromSlash(device.path))
+		if _, err := fileutil.SyncFile(track.FilePath, target); err != nil {
+			return fmt.Errorf("%s: %w", track.FilePath, err)
+		}
+		info, err := os.Stat(target)
+		if err != nil {
+			return err
+		}
+		device.size = info.Size()
+		device.sampleRate = 44100
+		if rate, err := tags.SampleRate(track.FilePath); err == nil && rate > 0 {
+			device.sampleRate = rate
+		}
+		if err := writeAnalysis(root, device); err != nil {
+			return fmt.Errorf("%s: %w", track.FilePath, err)
+		}
+		devices = append(devices, device)
+		byTrack[track] = device
+	}
+
+	// The new export.pdb only replaces the old one once it is complete
+	tmp := pdbPath + ".tmp"
+	if err := writePDB(tmp, devices, playlists, byTrack); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if _, err := os.Stat(pdbPath); err == nil {
+		if err := os.Rename(pdbPath, pdbPath+".bak"); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, pdbPath); err != nil {
+		return err
+	}
+
+	fileutil.RemoveStale(root, previous, current)
+	return current.Write(root, DeviceManifestName)
+}
+
+// extPath returns the path of the .EXT file next to an ANLZ0000.DAT file
+func extPath(datPath string) string {
+	return strings.TrimSuffix(datPath, ".DAT") + ".EXT"
+}
+
+// contentsPath returns the device path of a track below /Contents, sorted
+// into artist and album folders like rekordbox does
+func contentsPath(track *traktor.Track, used map[string]bool) string {
+	artist, album := track.Artist, track.Album
+	if artist == "" {
+		artist = "UnknownArtist"
+	}
+	if album == "" {
+		album = "UnknownAlbum"
+	}
+	name := filepath.Base(track.FilePath)
+	dir := "/Contents/" + fileutil.SanitizeFileName(artist) + "/" + fileutil.SanitizeFileName(album) + "/"
+	return fileutil.UniqueFileName(dir+name, used)
+}
+
+// analyzePath returns the device path of the analysis file of a track. The
+// folder names are derived from the track's device path.
+func analyzePath(devicePath string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(devicePath))
+	sum := hash.Sum32()
+	return fmt.Sprintf("/PIONEER/USBANLZ/P%03X/%08X/ANLZ0000.DAT", sum>>20, sum)
+}
+
+// writeAnalysis writes the ANLZ0000.DAT and ANLZ0000.EXT files of a track
+func writeAnalysis(root string, device *deviceTrack) error {
+	track := device.track
+	beats := deviceBeats(track)
+	hot, memory := deviceCues(track)
+
+	// Uncompressed files get a real waveform, others a flat line
+	var peaks []float64
+	columns := int(track.Duration * detailPerSecond)
+	if columns > 0 {
+		peaks, _ = readPeaks(track.FilePath, columns)
+	}
+
+	dat := newAnlzWriter()
+	dat.path(device.path)
+	dat.vbr()
+	dat.beatGrid(beats)
+	dat.preview("PWAV", waveformBytes(peaks, previewWidth))
+	dat.preview("PWV2", tinyWaveformBytes(peaks, tinyPreviewWidth))
+	dat.cueList(cueListMemory, memory)
+	dat.cueList(cueListHot, hot)
+
+	ext := newAnlzWriter()
+	ext.path(device.path)
+	ext.detail(waveformBytes(peaks, columns))
+	ext.extendedCueList(cueListMemory, memory)
+	ext.extendedCueList(cueListHot, hot)
+
+	path := filepath.Join(root, filepath.FromSlash(device.analyzePath))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, dat.bytes(), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(extPath(path), ext.bytes(), 0644)
+}
+
+// deviceBeats expands the Traktor grid into one entry per beat up to the end
+// of the track, counting bars from the grid anchor
+func deviceBeats(track *traktor.Track) []AnlzBeat {
+	tempo, ok := gridTempo(track)
+	if !ok || track.Duration <= 0 {
+		return nil
+	}
+	beatLength := 60 / tempo.Bpm
+	var anchor float64
+	for _, cue := range track.CuePoints {
+		if cue.Type == traktor.CueTypeGrid {
+			anchor = cue.Start / 1000
+			break
+		}
+	}
+	// Beats before the anchor count backwards so the anchor stays beat 1
+	firstIndex := int(math.Round((tempo.Inizio - anchor) / beatLength))
+	var beats []AnlzBeat
+	for i := 0; ; i++ {
+		at := tempo.Inizio + float64(i)*beatLength
+		if at > track.Duration {
+			break
+		}
+		number := (firstIndex+i)%4 + 1
+		if number <= 0 {
+			number += 4
+		}
+		beats = append(beats, AnlzBeat{Number: number, Tempo: tempo.Bpm, Time: at * 1000})
+	}
+	return beats
+}
+
+// deviceCues splits the Traktor cues into hot cues A to H and memory cues.
+// The load marker and cues without a hot cue become memory cues.
+func deviceCues(track *traktor.Track) (hot, memory []AnlzCue) {
+	for _, cue := range track.CuePoints {
+		entry := AnlzCue{Time: math.Max(cue.Start, 0), Comment: cue.Name}
+		switch cue.Type {
+		case traktor.CueTypeCue, traktor.CueTypeLoad:
+		case traktor.CueTypeLoop:
+			if cue.Len <= 0 {
+				continue
+			}
+			entry.Loop = true
+			entry.LoopTime = entry.Time + cue.Len
+		default:
+			continue
+		}
+		if cue.HotCue >= 0 && cue.HotCue < 8 && cue.Type != traktor.CueTypeLoad {
+			entry.HotCue = cue.HotCue + 1
+			entry.Color = cueColors[cue.HotCue]
+			hot = append(hot, entry)
+			continue
+		}
+		memory = append(memory, entry)
+	}
+	sort.Slice(hot, func(i, j int) bool { return hot[i].HotCue < hot[j].HotCue })
+	sort.Slice(memory, func(i, j int) bool { return memory[i].Time < memory[j].Time })
+	return hot, memory
+}
+
+// nameTable assigns ids to distinct names in order of first use
+type nameTable struct {
+	ids   map[string]uint32
+	names []string
+}
+
+func (t *nameTable) id(name string) uint32 {
+	if name == "" {
+		return 0
+	}
+	if t.ids == nil {
+		t.ids = make(map[string]uint32)
+	}
+	if id, exists := t.ids[name]; exists {
+		return id
+	}
+	t.names = append(t.names, name)
+	t.ids[name] = uint32(len(t.names))
+	return uint32(len(t.names))
+}
+
+// rows returns a row per name built by the given function
+func (t *nameTable) rows(build func(id uint32, name string) []byte) [][]byte {
+	rows := make([][]byte, len(t.names))
+	for i, name := range t.names {
+		rows[i] = build(uint32(i+1), name)
+	}
+	return rows
+}
+
+// deviceAlbum is an album row, albums are told apart by their artist
+type deviceAlbum struct {
+	name     string
+	artistID uint32
+}
+
+// writePDB writes the export.pdb tables
+func writePDB(path string, devices []*deviceTrack, playlists []*traktor.Playlist, byTrack map[*traktor.Track]*deviceTrack) error {
+	var genres, artists, labels, keys nameTable
+	albumIDs := make(map[deviceAlbum]uint32)
+	var albums []deviceAlbum
+	var trackRows [][]byte
+	for i, device := range devices {
+		track := device.track
+		ids := trackRowIDs{
+			genre:    genres.id(track.Genre),
+			artist:   artists.id(track.Artist),
+			remixer:  artists.id(track.Remixer),
+			composer: artists.id(track.Producer),
+			label:    labels.id(track.Label),
+		}
+		if value, ok := traktor.TrackKeyValue(track); ok {
+			ids.key = keys.id(traktor.KeyValueToNotation(value, traktor.NotationMusical))
+		} else {
+			ids.key = keys.id(track.Key)
+		}
+		if track.Album != "" {
+			album := deviceAlbum{name: track.Album, artistID: ids.artist}
+			id, exists := albumIDs[album]
+			if !exists {
+				albums = append(albums, album)
+				id = uint32(len(albums))
+				albumIDs[album] = id
+			}
+			ids.album = id
+		}
+		trackRows = append(trackRows, trackRow(i, device, ids))
+	}
+
+	w := newPDBWriter()
+	tables := map[int][][]byte{
+		pdbTracks: trackRows,
+		pdbGenres: genres.rows(idNameRow),
+		pdbArtists: artists.rows(func(id uint32, name string) []byte {
+			row := newRow(10)
+			row.u16(0, 0x60)
+			row.u16(2, uint16(id-1)<<5)
+			row.u32(4, id)
+			row.u8(8, 0x03)
+			row.u8(9, uint8(row.str(name)))
+			return row.data
+		}),
+		pdbLabels: labels.rows(idNameRow),
+		pdbKeys: keys.rows(func(id uint32, name string) []byte {
+			row := newRow(8)
+			row.u32(0, id)
+			row.u32(4, id)
+			row.str(name)
+			return row.data
+		}),
+		pdbColors:          colorRows(),
+		pdbPlaylistTree:    nil,
+		pdbPlaylistEntries: nil,
+		pdbColumns:         columnRows(),
+	}
+	var albumRows [][]byte
+	for i, album := range albums {
+		row := newRow(22)
+		row.u16(0, 0x80)
+		row.u16(2, uint16(i)<<5)
+		row.u32(8, album.artistID)
+		row.u32(12, uint32(i+1))
+		row.u8(20, 0x03)
+		row.u8(21, uint8(row.str(album.name)))
+		albumRows = append(albumRows, row.data)
+	}
+	tables[pdbAlbums] = albumRows
+	tables[pdbPlaylistTree], tables[pdbPlaylistEntries] = playlistRows(playlists, byTrack)
+
+	for table := 0; table < pdbTableCount; table++ {
+		if err := w.writeTable(table, tables[table]); err != nil {
+			return err
+		}
+	}
+	return w.writeFile(path)
+}
+
+// trackRowIDs are the ids a track row refers to
+type trackRowIDs struct {
+	genre, artist, remixer, composer, label, key, album uint32
+}
+
+// Offsets of the track row fields
+const (
+	trackRowSize       = 0x88
+	trackStringOffsets = 0x5e
+)
+
+// Indexes of the track row strings
+const (
+	trackAutoloadHotcues = 7
+	trackDateAdded       = 10
+	trackReleaseDate     = 11
+	trackAnalyzePath     = 14
+	trackAnalyzeDate     = 15
+	trackComment         = 16
+	trackTitle           = 17
+	trackFileName        = 19
+	trackFilePath        = 20
+	trackStringCount     = 21
+)
+
+// trackRow builds the track table row of a track
+func trackRow(index int, device *deviceTrack, ids trackRowIDs) []byte {
+	track := device.track
+	row := newRow(trackRowSize)
+	row.u16(0x00, 0x24)
+	row.u16(0x02, uint16(index)<<5)
+	row.u32(0x04, 0x000c0700)
+	row.u32(0x08, uint32(device.sampleRate))
+	row.u32(0x0c, ids.composer)
+	row.u32(0x10, uint32(device.size))
+	row.u16(0x18, 0x4a68)
+	row.u16(0x1a, 0x78f7)
+	row.u32(0x20, ids.key)
+	row.u32(0x28, ids.label)
+	row.u32(0x2c, ids.remixer)
+	row.u32(0x30, uint32(track.Bitrate/1000))
+	row.u32(0x38, uint32(math.Round(track.BPM*100)))
+	row.u32(0x3c, ids.genre)
+	row.u32(0x40, ids.album)
+	row.u32(0x44, ids.artist)
+	row.u32(0x48, device.id)
+	row.u16(0x4e, uint16(track.PlayCount))
+	if date, ok := traktor.ParseDate(track.ReleaseDate); ok {
+		row.u16(0x50, uint16(date.Year()))
+	}
+	row.u16(0x52, 16)
+	row.u16(0x54, uint16(math.Round(track.Duration)))
+	row.u16(0x56, 0x29)
+	row.u8(0x59, uint8(traktor.RatingToStars(track.Rating)))
+	row.u16(0x5a, 1)
+	row.u16(0x5c, 3)
+
+	values := make([]string, trackStringCount)
+	values[trackAutoloadHotcues] = "ON"
+	values[trackDateAdded] = convertDate(track.ImportDate)
+	values[trackReleaseDate] = convertDate(track.ReleaseDate)
+	values[trackAnalyzePath] = device.analyzePath
+	values[trackAnalyzeDate] = time.Now().Format("2006-01-02")
+	values[trackComment] = track.Comment
+	values[trackTitle] = track.Title
+	values[trackFileName] = filepath.Base(device.path)
+	values[trackFilePath] = device.path
+	for i, value := range values {
+		row.u16(trackStringOffsets+2*i, uint16(row.str(value)))
+	}
+	return row.data
+}
+
+// idNameRow builds a genre or label row
+func idNameRow(id uint32, name string) []byte {
+	row := newRow(4)
+	row.u32(0, id)
+	row.str(name)
+	return row.data
+}
+
+// colorRows builds the fixed colour table
+func colorRows() [][]byte {
+	rows := make([][]byte, len(trackColors))
+	for i, name := range trackColors {
+		row := newRow(8)
+		row.u16(5, uint16(i+1))
+		row.str(name)
+		rows[i] = row.data
+	}
+	return rows
+}
+
+// columnRows builds the browse category table. The names are UTF-16 strings
+// wrapped in the 0xfffa and 0xfffb markers.
+func columnRows() [][]byte {
+	rows := make([][]byte, len(deviceColumns))
+	for i, column := range deviceColumns {
+		row := newRow(4)
+		row.u16(0, uint16(i+1))
+		row.u16(2, column.id)
+		row.str("￺" + column.name + "￻")
+		rows[i] = row.data
+	}
+	return rows
+}
+
+// playlistRows rebuilds the Traktor folders in the playlist tree and lists
+// the tracks of each playlist
+func playlistRows(playlists []*traktor.Playlist, byTrack map[*traktor.Track]*deviceTrack) (tree, entries [][]byte) {
+	folders := make(map[string]uint32)
+	children := make(map[uint32]uint32)
+	nextID := uint32(1)
+	add := func(parent uint32, name string, folder bool) uint32 {
+		id := nextID
+		nextID++
+		row := newRow(0x14)
+		row.u32(0x00, parent)
+		row.u32(0x08, children[parent])
+		row.u32(0x0c, id)
+		if folder {
+			row.u32(0x10, 1)
+		}
+		row.str(name)
+		tree = append(tree, row.data)
+		children[parent]++
+		return id
+	}
+
+	for _, playlist := range playlists {
+		parts := strings.Split(playlist.Path, "/")
+		if playlist.Path == "" {
+			parts = []string{playlist.Name}
+		}
+		parent := uint32(0)
+		for i := range parts[:len(parts)-1] {
+			path := strings.Join(parts[:i+1], "/")
+			folder, exists := folders[path]
+			if !exists {
+				folder = add(parent, parts[i], true)
+				folders[path] = folder
+			}
+			parent = folder
+		}
+		id := add(parent, playlist.Name, false)
+		index := uint32(0)
+		for _, track := range playlist.Tracks {
+			device, exists := byTrack[track]
+			if !exists {
+				continue
+			}
+			index++
+			row := newRow(12)
+			row.u32(0, index)
+			row.u32(4, device.id)
+			row.u32(8, id)
+			entries = append(entries, row.data)
+		}
+	}
+	return tree, entries
+}
@@ -0,0 +1,305 @@
+package rekordbox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ilmarkerm/djlibgo/internal/testfixture"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// readBack reads the drive and indexes its tracks by title and its playlists
+// by path
+func readBack(t *testing.T, root string) (map[string]*traktor.Track, map[string]*traktor.Playlist) {
+	t.Helper()
+	device, err := ReadDevice(root)
+	if err != nil {
+		t.Fatalf("ReadDevice: %v", err)
+	}
+	return testfixture.Index(device)
+}
+
+func TestExportDeviceRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "drive")
+	collection := testfixture.Collection(t, dir)
+	if err := ExportDevice(root, collection, DeviceExportOptions{}); err != nil {
+		t.Fatalf("ExportDevice: %v", err)
+	}
+	tracks, playlists := readBack(t, root)
+	if len(tracks) != 3 {
+		t.Fatalf("read %d tracks, want 3", len(tracks))
+	}
+
+	one := tracks["One"]
+	if one == nil {
+		t.Fatal("track One is missing")
+	}
+	if want := filepath.Join(root, "Contents", "Artist", "Album", "One.mp3"); one.FilePath != want {
+		t.Errorf("path %s, want %s", one.FilePath, want)
+	}
+	info, err := os.Stat(one.FilePath)
+	if err != nil {
+		t.Fatalf("audio file was not copied: %v", err)
+	}
+	if int64(one.FileSize) != info.Size() {
+		t.Errorf("file size %d, want %d bytes", one.FileSize, info.Size())
+	}
+	if one.Artist != "Artist" || one.Album != "Album" {
+		t.Errorf("artist %q and album %q", one.Artist, one.Album)
+	}
+	if one.MusicalKey != 21 {
+		t.Errorf("key %d, want 21", one.MusicalKey)
+	}
+	if math.Abs(one.BPM-124) > 0.001 {
+		t.Errorf("BPM %.3f, want 124", one.BPM)
+	}
+
+	grid := testfixture.FindCue(one, traktor.CueTypeGrid, -1)
+	if grid == nil || grid.Grid == nil {
+		t.Fatal("beat grid is missing")
+	}
+	if math.Abs(grid.Grid.Bpm-124) > 0.001 {
+		t.Errorf("grid BPM %.3f, want 124", grid.Grid.Bpm)
+	}
+	// The first downbeat is the Traktor grid anchor
+	if math.Abs(grid.Start-1250) > 1 {
+		t.Errorf("first downbeat at %.2f ms, want 1250", grid.Start)
+	}
+
+	for _, want := range []struct {
+		hotCue int
+		start  float64
+		name   string
+	}{{0, 61000, "Drop"}, {3, 122500, "Break"}} {
+		cue := testfixture.FindCue(one, traktor.CueTypeCue, want.hotCue)
+		if cue == nil {
+			t.Errorf("hot cue %d is missing", want.hotCue+1)
+			continue
+		}
+		if math.Abs(cue.Start-want.start) > 1 || cue.Name != want.name {
+			t.Errorf("hot cue %d is %q at %.2f, want %q at %.0f", want.hotCue+1, cue.Name, cue.Start, want.name, want.start)
+		}
+	}
+	loop := testfixture.FindCue(one, traktor.CueTypeLoop, 5)
+	if loop == nil {
+		t.Fatal("hot loop 6 is missing")
+	}
+	if math.Abs(loop.Start-90000) > 1 || math.Abs(loop.Len-7742) > 1 {
+		t.Errorf("loop at %.2f for %.2f ms, want 90000 for 7742", loop.Start, loop.Len)
+	}
+
+	testfixture.CheckTitles(t, playlists, "Set/A", "Three", "One")
+	testfixture.CheckTitles(t, playlists, "Set/B", "Two")
+}
+
+func TestExportDeviceReplacesLibrary(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "drive")
+	collection := testfixture.Collection(t, dir)
+	if err := ExportDevice(root, collection, DeviceExportOptions{}); err != nil {
+		t.Fatalf("ExportDevice: %v", err)
+	}
+	before, _ := readBack(t, root)
+	unrelated := filepath.Join(root, "Contents", "notes.txt")
+	if err := os.WriteFile(unrelated, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := collection.GetPlaylistByPath("Set/B")
+	if err := ExportDevice(root, collection, DeviceExportOptions{Playlists: []*traktor.Playlist{b}}); err != nil {
+		t.Fatalf("ExportDevice B: %v", err)
+	}
+	tracks, playlists := readBack(t, root)
+	if len(tracks) != 1 || tracks["Two"] == nil {
+		t.Errorf("read %d tracks, want only Two", len(tracks))
+	}
+	testfixture.CheckTitles(t, playlists, "Set/B", "Two")
+	if len(playlists) != 1 {
+		t.Errorf("read %d playlists, want 1", len(playlists))
+	}
+
+	// Files of the tracks that left the library are gone, with their folders
+	for _, title := range []string{"One", "Three"} {
+		if _, err := os.Stat(before[title].FilePath); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed: %v", before[title].FilePath, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "Contents", "Other")); !os.IsNotExist(err) {
+		t.Errorf("empty artist folder was not removed: %v", err)
+	}
+	anlz, err := filepath.Glob(filepath.Join(root, "PIONEER", "USBANLZ", "*", "*", "ANLZ0000.*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anlz) != 2 {
+		t.Errorf("%d analysis files left, want the 2 of track Two", len(anlz))
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("file not written by the export was removed: %v", err)
+	}
+	if _, err := os.Stat(PDBPath(root) + ".bak"); err != nil {
+		t.Errorf("no backup of the previous export.pdb: %v", err)
+	}
+}
+
+func TestExportDeviceKeepsForeignFiles(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "drive")
+	collection := testfixture.Collection(t, dir)
+	if err := ExportDevice(root, collection, DeviceExportOptions{}); err != nil {
+		t.Fatalf("ExportDevice: %v", err)
+	}
+	before, _ := readBack(t, root)
+	// Without the manifest the library looks like one rekordbox wrote
+	if err := os.Remove(filepath.Join(root, DeviceManifestName)); err != nil {
+		t.Fatal(err)
+	}
+
+	b := collection.GetPlaylistByPath("Set/B")
+	if err := ExportDevice(root, collection, DeviceExportOptions{Playlists: []*traktor.Playlist{b}}); err != nil {
+		t.Fatalf("ExportDevice B: %v", err)
+	}
+	for _, title := range []string{"One", "Three"} {
+		if _, err := os.Stat(before[title].FilePath); err != nil {
+			t.Errorf("%s of a library this export did not write was removed: %v", title, err)
+		}
+	}
+}
+
+// TestExportDeviceFileLayout compares parts of export.pdb and the analysis
+// file of track One with bytes built by hand from the Deep Symmetry
+// documentation of the formats, so a mistake shared by the writer and the
+// reader does not go unnoticed
+func TestExportDeviceFileLayout(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "drive")
+	if err := ExportDevice(root, testfixture.Collection(t, dir), DeviceExportOptions{}); err != nil {
+		t.Fatalf("ExportDevice: %v", err)
+	}
+
+	// File header: page size 4096 and 20 tables, little endian
+	pdb, err := os.ReadFile(PDBPath(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(pdb[:0x0c]), "00000000"+"00100000"+"14000000"; got != want {
+		t.Errorf("file header %s, want %s", got, want)
+	}
+	if pages := binary.LittleEndian.Uint32(pdb[0x0c:]); int(pages)*4096 != len(pdb) {
+		t.Errorf("file header counts %d pages in %d bytes", pages, len(pdb))
+	}
+	// The tracks table pointer leads to an index page linking the data page
+	if tableType := binary.LittleEndian.Uint32(pdb[0x1c:]); tableType != 0 {
+		t.Fatalf("first table pointer has type %d, want tracks", tableType)
+	}
+	index := pdb[4096*int(binary.LittleEndian.Uint32(pdb[0x1c+8:])):]
+	if index[0x1b] != 0x64 {
+		t.Errorf("tracks index page flags %#x, want 0x64", index[0x1b])
+	}
+	page := pdb[4096*int(binary.LittleEndian.Uint32(index[0x0c:])):][:4096]
+	// Flags 0x34, and 3 rows packed as 13 bits of row offsets and 11 bits of rows
+	if got, want := hex.EncodeToString(page[0x08:0x0c]), "00000000"; got != want {
+		t.Errorf("data page table type %s, want %s", got, want)
+	}
+	if got, want := hex.EncodeToString(page[0x18:0x1c]), "03600034"; got != want {
+		t.Errorf("data page row counts and flags %s, want %s", got, want)
+	}
+	// Row offsets run backwards from the end of the page, before the present
+	// flags. Rows start after the 0x28 byte page header.
+	if flags := binary.LittleEndian.Uint16(page[4096-4:]); flags != 0x7 {
+		t.Errorf("row present flags %#x, want 0x7", flags)
+	}
+	var row []byte
+	for slot := 0; slot < 3; slot++ {
+		offset := 0x28 + int(binary.LittleEndian.Uint16(page[4096-6-2*slot:]))
+		candidate := page[offset:]
+		title := candidate[binary.LittleEndian.Uint16(candidate[0x5e+2*17:]):]
+		// A short ASCII string: its length plus one, shifted left and marked by bit 0
+		if bytes.HasPrefix(title, []byte("\x09One")) {
+			row = candidate
+		}
+	}
+	if row == nil {
+		t.Fatal("no track row with the title One")
+	}
+	for _, field := range []struct {
+		name   string
+		offset int
+		want   string
+	}{
+		{"subtype", 0x00, "2400"},
+		{"sample rate", 0x08, "44ac0000"},
+		{"file size", 0x10, "09000000"}, // "audio One"
+		{"tempo", 0x38, "70300000"},     // 124.00 BPM
+		{"duration", 0x54, "2c01"},      // 300 s
+	} {
+		n := len(field.want) / 2
+		if got := hex.EncodeToString(row[field.offset : field.offset+n]); got != field.want {
+			t.Errorf("track row %s %s, want %s", field.name, got, field.want)
+		}
+	}
+
+	// The analysis file is big endian sections after a PMAI header. Each
+	// section starts with its tag, header length and total length.
+	// String 14 of the row is the path of the analysis file
+	dat, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(rowString(row, 0x5e+2*14))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(dat[:28]), "504d4149"+"0000001c"+fmt.Sprintf("%08x", len(dat))+
+		"00000001"+"00010000"+"00010000"+"00000000"; got != want {
+		t.Errorf("PMAI header %s, want %s", got, want)
+	}
+	sections := make(map[string][][]byte)
+	for rest := dat[28:]; len(rest) >= 12; {
+		size := int(binary.BigEndian.Uint32(rest[8:]))
+		if size < 12 || size > len(rest) {
+			t.Fatalf("section %q has length %d", rest[:4], size)
+		}
+		sections[string(rest[:4])] = append(sections[string(rest[:4])], rest[:size])
+		rest = rest[size:]
+	}
+	if len(sections["PQTZ"]) != 1 {
+		t.Fatalf("%d PQTZ sections, want 1", len(sections["PQTZ"]))
+	}
+	// Beats are a beat number in the bar, the tempo times 100 and the time in
+	// ms. The first beat of the track is two beats before the downbeat at 1250 ms.
+	grid := sections["PQTZ"][0]
+	if got, want := hex.EncodeToString(grid[12:24]), "00000000"+"00080000"; got[:16] != want {
+		t.Errorf("PQTZ header %s, want %s followed by the beat count", got, want)
+	}
+	if got, want := hex.EncodeToString(grid[24:48]),
+		"0003"+"3070"+"0000011a"+"0004"+"3070"+"000002fe"+"0001"+"3070"+"000004e2"; got != want {
+		t.Errorf("PQTZ beats %s, want %s", got, want)
+	}
+
+	// The second cue list holds the hot cues: A, D and the loop on F
+	if len(sections["PCOB"]) != 2 {
+		t.Fatalf("%d PCOB sections, want 2", len(sections["PCOB"]))
+	}
+	hot := sections["PCOB"][1]
+	if got, want := hex.EncodeToString(hot[:24]), "50434f42"+"00000018"+fmt.Sprintf("%08x", len(hot))+
+		"00000001"+"0000"+"0003"+"ffffffff"; got != want {
+		t.Errorf("hot cue list header %s, want %s", got, want)
+	}
+	// Hot cue number, enabled, order links, type 1 for cues and 2 for loops,
+	// 1000, the time and the loop end in ms, and 16 bytes of padding
+	padding := strings.Repeat("00", 16)
+	wantCues := "50435054" + "0000001c" + "00000038" + "00000001" + "00000001" + "00010000" +
+		"ffff" + "ffff" + "01" + "00" + "03e8" + "0000ee48" + "ffffffff" + padding +
+		"50435054" + "0000001c" + "00000038" + "00000004" + "00000001" + "00010000" +
+		"ffff" + "ffff" + "01" + "00" + "03e8" + "0001de84" + "ffffffff" + padding +
+		"50435054" + "0000001c" + "00000038" + "00000006" + "00000001" + "00010000" +
+		"ffff" + "ffff" + "02" + "00" + "03e8" + "00015f90" + "00017dce" + padding
+	if got := hex.EncodeToString(hot[24:]); got != wantCues {
+		t.Errorf("hot cues are\n%s\nwant\n%s", got, wantCues)
+	}
+}
@@ -0,0 +1,339 @@
+package rekordbox
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// pdbFile is a loaded export.pdb
+type pdbFile struct {
+	data     []byte
+	pageSize int
+	tables   map[int]pdbTable
+}
+
+// readPDB loads an export.pdb and its table pointers
+func readPDB(path string) (*pdbFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 0x1c {
+		return nil, errors.New("export.pdb is too short")
+	}
+	f := &pdbFile{
+		data:     data,
+		pageSize: int(binary.LittleEndian.Uint32(data[0x04:])),
+		tables:   make(map[int]pdbTable),
+	}
+	count := int(binary.LittleEndian.Uint32(data[0x08:]))
+	if f.pageSize < 512 || 0x1c+16*count > len(data) || 0x1c+16*count > f.pageSize {
+		return nil, errors.New("invalid export.pdb header")
+	}
+	for i := 0; i < count; i++ {
+		pointer := data[0x1c+16*i:]
+		f.tables[int(binary.LittleEndian.Uint32(pointer))] = pdbTable{
+			emptyCandidate: binary.LittleEndian.Uint32(pointer[4:]),
+			firstPage:      binary.LittleEndian.Uint32(pointer[8:]),
+			lastPage:       binary.LittleEndian.Uint32(pointer[12:]),
+		}
+	}
+	return f, nil
+}
+
+// rows returns the present rows of a table. Each row slice runs to the end of
+// its page, the row types know their own layout.
+func (f *pdbFile) rows(tableType int) ([][]byte, error) {
+	table, exists := f.tables[tableType]
+	if !exists {
+		return nil, nil
+	}
+	var rows [][]byte
+	pageCount := len(f.data) / f.pageSize
+	for index, visited := table.firstPage, 0; ; visited++ {
+		if int(index) >= pageCount || visited > pageCount {
+			return nil, fmt.Errorf("table %d: broken page chain", tableType)
+		}
+		page := f.data[int(index)*f.pageSize : int(index+1)*f.pageSize]
+		if page[0x1b]&0x40 == 0 {
+			count := int(page[0x18])
+			if large := int(binary.LittleEndian.Uint16(page[0x22:])); large > count && large != 0x1fff {
+				count = large
+			}
+			for i := 0; i < count; i++ {
+				group, slot := i/pdbRowsPerGroup, i%pdbRowsPerGroup
+				base := f.pageSize - group*pdbRowGroupSize
+				if base-6-2*slot < pdbPageHeaderSize {
+					break
+				}
+				if binary.LittleEndian.Uint16(page[base-4:])&(1<<slot) == 0 {
+					continue
+				}
+				offset := pdbPageHeaderSize + int(binary.LittleEndian.Uint16(page[base-6-2*slot:]))
+				if offset < len(page) {
+					rows = append(rows, page[offset:])
+				}
+			}
+		}
+		if index == table.lastPage {
+			return rows, nil
+		}
+		index = binary.LittleEndian.Uint32(page[0x0c:])
+	}
+}
+
+// rowString reads the string at the offset stored at pos as a u16
+func rowString(row []byte, pos int) string {
+	offset := int(binary.LittleEndian.Uint16(row[pos:]))
+	if offset >= len(row) {
+		return ""
+	}
+	return decodeDeviceString(row[offset:])
+}
+
+// nearFarString reads the name of artist and album rows, whose offset is a
+// byte for near rows and a u16 for far rows
+func nearFarString(row []byte, near, far int) string {
+	offset := int(row[near])
+	if binary.LittleEndian.Uint16(row)&0x04 != 0 {
+		offset = int(binary.LittleEndian.Uint16(row[far:]))
+	}
+	if offset >= len(row) {
+		return ""
+	}
+	return decodeDeviceString(row[offset:])
+}
+
+// readNames reads an id to name table using the given row decoder
+func (f *pdbFile) readNames(tableType int, decode func(row []byte) (uint32, string)) (map[uint32]string, error) {
+	rows, err := f.rows(tableType)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint32]string, len(rows))
+	for _, row := range rows {
+		id, name := decode(row)
+		names[id] = name
+	}
+	return names, nil
+}
+
+// ReadDevice reads a drive prepared for Pioneer players: the tracks and
+// playlists of export.pdb and the beat grids and cues of the analysis files.
+// File paths point to the audio files below root.
+func ReadDevice(root string) (*traktor.TraktorCollection, error) {
+	f, err := readPDB(PDBPath(root))
+	if err != nil {
+		return nil, err
+	}
+
+	idName := func(row []byte) (uint32, string) {
+		return binary.LittleEndian.Uint32(row), decodeDeviceString(row[4:])
+	}
+	genres, err := f.readNames(pdbGenres, idName)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := f.readNames(pdbLabels, idName)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := f.readNames(pdbKeys, func(row []byte) (uint32, string) {
+		return binary.LittleEndian.Uint32(row), decodeDeviceString(row[8:])
+	})
+	if err != nil {
+		return nil, err
+	}
+	artists, err := f.readNames(pdbArtists, func(row []byte) (uint32, string) {
+		return binary.LittleEndian.Uint32(row[4:]), nearFarString(row, 9, 10)
+	})
+	if err != nil {
+		return nil, err
+	}
+	albums, err := f.readNames(pdbAlbums, func(row []byte) (uint32, string) {
+		return binary.LittleEndian.Uint32(row[12:]), nearFarString(row, 21, 22)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := f.rows(pdbTracks)
+	if err != nil {
+		return nil, err
+	}
+	tracks := make([]traktor.Track, 0, len(rows))
+	trackKeys := make(map[uint32]string, len(rows))
+	for _, row := range rows {
+		if len(row) < trackRowSize {
+			continue
+		}
+		u32 := func(pos int) uint32 { return binary.LittleEndian.Uint32(row[pos:]) }
+		u16 := func(pos int) int { return int(binary.LittleEndian.Uint16(row[pos:])) }
+		str := func(index int) string { return rowString(row, trackStringOffsets+2*index) }
+
+		devicePath := str(trackFilePath)
+		path := filepath.Join(root, filepath.FromSlash(devicePath))
+		track := traktor.Track{
+			Title:      str(trackTitle),
+			Artist:     artists[u32(0x44)],
+			Album:      albums[u32(0x40)],
+			Genre:      genres[u32(0x3c)],
+			Label:      labels[u32(0x28)],
+			Remixer:    artists[u32(0x2c)],
+			Producer:   artists[u32(0x0c)],
+			Comment:    str(trackComment),
+			Key:        keys[u32(0x20)],
+			MusicalKey: -1,
+			BPM:        float64(u32(0x38)) / 100,
+			Duration:   float64(u16(0x54)),
+			Bitrate:    int(u32(0x30)) * 1000,
+			FileSize:   int(u32(0x10)),
+			PlayCount:  u16(0x4e),
+			Rating:     int(row[0x59]) * 51,
+			FilePath:   path,
+			FileName:   filepath.Base(path),
+			PrimaryKey: path,
+		}
+		if key, ok := traktor.ParseKey(track.Key); ok {
+			track.MusicalKey = key
+		}
+		if year := u16(0x50); year > 0 {
+			track.ReleaseDate = fmt.Sprintf("%d/1/1", year)
+		}
+		if added, err := time.Parse("2006-01-02", str(trackDateAdded)); err == nil {
+			track.ImportDate = added.Format("2006/1/2")
+		}
+		if anlz := str(trackAnalyzePath); anlz != "" {
+			track.CuePoints = readDeviceCues(filepath.Join(root, filepath.FromSlash(anlz)))
+		}
+		trackKeys[u32(0x48)] = track.PrimaryKey
+		tracks = append(tracks, track)
+	}
+
+	playlists, err := f.readPlaylists(trackKeys)
+	if err != nil {
+		return nil, err
+	}
+	return traktor.NewCollection("rekordbox device", tracks, playlists), nil
+}
+
+// readDeviceCues converts the beat grid and cues of a track's analysis files.
+// Cue names come from the extended cues of the .EXT file when it exists.
+func readDeviceCues(datPath string) []traktor.CuePoint {
+	dat, err := ReadAnalysis(datPath)
+	if err != nil {
+		return nil
+	}
+	names := make(map[[2]int]string)
+	if ext, err := ReadAnalysis(extPath(datPath)); err == nil {
+		for _, cue := range ext.ExtendedCues {
+			names[[2]int{cue.HotCue, int(cue.Time)}] = cue.Comment
+		}
+	}
+
+	var points []traktor.CuePoint
+	for _, beat := range dat.Beats {
+		if beat.Number == 1 && beat.Tempo > 0 {
+			points = append(points, traktor.CuePoint{
+				Name:    "AutoGrid",
+				Type:    traktor.CueTypeGrid,
+				Start:   beat.Time,
+				Repeats: -1,
+				HotCue:  -1,
+				Grid:    &traktor.Grid{Bpm: beat.Tempo},
+			})
+			break
+		}
+	}
+	for _, cue := range dat.Cues {
+		point := traktor.CuePoint{
+			Name:    names[[2]int{cue.HotCue, int(cue.Time)}],
+			Type:    traktor.CueTypeCue,
+			Start:   cue.Time,
+			Repeats: -1,
+			HotCue:  cue.HotCue - 1,
+		}
+		if cue.Loop {
+			point.Type = traktor.CueTypeLoop
+			point.Len = math.Max(cue.LoopTime-cue.Time, 0)
+		}
+		points = append(points, point)
+	}
+	return points
+}
+
+// readPlaylists rebuilds the playlist paths from the playlist tree and fills
+// them from the playlist entries
+func (f *pdbFile) readPlaylists(trackKeys map[uint32]string) ([]traktor.Playlist, error) {
+	rows, err := f.rows(pdbPlaylistTree)
+	if err != nil {
+		return nil, err
+	}
+	type treeNode struct {
+		id, parent, order uint32
+		folder            bool
+		name              string
+	}
+	nodes := make(map[uint32]*treeNode, len(rows))
+	var lists []*treeNode
+	for _, row := range rows {
+		if len(row) < 0x15 {
+			continue
+		}
+		node := &treeNode{
+			parent: binary.LittleEndian.Uint32(row),
+			order:  binary.LittleEndian.Uint32(row[0x08:]),
+			id:     binary.LittleEndian.Uint32(row[0x0c:]),
+			folder: binary.LittleEndian.Uint32(row[0x10:]) != 0,
+			name:   decodeDeviceString(row[0x14:]),
+		}
+		nodes[node.id] = node
+		if !node.folder {
+			lists = append(lists, node)
+		}
+	}
+	pathOf := func(node *treeNode) string {
+		path := node.name
+		for parent, depth := nodes[node.parent], 0; parent != nil && depth < 32; parent, depth = nodes[parent.parent], depth+1 {
+			path = parent.name + "/" + path
+		}
+		return path
+	}
+
+	entryRows, err := f.rows(pdbPlaylistEntries)
+	if err != nil {
+		return nil, err
+	}
+	type entry struct{ index, track uint32 }
+	entries := make(map[uint32][]entry)
+	for _, row := range entryRows {
+		if len(row) < 12 {
+			continue
+		}
+		list := binary.LittleEndian.Uint32(row[8:])
+		entries[list] = append(entries[list], entry{binary.LittleEndian.Uint32(row), binary.LittleEndian.Uint32(row[4:])})
+	}
+
+	sort.SliceStable(lists, func(i, j int) bool { return lists[i].order < lists[j].order })
+	playlists := make([]traktor.Playlist, 0, len(lists))
+	for _, node := range lists {
+		playlist := traktor.Playlist{Name: node.name, Path: pathOf(node)}
+		listEntries := entries[node.id]
+		sort.Slice(listEntries, func(i, j int) bool { return listEntries[i].index < listEntries[j].index })
+		for _, e := range listEntries {
+			if key, exists := trackKeys[e.track]; exists {
+				playlist.TrackKeys = append(playlist.TrackKeys, key)
+			}
+		}
+		playlists = append(playlists, playlist)
+	}
+	return playlists, nil
+}
@@ -0,0 +1,286 @@
+package rekordbox
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"unicode/utf16"
+)
+
+// DeviceSQL layout of export.pdb. All values are little-endian.
+const (
+	pdbPageSize       = 4096
+	pdbPageHeaderSize = 0x28
+	pdbRowGroupSize   = 0x24
+	pdbRowsPerGroup   = 16
+)
+
+// Page flags of data pages and table index pages
+const (
+	pdbDataPage  = 0x34
+	pdbIndexPage = 0x64
+)
+
+// Table types of export.pdb
+const (
+	pdbTracks          = 0
+	pdbGenres          = 1
+	pdbArtists         = 2
+	pdbAlbums          = 3
+	pdbLabels          = 4
+	pdbKeys            = 5
+	pdbColors          = 6
+	pdbPlaylistTree    = 7
+	pdbPlaylistEntries = 8
+	pdbArtwork         = 13
+	pdbColumns         = 16
+	pdbTableCount      = 20
+)
+
+// pdbWriter collects the pages of an export.pdb file. Page 0 is the file header.
+type pdbWriter struct {
+	pages  [][]byte
+	tables [pdbTableCount]pdbTable
+}
+
+// pdbTable is a table pointer of the file header
+type pdbTable struct {
+	emptyCandidate uint32
+	firstPage      uint32
+	lastPage       uint32
+}
+
+func newPDBWriter() *pdbWriter {
+	w := &pdbWriter{}
+	w.allocate()
+	return w
+}
+
+// allocate adds an empty page and returns its index
+func (w *pdbWriter) allocate() uint32 {
+	w.pages = append(w.pages, make([]byte, pdbPageSize))
+	return uint32(len(w.pages) - 1)
+}
+
+// writeTable stores the rows of a table. Every table starts with an index
+// page followed by the data pages, and keeps an empty page for new rows.
+func (w *pdbWriter) writeTable(tableType int, rows [][]byte) error {
+	first := w.allocate()
+	var dataPages []uint32
+	for len(rows) > 0 {
+		page := w.allocate()
+		n, err := fillDataPage(w.pages[page], rows)
+		if err != nil {
+			return fmt.Errorf("table %d: %w", tableType, err)
+		}
+		rows = rows[n:]
+		dataPages = append(dataPages, page)
+	}
+	empty := w.allocate()
+
+	last := first
+	next := empty
+	if len(dataPages) > 0 {
+		last = dataPages[len(dataPages)-1]
+		next = dataPages[0]
+	}
+	writeIndexPage(w.pages[first], first, uint32(tableType), next)
+	for i, page := range dataPages {
+		next := empty
+		if i+1 < len(dataPages) {
+			next = dataPages[i+1]
+		}
+		putPageHeader(w.pages[page], page, uint32(tableType), next)
+	}
+	w.tables[tableType] = pdbTable{emptyCandidate: empty, firstPage: first, lastPage: last}
+	return nil
+}
+
+// putPageHeader writes the header fields shared by data and index pages
+func putPageHeader(page []byte, index, tableType, next uint32) {
+	binary.LittleEndian.PutUint32(page[0x04:], index)
+	binary.LittleEndian.PutUint32(page[0x08:], tableType)
+	binary.LittleEndian.PutUint32(page[0x0c:], next)
+	binary.LittleEndian.PutUint32(page[0x10:], 1)
+}
+
+// writeIndexPage writes a table index page without index entries
+func writeIndexPage(page []byte, index, tableType, next uint32) {
+	putPageHeader(page, index, tableType, next)
+	page[0x1b] = pdbIndexPage
+	binary.LittleEndian.PutUint16(page[0x20:], 0x1fff)
+	binary.LittleEndian.PutUint16(page[0x22:], 0x1fff)
+
+	content := page[pdbPageHeaderSize:]
+	binary.LittleEndian.PutUint16(content[0x00:], 0x1fff)
+	binary.LittleEndian.PutUint16(content[0x02:], 0x1fff)
+	binary.LittleEndian.PutUint16(content[0x04:], 0x03ec)
+	binary.LittleEndian.PutUint32(content[0x08:], index)
+	binary.LittleEndian.PutUint32(content[0x0c:], next)
+	binary.LittleEndian.PutUint32(content[0x10:], 0x03ffffff)
+	binary.LittleEndian.PutUint16(content[0x1a:], 0x1fff)
+	for pos := 0x1c; pos+4 <= len(content)-20; pos += 4 {
+		binary.LittleEndian.PutUint32(content[pos:], 0x1ffffff8)
+	}
+}
+
+// fillDataPage places as many rows as fit into a data page and returns how
+// many were placed. Rows grow from the heap start, the row index from the
+// page end in groups of 16.
+func fillDataPage(page []byte, rows [][]byte) (int, error) {
+	heap := page[pdbPageHeaderSize:]
+	used := 0
+	n := 0
+	for n < len(rows) && n < 0xff {
+		size := align4(len(rows[n]))
+		groups := (n + 1 + pdbRowsPerGroup - 1) / pdbRowsPerGroup
+		if used+size+groups*pdbRowGroupSize > len(heap) {
+			break
+		}
+		copy(heap[used:], rows[n])
+		group, slot := n/pdbRowsPerGroup, n%pdbRowsPerGroup
+		base := pdbPageSize - group*pdbRowGroupSize
+		binary.LittleEndian.PutUint16(page[base-6-2*slot:], uint16(used))
+		flags := binary.LittleEndian.Uint16(page[base-4:])
+		binary.LittleEndian.PutUint16(page[base-4:], flags|1<<slot)
+		used += size
+		n++
+	}
+	if n == 0 {
+		return 0, errors.New("row does not fit into a page")
+	}
+	groups := (n + pdbRowsPerGroup - 1) / pdbRowsPerGroup
+	// Three bytes pack the row offset count into the low 13 bits and the row
+	// count into the high 11 bits. Readers that take the first byte as the
+	// row count see the same number.
+	packed := uint32(n) | uint32(n)<<13
+	page[0x18], page[0x19], page[0x1a] = byte(packed), byte(packed>>8), byte(packed>>16)
+	page[0x1b] = pdbDataPage
+	binary.LittleEndian.PutUint16(page[0x1c:], uint16(len(heap)-used-groups*pdbRowGroupSize))
+	binary.LittleEndian.PutUint16(page[0x1e:], uint16(used))
+	binary.LittleEndian.PutUint16(page[0x20:], 1)
+	return n, nil
+}
+
+// writeFile writes the file header and all pages to path
+func (w *pdbWriter) writeFile(path string) error {
+	header := w.pages[0]
+	binary.LittleEndian.PutUint32(header[0x04:], pdbPageSize)
+	binary.LittleEndian.PutUint32(header[0x08:], pdbTableCount)
+	binary.LittleEndian.PutUint32(header[0x0c:], uint32(len(w.pages)))
+	binary.LittleEndian.PutUint32(header[0x10:], 5)
+	binary.LittleEndian.PutUint32(header[0x14:], 1)
+	for i, table := range w.tables {
+		pointer := header[0x1c+16*i:]
+		binary.LittleEndian.PutUint32(pointer[0:], uint32(i))
+		binary.LittleEndian.PutUint32(pointer[4:], table.emptyCandidate)
+		binary.LittleEndian.PutUint32(pointer[8:], table.firstPage)
+		binary.LittleEndian.PutUint32(pointer[12:], table.lastPage)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	for _, page := range w.pages {
+		if _, err := file.Write(page); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// rowBuilder builds a row with a fixed part followed by its strings
+type rowBuilder struct {
+	data []byte
+}
+
+func newRow(fixed int) *rowBuilder {
+	return &rowBuilder{data: make([]byte, fixed)}
+}
+
+func (r *rowBuilder) u8(offset int, value uint8) {
+	r.data[offset] = value
+}
+
+func (r *rowBuilder) u16(offset int, value uint16) {
+	binary.LittleEndian.PutUint16(r.data[offset:], value)
+}
+
+func (r *rowBuilder) u32(offset int, value uint32) {
+	binary.LittleEndian.PutUint32(r.data[offset:], value)
+}
+
+// str appends a string and returns its offset from the row start
+func (r *rowBuilder) str(value string) int {
+	offset := len(r.data)
+	r.data = append(r.data, encodeDeviceString(value)...)
+	return offset
+}
+
+// encodeDeviceString encodes a DeviceSQL string. Short ASCII strings have a
+// one byte header, longer ones a four byte header and UTF-16 for non-ASCII.
+func encodeDeviceString(value string) []byte {
+	ascii := true
+	for i := 0; i < len(value); i++ {
+		if value[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii && len(value) <= 126 {
+		return append([]byte{byte((len(value)+1)<<1 | 1)}, value...)
+	}
+	if ascii {
+		out := []byte{0x40, 0, 0, 0}
+		binary.LittleEndian.PutUint16(out[1:], uint16(len(value)+4))
+		return append(out, value...)
+	}
+	units := utf16.Encode([]rune(value))
+	out := []byte{0x90, 0, 0, 0}
+	binary.LittleEndian.PutUint16(out[1:], uint16(2*len(units)+4))
+	for _, unit := range units {
+		out = binary.LittleEndian.AppendUint16(out, unit)
+	}
+	return out
+}
+
+// decodeDeviceString reads a DeviceSQL string at the start of data
+func decodeDeviceString(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	flags := data[0]
+	if flags&1 == 1 {
+		n := int(flags>>1) - 1
+		if n < 0 || n+1 > len(data) {
+			return ""
+		}
+		return string(data[1 : 1+n])
+	}
+	if len(data) < 4 {
+		return ""
+	}
+	n := int(binary.LittleEndian.Uint16(data[1:])) - 4
+	if n < 0 || 4+n > len(data) {
+		return ""
+	}
+	body := data[4 : 4+n]
+	switch flags {
+	case 0x40:
+		return string(body)
+	case 0x90:
+		units := make([]uint16, len(body)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(body[2*i:])
+		}
+		return string(utf16.Decode(units))
+	}
+	return ""
+}
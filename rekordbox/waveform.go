@@ -0,0 +1,176 @@
+package rekordbox
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+
+	"github.com/ilmarkerm/djlibgo/audioformat"
+)
+
+// pcmInfo describes the sample data of a WAV or AIFF file
+type pcmInfo struct {
+	order      binary.ByteOrder
+	channels   int
+	bits       int
+	sampleRate float64
+	dataOffset int64
+	dataSize   int64
+}
+
+var errNotPCM = errors.New("not an uncompressed WAV or AIFF file")
+
+// readPeaks returns the peak level, 0 to 1, of each of the given number of
+// equally long parts of a WAV or AIFF file. Compressed formats need a decoder
+// and return errNotPCM.
+func readPeaks(path string, parts int) ([]float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := readPCMInfo(file)
+	if err != nil {
+		return nil, err
+	}
+	frameSize := int64(info.channels * info.bits / 8)
+	frames := info.dataSize / frameSize
+	if frames == 0 || parts <= 0 {
+		return nil, errNotPCM
+	}
+	if _, err := file.Seek(info.dataOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	peaks := make([]float64, parts)
+	reader := bufio.NewReaderSize(io.LimitReader(file, frames*frameSize), 1<<16)
+	sample := make([]byte, info.bits/8)
+	scale := math.Ldexp(1, info.bits-1)
+	for frame := int64(0); frame < frames; frame++ {
+		part := int(frame * int64(parts) / frames)
+		for channel := 0; channel < info.channels; channel++ {
+			if _, err := io.ReadFull(reader, sample); err != nil {
+				return peaks, nil
+			}
+			level := math.Abs(float64(decodeSample(sample, info.order))) / scale
+			if level > peaks[part] {
+				peaks[part] = level
+			}
+		}
+	}
+	return peaks, nil
+}
+
+// decodeSample reads a signed integer sample of 1 to 4 bytes. 8 bit WAV
+// samples are unsigned.
+func decodeSample(data []byte, order binary.ByteOrder) int32 {
+	if len(data) == 1 && order == binary.LittleEndian {
+		return int32(data[0]) - 128
+	}
+	var value int32
+	if order == binary.LittleEndian {
+		for i := len(data) - 1; i >= 0; i-- {
+			value = value<<8 | int32(data[i])
+		}
+	} else {
+		for _, b := range data {
+			value = value<<8 | int32(b)
+		}
+	}
+	shift := 32 - 8*len(data)
+	return value << shift >> shift
+}
+
+// readPCMInfo finds the format and sample data chunks of a WAV or AIFF file
+func readPCMInfo(file *os.File) (*pcmInfo, error) {
+	form, chunks, err := audioformat.ReadChunks(file)
+	if errors.Is(err, audioformat.ErrNoForm) {
+		return nil, errNotPCM
+	}
+	if err != nil {
+		return nil, err
+	}
+	info := &pcmInfo{order: form.Order}
+	for _, c := range chunks {
+		switch c.ID {
+		case "fmt ":
+			format := make([]byte, 16)
+			if _, err := file.ReadAt(format, c.Offset); err != nil {
+				return nil, errNotPCM
+			}
+			// 1 is PCM, 0xfffe the extensible format used for more channels
+			if tag := binary.LittleEndian.Uint16(format); tag != 1 && tag != 0xfffe {
+				return nil, errNotPCM
+			}
+			info.channels = int(binary.LittleEndian.Uint16(format[2:]))
+			info.sampleRate = float64(binary.LittleEndian.Uint32(format[4:]))
+			info.bits = int(binary.LittleEndian.Uint16(format[14:]))
+		case "COMM":
+			comm := make([]byte, 22)
+			if _, err := file.ReadAt(comm, c.Offset); err != nil {
+				return nil, errNotPCM
+			}
+			if form.Type == "AIFC" && string(comm[18:22]) != "NONE" {
+				return nil, errNotPCM
+			}
+			info.channels = int(binary.BigEndian.Uint16(comm))
+			info.bits = int(binary.BigEndian.Uint16(comm[6:]))
+			info.sampleRate = audioformat.ExtendedFloat(comm[8:18])
+		case "data":
+			info.dataOffset, info.dataSize = c.Offset, c.Size
+		case "SSND":
+			ssnd := make([]byte, 4)
+			if _, err := file.ReadAt(ssnd, c.Offset); err != nil {
+				return nil, errNotPCM
+			}
+			skip := int64(8 + binary.BigEndian.Uint32(ssnd))
+			info.dataOffset, info.dataSize = c.Offset+skip, c.Size-skip
+		}
+	}
+	if info.channels <= 0 || info.bits < 8 || info.bits > 32 || info.bits%8 != 0 || info.dataSize <= 0 {
+		return nil, errNotPCM
+	}
+	return info, nil
+}
+
+// peakAt returns the highest peak of the part of peaks that column i of a
+// waveform with the given width covers
+func peakAt(peaks []float64, i, width int) float64 {
+	from, to := i*len(peaks)/width, (i+1)*len(peaks)/width
+	if to <= from {
+		to = from + 1
+	}
+	peak := 0.0
+	for _, level := range peaks[from:min(to, len(peaks))] {
+		peak = math.Max(peak, level)
+	}
+	return math.Min(peak, 1)
+}
+
+// waveformBytes converts peaks into rekordbox waveform columns with the
+// height in the low five bits and a fixed whiteness in the top three
+func waveformBytes(peaks []float64, width int) []byte {
+	data := make([]byte, width)
+	for i := range data {
+		data[i] = 5 << 5
+		if len(peaks) > 0 {
+			data[i] |= byte(peakAt(peaks, i, width) * 31)
+		}
+	}
+	return data
+}
+
+// tinyWaveformBytes converts peaks into the 4 bit heights of a PWV2 preview
+func tinyWaveformBytes(peaks []float64, width int) []byte {
+	data := make([]byte, width)
+	for i := range data {
+		if len(peaks) > 0 {
+			data[i] = byte(peakAt(peaks, i, width) * 15)
+		}
+	}
+	return data
+}
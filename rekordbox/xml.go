@@ -0,0 +1,114 @@
+package rekordbox
+
+import "encoding/xml"
+
+// DJPlaylists is the root element of a rekordbox XML library export
+type DJPlaylists struct {
+	XMLName    xml.Name   `xml:"DJ_PLAYLISTS"`
+	Version    string     `xml:"Version,attr"`
+	Product    Product    `xml:"PRODUCT"`
+	Collection Collection `xml:"COLLECTION"`
+	Playlists  Playlists  `xml:"PLAYLISTS"`
+}
+
+// Product identifies the application that wrote the file
+type Product struct {
+	Name    string `xml:"Name,attr"`
+	Version string `xml:"Version,attr"`
+	Company string `xml:"Company,attr"`
+}
+
+// Collection contains all tracks of the library
+type Collection struct {
+	Entries int     `xml:"Entries,attr"`
+	Tracks  []Track `xml:"TRACK"`
+}
+
+// Track is a TRACK element of the collection
+type Track struct {
+	TrackID       int            `xml:"TrackID,attr"`
+	Name          string         `xml:"Name,attr"`
+	Artist        string         `xml:"Artist,attr"`
+	Composer      string         `xml:"Composer,attr,omitempty"`
+	Album         string         `xml:"Album,attr"`
+	Grouping      string         `xml:"Grouping,attr,omitempty"`
+	Genre         string         `xml:"Genre,attr"`
+	Kind          string         `xml:"Kind,attr"`
+	Size          int64          `xml:"Size,attr"`
+	TotalTime     int            `xml:"TotalTime,attr"`
+	DiscNumber    int            `xml:"DiscNumber,attr"`
+	TrackNumber   int            `xml:"TrackNumber,attr"`
+	Year          int            `xml:"Year,attr"`
+	AverageBpm    float64        `xml:"AverageBpm,attr"`
+	DateAdded     string         `xml:"DateAdded,attr"`
+	BitRate       int            `xml:"BitRate,attr"`
+	SampleRate    int            `xml:"SampleRate,attr"`
+	Comments      string         `xml:"Comments,attr"`
+	PlayCount     int            `xml:"PlayCount,attr"`
+	Rating        int            `xml:"Rating,attr"`
+	Location      string         `xml:"Location,attr"`
+	Remixer       string         `xml:"Remixer,attr"`
+	Tonality      string         `xml:"Tonality,attr"`
+	Label         string         `xml:"Label,attr"`
+	Mix           string         `xml:"Mix,attr"`
+	Tempos        []Tempo        `xml:"TEMPO"`
+	PositionMarks []PositionMark `xml:"POSITION_MARK"`
+}
+
+// Tempo is a beat grid anchor. Inizio is the position of the anchor beat in seconds.
+type Tempo struct {
+	Inizio  float64 `xml:"Inizio,attr"`
+	Bpm     float64 `xml:"Bpm,attr"`
+	Metro   string  `xml:"Metro,attr"`
+	Battito int     `xml:"Battito,attr"`
+}
+
+// PositionMark is a memory cue, hot cue or loop. Num is -1 for memory cues
+// and 0-7 for hot cues A-H. Positions are in seconds.
+type PositionMark struct {
+	Name  string   `xml:"Name,attr"`
+	Type  int      `xml:"Type,attr"`
+	Start float64  `xml:"Start,attr"`
+	End   *float64 `xml:"End,attr"`
+	Num   int      `xml:"Num,attr"`
+	Red   *int     `xml:"Red,attr"`
+	Green *int     `xml:"Green,attr"`
+	Blue  *int     `xml:"Blue,attr"`
+}
+
+// Position mark types used by rekordbox
+const (
+	MarkCue     = 0
+	MarkFadeIn  = 1
+	MarkFadeOut = 2
+	MarkLoad    = 3
+	MarkLoop    = 4
+)
+
+// Playlists contains the playlist tree
+type Playlists struct {
+	Node Node `xml:"NODE"`
+}
+
+// Node is a folder (Type 0) or playlist (Type 1) in the playlist tree
+type Node struct {
+	Type    int         `xml:"Type,attr"`
+	Name    string      `xml:"Name,attr"`
+	Count   *int        `xml:"Count,attr"`
+	KeyType *int        `xml:"KeyType,attr"`
+	Entries *int        `xml:"Entries,attr"`
+	Nodes   []Node      `xml:"NODE"`
+	Tracks  []NodeTrack `xml:"TRACK"`
+}
+
+// Node types
+const (
+	NodeFolder   = 0
+	NodePlaylist = 1
+)
+
+// NodeTrack references a collection track from a playlist. With KeyType 0 the
+// key is the TrackID, with KeyType 1 it is the Location.
+type NodeTrack struct {
+	Key string `xml:"Key,attr"`
+}
@@ -0,0 +1,308 @@
+package rekordbox
+
+import (
+	"encoding/xml"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// ExportOptions controls the rekordbox XML export
+type ExportOptions struct {
+	// Playlists limits the export to these playlists and their tracks.
+	// When empty the whole collection and all playlists are exported.
+	Playlists []*traktor.Playlist
+	// MemoryCues adds a memory cue for every hot cue, as CDJs without
+	// hot cue support only show memory cues
+	MemoryCues bool
+}
+
+// ExportFile writes the collection as rekordbox XML to path
+func ExportFile(path string, collection *traktor.TraktorCollection, opts ExportOptions) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Export(file, collection, opts); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Export writes the collection as rekordbox XML
+func Export(w io.Writer, collection *traktor.TraktorCollection, opts ExportOptions) error {
+	playlists := opts.Playlists
+	var tracks []*traktor.Track
+	if len(playlists) == 0 {
+		for i := range collection.Playlists {
+			playlists = append(playlists, &collection.Playlists[i])
+		}
+		for i := range collection.Tracks {
+			tracks = append(tracks, &collection.Tracks[i])
+		}
+	} else {
+		seen := make(map[*traktor.Track]bool)
+		for _, playlist := range playlists {
+			for _, track := range playlist.Tracks {
+				if !seen[track] {
+					seen[track] = true
+					tracks = append(tracks, track)
+				}
+			}
+		}
+	}
+
+	doc := DJPlaylists{
+		Version: "1.0.0",
+		Product: Product{Name: "djlibgo", Version: "1.0", Company: ""},
+	}
+
+	trackIDs := make(map[*traktor.Track]int, len(tracks))
+	for i, track := range tracks {
+		id := i + 1
+		trackIDs[track] = id
+		doc.Collection.Tracks = append(doc.Collection.Tracks, convertTrack(id, track, opts))
+	}
+	doc.Collection.Entries = len(doc.Collection.Tracks)
+	doc.Playlists.Node = buildPlaylistTree(playlists, trackIDs)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// convertTrack converts a Traktor track into a rekordbox TRACK element
+func convertTrack(id int, track *traktor.Track, opts ExportOptions) Track {
+	out := Track{
+		TrackID:    id,
+		Name:       track.Title,
+		Artist:     track.Artist,
+		Album:      track.Album,
+		Genre:      track.Genre,
+		Kind:       fileKind(track.FilePath),
+		Size:       fileSize(track),
+		TotalTime:  int(math.Round(track.Duration)),
+		AverageBpm: round2(track.BPM),
+		DateAdded:  convertDate(track.ImportDate),
+		BitRate:    track.Bitrate / 1000,
+		Comments:   track.Comment,
+		PlayCount:  track.PlayCount,
+		// Both Traktor and rekordbox store ratings as 0-255 in steps of 51
+		Rating:   traktor.RatingToStars(track.Rating) * 51,
+		Location: LocationURL(track.FilePath),
+		Remixer:  track.Remixer,
+		Label:    track.Label,
+	}
+	if date, ok := traktor.ParseDate(track.ReleaseDate); ok {
+		out.Year = date.Year()
+	}
+	if key, ok := traktor.TrackKeyValue(track); ok {
+		out.Tonality = traktor.KeyValueToNotation(key, traktor.NotationMusical)
+	}
+	if tempo, ok := gridTempo(track); ok {
+		out.Tempos = []Tempo{tempo}
+	}
+	out.PositionMarks = convertCuePoints(track.CuePoints, opts.MemoryCues)
+	return out
+}
+
+// gridTempo derives the rekordbox beat grid anchor from the Traktor grid cue
+func gridTempo(track *traktor.Track) (Tempo, bool) {
+	for _, cue := range track.CuePoints {
+		if cue.Type != traktor.CueTypeGrid {
+			continue
+		}
+		bpm := track.BPM
+		if cue.Grid != nil && cue.Grid.Bpm > 0 {
+			bpm = cue.Grid.Bpm
+		}
+		if bpm <= 0 {
+			return Tempo{}, false
+		}
+		// Move the anchor to the first beat of the track, rekordbox
+		// does not accept negative positions. The grid cue is a downbeat,
+		// so the anchor lands n beats earlier in the bar.
+		beat := 60 / bpm
+		start := cue.Start / 1000
+		n := int(math.Floor(start / beat))
+		start -= float64(n) * beat
+		return Tempo{Inizio: round3(start), Bpm: round2(bpm), Metro: "4/4", Battito: ((-n)%4+4)%4 + 1}, true
+	}
+	return Tempo{}, false
+}
+
+// convertCuePoints maps Traktor cues to rekordbox position marks. Traktor hot
+// cues 1-8 become rekordbox hot cues A-H, other cues become memory cues.
+func convertCuePoints(cues []traktor.CuePoint, memoryCues bool) []PositionMark {
+	var marks []PositionMark
+	for _, cue := range cues {
+		var markType int
+		switch cue.Type {
+		case traktor.CueTypeCue:
+			markType = MarkCue
+		case traktor.CueTypeFadeIn:
+			markType = MarkFadeIn
+		case traktor.CueTypeFadeOut:
+			markType = MarkFadeOut
+		case traktor.CueTypeLoad:
+			markType = MarkLoad
+		case traktor.CueTypeLoop:
+			markType = MarkLoop
+		default:
+			continue
+		}
+
+		mark := PositionMark{
+			Name:  cue.Name,
+			Type:  markType,
+			Start: round3(cue.Start / 1000),
+			Num:   -1,
+		}
+		if markType == MarkLoop && cue.Len > 0 {
+			end := round3((cue.Start + cue.Len) / 1000)
+			mark.End = &end
+		}
+		if cue.HotCue >= 0 && cue.HotCue < 8 {
+			mark.Num = cue.HotCue
+			if memoryCues {
+				memory := mark
+				memory.Num = -1
+				marks = append(marks, memory)
+			}
+		}
+		marks = append(marks, mark)
+	}
+	return marks
+}
+
+// buildPlaylistTree recreates the Traktor folder structure from the playlist paths
+func buildPlaylistTree(playlists []*traktor.Playlist, trackIDs map[*traktor.Track]int) Node {
+	root := Node{Type: NodeFolder, Name: "ROOT"}
+	for _, playlist := range playlists {
+		parts := strings.Split(playlist.Path, "/")
+		folder := &root
+		for _, part := range parts[:len(parts)-1] {
+			folder = childFolder(folder, part)
+		}
+
+		node := Node{Type: NodePlaylist, Name: playlist.Name, KeyType: intPtr(0)}
+		for _, track := range playlist.Tracks {
+			if id, exists := trackIDs[track]; exists {
+				node.Tracks = append(node.Tracks, NodeTrack{Key: strconv.Itoa(id)})
+			}
+		}
+		node.Entries = intPtr(len(node.Tracks))
+		folder.Nodes = append(folder.Nodes, node)
+	}
+	setFolderCounts(&root)
+	return root
+}
+
+func childFolder(parent *Node, name string) *Node {
+	for i := range parent.Nodes {
+		if parent.Nodes[i].Type == NodeFolder && parent.Nodes[i].Name == name {
+			return &parent.Nodes[i]
+		}
+	}
+	parent.Nodes = append(parent.Nodes, Node{Type: NodeFolder, Name: name})
+	return &parent.Nodes[len(parent.Nodes)-1]
+}
+
+func setFolderCounts(node *Node) {
+	if node.Type != NodeFolder {
+		return
+	}
+	node.Count = intPtr(len(node.Nodes))
+	for i := range node.Nodes {
+		setFolderCounts(&node.Nodes[i])
+	}
+}
+
+// LocationURL converts a file path into the file://localhost URL rekordbox uses
+func LocationURL(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		// Windows drive paths, file://localhost/C:/Music/...
+		path = "/" + path
+	}
+	u := url.URL{Scheme: "file", Host: "localhost", Path: path}
+	return u.String()
+}
+
+// LocationPath converts a rekordbox Location URL back into a file path
+func LocationPath(location string) string {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "file" {
+		return location
+	}
+	path := u.Path
+	if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		// Windows drive path
+		return filepath.FromSlash(path[1:])
+	}
+	return filepath.FromSlash(path)
+}
+
+// fileKind returns the rekordbox file type description for a path
+func fileKind(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		return "MP3 File"
+	case ".wav":
+		return "WAV File"
+	case ".aif", ".aiff":
+		return "AIFF File"
+	case ".flac":
+		return "FLAC File"
+	case ".m4a", ".mp4":
+		return "M4A File"
+	case ".ogg":
+		return "OGG File"
+	default:
+		return strings.ToUpper(strings.TrimPrefix(filepath.Ext(path), ".")) + " File"
+	}
+}
+
+// fileSize returns the size of the track file in bytes, or the size the
+// library knows when the file cannot be read
+func fileSize(track *traktor.Track) int64 {
+	if info, err := os.Stat(track.FilePath); err == nil {
+		return info.Size()
+	}
+	return int64(track.FileSize)
+}
+
+// convertDate converts Traktor's YYYY/M/D date into rekordbox's YYYY-MM-DD
+func convertDate(value string) string {
+	date, ok := traktor.ParseDate(value)
+	if !ok {
+		return ""
+	}
+	return date.Format("2006-01-02")
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+func round3(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
+
+func intPtr(i int) *int {
+	return &i
+}
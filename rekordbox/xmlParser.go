@@ -0,0 +1,157 @@
+package rekordbox
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// ParseLibraryFromPath parses a rekordbox XML export into the common collection model.
+// Track primary keys are the file paths of the tracks.
+func ParseLibraryFromPath(path string) (*traktor.TraktorCollection, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var doc DJPlaylists
+	if err := xml.NewDecoder(file).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	tracks := make([]traktor.Track, 0, len(doc.Collection.Tracks))
+	keysByID := make(map[string]string, len(doc.Collection.Tracks))
+	keysByLocation := make(map[string]string, len(doc.Collection.Tracks))
+	for _, t := range doc.Collection.Tracks {
+		track := convertToTraktorTrack(t)
+		keysByID[strconv.Itoa(t.TrackID)] = track.PrimaryKey
+		keysByLocation[t.Location] = track.PrimaryKey
+		tracks = append(tracks, track)
+	}
+
+	playlists := extractPlaylists(doc.Playlists.Node, "", keysByID, keysByLocation)
+
+	version := doc.Product.Name + " " + doc.Product.Version
+	return traktor.NewCollection(version, tracks, playlists), nil
+}
+
+// convertToTraktorTrack converts a rekordbox TRACK element into a track
+func convertToTraktorTrack(t Track) traktor.Track {
+	path := LocationPath(t.Location)
+	track := traktor.Track{
+		Artist:     t.Artist,
+		Title:      t.Name,
+		Album:      t.Album,
+		Genre:      t.Genre,
+		Label:      t.Label,
+		Comment:    t.Comments,
+		Remixer:    t.Remixer,
+		BPM:        t.AverageBpm,
+		Key:        t.Tonality,
+		MusicalKey: -1,
+		Rating:     t.Rating,
+		PlayCount:  t.PlayCount,
+		Duration:   float64(t.TotalTime),
+		Bitrate:    t.BitRate * 1000,
+		FileSize:   int(t.Size),
+		FilePath:   path,
+		FileName:   filepath.Base(path),
+		PrimaryKey: path,
+	}
+	if key, ok := traktor.ParseKey(t.Tonality); ok {
+		track.MusicalKey = key
+	}
+	if date, err := time.Parse("2006-01-02", t.DateAdded); err == nil {
+		track.ImportDate = date.Format("2006/1/2")
+	}
+	if t.Year > 0 {
+		track.ReleaseDate = fmt.Sprintf("%d/1/1", t.Year)
+	}
+	track.CuePoints = convertPositionMarks(t)
+	return track
+}
+
+// convertPositionMarks turns the beat grid and position marks into Traktor cue points
+func convertPositionMarks(t Track) []traktor.CuePoint {
+	var cues []traktor.CuePoint
+	if len(t.Tempos) > 0 {
+		tempo := t.Tempos[0]
+		cues = append(cues, traktor.CuePoint{
+			Name:    "Beat Marker",
+			Type:    traktor.CueTypeGrid,
+			Start:   tempo.Inizio * 1000,
+			Repeats: -1,
+			HotCue:  -1,
+			Grid:    &traktor.Grid{Bpm: tempo.Bpm},
+		})
+	}
+
+	for _, mark := range t.PositionMarks {
+		cue := traktor.CuePoint{
+			Name:    mark.Name,
+			Start:   mark.Start * 1000,
+			Repeats: -1,
+			HotCue:  mark.Num,
+		}
+		switch mark.Type {
+		case MarkFadeIn:
+			cue.Type = traktor.CueTypeFadeIn
+		case MarkFadeOut:
+			cue.Type = traktor.CueTypeFadeOut
+		case MarkLoad:
+			cue.Type = traktor.CueTypeLoad
+		case MarkLoop:
+			cue.Type = traktor.CueTypeLoop
+			if mark.End != nil {
+				cue.Len = (*mark.End - mark.Start) * 1000
+			}
+		default:
+			cue.Type = traktor.CueTypeCue
+		}
+		cues = append(cues, cue)
+	}
+	return cues
+}
+
+// extractPlaylists recursively extracts playlists from the rekordbox playlist tree
+func extractPlaylists(node Node, parentPath string, keysByID, keysByLocation map[string]string) []traktor.Playlist {
+	var playlists []traktor.Playlist
+
+	currentPath := parentPath
+	if node.Name != "" && node.Name != "ROOT" {
+		if currentPath == "" {
+			currentPath = node.Name
+		} else {
+			currentPath = currentPath + "/" + node.Name
+		}
+	}
+
+	if node.Type == NodePlaylist {
+		playlist := traktor.Playlist{
+			Name:      node.Name,
+			Path:      currentPath,
+			TrackKeys: make([]string, 0, len(node.Tracks)),
+		}
+		keys := keysByID
+		if node.KeyType != nil && *node.KeyType == 1 {
+			keys = keysByLocation
+		}
+		for _, item := range node.Tracks {
+			if key, exists := keys[item.Key]; exists {
+				playlist.TrackKeys = append(playlist.TrackKeys, key)
+			}
+		}
+		playlists = append(playlists, playlist)
+	}
+
+	for _, subnode := range node.Nodes {
+		playlists = append(playlists, extractPlaylists(subnode, currentPath, keysByID, keysByLocation)...)
+	}
+	return playlists
+}
@@ -0,0 +1,5 @@
+package serato
+
+const Prefix = "serato://"
+const PlaylistPrefix = "serato://playlist"
+const CollectionPrefix = "serato://collection"
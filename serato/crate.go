@@ -0,0 +1,121 @@
+package serato
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// crateVersion is the version string Serato writes at the start of crate files
+const crateVersion = "1.0/Serato ScratchLive Crate"
+
+// crateSeparator separates parent and child crate names in crate file names
+const crateSeparator = "%%"
+
+// defaultColumns are the columns shown for crates written by us
+var defaultColumns = []string{"song", "artist", "album", "bpm", "key", "length", "comment"}
+
+// Crate is a Serato crate. Name uses "/" between parent and child crates.
+// Tracks are paths relative to the root of the volume the crate lives on,
+// with "/" as separator.
+type Crate struct {
+	Name    string
+	Tracks  []string
+	Columns []string
+}
+
+// CrateFileName returns the file name for a crate, e.g. "Gigs%%Friday.crate"
+func CrateFileName(name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		// Keep the separator and path characters out of the individual names
+		part = strings.ReplaceAll(part, crateSeparator, "%")
+		parts[i] = strings.NewReplacer("\\", "-", ":", "-").Replace(part)
+	}
+	return strings.Join(parts, crateSeparator) + ".crate"
+}
+
+// CrateName returns the crate name for a crate file name
+func CrateName(fileName string) string {
+	name := strings.TrimSuffix(filepath.Base(fileName), ".crate")
+	return strings.ReplaceAll(name, crateSeparator, "/")
+}
+
+// ReadCrate reads a .crate file
+func ReadCrate(path string) (*Crate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := parseFields(data)
+	if err != nil && len(fields) == 0 {
+		return nil, err
+	}
+
+	crate := &Crate{Name: CrateName(path)}
+	for _, f := range fields {
+		switch f.tag {
+		case "otrk":
+			children, _ := parseFields(f.data)
+			for _, child := range children {
+				if child.tag == "ptrk" {
+					crate.Tracks = append(crate.Tracks, decodeString(child.data))
+				}
+			}
+		case "ovct":
+			children, _ := parseFields(f.data)
+			for _, child := range children {
+				if child.tag == "tvcn" {
+					crate.Columns = append(crate.Columns, decodeString(child.data))
+				}
+			}
+		}
+	}
+	return crate, nil
+}
+
+// WriteCrate writes the crate into the Subcrates folder of a _Serato_ directory
+func WriteCrate(seratoDir string, crate *Crate) (string, error) {
+	dir := filepath.Join(seratoDir, "Subcrates")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	columns := crate.Columns
+	if len(columns) == 0 {
+		columns = defaultColumns
+	}
+	fields := []field{stringField("vrsn", crateVersion)}
+	fields = append(fields, field{tag: "osrt", data: encodeFields([]field{
+		stringField("tvcn", columns[0]),
+		{tag: "brev", data: []byte{0}},
+	})})
+	for _, column := range columns {
+		fields = append(fields, field{tag: "ovct", data: encodeFields([]field{
+			stringField("tvcn", column),
+			stringField("tvcw", "0"),
+		})})
+	}
+	for _, track := range crate.Tracks {
+		fields = append(fields, field{tag: "otrk", data: encodeFields([]field{
+			stringField("ptrk", track),
+		})})
+	}
+
+	path := filepath.Join(dir, CrateFileName(crate.Name))
+	return path, os.WriteFile(path, encodeFields(fields), 0644)
+}
+
+// TrackPath converts an absolute file path into the volume relative path
+// stored in crates
+func TrackPath(path, volumeRoot string) string {
+	if rel, err := filepath.Rel(volumeRoot, path); err == nil && !strings.HasPrefix(rel, "..") {
+		path = rel
+	}
+	return strings.TrimPrefix(filepath.ToSlash(path), "/")
+}
+
+// AbsolutePath converts a volume relative crate path into an absolute file path
+func AbsolutePath(trackPath, volumeRoot string) string {
+	return filepath.Join(volumeRoot, filepath.FromSlash(trackPath))
+}
@@ -0,0 +1,152 @@
+package serato
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// maxSlots is the number of hot cue and saved loop slots in Serato
+const maxSlots = 8
+
+// Cue colours by Traktor cue type, taken from the Serato hot cue palette
+var (
+	colorCue  = color.RGBA{R: 0x00, G: 0x44, B: 0xcc, A: 0xff}
+	colorFade = color.RGBA{R: 0xcc, G: 0x44, B: 0x00, A: 0xff}
+	colorLoad = color.RGBA{R: 0xcc, G: 0xcc, B: 0x00, A: 0xff}
+	colorLoop = color.RGBA{R: 0x00, G: 0xcc, B: 0x00, A: 0xff}
+)
+
+// cueColor returns the colour for a Traktor cue. A COLOR attribute in
+// #RRGGBB form wins over the colour derived from the cue type.
+func cueColor(cue traktor.CuePoint) color.RGBA {
+	for _, attr := range cue.Attrs {
+		if attr.Name.Local != "COLOR" {
+			continue
+		}
+		var r, g, b uint8
+		if _, err := fmt.Sscanf(strings.TrimPrefix(attr.Value, "#"), "%02x%02x%02x", &r, &g, &b); err == nil {
+			return color.RGBA{R: r, G: g, B: b, A: 0xff}
+		}
+	}
+	switch cue.Type {
+	case traktor.CueTypeFadeIn, traktor.CueTypeFadeOut:
+		return colorFade
+	case traktor.CueTypeLoad:
+		return colorLoad
+	case traktor.CueTypeLoop:
+		return colorLoop
+	default:
+		return colorCue
+	}
+}
+
+// millis converts a Traktor position in milliseconds to a Serato position
+func millis(position float64) uint32 {
+	return uint32(math.Max(0, math.Round(position)))
+}
+
+// MarkersFromTrack converts the hot cues and loops of a Traktor track. Only
+// cues assigned to one of the first eight hot cue slots are converted, as
+// Serato has no memory cues.
+func MarkersFromTrack(track *traktor.Track) ([]Cue, []Loop) {
+	var cues []Cue
+	var loops []Loop
+	for _, cue := range track.CuePoints {
+		if cue.HotCue < 0 || cue.HotCue >= maxSlots || cue.Type == traktor.CueTypeGrid {
+			continue
+		}
+		if cue.Type == traktor.CueTypeLoop && cue.Len > 0 {
+			loops = append(loops, Loop{
+				Index: cue.HotCue,
+				Start: millis(cue.Start),
+				End:   millis(cue.Start + cue.Len),
+				Color: cueColor(cue),
+				Name:  cue.Name,
+			})
+			continue
+		}
+		cues = append(cues, Cue{
+			Index:    cue.HotCue,
+			Position: millis(cue.Start),
+			Color:    cueColor(cue),
+			Name:     cue.Name,
+		})
+	}
+	return cues, loops
+}
+
+// CuePointsFromMarkers converts Serato hot cues and loops into Traktor cue points
+func CuePointsFromMarkers(markers *Markers) []traktor.CuePoint {
+	var cues []traktor.CuePoint
+	for _, cue := range markers.Cues {
+		cues = append(cues, traktor.CuePoint{
+			Name:    cue.Name,
+			Type:    traktor.CueTypeCue,
+			Start:   float64(cue.Position),
+			Repeats: -1,
+			HotCue:  cue.Index,
+		})
+	}
+	for _, loop := range markers.Loops {
+		cues = append(cues, traktor.CuePoint{
+			Name:    loop.Name,
+			Type:    traktor.CueTypeLoop,
+			Start:   float64(loop.Start),
+			Len:     float64(loop.End) - float64(loop.Start),
+			Repeats: -1,
+			// Serato loop slots are separate from hot cues
+			HotCue: -1,
+		})
+	}
+	return cues
+}
+
+// WriteTrackMarkers writes the Traktor hot cues and loops of the track into
+// the Serato markers of its audio file. Only the slots Traktor uses are
+// replaced, so Serato cues and loops in other slots are kept, as is other
+// marker data such as the track colour.
+func WriteTrackMarkers(track *traktor.Track) error {
+	markers, err := ReadMarkers(track.FilePath)
+	if err != nil {
+		// Missing or unreadable markers are replaced. Errors reading the file
+		// itself come up again when writing.
+		markers = &Markers{}
+	}
+	cues, loops := MarkersFromTrack(track)
+	mergeMarkers(markers, cues, loops)
+	return WriteMarkers(track.FilePath, markers)
+}
+
+// mergeMarkers replaces the hot cues and loops of markers that share a slot
+// with cues or loops and adds the others. Hot cue and loop slots are
+// separate in Serato, so a cue never replaces a loop.
+func mergeMarkers(markers *Markers, cues []Cue, loops []Loop) {
+	cueSlots := make(map[int]bool)
+	for _, cue := range cues {
+		cueSlots[cue.Index] = true
+	}
+	for _, cue := range markers.Cues {
+		if !cueSlots[cue.Index] {
+			cues = append(cues, cue)
+		}
+	}
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].Index < cues[j].Index })
+	markers.Cues = cues
+
+	loopSlots := make(map[int]bool)
+	for _, loop := range loops {
+		loopSlots[loop.Index] = true
+	}
+	for _, loop := range markers.Loops {
+		if !loopSlots[loop.Index] {
+			loops = append(loops, loop)
+		}
+	}
+	sort.SliceStable(loops, func(i, j int) bool { return loops[i].Index < loops[j].Index })
+	markers.Loops = loops
+}
@@ -0,0 +1,121 @@
+package serato
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// databaseFile is the name of the Serato track database inside _Serato_
+const databaseFile = "database V2"
+
+// ReadDatabase reads the tracks of a Serato "database V2" file. Track paths
+// are made absolute using the volume root.
+func ReadDatabase(path, volumeRoot string) ([]traktor.Track, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := parseFields(data)
+	if err != nil && len(fields) == 0 {
+		return nil, err
+	}
+
+	var tracks []traktor.Track
+	for _, f := range fields {
+		if f.tag != "otrk" {
+			continue
+		}
+		children, _ := parseFields(f.data)
+		values := make(map[string]string, len(children))
+		var added uint32
+		for _, child := range children {
+			switch child.tag[0] {
+			case 't', 'p':
+				values[child.tag] = decodeString(child.data)
+			case 'u':
+				if child.tag == "uadd" && len(child.data) == 4 {
+					added = binary.BigEndian.Uint32(child.data)
+				}
+			}
+		}
+		if values["pfil"] == "" {
+			continue
+		}
+		tracks = append(tracks, convertDatabaseTrack(values, added, volumeRoot))
+	}
+	return tracks, nil
+}
+
+// convertDatabaseTrack creates a track from the string fields of a database record
+func convertDatabaseTrack(values map[string]string, added uint32, volumeRoot string) traktor.Track {
+	filePath := AbsolutePath(values["pfil"], volumeRoot)
+	track := traktor.Track{
+		Title:      values["tsng"],
+		Artist:     values["tart"],
+		Album:      values["talb"],
+		Genre:      values["tgen"],
+		Label:      values["tlbl"],
+		Comment:    values["tcom"],
+		Producer:   values["tcmp"],
+		Remixer:    values["trmx"],
+		Key:        values["tkey"],
+		FilePath:   filePath,
+		FileName:   filepath.Base(filePath),
+		PrimaryKey: filePath,
+		MusicalKey: -1,
+	}
+	if value, ok := traktor.ParseKey(track.Key); ok {
+		track.MusicalKey = value
+	}
+	track.BPM, _ = strconv.ParseFloat(values["tbpm"], 64)
+	track.Duration = parseLength(values["tlen"])
+	if bitrate, err := strconv.ParseFloat(strings.TrimSuffix(values["tbit"], "kbps"), 64); err == nil {
+		track.Bitrate = int(bitrate * 1000)
+	}
+	track.FileSize = parseSize(values["tsiz"])
+	if added > 0 {
+		track.ImportDate = time.Unix(int64(added), 0).Format("2006/1/2")
+	}
+	return track
+}
+
+// parseLength parses lengths in the "mm:ss.cc" form Serato stores
+func parseLength(value string) float64 {
+	minutes, seconds, found := strings.Cut(value, ":")
+	if !found {
+		return 0
+	}
+	m, err1 := strconv.Atoi(minutes)
+	s, err2 := strconv.ParseFloat(seconds, 64)
+	if err1 != nil || err2 != nil {
+		return 0
+	}
+	return float64(m*60) + s
+}
+
+// parseSize converts a size such as "7.9MB" into bytes. Plain numbers are
+// taken as bytes.
+func parseSize(value string) int {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	scale := 1.0
+	for _, unit := range []struct {
+		suffix string
+		scale  float64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if number, found := strings.CutSuffix(value, unit.suffix); found {
+			value, scale = strings.TrimSpace(number), unit.scale
+			break
+		}
+	}
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil || size < 0 {
+		return 0
+	}
+	return int(size * scale)
+}
@@ -0,0 +1,41 @@
+package serato
+
+import (
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// ExportCrates writes a crate for each playlist into the _Serato_ folder.
+// Crate names mirror the playlist paths, so "Gigs/Friday" becomes the
+// Friday subcrate of Gigs. Returns the paths of the written crate files.
+func ExportCrates(playlists []*traktor.Playlist, seratoDir string) ([]string, error) {
+	root := VolumeRoot(seratoDir)
+	var written []string
+	for _, playlist := range playlists {
+		crate := &Crate{Name: playlist.Path}
+		if crate.Name == "" {
+			crate.Name = playlist.Name
+		}
+		for _, track := range playlist.Tracks {
+			crate.Tracks = append(crate.Tracks, TrackPath(track.FilePath, root))
+		}
+		path, err := WriteCrate(seratoDir, crate)
+		if err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// WritePlaylistMarkers writes the Traktor hot cues and loops of all tracks in
+// the playlist into their audio files. Tracks that fail are returned with their
+// errors; the others are still written.
+func WritePlaylistMarkers(playlist *traktor.Playlist) map[string]error {
+	failed := make(map[string]error)
+	for _, track := range playlist.Tracks {
+		if err := WriteTrackMarkers(track); err != nil {
+			failed[track.FilePath] = err
+		}
+	}
+	return failed
+}
@@ -0,0 +1,65 @@
+package serato
+
+import (
+	"encoding/binary"
+	"errors"
+	"unicode/utf16"
+)
+
+// field is a tag-length-value record as used in crate and database files.
+// Tags are four ASCII characters, lengths are 32 bit big endian.
+type field struct {
+	tag  string
+	data []byte
+}
+
+// parseFields splits data into consecutive fields
+func parseFields(data []byte) ([]field, error) {
+	var fields []field
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return fields, errors.New("truncated Serato field")
+		}
+		length := int(binary.BigEndian.Uint32(data[4:8]))
+		if length > len(data)-8 {
+			return fields, errors.New("truncated Serato field")
+		}
+		fields = append(fields, field{tag: string(data[:4]), data: data[8 : 8+length]})
+		data = data[8+length:]
+	}
+	return fields, nil
+}
+
+// encodeFields serializes fields
+func encodeFields(fields []field) []byte {
+	var out []byte
+	for _, f := range fields {
+		out = append(out, f.tag...)
+		out = binary.BigEndian.AppendUint32(out, uint32(len(f.data)))
+		out = append(out, f.data...)
+	}
+	return out
+}
+
+// decodeString decodes the UTF-16 big endian strings Serato uses
+func decodeString(data []byte) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(data[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// encodeString encodes a string as UTF-16 big endian
+func encodeString(s string) []byte {
+	var out []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		out = binary.BigEndian.AppendUint16(out, unit)
+	}
+	return out
+}
+
+// stringField creates a field holding a UTF-16 string
+func stringField(tag, value string) field {
+	return field{tag: tag, data: encodeString(value)}
+}
@@ -0,0 +1,127 @@
+package serato
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/fileutil"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+var library *traktor.TraktorCollection
+var libraryPath string
+var libraryLoaded bool = false
+var libraryErr error
+
+// SetLibraryPath sets the _Serato_ folder to browse and discards the loaded library
+func SetLibraryPath(path string) {
+	libraryPath = path
+	library = nil
+	libraryErr = nil
+	libraryLoaded = false
+}
+
+// IsAvailable checks if a Serato library folder has been configured
+func IsAvailable() bool {
+	if libraryPath == "" {
+		return false
+	}
+	_, err := os.Stat(libraryPath)
+	return err == nil
+}
+
+// GetLibrary returns the parsed Serato library, or nil if it could not be
+// loaded. LoadError tells why.
+func GetLibrary() *traktor.TraktorCollection {
+	if !libraryLoaded {
+		library, libraryErr = ParseLibrary(libraryPath)
+		libraryLoaded = true
+	}
+	return library
+}
+
+// LoadError returns the error from loading the library, or nil
+func LoadError() error {
+	GetLibrary()
+	return libraryErr
+}
+
+// GetSortedPlaylistNames returns a sorted list of crate names.
+func GetSortedPlaylistNames() []string {
+	lib := GetLibrary()
+	if lib == nil {
+		return nil
+	}
+	names := make([]string, len(lib.Playlists))
+	for i, playlist := range lib.Playlists {
+		names[i] = playlist.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+func GetPlaylistByName(name string) *traktor.Playlist {
+	lib := GetLibrary()
+	if lib == nil {
+		return nil
+	}
+	return lib.GetPlaylistByName(name)
+}
+
+// VolumeRoot returns the root of the volume a _Serato_ folder belongs to.
+// Serato stores track paths relative to it.
+func VolumeRoot(seratoDir string) string {
+	root, _ := fileutil.DriveRoot(seratoDir)
+	return root
+}
+
+// ParseLibrary reads the database and crates of a _Serato_ folder. Crates
+// become playlists named by their full crate path; tracks in crates that are
+// missing from the database are added with their file name only. Crates that
+// cannot be read are left out and their errors returned with the library.
+func ParseLibrary(seratoDir string) (*traktor.TraktorCollection, error) {
+	root := VolumeRoot(seratoDir)
+	tracks, err := ReadDatabase(filepath.Join(seratoDir, databaseFile), root)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	known := make(map[string]bool, len(tracks))
+	for _, track := range tracks {
+		known[track.PrimaryKey] = true
+	}
+
+	files, err := filepath.Glob(filepath.Join(seratoDir, "Subcrates", "*.crate"))
+	if err != nil {
+		return nil, err
+	}
+	var playlists []traktor.Playlist
+	var crateErrs []error
+	for _, file := range files {
+		crate, err := ReadCrate(file)
+		if err != nil {
+			crateErrs = append(crateErrs, fmt.Errorf("crate %s: %w", filepath.Base(file), err))
+			continue
+		}
+		playlist := traktor.Playlist{Name: crate.Name, Path: crate.Name}
+		for _, trackPath := range crate.Tracks {
+			path := AbsolutePath(trackPath, root)
+			if !known[path] {
+				tracks = append(tracks, traktor.Track{
+					Title:      strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+					FilePath:   path,
+					FileName:   filepath.Base(path),
+					PrimaryKey: path,
+					MusicalKey: -1,
+				})
+				known[path] = true
+			}
+			playlist.TrackKeys = append(playlist.TrackKeys, path)
+		}
+		playlists = append(playlists, playlist)
+	}
+	return traktor.NewCollection("Serato", tracks, playlists), errors.Join(crateErrs...)
+}
@@ -0,0 +1,221 @@
+package serato
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"image/color"
+	"strings"
+)
+
+// markersDescription is the GEOB description of the Markers2 tag
+const markersDescription = "Serato Markers2"
+
+// markersVorbisKey is the Vorbis comment holding the Markers2 tag in FLAC files
+const markersVorbisKey = "SERATO_MARKERS_V2"
+
+// markersMinSize is the size Serato pads the GEOB data to
+const markersMinSize = 470
+
+// Cue is a Serato hot cue. Position is in milliseconds.
+type Cue struct {
+	Index    int
+	Position uint32
+	Color    color.RGBA
+	Name     string
+}
+
+// Loop is a Serato saved loop. Start and End are in milliseconds.
+type Loop struct {
+	Index  int
+	Start  uint32
+	End    uint32
+	Color  color.RGBA
+	Locked bool
+	Name   string
+}
+
+// markerEntry is an entry of the Markers2 payload that is kept as it was read
+type markerEntry struct {
+	name string
+	data []byte
+}
+
+// Markers is the content of a Serato Markers2 tag. Entries other than cues,
+// loops, the track colour and the BPM lock are preserved when writing.
+type Markers struct {
+	Cues       []Cue
+	Loops      []Loop
+	TrackColor *color.RGBA
+	BPMLock    *bool
+	other      []markerEntry
+}
+
+// ParseMarkers decodes the data of a Serato Markers2 GEOB frame
+func ParseMarkers(data []byte) (*Markers, error) {
+	invalid := errors.New("invalid Serato Markers2 data")
+	if len(data) < 2 || data[0] != 1 || data[1] != 1 {
+		return nil, invalid
+	}
+	// The base64 text is split into lines and padded with zero bytes
+	text := strings.TrimRight(string(data[2:]), "\x00")
+	text = strings.NewReplacer("\n", "", "\r", "", "=", "").Replace(text)
+	if len(text)%4 == 1 {
+		// Serato sometimes writes one stray character at the end
+		text = text[:len(text)-1]
+	}
+	payload, err := base64.RawStdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < 2 || payload[0] != 1 || payload[1] != 1 {
+		return nil, invalid
+	}
+	payload = payload[2:]
+
+	markers := &Markers{}
+	for len(payload) > 0 && payload[0] != 0 {
+		end := bytes.IndexByte(payload, 0)
+		if end < 0 || len(payload) < end+5 {
+			return nil, invalid
+		}
+		name := string(payload[:end])
+		length := int(binary.BigEndian.Uint32(payload[end+1:]))
+		payload = payload[end+5:]
+		if length > len(payload) {
+			return nil, invalid
+		}
+		markers.parseEntry(name, payload[:length])
+		payload = payload[length:]
+	}
+	return markers, nil
+}
+
+// parseEntry decodes a single entry, keeping unknown or malformed entries as they are
+func (m *Markers) parseEntry(name string, data []byte) {
+	switch {
+	case name == "CUE" && len(data) >= 13:
+		m.Cues = append(m.Cues, Cue{
+			Index:    int(data[1]),
+			Position: binary.BigEndian.Uint32(data[2:6]),
+			Color:    color.RGBA{R: data[7], G: data[8], B: data[9], A: 0xff},
+			Name:     cString(data[12:]),
+		})
+	case name == "LOOP" && len(data) >= 21:
+		m.Loops = append(m.Loops, Loop{
+			Index:  int(data[1]),
+			Start:  binary.BigEndian.Uint32(data[2:6]),
+			End:    binary.BigEndian.Uint32(data[6:10]),
+			Color:  color.RGBA{R: data[15], G: data[16], B: data[17], A: 0xff},
+			Locked: data[19] != 0,
+			Name:   cString(data[20:]),
+		})
+	case name == "COLOR" && len(data) >= 4:
+		m.TrackColor = &color.RGBA{R: data[1], G: data[2], B: data[3], A: 0xff}
+	case name == "BPMLOCK" && len(data) >= 1:
+		locked := data[0] != 0
+		m.BPMLock = &locked
+	default:
+		m.other = append(m.other, markerEntry{name: name, data: append([]byte(nil), data...)})
+	}
+}
+
+// cString returns the text up to the first zero byte
+func cString(data []byte) string {
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		data = data[:end]
+	}
+	return string(data)
+}
+
+// payload serializes the entries in the order Serato writes them
+func (m *Markers) payload() []byte {
+	var entries []markerEntry
+	if m.TrackColor != nil {
+		c := m.TrackColor
+		entries = append(entries, markerEntry{"COLOR", []byte{0, c.R, c.G, c.B}})
+	}
+	for _, cue := range m.Cues {
+		data := []byte{0, byte(cue.Index)}
+		data = binary.BigEndian.AppendUint32(data, cue.Position)
+		data = append(data, 0, cue.Color.R, cue.Color.G, cue.Color.B, 0, 0)
+		data = append(data, cue.Name...)
+		entries = append(entries, markerEntry{"CUE", append(data, 0)})
+	}
+	for _, loop := range m.Loops {
+		data := []byte{0, byte(loop.Index)}
+		data = binary.BigEndian.AppendUint32(data, loop.Start)
+		data = binary.BigEndian.AppendUint32(data, loop.End)
+		data = append(data, 0xff, 0xff, 0xff, 0xff, 0, loop.Color.R, loop.Color.G, loop.Color.B, 0)
+		if loop.Locked {
+			data = append(data, 1)
+		} else {
+			data = append(data, 0)
+		}
+		data = append(data, loop.Name...)
+		entries = append(entries, markerEntry{"LOOP", append(data, 0)})
+	}
+	entries = append(entries, m.other...)
+	if m.BPMLock != nil {
+		locked := byte(0)
+		if *m.BPMLock {
+			locked = 1
+		}
+		entries = append(entries, markerEntry{"BPMLOCK", []byte{locked}})
+	}
+
+	out := []byte{1, 1}
+	for _, entry := range entries {
+		out = append(out, entry.name...)
+		out = append(out, 0)
+		out = binary.BigEndian.AppendUint32(out, uint32(len(entry.data)))
+		out = append(out, entry.data...)
+	}
+	return append(out, 0)
+}
+
+// Bytes encodes the markers as GEOB frame data
+func (m *Markers) Bytes() []byte {
+	out := append([]byte{1, 1}, wrapLines(base64.RawStdEncoding.EncodeToString(m.payload()))...)
+	if len(out) < markersMinSize {
+		out = append(out, make([]byte, markersMinSize-len(out))...)
+	}
+	return out
+}
+
+// wrapLines splits base64 text into lines of 72 characters as Serato does
+func wrapLines(text string) string {
+	var b strings.Builder
+	for len(text) > 72 {
+		b.WriteString(text[:72])
+		b.WriteByte('\n')
+		text = text[72:]
+	}
+	b.WriteString(text)
+	return b.String()
+}
+
+// vorbisHeader precedes the GEOB data in the base64 encoded Vorbis comment
+const vorbisHeader = "application/octet-stream\x00\x00" + markersDescription + "\x00"
+
+// parseVorbisMarkers decodes the SERATO_MARKERS_V2 comment of FLAC files
+func parseVorbisMarkers(value string) (*Markers, error) {
+	text := strings.NewReplacer("\n", "", "\r", "", "=", "").Replace(value)
+	data, err := base64.RawStdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(vorbisHeader)) {
+		return nil, errors.New("invalid Serato Markers2 comment")
+	}
+	return ParseMarkers(data[len(vorbisHeader):])
+}
+
+// vorbisValue encodes the markers for the SERATO_MARKERS_V2 comment
+func (m *Markers) vorbisValue() string {
+	data := []byte(vorbisHeader)
+	data = append(data, 1, 1)
+	data = append(data, wrapLines(base64.RawStdEncoding.EncodeToString(m.payload()))...)
+	return wrapLines(base64.StdEncoding.EncodeToString(data))
+}
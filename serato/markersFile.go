@@ -0,0 +1,67 @@
+package serato
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/tags"
+)
+
+// isFLAC reports whether the markers of the file live in a Vorbis comment
+func isFLAC(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".flac")
+}
+
+// ReadMarkers reads the Serato Markers2 tag of an audio file. Files without
+// markers return tags.ErrNoTag.
+func ReadMarkers(path string) (*Markers, error) {
+	if isFLAC(path) {
+		comment, err := tags.ReadFLACComment(path)
+		if err != nil {
+			return nil, err
+		}
+		value := comment.Get(markersVorbisKey)
+		if value == "" {
+			return nil, tags.ErrNoTag
+		}
+		return parseVorbisMarkers(value)
+	}
+
+	tag, err := tags.ReadID3File(path)
+	if err != nil {
+		return nil, err
+	}
+	geob, found := tag.GEOB(markersDescription)
+	if !found {
+		return nil, tags.ErrNoTag
+	}
+	return ParseMarkers(geob.Data)
+}
+
+// WriteMarkers stores the markers in an MP3, AIFF, WAV or FLAC file, keeping
+// all other tags
+func WriteMarkers(path string, markers *Markers) error {
+	if isFLAC(path) {
+		comment, err := tags.ReadFLACComment(path)
+		if err == tags.ErrNoTag {
+			comment = &tags.VorbisComment{Vendor: "djlibgo"}
+		} else if err != nil {
+			return err
+		}
+		comment.Set(markersVorbisKey, markers.vorbisValue())
+		return tags.WriteFLACComment(path, comment)
+	}
+
+	tag, err := tags.ReadID3File(path)
+	if err == tags.ErrNoTag {
+		tag = tags.NewID3Tag()
+	} else if err != nil {
+		return err
+	}
+	tag.SetGEOB(tags.GEOB{
+		MimeType:    "application/octet-stream",
+		Description: markersDescription,
+		Data:        markers.Bytes(),
+	})
+	return tags.WriteID3File(path, tag)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/ilmarkerm/djlibgo/analysis"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// runSilence detects the leading and trailing silence of the collection
+// tracks, or of one playlist, and lists the Load, Fade In and Fade Out cues
+// it proposes. With -apply the cues are added to the collection; tracks
+// keep the cues of those types they already have.
+func runSilence(args []string) error {
+	flags := flag.NewFlagSet("silence", flag.ContinueOnError)
+	collectionPath := flags.String("collection", "", "collection.nml to check, defaults to the Traktor collection")
+	playlistName := flags.String("playlist", "", "playlist path or name to limit the tracks to")
+	threshold := flags.Float64("threshold", analysis.DefaultSilenceThreshold, "level in dBFS below which audio counts as silence")
+	workers := flags.Int("workers", 0, "number of files analysed in parallel, defaults to the number of CPUs")
+	all := flags.Bool("all", false, "list tracks without proposed cues too")
+	apply := flags.Bool("apply", false, "add the proposed cues to the collection")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var collection *traktor.TraktorCollection
+	var err error
+	if *collectionPath != "" {
+		collection, err = traktor.ParseCollectionFromPath(*collectionPath)
+	} else {
+		collection, err = traktor.ParseCollection()
+	}
+	if err != nil {
+		return fmt.Errorf("reading collection: %w", err)
+	}
+	var tracks []*traktor.Track
+	if *playlistName != "" {
+		playlist := collection.GetPlaylistByPath(*playlistName)
+		if playlist == nil {
+			playlist = collection.GetPlaylistByName(*playlistName)
+		}
+		if playlist == nil {
+			return fmt.Errorf("playlist %q not found", *playlistName)
+		}
+		tracks = playlist.Tracks
+	} else {
+		for i := range collection.Tracks {
+			tracks = append(tracks, &collection.Tracks[i])
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	checks, runErr := analysis.CheckSilence(ctx, tracks, *threshold, *workers, func(done, total int) {
+		fmt.Fprintf(os.Stderr, "\ranalysed %d of %d", done, total)
+	})
+	fmt.Fprintln(os.Stderr)
+
+	proposed := 0
+	for _, check := range checks {
+		if len(check.Cues) > 0 {
+			proposed++
+		}
+	}
+	fmt.Print(analysis.SilenceReport(checks, *all))
+	fmt.Printf("cues proposed for %d of %d tracks\n", proposed, len(checks))
+	if runErr != nil || !*apply {
+		return runErr
+	}
+
+	changed, err := analysis.ApplySilenceCues(collection, checks)
+	if err != nil {
+		return err
+	}
+	if changed > 0 {
+		if err := collection.Save(); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("added cues to %d tracks\n", changed)
+	return nil
+}
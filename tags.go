@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/tags"
+	"github.com/ilmarkerm/djlibgo/tagsync"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// keyNotationNames maps the -notation flag values to key notations
+var keyNotationNames = map[string]traktor.KeyNotation{
+	"musical": traktor.NotationMusical,
+	"openkey": traktor.NotationOpenKey,
+	"camelot": traktor.NotationCamelot,
+}
+
+// runTags writes collection metadata into file tags, or with -reverse fills
+// empty collection fields from the tags. -dry-run prints the changes only.
+func runTags(args []string) error {
+	names := make([]string, len(tags.AllFields))
+	for i, field := range tags.AllFields {
+		names[i] = string(field)
+	}
+	flags := flag.NewFlagSet("tags", flag.ContinueOnError)
+	collectionPath := flags.String("collection", "", "collection.nml to use, defaults to the Traktor collection")
+	playlistName := flags.String("playlist", "", "playlist path or name to limit the tracks to")
+	fieldList := flags.String("fields", strings.Join(names, ","), "comma separated fields to sync")
+	notation := flags.String("notation", "camelot", "key notation written to tags: musical, openkey or camelot")
+	reverse := flags.Bool("reverse", false, "fill empty collection fields from the file tags instead")
+	dryRun := flags.Bool("dry-run", false, "print the changes without writing anything")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	opts := tagsync.Options{Direction: tagsync.ToFiles}
+	if *reverse {
+		opts.Direction = tagsync.ToCollection
+	}
+	keyNotation, ok := keyNotationNames[strings.ToLower(*notation)]
+	if !ok {
+		return fmt.Errorf("unknown key notation %q", *notation)
+	}
+	opts.Notation = keyNotation
+	for _, name := range strings.Split(*fieldList, ",") {
+		field := tags.Field(strings.ToLower(strings.TrimSpace(name)))
+		if !containsField(tags.AllFields, field) {
+			return fmt.Errorf("unknown field %q, available: %s", name, strings.Join(names, ", "))
+		}
+		opts.Fields = append(opts.Fields, field)
+	}
+
+	var collection *traktor.TraktorCollection
+	var err error
+	if *collectionPath != "" {
+		collection, err = traktor.ParseCollectionFromPath(*collectionPath)
+	} else {
+		collection, err = traktor.ParseCollection()
+	}
+	if err != nil {
+		return fmt.Errorf("reading collection: %w", err)
+	}
+	var tracks []*traktor.Track
+	if *playlistName != "" {
+		playlist := collection.GetPlaylistByPath(*playlistName)
+		if playlist == nil {
+			playlist = collection.GetPlaylistByName(*playlistName)
+		}
+		if playlist == nil {
+			return fmt.Errorf("playlist %q not found", *playlistName)
+		}
+		tracks = playlist.Tracks
+	} else {
+		for i := range collection.Tracks {
+			tracks = append(tracks, &collection.Tracks[i])
+		}
+	}
+
+	plan := tagsync.NewPlan(tracks, opts)
+	fmt.Print(plan.Diff())
+	fmt.Printf("%d changes in %d tracks\n", len(plan.Changes), plan.Files())
+	if *dryRun || len(plan.Changes) == 0 {
+		return nil
+	}
+	failed := plan.Apply(collection)
+	for path, err := range failed {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+	}
+	if opts.Direction == tagsync.ToCollection {
+		if err := collection.Save(); err != nil {
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d tracks could not be updated", len(failed))
+	}
+	return nil
+}
+
+func containsField(fields []tags.Field, field tags.Field) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
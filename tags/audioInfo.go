@@ -0,0 +1,90 @@
+package tags
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/ilmarkerm/djlibgo/audioformat"
+)
+
+// SampleRate reads the sample rate from the header of an MP3, WAV, AIFF or FLAC file
+func SampleRate(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	switch kind := detectKind(path); kind {
+	case kindMP3:
+		return mp3SampleRate(file)
+	case kindWAV, kindAIFF:
+		form, chunks, err := audioformat.ReadChunks(file)
+		if err != nil {
+			return 0, err
+		}
+		for _, c := range chunks {
+			if form.Type == "WAVE" && c.ID == "fmt " && c.Size >= 8 {
+				data := make([]byte, 8)
+				if _, err := file.ReadAt(data, c.Offset); err != nil {
+					return 0, err
+				}
+				return int(binary.LittleEndian.Uint32(data[4:8])), nil
+			}
+			if form.Type != "WAVE" && c.ID == "COMM" && c.Size >= 18 {
+				data := make([]byte, 18)
+				if _, err := file.ReadAt(data, c.Offset); err != nil {
+					return 0, err
+				}
+				return int(audioformat.ExtendedFloat(data[8:18])), nil
+			}
+		}
+		return 0, errors.New("no format chunk found")
+	case kindFLAC:
+		blocks, _, err := readFLACBlocks(file)
+		if err != nil {
+			return 0, err
+		}
+		if len(blocks) == 0 || blocks[0].kind != flacStreamInfo || len(blocks[0].data) < 13 {
+			return 0, errors.New("missing FLAC STREAMINFO")
+		}
+		data := blocks[0].data
+		return int(data[10])<<12 | int(data[11])<<4 | int(data[12])>>4, nil
+	default:
+		return 0, ErrUnsupported
+	}
+}
+
+// mp3SampleRate skips the ID3 tag and reads the sample rate from the first frame header
+func mp3SampleRate(file *os.File) (int, error) {
+	_, size, err := ReadID3(bufio.NewReader(file))
+	if err != nil && err != ErrNoTag {
+		return 0, err
+	}
+	if _, err := file.Seek(int64(size), io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(file)
+	var previous byte
+	// Look for a frame sync within the first 64 KiB
+	for i := 0; i < 64*1024; i++ {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if previous == 0xff && b&0xe0 == 0xe0 {
+			rest, err := reader.Peek(2)
+			if err != nil {
+				return 0, err
+			}
+			if header, ok := audioformat.ParseFrameHeader([]byte{previous, b, rest[0], rest[1]}); ok {
+				return header.SampleRate, nil
+			}
+		}
+		previous = b
+	}
+	return 0, errors.New("no MPEG frame found")
+}
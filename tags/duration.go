@@ -0,0 +1,124 @@
+package tags
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/ilmarkerm/djlibgo/audioformat"
+)
+
+// mp3Duration reads the frame count of a Xing, Info or VBRI header and
+// estimates constant bitrate files from their size
+func mp3Duration(path string) (float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	_, tagSize, err := ReadID3(bufio.NewReader(file))
+	if err != nil && err != ErrNoTag {
+		return 0, err
+	}
+	start := int64(tagSize)
+	data := make([]byte, 64*1024)
+	n, err := file.ReadAt(data, start)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	data = data[:n]
+
+	for i := 0; i+4 <= len(data); i++ {
+		frame, ok := audioformat.ParseFrameHeader(data[i:])
+		if !ok {
+			continue
+		}
+		if header, ok := audioformat.ParseInfoFrame(data[i:], frame); ok && header.Frames >= 0 {
+			return float64(header.Frames) * float64(frame.SamplesPerFrame()) / float64(frame.SampleRate), nil
+		}
+
+		audioSize := info.Size() - start - int64(i)
+		if audioSize > 128 {
+			// An ID3v1 tag takes the last 128 bytes
+			tail := make([]byte, 3)
+			if _, err := file.ReadAt(tail, info.Size()-128); err == nil && string(tail) == "TAG" {
+				audioSize -= 128
+			}
+		}
+		return float64(audioSize) * 8 / float64(frame.Bitrate), nil
+	}
+	return 0, errors.New("no MPEG frame found")
+}
+
+// pcmDuration computes the duration of a WAV or AIFF file from its format
+// and sample data chunks
+func pcmDuration(path string, kind fileKind) (float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	_, chunks, err := audioformat.ReadChunks(file)
+	if err != nil {
+		return 0, err
+	}
+	var byteRate float64
+	var dataSize int64
+	for _, c := range chunks {
+		switch {
+		case kind == kindWAV && c.ID == "fmt " && c.Size >= 12:
+			data := make([]byte, 12)
+			if _, err := file.ReadAt(data, c.Offset); err != nil {
+				return 0, err
+			}
+			byteRate = float64(binary.LittleEndian.Uint32(data[8:12]))
+		case kind == kindWAV && c.ID == "data":
+			dataSize = c.Size
+		case kind == kindAIFF && c.ID == "COMM" && c.Size >= 18:
+			// AIFF stores the frame count directly
+			data := make([]byte, 18)
+			if _, err := file.ReadAt(data, c.Offset); err != nil {
+				return 0, err
+			}
+			if rate := audioformat.ExtendedFloat(data[8:18]); rate > 0 {
+				return float64(binary.BigEndian.Uint32(data[2:6])) / rate, nil
+			}
+		}
+	}
+	if byteRate == 0 || dataSize == 0 {
+		return 0, errors.New("no format chunk found")
+	}
+	return float64(dataSize) / byteRate, nil
+}
+
+// flacDuration reads the total sample count of the FLAC STREAMINFO block
+func flacDuration(path string) (float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	blocks, _, err := readFLACBlocks(file)
+	if err != nil {
+		return 0, err
+	}
+	if len(blocks) == 0 || blocks[0].kind != flacStreamInfo || len(blocks[0].data) < 18 {
+		return 0, errors.New("missing FLAC STREAMINFO")
+	}
+	data := blocks[0].data
+	rate := int(data[10])<<12 | int(data[11])<<4 | int(data[12])>>4
+	samples := uint64(data[13]&0x0f)<<32 | uint64(binary.BigEndian.Uint32(data[14:18]))
+	if rate == 0 {
+		return 0, errors.New("invalid FLAC sample rate")
+	}
+	return float64(samples) / float64(rate), nil
+}
@@ -0,0 +1,254 @@
+package tags
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Field is a metadata field that can be written to every supported tag format
+type Field string
+
+// Fields written by WriteFields. Rating is 0-255 as in ID3 POPM frames and
+// Traktor, BPM a decimal number.
+const (
+	FieldArtist  Field = "artist"
+	FieldTitle   Field = "title"
+	FieldAlbum   Field = "album"
+	FieldGenre   Field = "genre"
+	FieldLabel   Field = "label"
+	FieldComment Field = "comment"
+	FieldRating  Field = "rating"
+	FieldBPM     Field = "bpm"
+	FieldKey     Field = "key"
+	FieldRemixer Field = "remixer"
+)
+
+// ReplayGain fields. Gains are written as "-3.20 dB", peaks as linear
+// amplitudes. They are not part of AllFields, so tag sync leaves them alone.
+const (
+	FieldTrackGain Field = "replaygain_track_gain"
+	FieldTrackPeak Field = "replaygain_track_peak"
+	FieldAlbumGain Field = "replaygain_album_gain"
+	FieldAlbumPeak Field = "replaygain_album_peak"
+)
+
+// ReplayGainFields lists the ReplayGain fields
+var ReplayGainFields = []Field{FieldTrackGain, FieldTrackPeak, FieldAlbumGain, FieldAlbumPeak}
+
+// AllFields lists the fields in display order
+var AllFields = []Field{
+	FieldArtist, FieldTitle, FieldAlbum, FieldGenre, FieldLabel,
+	FieldComment, FieldRating, FieldBPM, FieldKey, FieldRemixer,
+}
+
+// FieldValues maps fields to their values in a tag
+type FieldValues map[Field]string
+
+// RatingEmail is the POPM owner under which ratings are written, the one
+// Traktor reads
+const RatingEmail = "traktor@native-instruments.de"
+
+// id3FieldFrames maps the text fields to ID3v2 frames
+var id3FieldFrames = map[Field]string{
+	FieldArtist: "TPE1", FieldTitle: "TIT2", FieldAlbum: "TALB", FieldGenre: "TCON",
+	FieldLabel: "TPUB", FieldBPM: "TBPM", FieldKey: "TKEY", FieldRemixer: "TPE4",
+}
+
+// id3UserTextFields maps fields to the descriptions of ID3v2 TXXX frames
+var id3UserTextFields = map[Field]string{
+	FieldTrackGain: "REPLAYGAIN_TRACK_GAIN", FieldTrackPeak: "REPLAYGAIN_TRACK_PEAK",
+	FieldAlbumGain: "REPLAYGAIN_ALBUM_GAIN", FieldAlbumPeak: "REPLAYGAIN_ALBUM_PEAK",
+}
+
+// vorbisFieldNames maps fields to Vorbis comment names. The first name is
+// written, the others are read when the first is missing.
+var vorbisFieldNames = map[Field][]string{
+	FieldArtist: {"ARTIST"}, FieldTitle: {"TITLE"}, FieldAlbum: {"ALBUM"},
+	FieldGenre: {"GENRE"}, FieldLabel: {"LABEL", "ORGANIZATION", "PUBLISHER"},
+	FieldComment: {"COMMENT", "DESCRIPTION"}, FieldRating: {"RATING"},
+	FieldBPM: {"BPM", "TEMPO"}, FieldKey: {"INITIALKEY", "KEY"}, FieldRemixer: {"REMIXER"},
+	FieldTrackGain: {"REPLAYGAIN_TRACK_GAIN"}, FieldTrackPeak: {"REPLAYGAIN_TRACK_PEAK"},
+	FieldAlbumGain: {"REPLAYGAIN_ALBUM_GAIN"}, FieldAlbumPeak: {"REPLAYGAIN_ALBUM_PEAK"},
+}
+
+// mp4FieldNames maps fields to MP4 items. Names longer than four characters
+// are freeform items.
+var mp4FieldNames = map[Field]string{
+	FieldArtist: "\xa9ART", FieldTitle: "\xa9nam", FieldAlbum: "\xa9alb", FieldGenre: "\xa9gen",
+	FieldLabel: "LABEL", FieldComment: "\xa9cmt", FieldRating: "RATING", FieldBPM: "tmpo",
+	FieldKey: "initialkey", FieldRemixer: "REMIXER",
+	FieldTrackGain: "replaygain_track_gain", FieldTrackPeak: "replaygain_track_peak",
+	FieldAlbumGain: "replaygain_album_gain", FieldAlbumPeak: "replaygain_album_peak",
+}
+
+// ReadFields reads the fields of an audio file's tag. Fields that are not
+// set are missing from the result.
+func ReadFields(path string) (FieldValues, error) {
+	values := make(FieldValues)
+	switch kind := detectKind(path); kind {
+	case kindMP3, kindAIFF, kindWAV:
+		tag, err := ReadID3File(path)
+		if errors.Is(err, ErrNoTag) {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for field, id := range id3FieldFrames {
+			values.set(field, tag.Text(id))
+		}
+		for field, description := range id3UserTextFields {
+			values.set(field, tag.UserText(description))
+		}
+		values.set(FieldGenre, id3Genre(values[FieldGenre]))
+		values.set(FieldComment, tag.Comment())
+		if rating, ok := tag.Popularimeter(RatingEmail); ok && rating > 0 {
+			values.set(FieldRating, strconv.Itoa(rating))
+		}
+	case kindFLAC, kindOGG:
+		comment, err := readVorbisFile(path, kind)
+		if errors.Is(err, ErrNoTag) {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for field, names := range vorbisFieldNames {
+			for _, name := range names {
+				if value := comment.Get(name); value != "" {
+					values.set(field, value)
+					break
+				}
+			}
+		}
+		values.set(FieldRating, ratingFromPercent(values[FieldRating]))
+	case kindMP4:
+		items, _, err := readMP4Items(path)
+		if err != nil {
+			return nil, err
+		}
+		for field, name := range mp4FieldNames {
+			if len(name) != 4 {
+				name = strings.ToUpper(name)
+			}
+			values.set(field, items[name])
+		}
+		if values[FieldBPM] == "0" {
+			delete(values, FieldBPM)
+		}
+		values.set(FieldRating, ratingFromPercent(values[FieldRating]))
+	default:
+		return nil, ErrUnsupported
+	}
+	return values, nil
+}
+
+// WriteFields stores the given fields in the tag of an audio file, creating
+// the tag when needed. Fields missing from values are left alone, empty
+// values remove the field.
+func WriteFields(path string, values FieldValues) error {
+	switch kind := detectKind(path); kind {
+	case kindMP3, kindAIFF, kindWAV:
+		tag, err := ReadID3File(path)
+		if errors.Is(err, ErrNoTag) {
+			tag = NewID3Tag()
+		} else if err != nil {
+			return err
+		}
+		for field, value := range values {
+			switch field {
+			case FieldComment:
+				tag.SetComment(value)
+			case FieldRating:
+				rating, _ := strconv.Atoi(value)
+				tag.SetPopularimeter(RatingEmail, rating)
+			default:
+				if id, ok := id3FieldFrames[field]; ok {
+					tag.SetText(id, value)
+				} else if description, ok := id3UserTextFields[field]; ok {
+					tag.SetUserText(description, value)
+				}
+			}
+		}
+		return WriteID3File(path, tag)
+	case kindFLAC, kindOGG:
+		comment, err := readVorbisFile(path, kind)
+		if errors.Is(err, ErrNoTag) {
+			comment = &VorbisComment{Vendor: "djlibgo"}
+		} else if err != nil {
+			return err
+		}
+		for field, value := range values {
+			names, ok := vorbisFieldNames[field]
+			if !ok {
+				continue
+			}
+			if field == FieldRating {
+				value = ratingToPercent(value)
+			}
+			// Drop the alternative names so readers don't find stale values
+			for _, name := range names[1:] {
+				comment.Remove(name)
+			}
+			comment.Set(names[0], value)
+		}
+		if kind == kindFLAC {
+			return WriteFLACComment(path, comment)
+		}
+		return WriteOggComment(path, comment)
+	case kindMP4:
+		items := make(map[string]string, len(values))
+		for field, value := range values {
+			name, ok := mp4FieldNames[field]
+			if !ok {
+				continue
+			}
+			if field == FieldRating {
+				value = ratingToPercent(value)
+			}
+			items[name] = value
+		}
+		return writeMP4Items(path, items)
+	default:
+		return ErrUnsupported
+	}
+}
+
+// set stores non-empty values
+func (v FieldValues) set(field Field, value string) {
+	if value = strings.TrimSpace(value); value != "" {
+		v[field] = value
+	} else {
+		delete(v, field)
+	}
+}
+
+// readVorbisFile reads the Vorbis comment of a FLAC or Ogg file
+func readVorbisFile(path string, kind fileKind) (*VorbisComment, error) {
+	if kind == kindFLAC {
+		return ReadFLACComment(path)
+	}
+	comment, _, err := readOgg(path)
+	return comment, err
+}
+
+// ratingToPercent converts a 0-255 rating to the 0-100 scale Vorbis comments
+// and MP4 tags use
+func ratingToPercent(value string) string {
+	rating, err := strconv.Atoi(value)
+	if err != nil || rating <= 0 {
+		return ""
+	}
+	return strconv.Itoa(int(math.Round(float64(min(rating, 255)) * 100 / 255)))
+}
+
+// ratingFromPercent converts a 0-100 rating to 0-255
+func ratingFromPercent(value string) string {
+	percent, err := strconv.Atoi(value)
+	if err != nil || percent <= 0 {
+		return ""
+	}
+	return strconv.Itoa(int(math.Round(float64(min(percent, 100)) * 255 / 100)))
+}
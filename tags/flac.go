@@ -0,0 +1,259 @@
+package tags
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// FLAC metadata block types
+const (
+	flacStreamInfo    = 0
+	flacPadding       = 1
+	flacVorbisComment = 4
+	flacPicture       = 6
+)
+
+// flacPaddingSize is the padding added when the metadata has to be rewritten
+const flacPaddingSize = 4096
+
+// flacBlock is a FLAC metadata block
+type flacBlock struct {
+	kind byte
+	data []byte
+}
+
+// VorbisComment holds the vendor string and KEY=value comments of a
+// Vorbis comment block as used by FLAC and Ogg
+type VorbisComment struct {
+	Vendor   string
+	Comments []string
+}
+
+// Get returns the first value for the key, compared case-insensitively
+func (v *VorbisComment) Get(key string) string {
+	values := v.GetAll(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// GetAll returns all values for the key
+func (v *VorbisComment) GetAll(key string) []string {
+	var values []string
+	for _, comment := range v.Comments {
+		name, value, found := strings.Cut(comment, "=")
+		if found && strings.EqualFold(name, key) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Set replaces all values for the key. Empty values remove the key.
+func (v *VorbisComment) Set(key string, values ...string) {
+	v.Remove(key)
+	for _, value := range values {
+		if value != "" {
+			v.Comments = append(v.Comments, strings.ToUpper(key)+"="+value)
+		}
+	}
+}
+
+// Remove deletes all values for the key
+func (v *VorbisComment) Remove(key string) {
+	comments := v.Comments[:0]
+	for _, comment := range v.Comments {
+		name, _, _ := strings.Cut(comment, "=")
+		if !strings.EqualFold(name, key) {
+			comments = append(comments, comment)
+		}
+	}
+	v.Comments = comments
+}
+
+// parseVorbisComment decodes a Vorbis comment block. All lengths are little endian.
+func parseVorbisComment(data []byte) (*VorbisComment, error) {
+	invalid := errors.New("invalid Vorbis comment")
+	if len(data) < 4 {
+		return nil, invalid
+	}
+	vendorLen := int(binary.LittleEndian.Uint32(data))
+	data = data[4:]
+	if vendorLen > len(data) || len(data)-vendorLen < 4 {
+		return nil, invalid
+	}
+	vc := &VorbisComment{Vendor: string(data[:vendorLen])}
+	data = data[vendorLen:]
+	count := int(binary.LittleEndian.Uint32(data))
+	data = data[4:]
+	for i := 0; i < count; i++ {
+		if len(data) < 4 {
+			return nil, invalid
+		}
+		length := int(binary.LittleEndian.Uint32(data))
+		data = data[4:]
+		if length > len(data) {
+			return nil, invalid
+		}
+		vc.Comments = append(vc.Comments, string(data[:length]))
+		data = data[length:]
+	}
+	return vc, nil
+}
+
+// Bytes encodes the Vorbis comment block
+func (v *VorbisComment) Bytes() []byte {
+	out := binary.LittleEndian.AppendUint32(nil, uint32(len(v.Vendor)))
+	out = append(out, v.Vendor...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(v.Comments)))
+	for _, comment := range v.Comments {
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(comment)))
+		out = append(out, comment...)
+	}
+	return out
+}
+
+// readFLACBlocks reads all metadata blocks and returns them with the offset of the audio frames
+func readFLACBlocks(r io.Reader) ([]flacBlock, int64, error) {
+	reader := bufio.NewReader(r)
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return nil, 0, err
+	}
+	offset := int64(4)
+	if string(magic) == "ID3" {
+		return nil, 0, errors.New("FLAC files with ID3 tags are not supported")
+	}
+	if string(magic) != "fLaC" {
+		return nil, 0, errors.New("not a FLAC file")
+	}
+
+	var blocks []flacBlock
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return nil, 0, err
+		}
+		last := header[0]&0x80 != 0
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		data := make([]byte, length)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, 0, err
+		}
+		blocks = append(blocks, flacBlock{kind: header[0] & 0x7f, data: data})
+		offset += int64(4 + length)
+		if last {
+			return blocks, offset, nil
+		}
+	}
+}
+
+// encodeFLACBlocks serializes metadata blocks, marking the last one
+func encodeFLACBlocks(blocks []flacBlock) []byte {
+	var out []byte
+	for i, block := range blocks {
+		kind := block.kind
+		if i == len(blocks)-1 {
+			kind |= 0x80
+		}
+		length := len(block.data)
+		out = append(out, kind, byte(length>>16), byte(length>>8), byte(length))
+		out = append(out, block.data...)
+	}
+	return out
+}
+
+// ReadFLACComment reads the Vorbis comment block of a FLAC file
+func ReadFLACComment(path string) (*VorbisComment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	blocks, _, err := readFLACBlocks(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range blocks {
+		if block.kind == flacVorbisComment {
+			return parseVorbisComment(block.data)
+		}
+	}
+	return nil, ErrNoTag
+}
+
+// WriteFLACComment replaces the Vorbis comment block of a FLAC file
+func WriteFLACComment(path string, comment *VorbisComment) error {
+	return updateFLACBlocks(path, func(blocks []flacBlock) []flacBlock {
+		data := comment.Bytes()
+		for i := range blocks {
+			if blocks[i].kind == flacVorbisComment {
+				blocks[i].data = data
+				return blocks
+			}
+		}
+		// The comment goes right after STREAMINFO, which must stay first
+		blocks = append(blocks, flacBlock{})
+		copy(blocks[2:], blocks[1:])
+		blocks[1] = flacBlock{kind: flacVorbisComment, data: data}
+		return blocks
+	})
+}
+
+// updateFLACBlocks changes the metadata blocks of a FLAC file. The new metadata
+// is written in place when it fits into the old metadata and padding, otherwise
+// the file is rewritten with fresh padding.
+func updateFLACBlocks(path string, update func([]flacBlock) []flacBlock) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	blocks, audioOffset, err := readFLACBlocks(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	var kept []flacBlock
+	for _, block := range blocks {
+		if block.kind != flacPadding {
+			kept = append(kept, block)
+		}
+	}
+	kept = update(kept)
+
+	available := audioOffset - 4
+	size := int64(len(encodeFLACBlocks(kept)))
+	if size == available || size+4 <= available {
+		if size < available {
+			kept = append(kept, flacBlock{kind: flacPadding, data: make([]byte, available-size-4)})
+		}
+		_, err := file.WriteAt(encodeFLACBlocks(kept), 4)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	file.Close()
+
+	kept = append(kept, flacBlock{kind: flacPadding, data: make([]byte, flacPaddingSize)})
+	return replaceFile(path, func(w io.Writer, old *os.File) error {
+		if _, err := io.WriteString(w, "fLaC"); err != nil {
+			return err
+		}
+		if _, err := w.Write(encodeFLACBlocks(kept)); err != nil {
+			return err
+		}
+		if _, err := old.Seek(audioOffset, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := io.Copy(w, old)
+		return err
+	})
+}
@@ -0,0 +1,50 @@
+package tags
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFLACCommentRoundTrip(t *testing.T) {
+	payload := append([]byte{0xff, 0xf8}, testPayload(2000)...)
+	// STREAMINFO of a 44.1 kHz stereo stream, the only block of the file
+	info := make([]byte, 34)
+	info[10], info[11], info[12] = 0x0a, 0xc4, 0x42
+	file := append([]byte("fLaC"), 0x80|flacStreamInfo, 0, 0, 34)
+	file = append(append(file, info...), payload...)
+	path := writeTestFile(t, "track.flac", file)
+
+	// The first comment does not fit and the file is rewritten with padding,
+	// the second is written in place and the third outgrows the padding
+	for _, values := range []FieldValues{
+		{FieldTitle: "A title", FieldArtist: "An artist", FieldRating: "255"},
+		{FieldTitle: "Short", FieldLabel: "A label"},
+		{FieldComment: strings.Repeat("x", 10000)},
+	} {
+		if err := WriteFields(path, values); err != nil {
+			t.Fatalf("WriteFields: %v", err)
+		}
+		checkFields(t, path, values)
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks, audioOffset, err := readFLACBlocks(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("readFLACBlocks: %v", err)
+		}
+		if blocks[0].kind != flacStreamInfo || !bytes.Equal(blocks[0].data, info) {
+			t.Error("STREAMINFO is not the unchanged first block")
+		}
+		if !bytes.Equal(data[audioOffset:], payload) {
+			t.Errorf("the audio after %d bytes of metadata changed", audioOffset)
+		}
+	}
+	checkFields(t, path, FieldValues{FieldTitle: "Short", FieldArtist: "An artist"})
+	if rate, err := SampleRate(path); err != nil || rate != 44100 {
+		t.Errorf("sample rate %d, %v after writing", rate, err)
+	}
+}
@@ -0,0 +1,244 @@
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/audioformat"
+)
+
+// fileKind identifies the container of an audio file
+type fileKind int
+
+const (
+	kindUnknown fileKind = iota
+	kindMP3
+	kindAIFF
+	kindWAV
+	kindFLAC
+	kindOGG
+	kindMP4
+)
+
+// detectKind returns the container kind from the file extension
+func detectKind(path string) fileKind {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		return kindMP3
+	case ".aif", ".aiff", ".aifc":
+		return kindAIFF
+	case ".wav", ".wave":
+		return kindWAV
+	case ".flac":
+		return kindFLAC
+	case ".ogg", ".oga", ".opus":
+		return kindOGG
+	case ".m4a", ".mp4", ".m4b", ".aac", ".alac":
+		return kindMP4
+	default:
+		return kindUnknown
+	}
+}
+
+// IsAudioFile reports whether the file extension is a supported audio format
+func IsAudioFile(path string) bool {
+	return detectKind(path) != kindUnknown
+}
+
+// id3ChunkID returns the name WAV and AIFF files give their ID3 chunk
+func id3ChunkID(form audioformat.Form) string {
+	if form.Type == "WAVE" {
+		return "id3 "
+	}
+	return "ID3 "
+}
+
+// ReadID3File reads the ID3v2 tag of an MP3, AIFF or WAV file
+func ReadID3File(path string) (*ID3Tag, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	kind := detectKind(path)
+	switch kind {
+	case kindMP3:
+		tag, _, err := ReadID3(bufio.NewReader(file))
+		return tag, err
+	case kindAIFF, kindWAV:
+		_, chunks, err := audioformat.ReadChunks(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range chunks {
+			if !strings.EqualFold(c.ID, "id3 ") {
+				continue
+			}
+			tag, _, err := ReadID3(io.NewSectionReader(file, c.Offset, c.Size))
+			return tag, err
+		}
+		return nil, ErrNoTag
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// WriteID3File stores the tag in an MP3, AIFF or WAV file, replacing any
+// existing tag. Tags that would lose frames are refused.
+func WriteID3File(path string, tag *ID3Tag) error {
+	if err := tag.Writable(); err != nil {
+		return err
+	}
+	switch kind := detectKind(path); kind {
+	case kindMP3:
+		return writeMP3Tag(path, tag)
+	case kindAIFF, kindWAV:
+		return writeChunkTag(path, tag)
+	default:
+		return ErrUnsupported
+	}
+}
+
+// writeMP3Tag writes the tag in place when it fits into the space of the old
+// tag and rewrites the file otherwise
+func writeMP3Tag(path string, tag *ID3Tag) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	_, oldSize, err := ReadID3(bufio.NewReader(file))
+	if err == ErrNoTag {
+		oldSize = 0
+	} else if err != nil {
+		file.Close()
+		return err
+	}
+
+	data := tag.Bytes(0)
+	if oldSize > 0 && len(data) <= oldSize {
+		data = tag.Bytes(oldSize - len(data))
+		_, err := file.WriteAt(data, 0)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	file.Close()
+
+	return replaceFile(path, func(w io.Writer, old *os.File) error {
+		if _, err := w.Write(tag.Bytes(id3Padding)); err != nil {
+			return err
+		}
+		if _, err := old.Seek(int64(oldSize), io.SeekStart); err != nil {
+			return err
+		}
+		_, err := io.Copy(w, old)
+		return err
+	})
+}
+
+// writeChunkTag rewrites a WAV or AIFF file with the tag stored in its ID3 chunk
+func writeChunkTag(path string, tag *ID3Tag) error {
+	return replaceFile(path, func(w io.Writer, old *os.File) error {
+		form, chunks, err := audioformat.ReadChunks(old)
+		if err != nil {
+			return err
+		}
+		header := make([]byte, 12)
+		if _, err := old.ReadAt(header, 0); err != nil {
+			return err
+		}
+
+		data := tag.Bytes(0)
+		// The container size counts the form type and all chunks
+		size := int64(4) + chunkSize(int64(len(data)))
+		for _, c := range chunks {
+			if !strings.EqualFold(c.ID, "id3 ") {
+				size += chunkSize(c.Size)
+			}
+		}
+		form.Order.PutUint32(header[4:8], uint32(size))
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+
+		for _, c := range chunks {
+			if strings.EqualFold(c.ID, "id3 ") {
+				continue
+			}
+			if err := writeChunk(w, form.Order, c.ID, io.NewSectionReader(old, c.Offset, c.Size), c.Size); err != nil {
+				return err
+			}
+		}
+		return writeChunk(w, form.Order, id3ChunkID(form), bytes.NewReader(data), int64(len(data)))
+	})
+}
+
+// chunkSize returns the space a chunk with the given data size takes, including
+// header and padding
+func chunkSize(size int64) int64 {
+	return 8 + size + size%2
+}
+
+// writeChunk writes a chunk header, its data and the padding byte for odd sizes
+func writeChunk(w io.Writer, order binary.ByteOrder, id string, data io.Reader, size int64) error {
+	header := make([]byte, 8)
+	copy(header, id)
+	order.PutUint32(header[4:8], uint32(size))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, data, size); err != nil {
+		return err
+	}
+	if size%2 == 1 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// replaceFile writes a new version of the file to a temporary file next to it
+// and renames it over the original once complete
+func replaceFile(path string, write func(w io.Writer, old *os.File) error) error {
+	old, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer old.Close()
+	info, err := old.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tag-*"+filepath.Ext(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	buffered := bufio.NewWriter(tmp)
+	if err := write(buffered, old); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	old.Close()
+	return os.Rename(tmp.Name(), path)
+}
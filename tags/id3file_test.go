@@ -0,0 +1,168 @@
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ilmarkerm/djlibgo/audioformat"
+)
+
+// testPayload returns n bytes that stand in for audio data
+func testPayload(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i/256)
+	}
+	return data
+}
+
+// writeTestFile writes data to a file called name in a temporary folder
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// checkFields fails the test unless the tag of the file has the given values
+func checkFields(t *testing.T, path string, want FieldValues) {
+	t.Helper()
+	got, err := ReadFields(path)
+	if err != nil {
+		t.Fatalf("ReadFields: %v", err)
+	}
+	for field, value := range want {
+		if got[field] != value {
+			t.Errorf("%s is %q, want %q", field, got[field], value)
+		}
+	}
+}
+
+func TestMP3TagRoundTrip(t *testing.T) {
+	payload := append([]byte{0xff, 0xfb, 0x90, 0x64}, testPayload(3000)...)
+	path := writeTestFile(t, "track.mp3", payload)
+
+	// The first tag is put in front of the audio, later ones fit its padding
+	for _, values := range []FieldValues{
+		{FieldTitle: "A title", FieldArtist: "An artist", FieldBPM: "124", FieldRating: "204"},
+		{FieldTitle: "Short", FieldComment: "A comment"},
+	} {
+		if err := WriteFields(path, values); err != nil {
+			t.Fatalf("WriteFields: %v", err)
+		}
+		checkFields(t, path, values)
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, size, err := ReadID3(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatalf("ReadID3: %v", err)
+		}
+		if !bytes.Equal(data[size:], payload) {
+			t.Errorf("the audio after the %d byte tag changed", size)
+		}
+	}
+	checkFields(t, path, FieldValues{FieldArtist: "An artist"})
+}
+
+// chunkFile builds a RIFF or IFF file of the given form type and chunks
+func chunkFile(magic, formType string, order binary.AppendByteOrder, chunks ...[]byte) []byte {
+	body := []byte(formType)
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	out := []byte(magic)
+	out = order.AppendUint32(out, uint32(len(body)))
+	return append(out, body...)
+}
+
+// testChunk encodes a chunk with its padding byte
+func testChunk(order binary.AppendByteOrder, id string, data []byte) []byte {
+	out := order.AppendUint32([]byte(id), uint32(len(data)))
+	out = append(out, data...)
+	if len(data)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+func TestChunkTagRoundTrip(t *testing.T) {
+	// An odd size checks the padding of the data chunk
+	payload := testPayload(1001)
+	format := make([]byte, 16)
+	binary.LittleEndian.PutUint16(format[0:], 1)
+	binary.LittleEndian.PutUint16(format[2:], 1)
+	binary.LittleEndian.PutUint32(format[4:], 44100)
+	common := make([]byte, 18)
+	binary.BigEndian.PutUint16(common[0:], 1)
+	binary.BigEndian.PutUint16(common[6:], 16)
+	copy(common[8:], []byte{0x40, 0x0e, 0xac, 0x44})
+
+	for _, test := range []struct {
+		name, audioID string
+		data          []byte
+	}{
+		{"track.wav", "data", chunkFile("RIFF", "WAVE", binary.LittleEndian,
+			testChunk(binary.LittleEndian, "fmt ", format), testChunk(binary.LittleEndian, "data", payload))},
+		{"track.aiff", "SSND", chunkFile("FORM", "AIFF", binary.BigEndian,
+			testChunk(binary.BigEndian, "COMM", common), testChunk(binary.BigEndian, "SSND", payload))},
+	} {
+		path := writeTestFile(t, test.name, test.data)
+		for _, values := range []FieldValues{
+			{FieldTitle: "A title", FieldKey: "8A"},
+			{FieldTitle: "Another title"},
+		} {
+			if err := WriteFields(path, values); err != nil {
+				t.Fatalf("%s: WriteFields: %v", test.name, err)
+			}
+			checkFields(t, path, values)
+		}
+		if rate, err := SampleRate(path); err != nil || rate != 44100 {
+			t.Errorf("%s: sample rate %d, %v after writing", test.name, rate, err)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, _ := file.Stat()
+		form, chunks, err := audioformat.ReadChunks(file)
+		if err != nil {
+			file.Close()
+			t.Fatalf("%s: ReadChunks: %v", test.name, err)
+		}
+		header := make([]byte, 8)
+		if _, err := file.ReadAt(header, 0); err != nil {
+			t.Fatal(err)
+		}
+		if size := int64(form.Order.Uint32(header[4:8])); size+8 != info.Size() {
+			t.Errorf("%s: the form is %d bytes in a %d byte file", test.name, size, info.Size())
+		}
+		found := false
+		for _, c := range chunks {
+			if c.ID != test.audioID {
+				continue
+			}
+			found = true
+			data := make([]byte, c.Size)
+			if _, err := file.ReadAt(data, c.Offset); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, payload) {
+				t.Errorf("%s: the %s chunk changed", test.name, c.ID)
+			}
+		}
+		file.Close()
+		if !found {
+			t.Errorf("%s: the %s chunk is missing", test.name, test.audioID)
+		}
+	}
+}
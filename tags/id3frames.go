@@ -0,0 +1,307 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+)
+
+// ID3v2 text encodings
+const (
+	encodingLatin1  = 0
+	encodingUTF16   = 1
+	encodingUTF16BE = 2
+	encodingUTF8    = 3
+)
+
+// decodeText decodes an ID3 string in the given encoding
+func decodeText(encoding byte, data []byte) string {
+	switch encoding {
+	case encodingUTF16, encodingUTF16BE:
+		order := binary.ByteOrder(binary.BigEndian)
+		if len(data) >= 2 {
+			if data[0] == 0xff && data[1] == 0xfe {
+				order = binary.LittleEndian
+				data = data[2:]
+			} else if data[0] == 0xfe && data[1] == 0xff {
+				data = data[2:]
+			}
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = order.Uint16(data[i*2:])
+		}
+		return string(utf16.Decode(units))
+	case encodingUTF8:
+		return string(data)
+	default:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+}
+
+// terminatorLength returns the length of the string terminator for an encoding
+func terminatorLength(encoding byte) int {
+	if encoding == encodingUTF16 || encoding == encodingUTF16BE {
+		return 2
+	}
+	return 1
+}
+
+// splitText splits off the first terminated string and returns it with the rest
+func splitText(encoding byte, data []byte) (string, []byte) {
+	if terminatorLength(encoding) == 2 {
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i] == 0 && data[i+1] == 0 {
+				return decodeText(encoding, data[:i]), data[i+2:]
+			}
+		}
+		return decodeText(encoding, data), nil
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return decodeText(encoding, data[:i]), data[i+1:]
+	}
+	return decodeText(encoding, data), nil
+}
+
+// textEncoding returns the encoding used to write a string in a tag version.
+// ID3v2.3 has no UTF-8, so non Latin-1 text is written as UTF-16.
+func textEncoding(version byte, text string) byte {
+	if version >= 4 {
+		return encodingUTF8
+	}
+	for _, r := range text {
+		if r > 0xff {
+			return encodingUTF16
+		}
+	}
+	return encodingLatin1
+}
+
+// encodeText encodes a string, optionally followed by a terminator
+func encodeText(encoding byte, text string, terminate bool) []byte {
+	var out []byte
+	switch encoding {
+	case encodingUTF16:
+		out = []byte{0xff, 0xfe}
+		for _, unit := range utf16.Encode([]rune(text)) {
+			out = binary.LittleEndian.AppendUint16(out, unit)
+		}
+	case encodingUTF16BE:
+		for _, unit := range utf16.Encode([]rune(text)) {
+			out = binary.BigEndian.AppendUint16(out, unit)
+		}
+	case encodingUTF8:
+		out = []byte(text)
+	default:
+		for _, r := range text {
+			if r > 0xff {
+				r = '?'
+			}
+			out = append(out, byte(r))
+		}
+	}
+	if terminate {
+		out = append(out, make([]byte, terminatorLength(encoding))...)
+	}
+	return out
+}
+
+// Text returns the value of a text frame such as TIT2. Multiple values in
+// ID3v2.4 frames are joined with "/".
+func (t *ID3Tag) Text(id string) string {
+	frame := t.Frame(id)
+	if frame == nil || len(frame.Data) == 0 {
+		return ""
+	}
+	encoding := frame.Data[0]
+	data := frame.Data[1:]
+	var values []string
+	for len(data) > 0 {
+		var value string
+		value, data = splitText(encoding, data)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return strings.Join(values, "/")
+}
+
+// SetText sets a text frame. An empty value removes the frame.
+func (t *ID3Tag) SetText(id, value string) {
+	if value == "" {
+		t.RemoveFrames(func(f *ID3Frame) bool { return f.ID == id })
+		return
+	}
+	encoding := textEncoding(t.Version, value)
+	data := append([]byte{encoding}, encodeText(encoding, value, false)...)
+	t.SetFrame(ID3Frame{ID: id, Data: data})
+}
+
+// UserText returns the value of the TXXX frame with the given description.
+// Descriptions are compared without case, as players write them both ways.
+func (t *ID3Tag) UserText(description string) string {
+	for _, frame := range t.FramesByID("TXXX") {
+		if len(frame.Data) < 2 {
+			continue
+		}
+		name, value := splitText(frame.Data[0], frame.Data[1:])
+		if strings.EqualFold(name, description) {
+			text, _ := splitText(frame.Data[0], value)
+			return text
+		}
+	}
+	return ""
+}
+
+// SetUserText replaces the TXXX frame with the given description. An empty
+// value removes it.
+func (t *ID3Tag) SetUserText(description, value string) {
+	t.RemoveFrames(func(f *ID3Frame) bool {
+		if f.ID != "TXXX" || f.Raw || len(f.Data) < 2 {
+			return false
+		}
+		name, _ := splitText(f.Data[0], f.Data[1:])
+		return strings.EqualFold(name, description)
+	})
+	if value == "" {
+		return
+	}
+	encoding := textEncoding(t.Version, description+value)
+	data := append([]byte{encoding}, encodeText(encoding, description, true)...)
+	data = append(data, encodeText(encoding, value, false)...)
+	t.Frames = append(t.Frames, ID3Frame{ID: "TXXX", Data: data})
+}
+
+// GEOB is a general encapsulated object frame
+type GEOB struct {
+	MimeType    string
+	FileName    string
+	Description string
+	Data        []byte
+}
+
+// ParseGEOB decodes a GEOB frame
+func ParseGEOB(frame *ID3Frame) (GEOB, bool) {
+	if len(frame.Data) < 2 {
+		return GEOB{}, false
+	}
+	encoding := frame.Data[0]
+	var geob GEOB
+	rest := frame.Data[1:]
+	geob.MimeType, rest = splitText(encodingLatin1, rest)
+	geob.FileName, rest = splitText(encoding, rest)
+	geob.Description, rest = splitText(encoding, rest)
+	geob.Data = rest
+	return geob, true
+}
+
+// GEOB returns the GEOB frame with the given description
+func (t *ID3Tag) GEOB(description string) (GEOB, bool) {
+	for _, frame := range t.FramesByID("GEOB") {
+		if geob, ok := ParseGEOB(frame); ok && geob.Description == description {
+			return geob, true
+		}
+	}
+	return GEOB{}, false
+}
+
+// SetGEOB replaces the GEOB frame with the same description
+func (t *ID3Tag) SetGEOB(geob GEOB) {
+	data := []byte{encodingLatin1}
+	data = append(data, encodeText(encodingLatin1, geob.MimeType, true)...)
+	data = append(data, encodeText(encodingLatin1, geob.FileName, true)...)
+	data = append(data, encodeText(encodingLatin1, geob.Description, true)...)
+	data = append(data, geob.Data...)
+
+	t.RemoveFrames(func(f *ID3Frame) bool {
+		if f.ID != "GEOB" || f.Raw {
+			return false
+		}
+		existing, ok := ParseGEOB(f)
+		return ok && existing.Description == geob.Description
+	})
+	t.Frames = append(t.Frames, ID3Frame{ID: "GEOB", Data: data})
+}
+
+// Comment returns the text of the COMM frame without description, which is
+// the comment players show. Frames with a description, like iTunes'
+// iTunNORM, are ignored.
+func (t *ID3Tag) Comment() string {
+	for _, frame := range t.FramesByID("COMM") {
+		if len(frame.Data) < 5 {
+			continue
+		}
+		encoding := frame.Data[0]
+		description, text := splitText(encoding, frame.Data[4:])
+		if description == "" {
+			value, _ := splitText(encoding, text)
+			return value
+		}
+	}
+	return ""
+}
+
+// SetComment replaces the COMM frame without description. An empty value
+// removes it.
+func (t *ID3Tag) SetComment(value string) {
+	t.RemoveFrames(func(f *ID3Frame) bool {
+		if f.ID != "COMM" || f.Raw || len(f.Data) < 5 {
+			return false
+		}
+		description, _ := splitText(f.Data[0], f.Data[4:])
+		return description == ""
+	})
+	if value == "" {
+		return
+	}
+	encoding := textEncoding(t.Version, value)
+	data := append([]byte{encoding}, "eng"...)
+	data = append(data, encodeText(encoding, "", true)...)
+	data = append(data, encodeText(encoding, value, false)...)
+	t.Frames = append(t.Frames, ID3Frame{ID: "COMM", Data: data})
+}
+
+// Popularimeter returns the 0-255 rating of the POPM frame with the given
+// email, or of the first POPM frame when none matches
+func (t *ID3Tag) Popularimeter(email string) (int, bool) {
+	frames := t.FramesByID("POPM")
+	for _, preferred := range []bool{true, false} {
+		for _, frame := range frames {
+			owner, rest := splitText(encodingLatin1, frame.Data)
+			if len(rest) == 0 || (preferred && owner != email) {
+				continue
+			}
+			return int(rest[0]), true
+		}
+	}
+	return 0, false
+}
+
+// SetPopularimeter replaces the POPM frame with the given email, keeping
+// ratings other players stored under their own email. A rating of 0 removes
+// the frame.
+func (t *ID3Tag) SetPopularimeter(email string, rating int) {
+	counter := []byte{0, 0, 0, 0}
+	t.RemoveFrames(func(f *ID3Frame) bool {
+		if f.ID != "POPM" || f.Raw {
+			return false
+		}
+		owner, rest := splitText(encodingLatin1, f.Data)
+		if owner == email && len(rest) > 1 {
+			counter = rest[1:]
+		}
+		return owner == email
+	})
+	if rating <= 0 {
+		return
+	}
+	data := encodeText(encodingLatin1, email, true)
+	data = append(data, byte(min(rating, 255)))
+	data = append(data, counter...)
+	t.Frames = append(t.Frames, ID3Frame{ID: "POPM", Data: data})
+}
@@ -0,0 +1,359 @@
+package tags
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// id3HeaderSize is the size of the ID3v2 tag header
+const id3HeaderSize = 10
+
+// id3Padding is the padding added when a tag has to be rewritten
+const id3Padding = 2048
+
+// ErrNoTag is returned when a file has no tag of the requested kind
+var ErrNoTag = errors.New("no tag found")
+
+// ErrUnsupported is returned for file formats or tag features that are not supported
+var ErrUnsupported = errors.New("unsupported file format")
+
+// ID3Frame is a single ID3v2 frame. Data holds the frame content with
+// unsynchronisation and compression already removed. Raw frames could not be
+// decoded and keep their content and flags as stored, so they are written
+// back unchanged.
+type ID3Frame struct {
+	ID    string
+	Flags uint16
+	Data  []byte
+	Raw   bool
+}
+
+// ID3Tag is an ID3v2.2, 2.3 or 2.4 tag. Version is the major version number.
+type ID3Tag struct {
+	Version byte
+	Frames  []ID3Frame
+}
+
+// NewID3Tag returns an empty ID3v2.3 tag, the version most players understand
+func NewID3Tag() *ID3Tag {
+	return &ID3Tag{Version: 3}
+}
+
+// Frame returns the first decoded frame with the given ID, or nil
+func (t *ID3Tag) Frame(id string) *ID3Frame {
+	for i := range t.Frames {
+		if t.Frames[i].ID == id && !t.Frames[i].Raw {
+			return &t.Frames[i]
+		}
+	}
+	return nil
+}
+
+// FramesByID returns all decoded frames with the given ID
+func (t *ID3Tag) FramesByID(id string) []*ID3Frame {
+	var frames []*ID3Frame
+	for i := range t.Frames {
+		if t.Frames[i].ID == id && !t.Frames[i].Raw {
+			frames = append(frames, &t.Frames[i])
+		}
+	}
+	return frames
+}
+
+// RemoveFrames removes all frames for which match returns true
+func (t *ID3Tag) RemoveFrames(match func(*ID3Frame) bool) {
+	frames := t.Frames[:0]
+	for i := range t.Frames {
+		if !match(&t.Frames[i]) {
+			frames = append(frames, t.Frames[i])
+		}
+	}
+	t.Frames = frames
+}
+
+// SetFrame replaces all frames with the frame's ID by the given frame
+func (t *ID3Tag) SetFrame(frame ID3Frame) {
+	t.RemoveFrames(func(f *ID3Frame) bool { return f.ID == frame.ID })
+	t.Frames = append(t.Frames, frame)
+}
+
+// syncsafe decodes a 28 bit integer stored in four 7 bit bytes
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// putSyncsafe encodes a 28 bit integer into four 7 bit bytes
+func putSyncsafe(b []byte, n int) {
+	b[0] = byte(n>>21) & 0x7f
+	b[1] = byte(n>>14) & 0x7f
+	b[2] = byte(n>>7) & 0x7f
+	b[3] = byte(n) & 0x7f
+}
+
+// removeUnsync reverses ID3 unsynchronisation, which inserts a zero after every 0xff
+func removeUnsync(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		out = append(out, data[i])
+		if data[i] == 0xff && i+1 < len(data) && data[i+1] == 0x00 {
+			i++
+		}
+	}
+	return out
+}
+
+// readID3Header reads the tag header and returns the version, flags and tag size
+// excluding the header
+func readID3Header(header []byte) (byte, byte, int, error) {
+	if len(header) < id3HeaderSize || string(header[:3]) != "ID3" {
+		return 0, 0, 0, ErrNoTag
+	}
+	version := header[3]
+	if version < 2 || version > 4 {
+		return 0, 0, 0, ErrUnsupported
+	}
+	return version, header[5], syncsafe(header[6:10]), nil
+}
+
+// ReadID3 reads an ID3v2 tag from the start of r. The returned size is the
+// number of bytes the tag occupies, including header and padding.
+func ReadID3(r io.Reader) (*ID3Tag, int, error) {
+	header := make([]byte, id3HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, 0, ErrNoTag
+		}
+		return nil, 0, err
+	}
+	version, flags, size, err := readID3Header(header)
+	if err != nil {
+		return nil, 0, err
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, 0, err
+	}
+	total := id3HeaderSize + size
+	if flags&0x10 != 0 {
+		// ID3v2.4 footer
+		total += id3HeaderSize
+	}
+
+	tag, err := ParseID3(version, flags, body)
+	return tag, total, err
+}
+
+// ParseID3 parses the body of an ID3v2 tag following the header
+func ParseID3(version, flags byte, body []byte) (*ID3Tag, error) {
+	tag := &ID3Tag{Version: version}
+
+	// Before 2.4 unsynchronisation applies to the whole tag
+	if flags&0x80 != 0 && version < 4 {
+		body = removeUnsync(body)
+	}
+	if flags&0x40 != 0 && version >= 3 && len(body) >= 4 {
+		var extSize int
+		if version == 4 {
+			extSize = syncsafe(body[:4])
+		} else {
+			extSize = int(binary.BigEndian.Uint32(body[:4])) + 4
+		}
+		if extSize > len(body) {
+			return nil, errors.New("invalid ID3 extended header")
+		}
+		body = body[extSize:]
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+
+	for len(body) >= headerLen {
+		if body[0] == 0 {
+			// Padding
+			break
+		}
+		id := string(body[:idLen])
+		var size int
+		var frameFlags uint16
+		switch version {
+		case 2:
+			size = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			size = int(binary.BigEndian.Uint32(body[4:8]))
+			frameFlags = binary.BigEndian.Uint16(body[8:10])
+		default:
+			size = syncsafe(body[4:8])
+			frameFlags = binary.BigEndian.Uint16(body[8:10])
+		}
+		if size > len(body)-headerLen {
+			break
+		}
+		stored := body[headerLen : headerLen+size]
+		body = body[headerLen+size:]
+
+		data, decodedFlags, err := decodeFrameData(version, frameFlags, stored)
+		if err != nil {
+			tag.Frames = append(tag.Frames, ID3Frame{ID: id, Flags: frameFlags, Data: stored, Raw: true})
+			continue
+		}
+		if version == 2 {
+			// Use the ID3v2.3 frame IDs so lookups work for all versions
+			mapped, exists := v22FrameIDs[id]
+			if !exists {
+				tag.Frames = append(tag.Frames, ID3Frame{ID: id, Data: stored, Raw: true})
+				continue
+			}
+			if mapped == "APIC" {
+				data = convertV22Picture(data)
+			}
+			id = mapped
+		}
+		tag.Frames = append(tag.Frames, ID3Frame{ID: id, Flags: decodedFlags, Data: data})
+	}
+	return tag, nil
+}
+
+// decodeFrameData removes per-frame unsynchronisation and compression. The
+// returned flags no longer carry the flags for the removed encodings.
+func decodeFrameData(version byte, flags uint16, data []byte) ([]byte, uint16, error) {
+	switch version {
+	case 3:
+		if flags&0x0040 != 0 {
+			// Encrypted frames are kept as they are
+			return data, flags, nil
+		}
+		// The extra header bytes follow the flag order: the decompressed
+		// size comes before the grouping identity byte
+		compressed := flags&0x0080 != 0
+		if compressed {
+			if len(data) < 4 {
+				return nil, 0, errors.New("invalid compressed frame")
+			}
+			data = data[4:]
+		}
+		if flags&0x0020 != 0 && len(data) > 0 {
+			data = data[1:]
+			flags &^= 0x0020
+		}
+		if compressed {
+			decompressed, err := inflate(data)
+			if err != nil {
+				return nil, 0, err
+			}
+			data = decompressed
+			flags &^= 0x0080
+		}
+	case 4:
+		if flags&0x0004 != 0 {
+			return data, flags, nil
+		}
+		if flags&0x0040 != 0 && len(data) > 0 {
+			data = data[1:]
+			flags &^= 0x0040
+		}
+		if flags&0x0001 != 0 && len(data) >= 4 {
+			// Data length indicator
+			data = data[4:]
+			flags &^= 0x0001
+		}
+		if flags&0x0002 != 0 {
+			data = removeUnsync(data)
+			flags &^= 0x0002
+		}
+		if flags&0x0008 != 0 {
+			decompressed, err := inflate(data)
+			if err != nil {
+				return nil, 0, err
+			}
+			data = decompressed
+			flags &^= 0x0008
+		}
+	}
+	return data, flags, nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// v22FrameIDs maps ID3v2.2 frame IDs to their ID3v2.3 equivalents. Other
+// v2.2 frames are kept as raw frames, which Writable refuses.
+var v22FrameIDs = map[string]string{
+	"TT2": "TIT2", "TP1": "TPE1", "TP2": "TPE2", "TAL": "TALB", "TCO": "TCON",
+	"TYE": "TYER", "TRK": "TRCK", "TBP": "TBPM", "TKE": "TKEY", "TPB": "TPUB",
+	"COM": "COMM", "PIC": "APIC", "GEO": "GEOB", "TXX": "TXXX", "TP4": "TPE4",
+	"POP": "POPM", "TLE": "TLEN", "TCM": "TCOM", "TPA": "TPOS", "ULT": "USLT",
+}
+
+// Writable returns an error when writing the tag would lose frames. ID3v2.2
+// frames without an ID3v2.3 equivalent cannot be written, as v2.2 tags are
+// written as v2.3.
+func (t *ID3Tag) Writable() error {
+	for _, frame := range t.Frames {
+		if len(frame.ID) != 4 {
+			return fmt.Errorf("ID3v2.2 frame %s has no ID3v2.3 equivalent: %w", frame.ID, ErrUnsupported)
+		}
+	}
+	return nil
+}
+
+// Bytes serializes the tag, including header, followed by the given amount of
+// padding. Tags read as ID3v2.2 are written as ID3v2.3, without the frames
+// Writable complains about.
+func (t *ID3Tag) Bytes(padding int) []byte {
+	version := t.Version
+	if version < 3 {
+		version = 3
+	}
+
+	var body bytes.Buffer
+	for _, frame := range t.Frames {
+		if len(frame.ID) != 4 {
+			continue
+		}
+		header := make([]byte, 10)
+		copy(header, frame.ID)
+		if version == 4 {
+			putSyncsafe(header[4:8], len(frame.Data))
+		} else {
+			binary.BigEndian.PutUint32(header[4:8], uint32(len(frame.Data)))
+		}
+		binary.BigEndian.PutUint16(header[8:10], frame.Flags)
+		body.Write(header)
+		body.Write(frame.Data)
+	}
+	body.Write(make([]byte, padding))
+
+	out := make([]byte, id3HeaderSize, id3HeaderSize+body.Len())
+	copy(out, "ID3")
+	out[3] = version
+	putSyncsafe(out[6:10], body.Len())
+	return append(out, body.Bytes()...)
+}
+
+// convertV22Picture converts a v2.2 PIC frame, which has a three letter image
+// format instead of a MIME type, into APIC data
+func convertV22Picture(data []byte) []byte {
+	if len(data) < 4 {
+		return data
+	}
+	mime := "image/jpeg"
+	if string(bytes.ToUpper(data[1:4])) == "PNG" {
+		mime = "image/png"
+	}
+	out := []byte{data[0]}
+	out = append(out, mime...)
+	out = append(out, 0)
+	return append(out, data[4:]...)
+}
@@ -0,0 +1,117 @@
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+// testID3 builds a tag of the given version from encoded frames
+func testID3(version byte, frames ...[]byte) []byte {
+	var body []byte
+	for _, frame := range frames {
+		body = append(body, frame...)
+	}
+	header := []byte{'I', 'D', '3', version, 0, 0, 0, 0, 0, 0}
+	putSyncsafe(header[6:], len(body))
+	return append(header, body...)
+}
+
+// v22Frame encodes an ID3v2.2 frame
+func v22Frame(id string, data []byte) []byte {
+	size := len(data)
+	return append([]byte{id[0], id[1], id[2], byte(size >> 16), byte(size >> 8), byte(size)}, data...)
+}
+
+// v23Frame encodes an ID3v2.3 frame
+func v23Frame(id string, flags uint16, data []byte) []byte {
+	out := binary.BigEndian.AppendUint32([]byte(id), uint32(len(data)))
+	out = binary.BigEndian.AppendUint16(out, flags)
+	return append(out, data...)
+}
+
+func TestV22FramesWithoutEquivalent(t *testing.T) {
+	title := v22Frame("TT2", []byte("\x00A title"))
+	tag, _, err := ReadID3(bytes.NewReader(testID3(2, title)))
+	if err != nil {
+		t.Fatalf("ReadID3: %v", err)
+	}
+	if err := tag.Writable(); err != nil {
+		t.Errorf("a v2.2 tag of mapped frames is not writable: %v", err)
+	}
+	written, _, err := ReadID3(bytes.NewReader(tag.Bytes(0)))
+	if err != nil {
+		t.Fatalf("ReadID3 of the written tag: %v", err)
+	}
+	if written.Version != 3 || written.Text("TIT2") != "A title" {
+		t.Errorf("v2.2 tag written as version %d with title %q", written.Version, written.Text("TIT2"))
+	}
+
+	// CRM, encrypted meta, has no ID3v2.3 frame
+	data := testID3(2, title, v22Frame("CRM", []byte("owner\x00explanation\x00data")))
+	payload := append([]byte{0xff, 0xfb, 0x90, 0x64}, testPayload(500)...)
+	path := writeTestFile(t, "track.mp3", append(data, payload...))
+	tag, err = ReadID3File(path)
+	if err != nil {
+		t.Fatalf("ReadID3File: %v", err)
+	}
+	if frame := tag.Frame("CRM"); frame != nil {
+		t.Error("the unmapped frame is returned as a decoded frame")
+	}
+	if err := tag.Writable(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Writable returned %v for an unmapped v2.2 frame", err)
+	}
+	tag.SetText("TIT2", "Another title")
+	if err := WriteID3File(path, tag); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("WriteID3File returned %v for an unmapped v2.2 frame", err)
+	}
+	if err := WriteFields(path, FieldValues{FieldTitle: "Another title"}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("WriteFields returned %v for an unmapped v2.2 frame", err)
+	}
+	if stored, err := os.ReadFile(path); err != nil || !bytes.Equal(stored, append(data, payload...)) {
+		t.Errorf("the refused write changed the file: %v", err)
+	}
+}
+
+func TestRawFramesSurviveWrite(t *testing.T) {
+	// A compressed frame whose data is not a zlib stream cannot be decoded
+	broken := []byte{0, 0, 0, 20, 'n', 'o', 't', ' ', 'z', 'l', 'i', 'b'}
+	data := testID3(3,
+		v23Frame("TIT2", 0, []byte("\x00A title")),
+		v23Frame("PRIV", 0x0080, broken),
+	)
+	payload := append([]byte{0xff, 0xfb, 0x90, 0x64}, testPayload(500)...)
+	path := writeTestFile(t, "track.mp3", append(data, payload...))
+
+	if err := WriteFields(path, FieldValues{FieldTitle: "Another title", FieldArtist: "An artist"}); err != nil {
+		t.Fatalf("WriteFields: %v", err)
+	}
+	checkFields(t, path, FieldValues{FieldTitle: "Another title", FieldArtist: "An artist"})
+
+	stored, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, size, err := ReadID3(bufio.NewReader(bytes.NewReader(stored)))
+	if err != nil {
+		t.Fatalf("ReadID3: %v", err)
+	}
+	if !bytes.Equal(stored[size:], payload) {
+		t.Error("the audio after the tag changed")
+	}
+	if tag.Frame("PRIV") != nil || len(tag.FramesByID("PRIV")) != 0 {
+		t.Error("the raw frame is returned as a decoded frame")
+	}
+	var raw []ID3Frame
+	for _, frame := range tag.Frames {
+		if frame.Raw {
+			raw = append(raw, frame)
+		}
+	}
+	if len(raw) != 1 || raw[0].ID != "PRIV" || raw[0].Flags != 0x0080 || !bytes.Equal(raw[0].Data, broken) {
+		t.Errorf("raw frames after the write are %+v, want the PRIV frame as stored", raw)
+	}
+}
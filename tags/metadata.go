@@ -0,0 +1,142 @@
+package tags
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Metadata holds the fields shown for audio files, read from whichever tag
+// format the file uses. Duration is in seconds and 0 when unknown.
+type Metadata struct {
+	Artist   string
+	Title    string
+	Album    string
+	Genre    string
+	Label    string
+	Key      string
+	Year     int
+	BPM      float64
+	Duration float64
+}
+
+// ReadMetadata reads the tags and duration of an MP3, AIFF, WAV, FLAC, Ogg or
+// MP4 file. Files without a tag return the duration and empty fields.
+func ReadMetadata(path string) (*Metadata, error) {
+	var meta *Metadata
+	switch kind := detectKind(path); kind {
+	case kindMP3, kindAIFF, kindWAV:
+		tag, err := ReadID3File(path)
+		if err != nil && !errors.Is(err, ErrNoTag) {
+			return nil, err
+		}
+		meta = metadataFromID3(tag)
+		if kind == kindMP3 {
+			meta.Duration, _ = mp3Duration(path)
+		} else {
+			meta.Duration, _ = pcmDuration(path, kind)
+		}
+	case kindFLAC:
+		comment, err := ReadFLACComment(path)
+		if err != nil && !errors.Is(err, ErrNoTag) {
+			return nil, err
+		}
+		meta = metadataFromVorbis(comment)
+		meta.Duration, _ = flacDuration(path)
+	case kindOGG:
+		comment, duration, err := readOgg(path)
+		if err != nil && !errors.Is(err, ErrNoTag) {
+			return nil, err
+		}
+		meta = metadataFromVorbis(comment)
+		meta.Duration = duration
+	case kindMP4:
+		return readMP4(path)
+	default:
+		return nil, ErrUnsupported
+	}
+	return meta, nil
+}
+
+// metadataFromID3 maps the ID3 text frames. TDRC is the ID3v2.4 recording
+// time, TYER the ID3v2.3 year.
+func metadataFromID3(tag *ID3Tag) *Metadata {
+	meta := &Metadata{}
+	if tag == nil {
+		return meta
+	}
+	year := tag.Text("TDRC")
+	if year == "" {
+		year = tag.Text("TYER")
+	}
+	meta.Artist = tag.Text("TPE1")
+	meta.Title = tag.Text("TIT2")
+	meta.Album = tag.Text("TALB")
+	meta.Genre = id3Genre(tag.Text("TCON"))
+	meta.Label = tag.Text("TPUB")
+	meta.Key = tag.Text("TKEY")
+	meta.Year = parseYear(year)
+	meta.BPM = parseBPM(tag.Text("TBPM"))
+	return meta
+}
+
+// id3Genre drops the "(17)" genre number that older taggers put in front of
+// or instead of the genre name
+func id3Genre(genre string) string {
+	if strings.HasPrefix(genre, "(") {
+		if end := strings.Index(genre, ")"); end > 0 {
+			if _, err := strconv.Atoi(genre[1:end]); err == nil && end+1 < len(genre) {
+				return genre[end+1:]
+			}
+		}
+	}
+	return genre
+}
+
+// metadataFromVorbis maps Vorbis comments. Taggers disagree on the names for
+// label, key and tempo, so the common alternatives are tried in turn.
+func metadataFromVorbis(comment *VorbisComment) *Metadata {
+	meta := &Metadata{}
+	if comment == nil {
+		return meta
+	}
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if value := comment.Get(key); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	meta.Artist = first("ARTIST", "ALBUMARTIST")
+	meta.Title = comment.Get("TITLE")
+	meta.Album = comment.Get("ALBUM")
+	meta.Genre = comment.Get("GENRE")
+	meta.Label = first("LABEL", "ORGANIZATION", "PUBLISHER")
+	meta.Key = first("INITIALKEY", "KEY")
+	meta.Year = parseYear(first("DATE", "YEAR", "ORIGINALDATE"))
+	meta.BPM = parseBPM(first("BPM", "TEMPO"))
+	return meta
+}
+
+// parseYear reads the year from dates like "2019", "2019-05-01" or "2019-05-01T10:00:00"
+func parseYear(value string) int {
+	value = strings.TrimSpace(value)
+	if len(value) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(value[:4])
+	if err != nil {
+		return 0
+	}
+	return year
+}
+
+// parseBPM reads a tempo, accepting a decimal comma
+func parseBPM(value string) float64 {
+	bpm, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(value), ",", "."), 64)
+	if err != nil || bpm < 0 {
+		return 0
+	}
+	return bpm
+}
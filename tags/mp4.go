@@ -0,0 +1,234 @@
+package tags
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Type indicators of MP4 data atoms
+const (
+	mp4TypeImplicit = 0
+	mp4TypeUTF8     = 1
+	mp4TypePNG      = 14
+	mp4TypeInteger  = 21
+)
+
+// mp4Atom is a box of an MP4 file. Offset is the position of the atom data,
+// which follows a header of 8 or, for 64 bit sizes, 16 bytes.
+type mp4Atom struct {
+	kind   string
+	header int64
+	offset int64
+	size   int64
+}
+
+// readMP4Atoms lists the atoms between start and end
+func readMP4Atoms(r io.ReaderAt, start, end int64) ([]mp4Atom, error) {
+	var atoms []mp4Atom
+	header := make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return atoms, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			// The atom runs to the end of the file
+			size = end - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return atoms, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize || offset+size > end {
+			return atoms, errors.New("invalid MP4 atom size")
+		}
+		atoms = append(atoms, mp4Atom{kind: string(header[4:8]), header: headerSize, offset: offset + headerSize, size: size - headerSize})
+		offset += size
+	}
+	return atoms, nil
+}
+
+// findMP4Atom returns the atom at the given path below the atoms, such as
+// "moov", "udta", "meta"
+func findMP4Atom(r io.ReaderAt, atoms []mp4Atom, path ...string) (mp4Atom, bool) {
+	for i, name := range path {
+		var found *mp4Atom
+		for j := range atoms {
+			if atoms[j].kind == name {
+				found = &atoms[j]
+				break
+			}
+		}
+		if found == nil {
+			return mp4Atom{}, false
+		}
+		if i == len(path)-1 {
+			return *found, true
+		}
+		start := found.offset
+		if name == "meta" {
+			// meta is a full box with version and flags before its children
+			start += 4
+		}
+		children, err := readMP4Atoms(r, start, found.offset+found.size)
+		if err != nil && len(children) == 0 {
+			return mp4Atom{}, false
+		}
+		atoms = children
+	}
+	return mp4Atom{}, false
+}
+
+// readMP4 reads the iTunes style metadata and the duration of an MP4 file,
+// including M4A, ALAC and Native Instruments stem files
+func readMP4(path string) (*Metadata, error) {
+	items, duration, err := readMP4Items(path)
+	if err != nil {
+		return nil, err
+	}
+	meta := &Metadata{
+		Artist:   items["\xa9ART"],
+		Title:    items["\xa9nam"],
+		Album:    items["\xa9alb"],
+		Genre:    items["\xa9gen"],
+		Year:     parseYear(items["\xa9day"]),
+		BPM:      parseBPM(items["tmpo"]),
+		Duration: duration,
+	}
+	if meta.Artist == "" {
+		meta.Artist = items["aART"]
+	}
+	for _, name := range []string{"LABEL", "PUBLISHER", "\xa9pub"} {
+		if meta.Label == "" {
+			meta.Label = items[name]
+		}
+	}
+	for _, name := range []string{"INITIALKEY", "KEY"} {
+		if meta.Key == "" {
+			meta.Key = items[name]
+		}
+	}
+	if bpm := parseBPM(items["BPM"]); bpm > 0 {
+		meta.BPM = bpm
+	}
+	return meta, nil
+}
+
+// readMP4Items reads the ilst items of an MP4 file and the duration. Items
+// are keyed by atom name, freeform "----" items by their upper case name.
+func readMP4Items(path string) (map[string]string, float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	top, err := readMP4Atoms(file, 0, info.Size())
+	if len(top) == 0 {
+		if err == nil {
+			err = ErrUnsupported
+		}
+		return nil, 0, err
+	}
+	var duration float64
+	if mvhd, ok := findMP4Atom(file, top, "moov", "mvhd"); ok {
+		duration = mp4Duration(file, mvhd)
+	}
+	values := make(map[string]string)
+	ilst, ok := findMP4Atom(file, top, "moov", "udta", "meta", "ilst")
+	if !ok {
+		return values, duration, nil
+	}
+	items, _ := readMP4Atoms(file, ilst.offset, ilst.offset+ilst.size)
+	for _, item := range items {
+		name, value := readMP4Item(file, item)
+		if value != "" {
+			if _, exists := values[name]; !exists {
+				values[name] = value
+			}
+		}
+	}
+	return values, duration, nil
+}
+
+// mp4Duration reads the duration from the movie header
+func mp4Duration(r io.ReaderAt, mvhd mp4Atom) float64 {
+	data := make([]byte, min(mvhd.size, 32))
+	if _, err := r.ReadAt(data, mvhd.offset); err != nil || len(data) < 20 {
+		return 0
+	}
+	var scale, duration uint64
+	if data[0] == 1 {
+		if len(data) < 32 {
+			return 0
+		}
+		scale = uint64(binary.BigEndian.Uint32(data[20:24]))
+		duration = binary.BigEndian.Uint64(data[24:32])
+	} else {
+		scale = uint64(binary.BigEndian.Uint32(data[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+	}
+	if scale == 0 {
+		return 0
+	}
+	return float64(duration) / float64(scale)
+}
+
+// readMP4Item reads an ilst item. Freeform "----" items are returned under
+// their upper case name, such as "INITIALKEY". Integers are returned as text.
+func readMP4Item(r io.ReaderAt, item mp4Atom) (string, string) {
+	name := item.kind
+	children, _ := readMP4Atoms(r, item.offset, item.offset+item.size)
+	var value string
+	for _, child := range children {
+		// Items carry at most a few kilobytes of text, cover art is skipped
+		if child.size < 8 || child.size > 64*1024 {
+			continue
+		}
+		data := make([]byte, child.size)
+		if _, err := r.ReadAt(data, child.offset); err != nil {
+			continue
+		}
+		switch child.kind {
+		case "name":
+			if item.kind == "----" {
+				name = strings.ToUpper(string(data[4:]))
+			}
+		case "data":
+			value = mp4DataValue(data)
+		}
+	}
+	return name, value
+}
+
+// mp4DataValue decodes the payload of a data atom: a type indicator, the
+// locale and the value. Text and integers are supported.
+func mp4DataValue(data []byte) string {
+	if len(data) < 8 {
+		return ""
+	}
+	body := data[8:]
+	switch binary.BigEndian.Uint32(data[:4]) & 0xffffff {
+	case mp4TypeUTF8:
+		return strings.TrimRight(string(body), "\x00")
+	case mp4TypeImplicit, mp4TypeInteger:
+		number := 0
+		for _, b := range body {
+			number = number<<8 | int(b)
+		}
+		return strconv.Itoa(number)
+	}
+	return ""
+}
@@ -0,0 +1,232 @@
+package tags
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// mp4Containers are the atoms whose children are rewritten when tags change.
+// All other atoms are kept as opaque data.
+var mp4Containers = map[string]bool{
+	"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true,
+	"edts": true, "udta": true, "meta": true, "ilst": true,
+}
+
+// mp4Box is an atom held in memory. Containers have children, other atoms
+// data. The meta atom keeps its version and flags in data before the children.
+type mp4Box struct {
+	kind     string
+	data     []byte
+	children []*mp4Box
+}
+
+// parseMP4Boxes decodes the atoms of data. Items inside ilst are parsed as
+// containers of their mean, name and data atoms.
+func parseMP4Boxes(data []byte, parent string) ([]*mp4Box, error) {
+	var boxes []*mp4Box
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data))
+		headerSize := 8
+		switch size {
+		case 0:
+			size = len(data)
+		case 1:
+			if len(data) < 16 {
+				return nil, errors.New("invalid MP4 atom size")
+			}
+			size = int(binary.BigEndian.Uint64(data[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize || size > len(data) {
+			return nil, errors.New("invalid MP4 atom size")
+		}
+		box := &mp4Box{kind: string(data[4:8])}
+		body := data[headerSize:size]
+		switch {
+		case box.kind == "meta" && len(body) >= 4:
+			box.data = body[:4]
+			children, err := parseMP4Boxes(body[4:], box.kind)
+			if err != nil {
+				return nil, err
+			}
+			box.children = children
+		case mp4Containers[box.kind] || parent == "ilst":
+			children, err := parseMP4Boxes(body, box.kind)
+			if err != nil {
+				return nil, err
+			}
+			box.children = children
+		default:
+			box.data = body
+		}
+		boxes = append(boxes, box)
+		data = data[size:]
+	}
+	return boxes, nil
+}
+
+// encode serializes the box with its children
+func (b *mp4Box) encode() []byte {
+	body := append([]byte{}, b.data...)
+	for _, child := range b.children {
+		body = append(body, child.encode()...)
+	}
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	out = append(out, b.kind...)
+	return append(out, body...)
+}
+
+// child returns the first child of the given kind, creating it when create is set
+func (b *mp4Box) child(kind string, create bool) *mp4Box {
+	for _, child := range b.children {
+		if child.kind == kind {
+			return child
+		}
+	}
+	if !create {
+		return nil
+	}
+	child := &mp4Box{kind: kind}
+	switch kind {
+	case "meta":
+		child.data = make([]byte, 4)
+		// iTunes metadata needs a handler of type mdir
+		hdlr := make([]byte, 25)
+		copy(hdlr[8:], "mdirappl")
+		child.children = append(child.children, &mp4Box{kind: "hdlr", data: hdlr})
+	}
+	b.children = append(b.children, child)
+	return child
+}
+
+// freeformName returns the name of a "----" item in upper case
+func (b *mp4Box) freeformName() string {
+	if name := b.child("name", false); name != nil && len(name.data) >= 4 {
+		return strings.ToUpper(string(name.data[4:]))
+	}
+	return ""
+}
+
+// setMP4Item replaces an ilst item. Names of four characters are atoms like
+// "\xa9ART", longer names freeform items below com.apple.iTunes. An empty value
+// removes the item.
+func setMP4Item(ilst *mp4Box, name, value string) {
+	freeform := len(name) != 4
+	items := ilst.children[:0]
+	for _, item := range ilst.children {
+		if freeform && item.kind == "----" && item.freeformName() == strings.ToUpper(name) {
+			continue
+		}
+		if !freeform && item.kind == name {
+			continue
+		}
+		items = append(items, item)
+	}
+	ilst.children = items
+	if value == "" {
+		return
+	}
+
+	data := &mp4Box{kind: "data"}
+	if name == "tmpo" {
+		data.data = binary.BigEndian.AppendUint32(nil, mp4TypeInteger)
+		data.data = append(data.data, 0, 0, 0, 0)
+		data.data = binary.BigEndian.AppendUint16(data.data, uint16(parseBPM(value)+0.5))
+	} else {
+		data.data = binary.BigEndian.AppendUint32(nil, mp4TypeUTF8)
+		data.data = append(data.data, 0, 0, 0, 0)
+		data.data = append(data.data, value...)
+	}
+	item := &mp4Box{kind: name, children: []*mp4Box{data}}
+	if freeform {
+		item.kind = "----"
+		item.children = []*mp4Box{
+			{kind: "mean", data: append(make([]byte, 4), "com.apple.iTunes"...)},
+			{kind: "name", data: append(make([]byte, 4), name...)},
+			data,
+		}
+	}
+	ilst.children = append(ilst.children, item)
+}
+
+// shiftChunkOffsets moves the sample data references of all tracks that point
+// at or behind from by delta bytes
+func shiftChunkOffsets(box *mp4Box, from, delta int64) {
+	for _, child := range box.children {
+		shiftChunkOffsets(child, from, delta)
+	}
+	if len(box.data) < 8 || (box.kind != "stco" && box.kind != "co64") {
+		return
+	}
+	count := int(binary.BigEndian.Uint32(box.data[4:8]))
+	entries := box.data[8:]
+	for i := 0; i < count; i++ {
+		if box.kind == "stco" && len(entries) >= (i+1)*4 {
+			offset := int64(binary.BigEndian.Uint32(entries[i*4:]))
+			if offset >= from {
+				binary.BigEndian.PutUint32(entries[i*4:], uint32(offset+delta))
+			}
+		} else if box.kind == "co64" && len(entries) >= (i+1)*8 {
+			offset := int64(binary.BigEndian.Uint64(entries[i*8:]))
+			if offset >= from {
+				binary.BigEndian.PutUint64(entries[i*8:], uint64(offset+delta))
+			}
+		}
+	}
+}
+
+// writeMP4Items changes the ilst items of an MP4 file. The file is rewritten
+// with the new moov atom, and chunk offsets behind it are moved by the change
+// in size.
+func writeMP4Items(path string, values map[string]string) error {
+	return replaceFile(path, func(w io.Writer, old *os.File) error {
+		info, err := old.Stat()
+		if err != nil {
+			return err
+		}
+		top, err := readMP4Atoms(old, 0, info.Size())
+		if err != nil {
+			return err
+		}
+		var moov *mp4Atom
+		for i := range top {
+			if top[i].kind == "moov" {
+				moov = &top[i]
+			}
+		}
+		if moov == nil {
+			return errors.New("missing MP4 moov atom")
+		}
+		start := moov.offset - moov.header
+		end := moov.offset + moov.size
+
+		data := make([]byte, end-start)
+		if _, err := old.ReadAt(data, start); err != nil {
+			return err
+		}
+		boxes, err := parseMP4Boxes(data, "")
+		if err != nil || len(boxes) != 1 {
+			return errors.New("invalid MP4 moov atom")
+		}
+		root := boxes[0]
+		ilst := root.child("udta", true).child("meta", true).child("ilst", true)
+		for name, value := range values {
+			setMP4Item(ilst, name, value)
+		}
+		if delta := int64(len(root.encode())) - (end - start); delta != 0 {
+			shiftChunkOffsets(root, end, delta)
+		}
+
+		if _, err := io.Copy(w, io.NewSectionReader(old, 0, start)); err != nil {
+			return err
+		}
+		if _, err := w.Write(root.encode()); err != nil {
+			return err
+		}
+		_, err = io.Copy(w, io.NewSectionReader(old, end, info.Size()-end))
+		return err
+	})
+}
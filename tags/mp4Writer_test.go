@@ -0,0 +1,86 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+// testMP4 builds an MP4 file with the movie header in front of the media
+// data. The chunk offset table points at the payload in mdat.
+func testMP4(payload []byte) []byte {
+	ftyp := &mp4Box{kind: "ftyp", data: []byte("M4A \x00\x00\x00\x00M4A mp42isom")}
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 5000)
+	stco := &mp4Box{kind: "stco", data: make([]byte, 12)}
+	binary.BigEndian.PutUint32(stco.data[4:], 1)
+	moov := &mp4Box{kind: "moov", children: []*mp4Box{
+		{kind: "mvhd", data: mvhd},
+		{kind: "trak", children: []*mp4Box{
+			{kind: "mdia", children: []*mp4Box{
+				{kind: "minf", children: []*mp4Box{
+					{kind: "stbl", children: []*mp4Box{stco}},
+				}},
+			}},
+		}},
+	}}
+	mdat := &mp4Box{kind: "mdat", data: payload}
+	offset := len(ftyp.encode()) + len(moov.encode()) + 8
+	binary.BigEndian.PutUint32(stco.data[8:], uint32(offset))
+
+	out := append(ftyp.encode(), moov.encode()...)
+	return append(out, mdat.encode()...)
+}
+
+func TestMP4ItemsRoundTrip(t *testing.T) {
+	payload := testPayload(4000)
+	path := writeTestFile(t, "track.m4a", testMP4(payload))
+
+	for _, values := range []FieldValues{
+		{FieldTitle: "A title", FieldArtist: "An artist", FieldBPM: "124", FieldKey: "8A", FieldRating: "153"},
+		{FieldTitle: "A much longer title than before", FieldLabel: "A label"},
+		{FieldTitle: "Short"},
+	} {
+		if err := WriteFields(path, values); err != nil {
+			t.Fatalf("WriteFields: %v", err)
+		}
+		checkFields(t, path, values)
+
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, _ := file.Stat()
+		top, err := readMP4Atoms(file, 0, info.Size())
+		if err != nil {
+			file.Close()
+			t.Fatalf("readMP4Atoms: %v", err)
+		}
+		mdat, found := findMP4Atom(file, top, "mdat")
+		stco, _ := findMP4Atom(file, top, "moov", "trak", "mdia", "minf", "stbl", "stco")
+		table := make([]byte, 12)
+		if _, err := file.ReadAt(table, stco.offset); err != nil {
+			file.Close()
+			t.Fatal(err)
+		}
+		data := make([]byte, mdat.size)
+		if _, err := file.ReadAt(data, mdat.offset); err != nil {
+			file.Close()
+			t.Fatal(err)
+		}
+		file.Close()
+
+		if !found || !bytes.Equal(data, payload) {
+			t.Error("the media data changed")
+		}
+		if offset := int64(binary.BigEndian.Uint32(table[8:])); offset != mdat.offset {
+			t.Errorf("chunk offset %d, the media data starts at %d", offset, mdat.offset)
+		}
+	}
+	checkFields(t, path, FieldValues{FieldArtist: "An artist", FieldKey: "8A", FieldLabel: "A label"})
+	if meta, err := ReadMetadata(path); err != nil || meta.Duration != 5 {
+		t.Errorf("metadata %+v, %v after writing, want a 5 s duration", meta, err)
+	}
+}
@@ -0,0 +1,327 @@
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// oggContinued flags pages that start with the rest of a packet
+const oggContinued = 0x01
+
+// oggPage is the header of an Ogg page
+type oggPage struct {
+	flags    byte
+	granule  uint64
+	serial   uint32
+	sequence uint32
+	segments []byte
+}
+
+// readOggPage reads a page header and returns the page with its data
+func readOggPage(r *bufio.Reader) (oggPage, []byte, error) {
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return oggPage{}, nil, err
+	}
+	if string(header[:4]) != "OggS" {
+		return oggPage{}, nil, errors.New("invalid Ogg page")
+	}
+	page := oggPage{
+		flags:    header[5],
+		granule:  binary.LittleEndian.Uint64(header[6:14]),
+		serial:   binary.LittleEndian.Uint32(header[14:18]),
+		sequence: binary.LittleEndian.Uint32(header[18:22]),
+		segments: make([]byte, header[26]),
+	}
+	if _, err := io.ReadFull(r, page.segments); err != nil {
+		return oggPage{}, nil, err
+	}
+	size := 0
+	for _, segment := range page.segments {
+		size += int(segment)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return oggPage{}, nil, err
+	}
+	return page, data, nil
+}
+
+// encode serializes the page with the given data and a fresh checksum
+func (p oggPage) encode(data []byte) []byte {
+	out := make([]byte, 27, 27+len(p.segments)+len(data))
+	copy(out, "OggS")
+	out[5] = p.flags
+	binary.LittleEndian.PutUint64(out[6:14], p.granule)
+	binary.LittleEndian.PutUint32(out[14:18], p.serial)
+	binary.LittleEndian.PutUint32(out[18:22], p.sequence)
+	out[26] = byte(len(p.segments))
+	out = append(out, p.segments...)
+	out = append(out, data...)
+	binary.LittleEndian.PutUint32(out[22:26], oggChecksum(out))
+	return out
+}
+
+// oggCRCTable is the table of the CRC-32 variant Ogg uses: polynomial
+// 0x04c11db7, not reflected, starting at 0
+var oggCRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 24
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func oggChecksum(page []byte) uint32 {
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// oggReader returns the packets of the first logical stream of an Ogg file.
+// Packets end with a segment shorter than 255 bytes.
+type oggReader struct {
+	r       *bufio.Reader
+	serial  uint32
+	started bool
+	page    oggPage
+	pending [][]byte
+	partial []byte
+}
+
+// next returns the next packet
+func (o *oggReader) next() ([]byte, error) {
+	for len(o.pending) == 0 {
+		page, data, err := readOggPage(o.r)
+		if err != nil {
+			return nil, err
+		}
+		if !o.started {
+			o.serial, o.started = page.serial, true
+		}
+		if page.serial != o.serial {
+			continue
+		}
+		o.page = page
+		for _, segment := range page.segments {
+			o.partial = append(o.partial, data[:segment]...)
+			data = data[segment:]
+			if segment < 255 {
+				o.pending = append(o.pending, o.partial)
+				o.partial = nil
+			}
+		}
+	}
+	packet := o.pending[0]
+	o.pending = o.pending[1:]
+	return packet, nil
+}
+
+// pageDone reports whether the last returned packet ended its page
+func (o *oggReader) pageDone() bool {
+	return len(o.pending) == 0 && o.partial == nil
+}
+
+// oggCodec tells the codec from the identification header. It returns the
+// number of header packets, the prefix of the comment header and the sample
+// rate granule positions count in.
+func oggCodec(ident []byte) (int, string, uint64, error) {
+	switch {
+	case len(ident) >= 16 && bytes.HasPrefix(ident, []byte("\x01vorbis")):
+		return 3, "\x03vorbis", uint64(binary.LittleEndian.Uint32(ident[12:16])), nil
+	case len(ident) >= 12 && bytes.HasPrefix(ident, []byte("OpusHead")):
+		// Opus granule positions always count 48 kHz samples
+		return 2, "OpusTags", 48000, nil
+	default:
+		return 0, "", 0, ErrUnsupported
+	}
+}
+
+// readOgg reads the comment header and duration of an Ogg Vorbis or Opus
+// file. Only the first logical stream is read.
+func readOgg(path string) (*VorbisComment, float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	o := &oggReader{r: bufio.NewReader(file)}
+	ident, err := o.next()
+	if err != nil {
+		return nil, 0, err
+	}
+	comments, err := o.next()
+	if err != nil {
+		return nil, 0, err
+	}
+	_, prefix, rate, err := oggCodec(ident)
+	if err != nil || !bytes.HasPrefix(comments, []byte(prefix)) {
+		return nil, 0, ErrUnsupported
+	}
+	var preSkip uint64
+	if prefix == "OpusTags" {
+		preSkip = uint64(binary.LittleEndian.Uint16(ident[10:12]))
+	}
+
+	var duration float64
+	if granule, err := lastOggGranule(file, o.serial); err == nil && rate > 0 && granule > preSkip {
+		duration = float64(granule-preSkip) / float64(rate)
+	}
+	comment, err := parseVorbisComment(comments[len(prefix):])
+	if err != nil {
+		return nil, duration, ErrNoTag
+	}
+	return comment, duration, nil
+}
+
+// lastOggGranule finds the granule position of the last page of the stream,
+// which counts the samples of the whole stream
+func lastOggGranule(file *os.File, serial uint32) (uint64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := min(info.Size(), 64*1024)
+	tail := make([]byte, size)
+	if _, err := file.ReadAt(tail, info.Size()-size); err != nil && err != io.EOF {
+		return 0, err
+	}
+	for i := len(tail) - 27; i >= 0; i-- {
+		if string(tail[i:i+4]) != "OggS" || binary.LittleEndian.Uint32(tail[i+14:]) != serial {
+			continue
+		}
+		if granule := binary.LittleEndian.Uint64(tail[i+6:]); granule != ^uint64(0) {
+			return granule, nil
+		}
+	}
+	return 0, errors.New("no Ogg page found")
+}
+
+// WriteOggComment replaces the comment header of an Ogg Vorbis or Opus file.
+// The header packets are paged anew and the sequence numbers of the pages
+// that follow are shifted to match.
+func WriteOggComment(path string, comment *VorbisComment) error {
+	return replaceFile(path, func(w io.Writer, old *os.File) error {
+		o := &oggReader{r: bufio.NewReader(old)}
+		ident, err := o.next()
+		if err != nil {
+			return err
+		}
+		if !o.pageDone() {
+			return errors.New("invalid Ogg identification page")
+		}
+		first := o.page
+		count, prefix, _, err := oggCodec(ident)
+		if err != nil {
+			return err
+		}
+		comments, err := o.next()
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(comments, []byte(prefix)) {
+			return errors.New("missing Ogg comment header")
+		}
+		headers := [][]byte{append([]byte(prefix), comment.Bytes()...)}
+		if prefix == "\x03vorbis" {
+			// The Vorbis comment header ends with a framing bit
+			headers[0] = append(headers[0], 1)
+		}
+		// Vorbis has a setup header after the comments
+		for len(headers) < count-1 {
+			packet, err := o.next()
+			if err != nil {
+				return err
+			}
+			headers = append(headers, packet)
+		}
+		if !o.pageDone() {
+			// Audio never shares a page with the headers in valid files
+			return ErrUnsupported
+		}
+
+		first.segments = lacing(len(ident))
+		if _, err := w.Write(first.encode(ident)); err != nil {
+			return err
+		}
+		sequence := first.sequence + 1
+		for _, page := range paginate(first.serial, &sequence, headers) {
+			if _, err := w.Write(page); err != nil {
+				return err
+			}
+		}
+
+		// Renumber the remaining pages of the stream
+		shift := sequence - (o.page.sequence + 1)
+		for {
+			page, data, err := readOggPage(o.r)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if page.serial == first.serial {
+				page.sequence += shift
+			}
+			if _, err := w.Write(page.encode(data)); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// lacing returns the segment table for a packet of the given size
+func lacing(size int) []byte {
+	segments := bytes.Repeat([]byte{255}, size/255)
+	return append(segments, byte(size%255))
+}
+
+// paginate lays out header packets on pages of at most 255 segments, with
+// a granule position of 0 on pages where a packet ends
+func paginate(serial uint32, sequence *uint32, packets [][]byte) [][]byte {
+	var pages [][]byte
+	page := oggPage{serial: serial, granule: ^uint64(0)}
+	var data []byte
+	flush := func() {
+		page.sequence = *sequence
+		*sequence++
+		pages = append(pages, page.encode(data))
+		page = oggPage{serial: serial, granule: ^uint64(0)}
+		data = nil
+	}
+	for _, packet := range packets {
+		rest := packet
+		for i, segment := range lacing(len(packet)) {
+			if len(page.segments) == 255 {
+				flush()
+				if i > 0 {
+					page.flags = oggContinued
+				}
+			}
+			page.segments = append(page.segments, segment)
+			data = append(data, rest[:segment]...)
+			rest = rest[segment:]
+		}
+		page.granule = 0
+	}
+	if len(page.segments) > 0 {
+		flush()
+	}
+	return pages
+}
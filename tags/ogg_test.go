@@ -0,0 +1,98 @@
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testOggVorbis builds an Ogg Vorbis stream with the three header packets and
+// two audio pages holding the given packets
+func testOggVorbis(audio [][]byte) []byte {
+	ident := append([]byte("\x01vorbis"), 0, 0, 0, 0, 2)
+	ident = binary.LittleEndian.AppendUint32(ident, 44100)
+	ident = append(ident, make([]byte, 12)...)
+	ident = append(ident, 0xb8, 1)
+	comment := append([]byte("\x03vorbis"), (&VorbisComment{Vendor: "test"}).Bytes()...)
+	comment = append(comment, 1)
+	setup := append([]byte("\x05vorbis"), testPayload(300)...)
+
+	const serial = 0x1234
+	first := oggPage{flags: 0x02, serial: serial, segments: lacing(len(ident))}
+	out := first.encode(ident)
+	sequence := uint32(1)
+	for _, page := range paginate(serial, &sequence, [][]byte{comment, setup}) {
+		out = append(out, page...)
+	}
+	for i, packet := range audio {
+		page := oggPage{serial: serial, sequence: sequence, granule: uint64(i+1) * 22050, segments: lacing(len(packet))}
+		if i == len(audio)-1 {
+			page.flags = 0x04
+		}
+		out = append(out, page.encode(packet)...)
+		sequence++
+	}
+	return out
+}
+
+func TestOggCommentRoundTrip(t *testing.T) {
+	audio := [][]byte{testPayload(700), testPayload(1200)[500:]}
+	path := writeTestFile(t, "track.ogg", testOggVorbis(audio))
+
+	// The long comment spreads the headers over more pages, which moves the
+	// sequence numbers of the audio pages
+	for _, values := range []FieldValues{
+		{FieldTitle: "A title", FieldBPM: "128.5", FieldRating: "102"},
+		{FieldTitle: "Short", FieldComment: strings.Repeat("x", 70000)},
+	} {
+		if err := WriteFields(path, values); err != nil {
+			t.Fatalf("WriteFields: %v", err)
+		}
+		checkFields(t, path, values)
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := bufio.NewReader(bytes.NewReader(data))
+		var rebuilt []byte
+		var audioPages [][]byte
+		for sequence := uint32(0); ; sequence++ {
+			page, pageData, err := readOggPage(reader)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("readOggPage: %v", err)
+			}
+			if page.sequence != sequence {
+				t.Errorf("page %d has sequence number %d", sequence, page.sequence)
+			}
+			if page.granule != ^uint64(0) && page.granule > 0 {
+				audioPages = append(audioPages, pageData)
+			}
+			rebuilt = append(rebuilt, page.encode(pageData)...)
+		}
+		// Encoding the pages again gives the same bytes only with valid checksums
+		if !bytes.Equal(rebuilt, data) {
+			t.Error("the pages do not carry valid checksums")
+		}
+		if len(audioPages) != len(audio) {
+			t.Fatalf("found %d audio pages, want %d", len(audioPages), len(audio))
+		}
+		for i := range audio {
+			if !bytes.Equal(audioPages[i], audio[i]) {
+				t.Errorf("audio page %d changed", i)
+			}
+		}
+	}
+
+	if _, duration, err := readOgg(path); err != nil || math.Abs(duration-1) > 1e-9 {
+		t.Errorf("duration %.3f, %v after writing, want 1 s", duration, err)
+	}
+}
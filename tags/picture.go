@@ -0,0 +1,190 @@
+package tags
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+// pictureFrontCover is the picture type of front covers in APIC frames and
+// FLAC PICTURE blocks
+const pictureFrontCover = 3
+
+// Picture is an image embedded in a tag
+type Picture struct {
+	MimeType string
+	Data     []byte
+}
+
+// ReadPicture returns the embedded cover of an audio file, preferring front
+// covers when a file has several pictures. Files without one return ErrNoTag.
+func ReadPicture(path string) (*Picture, error) {
+	var found []typedPicture
+	add := func(picture *Picture, kind int, ok bool) {
+		if ok {
+			found = append(found, typedPicture{picture, kind})
+		}
+	}
+	switch kind := detectKind(path); kind {
+	case kindMP3, kindAIFF, kindWAV:
+		tag, err := ReadID3File(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, frame := range tag.FramesByID("APIC") {
+			add(parseAPIC(frame.Data))
+		}
+	case kindFLAC:
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		blocks, _, err := readFLACBlocks(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, block := range blocks {
+			if block.kind == flacPicture {
+				add(parseFLACPicture(block.data))
+			}
+		}
+	case kindOGG:
+		comment, _, err := readOgg(path)
+		if err != nil {
+			return nil, err
+		}
+		// Ogg files carry FLAC picture blocks in base64
+		for _, value := range comment.GetAll("METADATA_BLOCK_PICTURE") {
+			if data, err := base64.StdEncoding.DecodeString(value); err == nil {
+				add(parseFLACPicture(data))
+			}
+		}
+	case kindMP4:
+		return readMP4Picture(path)
+	default:
+		return nil, ErrUnsupported
+	}
+
+	for _, candidate := range found {
+		if candidate.kind == pictureFrontCover {
+			return candidate.picture, nil
+		}
+	}
+	if len(found) == 0 {
+		return nil, ErrNoTag
+	}
+	return found[0].picture, nil
+}
+
+// typedPicture is a picture with its APIC or FLAC picture type
+type typedPicture struct {
+	picture *Picture
+	kind    int
+}
+
+// parseAPIC decodes an APIC frame: text encoding, MIME type, picture type,
+// description and the image data
+func parseAPIC(data []byte) (*Picture, int, bool) {
+	if len(data) < 4 {
+		return nil, 0, false
+	}
+	encoding := data[0]
+	mime, rest := splitText(encodingLatin1, data[1:])
+	if len(rest) < 2 {
+		return nil, 0, false
+	}
+	kind := int(rest[0])
+	_, rest = splitText(encoding, rest[1:])
+	if len(rest) == 0 {
+		return nil, 0, false
+	}
+	return &Picture{MimeType: mime, Data: rest}, kind, true
+}
+
+// parseFLACPicture decodes a FLAC PICTURE block. All numbers are big endian.
+func parseFLACPicture(data []byte) (*Picture, int, bool) {
+	next := func(n int) ([]byte, bool) {
+		if n < 0 || len(data) < n {
+			return nil, false
+		}
+		value := data[:n]
+		data = data[n:]
+		return value, true
+	}
+	number := func() (int, bool) {
+		value, ok := next(4)
+		if !ok {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint32(value)), true
+	}
+
+	kind, ok := number()
+	mimeLength, ok2 := number()
+	if !ok || !ok2 {
+		return nil, 0, false
+	}
+	mime, ok := next(mimeLength)
+	if !ok {
+		return nil, 0, false
+	}
+	descriptionLength, ok := number()
+	if !ok {
+		return nil, 0, false
+	}
+	// Description, then width, height, depth and palette size
+	if _, ok := next(descriptionLength + 16); !ok {
+		return nil, 0, false
+	}
+	size, ok := number()
+	if !ok {
+		return nil, 0, false
+	}
+	image, ok := next(size)
+	if !ok || size == 0 {
+		return nil, 0, false
+	}
+	return &Picture{MimeType: string(mime), Data: image}, kind, true
+}
+
+// readMP4Picture reads the first image of the covr item
+func readMP4Picture(path string) (*Picture, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	top, err := readMP4Atoms(file, 0, info.Size())
+	if len(top) == 0 {
+		if err == nil {
+			err = ErrUnsupported
+		}
+		return nil, err
+	}
+	covr, ok := findMP4Atom(file, top, "moov", "udta", "meta", "ilst", "covr")
+	if !ok {
+		return nil, ErrNoTag
+	}
+	children, _ := readMP4Atoms(file, covr.offset, covr.offset+covr.size)
+	for _, child := range children {
+		if child.kind != "data" || child.size <= 8 {
+			continue
+		}
+		data := make([]byte, child.size)
+		if _, err := file.ReadAt(data, child.offset); err != nil {
+			return nil, err
+		}
+		mime := "image/jpeg"
+		if binary.BigEndian.Uint32(data[:4])&0xffffff == mp4TypePNG {
+			mime = "image/png"
+		}
+		return &Picture{MimeType: mime, Data: data[8:]}, nil
+	}
+	return nil, errors.New("empty MP4 cover")
+}
@@ -0,0 +1,241 @@
+package tagsync
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/tags"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// Direction tells which side of a sync is changed
+type Direction int
+
+const (
+	// ToFiles writes the collection's values into the file tags
+	ToFiles Direction = iota
+	// ToCollection fills empty collection fields from the file tags
+	ToCollection
+)
+
+// Options controls which fields are compared
+type Options struct {
+	// Fields are the fields to sync, all of tags.AllFields when empty
+	Fields []tags.Field
+	// Direction selects whether files or the collection are changed
+	Direction Direction
+	// Notation is the key notation written to tags
+	Notation traktor.KeyNotation
+}
+
+// Change is a field that differs between a track and its file
+type Change struct {
+	Track *traktor.Track
+	Field tags.Field
+	Old   string
+	New   string
+}
+
+// Plan holds the changes a sync would make. Building a plan only reads files,
+// so it doubles as the dry run.
+type Plan struct {
+	Direction Direction
+	Changes   []Change
+	// Failed maps files whose tags could not be read to the error
+	Failed map[string]error
+}
+
+// NewPlan compares the tracks with the tags of their files. When writing to
+// files, empty collection fields never clear a tag. When filling the
+// collection, only empty collection fields are changed.
+func NewPlan(tracks []*traktor.Track, opts Options) *Plan {
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = tags.AllFields
+	}
+	plan := &Plan{Direction: opts.Direction, Failed: make(map[string]error)}
+	seen := make(map[*traktor.Track]bool)
+	for _, track := range tracks {
+		if seen[track] {
+			continue
+		}
+		seen[track] = true
+		if !tags.IsAudioFile(track.FilePath) {
+			continue
+		}
+		values, err := tags.ReadFields(track.FilePath)
+		if err != nil {
+			plan.Failed[track.FilePath] = err
+			continue
+		}
+		for _, field := range fields {
+			trackValue := TrackValue(track, field, opts.Notation)
+			tagValue := values[field]
+			if sameValue(field, trackValue, tagValue) {
+				continue
+			}
+			switch {
+			case opts.Direction == ToFiles && trackValue != "":
+				plan.Changes = append(plan.Changes, Change{Track: track, Field: field, Old: tagValue, New: trackValue})
+			case opts.Direction == ToCollection && trackValue == "" && tagValue != "":
+				plan.Changes = append(plan.Changes, Change{Track: track, Field: field, Old: trackValue, New: tagValue})
+			}
+		}
+	}
+	return plan
+}
+
+// Diff lists the changes per file for review before applying them
+func (p *Plan) Diff() string {
+	var b strings.Builder
+	var last *traktor.Track
+	for _, change := range p.Changes {
+		if change.Track != last {
+			last = change.Track
+			b.WriteString(change.Track.FilePath + "\n")
+		}
+		fmt.Fprintf(&b, "  %-8s %q -> %q\n", change.Field+":", change.Old, change.New)
+	}
+	paths := make([]string, 0, len(p.Failed))
+	for path := range p.Failed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s\n  not readable: %v\n", path, p.Failed[path])
+	}
+	return b.String()
+}
+
+// Files returns the number of files with changes
+func (p *Plan) Files() int {
+	files := make(map[*traktor.Track]bool)
+	for _, change := range p.Changes {
+		files[change.Track] = true
+	}
+	return len(files)
+}
+
+// Apply makes the planned changes. Tags are written file by file, failures
+// are returned per file. Collection fields are updated in memory and in the
+// collection's entries; saving the collection is left to the caller.
+func (p *Plan) Apply(collection *traktor.TraktorCollection) map[string]error {
+	failed := make(map[string]error)
+	var order []*traktor.Track
+	byTrack := make(map[*traktor.Track]tags.FieldValues)
+	for _, change := range p.Changes {
+		if _, exists := byTrack[change.Track]; !exists {
+			order = append(order, change.Track)
+			byTrack[change.Track] = make(tags.FieldValues)
+		}
+		byTrack[change.Track][change.Field] = change.New
+	}
+
+	for _, track := range order {
+		values := byTrack[track]
+		if p.Direction == ToFiles {
+			if err := tags.WriteFields(track.FilePath, values); err != nil {
+				failed[track.FilePath] = err
+			}
+			continue
+		}
+		for field, value := range values {
+			SetTrackValue(track, field, value)
+		}
+		if collection != nil {
+			if err := collection.UpdateTrack(track); err != nil {
+				failed[track.FilePath] = err
+			}
+		}
+	}
+	return failed
+}
+
+// TrackValue returns a track field formatted as it is written to tags
+func TrackValue(track *traktor.Track, field tags.Field, notation traktor.KeyNotation) string {
+	switch field {
+	case tags.FieldArtist:
+		return track.Artist
+	case tags.FieldTitle:
+		return track.Title
+	case tags.FieldAlbum:
+		return track.Album
+	case tags.FieldGenre:
+		return track.Genre
+	case tags.FieldLabel:
+		return track.Label
+	case tags.FieldComment:
+		return track.Comment
+	case tags.FieldRemixer:
+		return track.Remixer
+	case tags.FieldRating:
+		if track.Rating > 0 {
+			return strconv.Itoa(track.Rating)
+		}
+	case tags.FieldBPM:
+		if track.BPM > 0 {
+			return strconv.FormatFloat(math.Round(track.BPM*100)/100, 'f', -1, 64)
+		}
+	case tags.FieldKey:
+		if value, ok := traktor.TrackKeyValue(track); ok {
+			return traktor.KeyValueToNotation(value, notation)
+		}
+		return track.Key
+	}
+	return ""
+}
+
+// SetTrackValue sets a track field from a tag value
+func SetTrackValue(track *traktor.Track, field tags.Field, value string) {
+	switch field {
+	case tags.FieldArtist:
+		track.Artist = value
+	case tags.FieldTitle:
+		track.Title = value
+	case tags.FieldAlbum:
+		track.Album = value
+	case tags.FieldGenre:
+		track.Genre = value
+	case tags.FieldLabel:
+		track.Label = value
+	case tags.FieldComment:
+		track.Comment = value
+	case tags.FieldRemixer:
+		track.Remixer = value
+	case tags.FieldRating:
+		if rating, err := strconv.Atoi(value); err == nil {
+			track.Rating = max(0, min(rating, 255))
+		}
+	case tags.FieldBPM:
+		if bpm, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64); err == nil && bpm > 0 {
+			track.BPM = bpm
+		}
+	case tags.FieldKey:
+		track.Key = value
+		if key, ok := traktor.ParseKey(value); ok {
+			track.MusicalKey = key
+		}
+	}
+}
+
+// sameValue compares a collection and a tag value. Tempos match when the tag
+// holds the tempo rounded to a whole number, as ID3 and MP4 tags often do.
+// Keys are compared as text, so tags in another notation are rewritten.
+func sameValue(field tags.Field, trackValue, tagValue string) bool {
+	if trackValue == tagValue {
+		return true
+	}
+	switch field {
+	case tags.FieldBPM, tags.FieldRating:
+		a, errA := strconv.ParseFloat(trackValue, 64)
+		b, errB := strconv.ParseFloat(strings.ReplaceAll(tagValue, ",", "."), 64)
+		if errA != nil || errB != nil {
+			return false
+		}
+		return math.Abs(a-b) < 0.01 || (b == math.Trunc(b) && math.Round(a) == b)
+	}
+	return strings.TrimSpace(trackValue) == strings.TrimSpace(tagValue)
+}
@@ -0,0 +1,135 @@
+package trackdump
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// Column is a track field that can be dumped
+type Column struct {
+	Name        string
+	Description string
+	value       func(track *traktor.Track) any
+}
+
+// Cue is a cue point as written into dumps. Start and length are in
+// milliseconds, hot cues are numbered from 1 and 0 means none.
+type Cue struct {
+	Name   string  `json:"name"`
+	Type   string  `json:"type"`
+	Start  float64 `json:"start"`
+	Length float64 `json:"length,omitempty"`
+	HotCue int     `json:"hotcue,omitempty"`
+	BPM    float64 `json:"bpm,omitempty"`
+}
+
+// Columns lists all columns in the order of the Track fields
+var Columns = []Column{
+	{"artist", "Artist", func(t *traktor.Track) any { return t.Artist }},
+	{"title", "Title", func(t *traktor.Track) any { return t.Title }},
+	{"album", "Album", func(t *traktor.Track) any { return t.Album }},
+	{"genre", "Genre", func(t *traktor.Track) any { return t.Genre }},
+	{"label", "Label", func(t *traktor.Track) any { return t.Label }},
+	{"comment", "Comment", func(t *traktor.Track) any { return t.Comment }},
+	{"remixer", "Remixer", func(t *traktor.Track) any { return t.Remixer }},
+	{"producer", "Producer", func(t *traktor.Track) any { return t.Producer }},
+	{"bpm", "Tempo in beats per minute", func(t *traktor.Track) any { return t.BPM }},
+	{"bpm_quality", "Confidence of the tempo detection", func(t *traktor.Track) any { return t.BPMQuality }},
+	{"key", "Key text as stored in the library", func(t *traktor.Track) any { return t.Key }},
+	{"key_value", "Key number as stored in the library, -1 for none", func(t *traktor.Track) any { return t.MusicalKey }},
+	{"musical_key", "Decoded key as note name", keyColumn(traktor.NotationMusical)},
+	{"open_key", "Decoded key in Open Key notation", keyColumn(traktor.NotationOpenKey)},
+	{"camelot", "Decoded key in Camelot notation", keyColumn(traktor.NotationCamelot)},
+	{"rating", "Rating from 0 to 255", func(t *traktor.Track) any { return t.Rating }},
+	{"stars", "Rating in stars from 0 to 5", func(t *traktor.Track) any { return traktor.RatingToStars(t.Rating) }},
+	{"play_count", "Play count", func(t *traktor.Track) any { return t.PlayCount }},
+	{"duration", "Duration as m:ss", func(t *traktor.Track) any { return traktor.FormatDuration(t.Duration) }},
+	{"duration_seconds", "Duration in seconds", func(t *traktor.Track) any { return t.Duration }},
+	{"bitrate", "Bitrate in bits per second", func(t *traktor.Track) any { return t.Bitrate }},
+	{"file_size", "File size in bytes", func(t *traktor.Track) any { return t.FileSize }},
+	{"file_path", "File path", func(t *traktor.Track) any { return t.FilePath }},
+	{"file_name", "File name", func(t *traktor.Track) any { return t.FileName }},
+	{"volume", "Volume", func(t *traktor.Track) any { return t.Volume }},
+	{"import_date", "Import date", func(t *traktor.Track) any { return t.ImportDate }},
+	{"last_played", "Last played date", func(t *traktor.Track) any { return t.LastPlayed }},
+	{"release_date", "Release date", func(t *traktor.Track) any { return t.ReleaseDate }},
+	{"peak_db", "Peak level in dB", func(t *traktor.Track) any { return t.PeakDb }},
+	{"perceived_db", "Perceived loudness in dB", func(t *traktor.Track) any { return t.PerceivedDb }},
+	{"cover_art_id", "Traktor cover art cache ID", func(t *traktor.Track) any { return t.CoverArtID }},
+	{"cue_points", "Cue points, grid markers and loops", cueColumn},
+	{"primary_key", "Library key of the track", func(t *traktor.Track) any { return t.PrimaryKey }},
+}
+
+// DefaultColumns are the columns used when none are chosen
+var DefaultColumns = []string{"artist", "title", "album", "genre", "bpm", "musical_key", "duration", "stars", "file_path"}
+
+// ColumnNames returns the names of all columns
+func ColumnNames() []string {
+	names := make([]string, len(Columns))
+	for i, column := range Columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+// ParseColumns looks up columns by name. Names are case insensitive and may
+// be given as one comma separated list.
+func ParseColumns(names []string) ([]Column, error) {
+	var columns []Column
+	for _, list := range names {
+		for _, name := range strings.Split(list, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			column, ok := lookupColumn(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown column %q", name)
+			}
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns selected")
+	}
+	return columns, nil
+}
+
+func lookupColumn(name string) (Column, bool) {
+	for _, column := range Columns {
+		if column.Name == name {
+			return column, true
+		}
+	}
+	return Column{}, false
+}
+
+// keyColumn decodes the key of a track into the given notation
+func keyColumn(notation traktor.KeyNotation) func(t *traktor.Track) any {
+	return func(t *traktor.Track) any {
+		if value, ok := traktor.TrackKeyValue(t); ok {
+			return traktor.KeyValueToNotation(value, notation)
+		}
+		return ""
+	}
+}
+
+func cueColumn(t *traktor.Track) any {
+	cues := make([]Cue, 0, len(t.CuePoints))
+	for _, point := range t.CuePoints {
+		cue := Cue{
+			Name:   point.Name,
+			Type:   traktor.CuePointTypeToString(point.Type),
+			Start:  point.Start,
+			Length: point.Len,
+			HotCue: point.HotCue + 1,
+		}
+		if point.Grid != nil {
+			cue.BPM = point.Grid.Bpm
+		}
+		cues = append(cues, cue)
+	}
+	return cues
+}
@@ -0,0 +1,222 @@
+package trackdump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// Format is a dump output format
+type Format string
+
+const (
+	FormatCSV       Format = "csv"
+	FormatJSONLines Format = "jsonl"
+	FormatYAML      Format = "yaml"
+)
+
+// Formats lists all supported formats in display order
+var Formats = []Format{FormatCSV, FormatJSONLines, FormatYAML}
+
+// Extension returns the file extension for the format, including the dot
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+// Writer writes tracks one at a time so large collections are never held in
+// memory as a whole. Close flushes the output.
+type Writer struct {
+	out     *bufio.Writer
+	csv     *csv.Writer
+	format  Format
+	columns []Column
+}
+
+// NewWriter starts a dump. CSV dumps begin with a header row.
+func NewWriter(w io.Writer, format Format, columns []Column) (*Writer, error) {
+	writer := &Writer{out: bufio.NewWriter(w), format: format, columns: columns}
+	switch format {
+	case FormatCSV:
+		writer.csv = csv.NewWriter(writer.out)
+		header := make([]string, len(columns))
+		for i, column := range columns {
+			header[i] = column.Name
+		}
+		if err := writer.csv.Write(header); err != nil {
+			return nil, err
+		}
+	case FormatJSONLines, FormatYAML:
+	default:
+		return nil, fmt.Errorf("unknown dump format %q", format)
+	}
+	return writer, nil
+}
+
+// Write writes a single track
+func (w *Writer) Write(track *traktor.Track) error {
+	switch w.format {
+	case FormatCSV:
+		record := make([]string, len(w.columns))
+		for i, column := range w.columns {
+			record[i] = csvValue(column.value(track))
+		}
+		return w.csv.Write(record)
+	case FormatJSONLines:
+		return w.writeJSONLine(track)
+	default:
+		return w.writeYAML(track)
+	}
+}
+
+// Close flushes everything written so far
+func (w *Writer) Close() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return w.out.Flush()
+}
+
+// WriteTracks dumps a list of tracks
+func WriteTracks(w io.Writer, format Format, columns []Column, tracks []*traktor.Track) error {
+	writer, err := NewWriter(w, format, columns)
+	if err != nil {
+		return err
+	}
+	for _, track := range tracks {
+		if err := writer.Write(track); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// WriteCollection dumps all tracks of a collection
+func WriteCollection(w io.Writer, format Format, columns []Column, collection *traktor.TraktorCollection) error {
+	writer, err := NewWriter(w, format, columns)
+	if err != nil {
+		return err
+	}
+	for i := range collection.Tracks {
+		if err := writer.Write(&collection.Tracks[i]); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// writeJSONLine writes the track as one JSON object with the columns in order
+func (w *Writer) writeJSONLine(track *traktor.Track) error {
+	w.out.WriteByte('{')
+	for i, column := range w.columns {
+		if i > 0 {
+			w.out.WriteByte(',')
+		}
+		name, _ := marshal(column.Name)
+		value, err := marshal(column.value(track))
+		if err != nil {
+			return err
+		}
+		w.out.Write(name)
+		w.out.WriteByte(':')
+		w.out.Write(value)
+	}
+	_, err := w.out.WriteString("}\n")
+	return err
+}
+
+// writeYAML writes the track as one item of a top level sequence. Strings
+// are double quoted, which YAML reads with the same escapes as JSON.
+func (w *Writer) writeYAML(track *traktor.Track) error {
+	for i, column := range w.columns {
+		prefix := "  "
+		if i == 0 {
+			prefix = "- "
+		}
+		w.out.WriteString(prefix + column.Name + ":")
+		switch value := column.value(track).(type) {
+		case []Cue:
+			if len(value) == 0 {
+				w.out.WriteString(" []\n")
+				continue
+			}
+			w.out.WriteByte('\n')
+			for _, cue := range value {
+				if err := writeYAMLCue(w.out, cue); err != nil {
+					return err
+				}
+			}
+		default:
+			text, err := marshal(value)
+			if err != nil {
+				return err
+			}
+			w.out.WriteByte(' ')
+			w.out.Write(text)
+			w.out.WriteByte('\n')
+		}
+	}
+	return nil
+}
+
+// writeYAMLCue writes a cue point as a mapping nested below a track
+func writeYAMLCue(out *bufio.Writer, cue Cue) error {
+	name, err := marshal(cue.Name)
+	if err != nil {
+		return err
+	}
+	typeName, _ := marshal(cue.Type)
+	fmt.Fprintf(out, "    - name: %s\n      type: %s\n      start: %s\n", name, typeName, formatFloat(cue.Start))
+	if cue.Length != 0 {
+		fmt.Fprintf(out, "      length: %s\n", formatFloat(cue.Length))
+	}
+	if cue.HotCue != 0 {
+		fmt.Fprintf(out, "      hotcue: %d\n", cue.HotCue)
+	}
+	if cue.BPM != 0 {
+		fmt.Fprintf(out, "      bpm: %s\n", formatFloat(cue.BPM))
+	}
+	return nil
+}
+
+// csvValue formats a column value as a CSV cell. Cue points are written as a
+// JSON array so scripts can still read them from a single cell.
+func csvValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return formatFloat(v)
+	default:
+		text, err := marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(text)
+	}
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// marshal encodes a value as JSON without escaping HTML characters
+func marshal(value any) ([]byte, error) {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
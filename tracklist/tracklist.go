@@ -0,0 +1,240 @@
+package tracklist
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// Format is a tracklist output format
+type Format string
+
+const (
+	FormatText           Format = "text"
+	FormatYouTube        Format = "youtube"
+	FormatMixcloud       Format = "mixcloud"
+	Format1001Tracklists Format = "1001tracklists"
+	FormatJSON           Format = "json"
+)
+
+// Formats lists all supported formats in display order
+var Formats = []Format{FormatText, FormatYouTube, FormatMixcloud, Format1001Tracklists, FormatJSON}
+
+// ErrNoTimestamps is returned for playlists that carry no history play times
+var ErrNoTimestamps = errors.New("playlist has no play timestamps")
+
+// Options controls how each track line is formatted
+type Options struct {
+	// Separator is placed between artist and title, defaults to " - "
+	Separator string
+	// Remixer appends the remixer using RemixerFormat when set
+	Remixer bool
+	// RemixerFormat is a fmt format for the remixer, defaults to " (%s Remix)"
+	RemixerFormat string
+	// Label appends the label using LabelFormat when set
+	Label bool
+	// LabelFormat is a fmt format for the label, defaults to " [%s]"
+	LabelFormat string
+	// IncludePrivate keeps tracks that were only played in the headphones
+	IncludePrivate bool
+}
+
+// Entry is a single track in a tracklist
+type Entry struct {
+	Offset  time.Duration
+	Artist  string
+	Title   string
+	Remixer string
+	Label   string
+}
+
+// Build creates the tracklist entries of a history playlist. Offsets are relative
+// to the first played track.
+func Build(playlist *traktor.Playlist, opts Options) ([]Entry, error) {
+	if len(playlist.History) == 0 {
+		return nil, ErrNoTimestamps
+	}
+
+	history := make([]traktor.HistoryEntry, 0, len(playlist.History))
+	for _, h := range playlist.History {
+		if h.Track == nil || h.StartTime.IsZero() {
+			continue
+		}
+		if !h.Public && !opts.IncludePrivate {
+			continue
+		}
+		history = append(history, h)
+	}
+	if len(history) == 0 {
+		return nil, ErrNoTimestamps
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].StartTime.Before(history[j].StartTime)
+	})
+
+	start := history[0].StartTime
+	entries := make([]Entry, len(history))
+	for i, h := range history {
+		entries[i] = Entry{
+			Offset:  h.StartTime.Sub(start),
+			Artist:  h.Track.Artist,
+			Title:   h.Track.Title,
+			Remixer: h.Track.Remixer,
+			Label:   h.Track.Label,
+		}
+	}
+	return entries, nil
+}
+
+// Write formats the entries in the given format
+func Write(w io.Writer, format Format, entries []Entry, opts Options) error {
+	switch format {
+	case FormatText:
+		return writeLines(w, entries, func(e Entry) string {
+			return formatMinutes(e.Offset) + " " + formatTrack(e, opts)
+		})
+	case FormatYouTube:
+		return writeYouTube(w, entries, opts)
+	case FormatMixcloud:
+		return writeMixcloud(w, entries, opts)
+	case Format1001Tracklists:
+		return writeLines(w, entries, func(e Entry) string {
+			return "[" + formatMinutes(e.Offset) + "] " + formatTrack(e, opts)
+		})
+	case FormatJSON:
+		return writeJSON(w, entries)
+	default:
+		return fmt.Errorf("unknown tracklist format %q", format)
+	}
+}
+
+// String formats the entries in the given format and returns the result
+func String(format Format, entries []Entry, opts Options) (string, error) {
+	var b strings.Builder
+	if err := Write(&b, format, entries, opts); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// formatTrack formats artist, title and the optional remixer and label
+func formatTrack(e Entry, opts Options) string {
+	separator := opts.Separator
+	if separator == "" {
+		separator = " - "
+	}
+	line := e.Title
+	if e.Artist != "" {
+		line = e.Artist + separator + e.Title
+	}
+	if opts.Remixer && e.Remixer != "" {
+		format := opts.RemixerFormat
+		if format == "" {
+			format = " (%s Remix)"
+		}
+		line += fmt.Sprintf(format, e.Remixer)
+	}
+	if opts.Label && e.Label != "" {
+		format := opts.LabelFormat
+		if format == "" {
+			format = " [%s]"
+		}
+		line += fmt.Sprintf(format, e.Label)
+	}
+	return line
+}
+
+// formatMinutes formats an offset as mm:ss, minutes are not wrapped at one hour
+func formatMinutes(d time.Duration) string {
+	seconds := int(d.Seconds())
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+// formatChapter formats an offset the way YouTube chapters expect it
+func formatChapter(d time.Duration, hours bool) string {
+	seconds := int(d.Seconds())
+	if hours {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+func writeLines(w io.Writer, entries []Entry, line func(Entry) string) error {
+	for _, e := range entries {
+		if _, err := io.WriteString(w, line(e)+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeYouTube writes chapters. YouTube requires the first chapter at 0:00
+// and the same time format on every line.
+func writeYouTube(w io.Writer, entries []Entry, opts Options) error {
+	hours := len(entries) > 0 && entries[len(entries)-1].Offset >= time.Hour
+	for i, e := range entries {
+		offset := e.Offset
+		if i == 0 {
+			offset = 0
+		}
+		if _, err := io.WriteString(w, formatChapter(offset, hours)+" "+formatTrack(e, opts)+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMixcloud writes the section list used by the Mixcloud upload form
+func writeMixcloud(w io.Writer, entries []Entry, opts Options) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"artist", "song", "start_time"}); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		// Mixcloud has no separate fields, so remixer and label go into the song title
+		song := formatTrack(Entry{Title: e.Title, Remixer: e.Remixer, Label: e.Label}, opts)
+		record := []string{e.Artist, song, strconv.Itoa(int(e.Offset.Seconds()))}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+type jsonEntry struct {
+	Index         int     `json:"index"`
+	Offset        string  `json:"offset"`
+	OffsetSeconds float64 `json:"offset_seconds"`
+	Artist        string  `json:"artist"`
+	Title         string  `json:"title"`
+	Remixer       string  `json:"remixer,omitempty"`
+	Label         string  `json:"label,omitempty"`
+}
+
+func writeJSON(w io.Writer, entries []Entry) error {
+	out := make([]jsonEntry, len(entries))
+	for i, e := range entries {
+		out[i] = jsonEntry{
+			Index:         i + 1,
+			Offset:        formatMinutes(e.Offset),
+			OffsetSeconds: e.Offset.Seconds(),
+			Artist:        e.Artist,
+			Title:         e.Title,
+			Remixer:       e.Remixer,
+			Label:         e.Label,
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(out)
+}
@@ -28,6 +28,18 @@ func GetSortedPlaylistNames() []string {
 	return names
 }
 
+// GetSortedPlaylistPaths returns a sorted list of playlist paths, which tell
+// apart playlists with the same name in different folders.
+func GetSortedPlaylistPaths() []string {
+	pl := GetPlaylists()
+	paths := make([]string, len(pl))
+	for i, playlist := range pl {
+		paths[i] = playlist.Path
+	}
+	sort.Strings(paths)
+	return paths
+}
+
 // LoadCollection loads the Traktor collection.
 func LoadCollection() {
 	if !tcLoaded {
@@ -44,3 +56,21 @@ func GetPlaylistByName(name string) *Playlist {
 	}
 	return tc.GetPlaylistByName(name)
 }
+
+// GetPlaylistByPath finds a playlist of the loaded collection by its full path
+func GetPlaylistByPath(path string) *Playlist {
+	if !tcLoaded {
+		tc, _ = ParseCollection()
+		tcLoaded = true
+	}
+	return tc.GetPlaylistByPath(path)
+}
+
+// GetCollection returns the loaded Traktor collection, or nil if it could not be loaded
+func GetCollection() *TraktorCollection {
+	if !tcLoaded {
+		tc, _ = ParseCollection()
+		tcLoaded = true
+	}
+	return tc
+}
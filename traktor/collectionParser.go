@@ -2,18 +2,31 @@ package traktor
 
 import (
 	"encoding/xml"
+	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"time"
 )
 
 // NML represents the root element of the Traktor collection.nml file
 type NML struct {
-	XMLName    xml.Name   `xml:"NML"`
-	Version    string     `xml:"VERSION,attr"`
-	Collection Collection `xml:"COLLECTION"`
-	Playlists  Playlists  `xml:"PLAYLISTS"`
+	XMLName      xml.Name     `xml:"NML"`
+	Version      string       `xml:"VERSION,attr"`
+	Head         *RawElement  `xml:"HEAD"`
+	MusicFolders *RawElement  `xml:"MUSICFOLDERS"`
+	Collection   Collection   `xml:"COLLECTION"`
+	Sets         *RawElement  `xml:"SETS"`
+	Playlists    Playlists    `xml:"PLAYLISTS"`
+	Extra        []RawElement `xml:",any"`
+}
+
+// RawElement preserves an XML element that is not modelled by the parser,
+// so that it survives a round trip through Save
+type RawElement struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
 }
 
 // Collection contains all tracks in the library
@@ -24,20 +37,22 @@ type Collection struct {
 
 // Entry represents a single track in the collection
 type Entry struct {
-	Artist       string     `xml:"ARTIST,attr"`
-	Title        string     `xml:"TITLE,attr"`
-	AudioID      string     `xml:"AUDIO_ID,attr"`
-	ModifiedDate string     `xml:"MODIFIED_DATE,attr"`
-	ModifiedTime string     `xml:"MODIFIED_TIME,attr"`
-	Location     Location   `xml:"LOCATION"`
-	Album        Album      `xml:"ALBUM"`
-	Info         Info       `xml:"INFO"`
-	Tempo        Tempo      `xml:"TEMPO"`
-	Loudness     Loudness   `xml:"LOUDNESS"`
-	MusicalKey   MusicalKey `xml:"MUSICAL_KEY"`
-	CuePoints    []CuePoint `xml:"CUE_V2"`
-	LoopInfo     LoopInfo   `xml:"LOOPINFO"`
-	PrimaryKey   string     `xml:"-"` // Computed field for playlist references
+	Artist       string       `xml:"ARTIST,attr,omitempty"`
+	Title        string       `xml:"TITLE,attr,omitempty"`
+	AudioID      string       `xml:"AUDIO_ID,attr,omitempty"`
+	ModifiedDate string       `xml:"MODIFIED_DATE,attr,omitempty"`
+	ModifiedTime string       `xml:"MODIFIED_TIME,attr,omitempty"`
+	Attrs        []xml.Attr   `xml:",any,attr"`
+	Location     Location     `xml:"LOCATION"`
+	Album        *Album       `xml:"ALBUM"`
+	Info         Info         `xml:"INFO"`
+	Tempo        *Tempo       `xml:"TEMPO"`
+	Loudness     *Loudness    `xml:"LOUDNESS"`
+	MusicalKey   *MusicalKey  `xml:"MUSICAL_KEY"`
+	LoopInfo     *LoopInfo    `xml:"LOOPINFO"`
+	CuePoints    []CuePoint   `xml:"CUE_V2"`
+	Extra        []RawElement `xml:",any"`
+	PrimaryKey   string       `xml:"-"` // Computed field for playlist references
 }
 
 // Location contains file path information
@@ -50,32 +65,33 @@ type Location struct {
 
 // Album contains album metadata
 type Album struct {
-	Title    string `xml:"TITLE,attr"`
-	Track    int    `xml:"TRACK,attr"`
-	OfTracks int    `xml:"OF_TRACKS,attr"`
+	Title    string `xml:"TITLE,attr,omitempty"`
+	Track    int    `xml:"TRACK,attr,omitempty"`
+	OfTracks int    `xml:"OF_TRACKS,attr,omitempty"`
 }
 
 // Info contains additional track information
 type Info struct {
-	Bitrate       int     `xml:"BITRATE,attr"`
-	Genre         string  `xml:"GENRE,attr"`
-	Label         string  `xml:"LABEL,attr"`
-	Comment       string  `xml:"COMMENT,attr"`
-	Comment2      string  `xml:"COMMENT2,attr"`
-	CoverArtID    string  `xml:"COVERARTID,attr"`
-	Key           string  `xml:"KEY,attr"`
-	PlayCount     int     `xml:"PLAYCOUNT,attr"`
-	PlayTime      int     `xml:"PLAYTIME,attr"`
-	PlayTimeFloat float64 `xml:"PLAYTIME_FLOAT,attr"`
-	ImportDate    string  `xml:"IMPORT_DATE,attr"`
-	LastPlayed    string  `xml:"LAST_PLAYED,attr"`
-	Ranking       int     `xml:"RANKING,attr"`
-	ReleaseDate   string  `xml:"RELEASE_DATE,attr"`
-	Remixer       string  `xml:"REMIXER,attr"`
-	Producer      string  `xml:"PRODUCER,attr"`
-	Mix           string  `xml:"MIX,attr"`
-	FileSize      int     `xml:"FILESIZE,attr"`
-	Flags         int     `xml:"FLAGS,attr"`
+	Bitrate       int        `xml:"BITRATE,attr,omitempty"`
+	Genre         string     `xml:"GENRE,attr,omitempty"`
+	Label         string     `xml:"LABEL,attr,omitempty"`
+	Comment       string     `xml:"COMMENT,attr,omitempty"`
+	Comment2      string     `xml:"COMMENT2,attr,omitempty"`
+	CoverArtID    string     `xml:"COVERARTID,attr,omitempty"`
+	Key           string     `xml:"KEY,attr,omitempty"`
+	PlayCount     int        `xml:"PLAYCOUNT,attr,omitempty"`
+	PlayTime      int        `xml:"PLAYTIME,attr,omitempty"`
+	PlayTimeFloat float64    `xml:"PLAYTIME_FLOAT,attr,omitempty"`
+	ImportDate    string     `xml:"IMPORT_DATE,attr,omitempty"`
+	LastPlayed    string     `xml:"LAST_PLAYED,attr,omitempty"`
+	Ranking       int        `xml:"RANKING,attr,omitempty"`
+	ReleaseDate   string     `xml:"RELEASE_DATE,attr,omitempty"`
+	Remixer       string     `xml:"REMIXER,attr,omitempty"`
+	Producer      string     `xml:"PRODUCER,attr,omitempty"`
+	Mix           string     `xml:"MIX,attr,omitempty"`
+	FileSize      int        `xml:"FILESIZE,attr,omitempty"` // KB
+	Flags         int        `xml:"FLAGS,attr,omitempty"`
+	Attrs         []xml.Attr `xml:",any,attr"`
 }
 
 // Tempo contains BPM information
@@ -98,12 +114,30 @@ type MusicalKey struct {
 
 // CuePoint represents a cue point or loop marker
 type CuePoint struct {
-	Name    string  `xml:"NAME,attr"`
-	Type    int     `xml:"TYPE,attr"`
-	Start   float64 `xml:"START,attr"`
-	Len     float64 `xml:"LEN,attr"`
-	Repeats int     `xml:"REPEATS,attr"`
-	HotCue  int     `xml:"HOTCUE,attr"`
+	Name         string     `xml:"NAME,attr"`
+	DisplayOrder int        `xml:"DISPL_ORDER,attr"`
+	Type         int        `xml:"TYPE,attr"`
+	Start        float64    `xml:"START,attr"`
+	Len          float64    `xml:"LEN,attr"`
+	Repeats      int        `xml:"REPEATS,attr"`
+	HotCue       int        `xml:"HOTCUE,attr"`
+	Attrs        []xml.Attr `xml:",any,attr"`
+	Grid         *Grid      `xml:"GRID"`
+}
+
+// Cue point types as stored in the TYPE attribute of CUE_V2
+const (
+	CueTypeCue     = 0
+	CueTypeFadeIn  = 1
+	CueTypeFadeOut = 2
+	CueTypeLoad    = 3
+	CueTypeGrid    = 4
+	CueTypeLoop    = 5
+)
+
+// Grid holds the tempo stored on a grid marker cue point
+type Grid struct {
+	Bpm float64 `xml:"BPM,attr"`
 }
 
 // LoopInfo contains loop information
@@ -124,6 +158,7 @@ type Node struct {
 	Count    int           `xml:"COUNT,attr"`
 	Subnodes []Node        `xml:"SUBNODES>NODE"`
 	Playlist *PlaylistData `xml:"PLAYLIST"`
+	Extra    []RawElement  `xml:",any"`
 }
 
 // PlaylistData contains the actual playlist entries
@@ -136,7 +171,20 @@ type PlaylistData struct {
 
 // PlaylistItem represents a track reference in a playlist
 type PlaylistItem struct {
-	PrimaryKey PrimaryKey `xml:"PRIMARYKEY"`
+	PrimaryKey   PrimaryKey    `xml:"PRIMARYKEY"`
+	ExtendedData *ExtendedData `xml:"EXTENDEDDATA"`
+	Extra        []RawElement  `xml:",any"`
+}
+
+// ExtendedData carries the play information Traktor records in history playlists
+type ExtendedData struct {
+	Deck         int        `xml:"DECK,attr"`
+	Duration     float64    `xml:"DURATION,attr"`
+	ExtendedType string     `xml:"EXTENDEDTYPE,attr"`
+	PlayedPublic int        `xml:"PLAYEDPUBLIC,attr"`
+	StartDate    int        `xml:"STARTDATE,attr"`
+	StartTime    int        `xml:"STARTTIME,attr"`
+	Attrs        []xml.Attr `xml:",any,attr"`
 }
 
 // PrimaryKey is the unique identifier for a track
@@ -156,13 +204,14 @@ type Track struct {
 	Remixer     string
 	Producer    string
 	BPM         float64
+	BPMQuality  float64
 	Key         string
 	MusicalKey  int
 	Rating      int
 	PlayCount   int
 	Duration    float64
 	Bitrate     int
-	FileSize    int
+	FileSize    int // bytes, collection files store KB
 	FilePath    string
 	FileName    string
 	Volume      string
@@ -171,6 +220,7 @@ type Track struct {
 	ReleaseDate string
 	PeakDb      float64
 	PerceivedDb float64
+	CoverArtID  string
 	CuePoints   []CuePoint
 	PrimaryKey  string
 }
@@ -181,6 +231,17 @@ type Playlist struct {
 	Path      string
 	TrackKeys []string
 	Tracks    []*Track
+	History   []HistoryEntry
+}
+
+// HistoryEntry is a single play recorded in a history playlist
+type HistoryEntry struct {
+	Key       string
+	Track     *Track
+	StartTime time.Time
+	Duration  float64
+	Deck      int
+	Public    bool
 }
 
 // TraktorCollection holds the parsed collection data
@@ -189,6 +250,9 @@ type TraktorCollection struct {
 	Tracks    []Track
 	Playlists []Playlist
 	trackMap  map[string]*Track
+	entries   map[string]int
+	nml       *NML
+	path      string
 }
 
 // IsAvailable checks if Traktor is installed and collection exists
@@ -245,6 +309,8 @@ func ParseCollectionFromPath(path string) (*TraktorCollection, error) {
 	collection := &TraktorCollection{
 		Version:  nml.Version,
 		trackMap: make(map[string]*Track),
+		nml:      &nml,
+		path:     path,
 	}
 
 	// Parse tracks
@@ -261,6 +327,31 @@ func ParseCollectionFromPath(path string) (*TraktorCollection, error) {
 	return collection, nil
 }
 
+// NewCollection builds a collection from tracks and playlists read from another
+// library. Playlist tracks are resolved from their TrackKeys, which must match
+// the PrimaryKey of the tracks. The collection has no NML data and cannot be saved.
+func NewCollection(version string, tracks []Track, playlists []Playlist) *TraktorCollection {
+	collection := &TraktorCollection{
+		Version:   version,
+		Tracks:    tracks,
+		Playlists: playlists,
+		trackMap:  make(map[string]*Track, len(tracks)),
+	}
+	for i := range collection.Tracks {
+		collection.trackMap[collection.Tracks[i].PrimaryKey] = &collection.Tracks[i]
+	}
+	for i := range collection.Playlists {
+		playlist := &collection.Playlists[i]
+		playlist.Tracks = make([]*Track, 0, len(playlist.TrackKeys))
+		for _, key := range playlist.TrackKeys {
+			if track, exists := collection.trackMap[key]; exists {
+				playlist.Tracks = append(playlist.Tracks, track)
+			}
+		}
+	}
+	return collection
+}
+
 // convertEntryToTrack converts an NML Entry to a simplified Track
 func convertEntryToTrack(entry Entry) Track {
 	// Build the primary key (used to reference tracks in playlists)
@@ -269,31 +360,51 @@ func convertEntryToTrack(entry Entry) Track {
 	// Build full file path
 	filePath := buildFilePath(entry.Location)
 
+	// Optional elements are missing for tracks Traktor has not analyzed yet
+	var album Album
+	if entry.Album != nil {
+		album = *entry.Album
+	}
+	var tempo Tempo
+	if entry.Tempo != nil {
+		tempo = *entry.Tempo
+	}
+	var loudness Loudness
+	if entry.Loudness != nil {
+		loudness = *entry.Loudness
+	}
+	musicalKey := MusicalKey{Value: -1}
+	if entry.MusicalKey != nil {
+		musicalKey = *entry.MusicalKey
+	}
+
 	return Track{
 		Artist:      entry.Artist,
 		Title:       entry.Title,
-		Album:       entry.Album.Title,
+		Album:       album.Title,
 		Genre:       entry.Info.Genre,
 		Label:       entry.Info.Label,
 		Comment:     entry.Info.Comment,
 		Remixer:     entry.Info.Remixer,
 		Producer:    entry.Info.Producer,
-		BPM:         entry.Tempo.Bpm,
+		BPM:         tempo.Bpm,
+		BPMQuality:  tempo.BpmQuality,
 		Key:         entry.Info.Key,
-		MusicalKey:  entry.MusicalKey.Value,
+		MusicalKey:  musicalKey.Value,
 		Rating:      entry.Info.Ranking,
 		PlayCount:   entry.Info.PlayCount,
 		Duration:    entry.Info.PlayTimeFloat,
 		Bitrate:     entry.Info.Bitrate,
-		FileSize:    entry.Info.FileSize,
+		FileSize:    entry.Info.FileSize * 1024,
 		FilePath:    filePath,
 		FileName:    entry.Location.File,
 		Volume:      entry.Location.Volume,
 		ImportDate:  entry.Info.ImportDate,
 		LastPlayed:  entry.Info.LastPlayed,
 		ReleaseDate: entry.Info.ReleaseDate,
-		PeakDb:      entry.Loudness.PeakDb,
-		PerceivedDb: entry.Loudness.PerceivedDb,
+		PeakDb:      loudness.PeakDb,
+		PerceivedDb: loudness.PerceivedDb,
+		CoverArtID:  entry.Info.CoverArtID,
 		CuePoints:   entry.CuePoints,
 		PrimaryKey:  primaryKey,
 	}
@@ -323,6 +434,31 @@ func buildFilePath(loc Location) string {
 	return filepath.Join(dir, loc.File)
 }
 
+// decodeStartTime converts Traktor's packed history date (year<<16 | month<<8 | day)
+// and seconds since midnight into a local time
+func decodeStartTime(date, seconds int) time.Time {
+	if date == 0 {
+		return time.Time{}
+	}
+	year := date >> 16
+	month := (date >> 8) & 0xff
+	day := date & 0xff
+	return time.Date(year, time.Month(month), day, 0, 0, seconds, 0, time.Local)
+}
+
+// ParseDate parses the YYYY/M/D dates Traktor uses for IMPORT_DATE, LAST_PLAYED
+// and RELEASE_DATE. The boolean is false for empty or malformed values.
+func ParseDate(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation("2006/1/2", value, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
 // extractPlaylists recursively extracts playlists from the node tree
 func extractPlaylists(node Node, parentPath string, trackMap map[string]*Track) []Playlist {
 	var playlists []Playlist
@@ -350,9 +486,22 @@ func extractPlaylists(node Node, parentPath string, trackMap map[string]*Track)
 			playlist.TrackKeys = append(playlist.TrackKeys, key)
 
 			// Look up the track in our map
-			if track, exists := trackMap[key]; exists {
+			track, exists := trackMap[key]
+			if exists {
 				playlist.Tracks = append(playlist.Tracks, track)
 			}
+
+			// History playlists carry the time each track was played
+			if item.ExtendedData != nil && item.ExtendedData.ExtendedType == "HistoryData" {
+				playlist.History = append(playlist.History, HistoryEntry{
+					Key:       key,
+					Track:     track,
+					StartTime: decodeStartTime(item.ExtendedData.StartDate, item.ExtendedData.StartTime),
+					Duration:  item.ExtendedData.Duration,
+					Deck:      item.ExtendedData.Deck,
+					Public:    item.ExtendedData.PlayedPublic != 0,
+				})
+			}
 		}
 
 		playlists = append(playlists, playlist)
@@ -372,6 +521,18 @@ func (c *TraktorCollection) GetTrackByKey(key string) *Track {
 	return c.trackMap[key]
 }
 
+// CoverArtPath returns the file of Traktor's cover art cache for a
+// COVERARTID such as "080/ABCDEF0123", or "" when the collection was not
+// loaded from disk. Traktor keeps the cache in the CoverArt folder next to
+// collection.nml and appends "000" to the file names. The files need not be
+// plain images, coverart.Load also looks for an image after a header.
+func (c *TraktorCollection) CoverArtPath(id string) string {
+	if c.path == "" || id == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(c.path), "CoverArt", filepath.FromSlash(id)+"000")
+}
+
 // GetPlaylistByName finds a playlist by name
 func (c *TraktorCollection) GetPlaylistByName(name string) *Playlist {
 	for i := range c.Playlists {
@@ -392,6 +553,19 @@ func (c *TraktorCollection) GetPlaylistByPath(path string) *Playlist {
 	return nil
 }
 
+// GetPlaylistsInFolder returns all playlists below a folder path, recursively.
+// An empty folder returns every playlist.
+func (c *TraktorCollection) GetPlaylistsInFolder(folder string) []*Playlist {
+	var results []*Playlist
+	prefix := strings.TrimSuffix(folder, "/") + "/"
+	for i := range c.Playlists {
+		if folder == "" || strings.HasPrefix(c.Playlists[i].Path, prefix) {
+			results = append(results, &c.Playlists[i])
+		}
+	}
+	return results
+}
+
 // SearchTracks searches for tracks matching the query in artist, title, or album
 func (c *TraktorCollection) SearchTracks(query string) []Track {
 	query = strings.ToLower(query)
@@ -437,19 +611,8 @@ func (c *TraktorCollection) GetTracksByKey(key string) []Track {
 
 // KeyValueToString converts the numeric musical key value to a string representation
 func KeyValueToString(value int) string {
-	// Traktor uses Open Key notation internally (0-23)
-	// Even numbers are major, odd numbers are minor
-	keys := []string{
-		"1d", "1m", "2d", "2m", "3d", "3m",
-		"4d", "4m", "5d", "5m", "6d", "6m",
-		"7d", "7m", "8d", "8m", "9d", "9m",
-		"10d", "10m", "11d", "11m", "12d", "12m",
-	}
-
-	if value >= 0 && value < len(keys) {
-		return keys[value]
-	}
-	return ""
+	// Traktor stores major keys C..B as 0-11 and minor keys Cm..Bm as 12-23
+	return KeyValueToNotation(value, NotationOpenKey)
 }
 
 // FormatDuration formats duration in seconds to MM:SS format
@@ -457,23 +620,23 @@ func FormatDuration(seconds float64) string {
 	totalSeconds := int(seconds)
 	minutes := totalSeconds / 60
 	secs := totalSeconds % 60
-	return strconv.Itoa(minutes) + ":" + strconv.Itoa(secs)
+	return fmt.Sprintf("%d:%02d", minutes, secs)
 }
 
 // CuePointTypeToString converts cue point type to a human-readable string
 func CuePointTypeToString(cueType int) string {
 	switch cueType {
-	case 0:
+	case CueTypeCue:
 		return "Cue"
-	case 1:
+	case CueTypeFadeIn:
 		return "Fade In"
-	case 2:
+	case CueTypeFadeOut:
 		return "Fade Out"
-	case 3:
+	case CueTypeLoad:
 		return "Load"
-	case 4:
+	case CueTypeGrid:
 		return "Grid"
-	case 5:
+	case CueTypeLoop:
 		return "Loop"
 	default:
 		return "Unknown"
@@ -0,0 +1,292 @@
+package traktor
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/fileutil"
+)
+
+// nmlHeader is the XML declaration Traktor writes at the top of collection.nml
+const nmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="no" ?>` + "\n"
+
+// ErrPlaylistExists is returned when a playlist with the same path already exists
+var ErrPlaylistExists = errors.New("playlist already exists")
+
+// MarshalXML writes a playlist tree node in the layout Traktor expects,
+// with the SUBNODES element carrying the number of children
+func (n Node) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Local: "NODE"}
+	start.Attr = []xml.Attr{
+		{Name: xml.Name{Local: "TYPE"}, Value: n.Type},
+		{Name: xml.Name{Local: "NAME"}, Value: n.Name},
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	if n.Type == "FOLDER" {
+		subnodes := xml.StartElement{
+			Name: xml.Name{Local: "SUBNODES"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "COUNT"}, Value: strconv.Itoa(len(n.Subnodes))}},
+		}
+		if err := e.EncodeToken(subnodes); err != nil {
+			return err
+		}
+		for _, subnode := range n.Subnodes {
+			if err := e.Encode(subnode); err != nil {
+				return err
+			}
+		}
+		if err := e.EncodeToken(subnodes.End()); err != nil {
+			return err
+		}
+	}
+
+	if n.Playlist != nil {
+		n.Playlist.Entries = len(n.Playlist.Items)
+		if err := e.EncodeElement(n.Playlist, xml.StartElement{Name: xml.Name{Local: "PLAYLIST"}}); err != nil {
+			return err
+		}
+	}
+
+	for _, extra := range n.Extra {
+		if err := e.Encode(extra); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// Path returns the location of the collection.nml file the collection was loaded from
+func (c *TraktorCollection) Path() string {
+	return c.path
+}
+
+// Save writes the collection back to the collection.nml it was loaded from
+func (c *TraktorCollection) Save() error {
+	if c.path == "" {
+		return os.ErrNotExist
+	}
+	return c.SaveTo(c.path)
+}
+
+// SaveTo writes the collection to the given path. An existing file is kept
+// as a .bak copy next to it.
+func (c *TraktorCollection) SaveTo(path string) error {
+	if c.nml == nil {
+		return errors.New("collection has no NML data")
+	}
+	return writeNML(path, c.nml, true)
+}
+
+// writeNML writes an NML document through a temporary file, so an
+// interrupted write never leaves a truncated file behind
+func writeNML(path string, nml *NML, backup bool) error {
+	nml.Collection.Entries = len(nml.Collection.Tracks)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".collection-*.nml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(nmlHeader); err != nil {
+		tmp.Close()
+		return err
+	}
+	encoder := xml.NewEncoder(tmp)
+	if err := encoder.Encode(nml); err != nil {
+		tmp.Close()
+		return err
+	}
+	info, statErr := os.Stat(path)
+	if statErr == nil {
+		if err := tmp.Chmod(info.Mode()); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if statErr == nil && backup {
+		if err := backupFile(path); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// backupFile keeps a .bak copy of a file next to it. The original stays in
+// place until it is replaced, so it is never missing.
+func backupFile(path string) error {
+	bak := path + ".bak"
+	if err := os.Remove(bak); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(path, bak); err == nil {
+		return nil
+	}
+	// Some file systems have no hard links
+	return fileutil.CopyFile(path, bak)
+}
+
+// AddPlaylist creates a new playlist in the given folder path (folders separated
+// by "/", empty for the root) containing the tracks with the given primary keys.
+// Missing folders are created. Keys that are not in the collection are skipped.
+func (c *TraktorCollection) AddPlaylist(folderPath, name string, keys []string) (*Playlist, error) {
+	if c.nml == nil {
+		return nil, errors.New("collection has no NML data")
+	}
+	if name == "" {
+		return nil, errors.New("playlist name is empty")
+	}
+
+	root := &c.nml.Playlists.Node
+	if root.Type == "" {
+		root.Type = "FOLDER"
+		root.Name = "$ROOT"
+	}
+
+	folder := root
+	var pathParts []string
+	for _, part := range strings.Split(folderPath, "/") {
+		if part == "" {
+			continue
+		}
+		folder = findOrCreateFolder(folder, part)
+		pathParts = append(pathParts, part)
+	}
+
+	for _, subnode := range folder.Subnodes {
+		if subnode.Name == name && subnode.Type == "PLAYLIST" {
+			return nil, fmt.Errorf("%w: %s", ErrPlaylistExists, strings.Join(append(pathParts, name), "/"))
+		}
+	}
+
+	playlist := Playlist{
+		Name: name,
+		Path: strings.Join(append(pathParts, name), "/"),
+	}
+	data := &PlaylistData{
+		Type: "LIST",
+		UUID: newUUID(),
+	}
+	for _, key := range keys {
+		track, exists := c.trackMap[key]
+		if !exists {
+			continue
+		}
+		data.Items = append(data.Items, PlaylistItem{
+			PrimaryKey: PrimaryKey{Type: "TRACK", Key: key},
+		})
+		playlist.TrackKeys = append(playlist.TrackKeys, key)
+		playlist.Tracks = append(playlist.Tracks, track)
+	}
+	data.Entries = len(data.Items)
+
+	folder.Subnodes = append(folder.Subnodes, Node{
+		Type:     "PLAYLIST",
+		Name:     name,
+		Playlist: data,
+	})
+
+	c.Playlists = append(c.Playlists, playlist)
+	return &c.Playlists[len(c.Playlists)-1], nil
+}
+
+// findOrCreateFolder returns the folder node with the given name below parent
+func findOrCreateFolder(parent *Node, name string) *Node {
+	for i := range parent.Subnodes {
+		if parent.Subnodes[i].Type == "FOLDER" && parent.Subnodes[i].Name == name {
+			return &parent.Subnodes[i]
+		}
+	}
+	parent.Subnodes = append(parent.Subnodes, Node{Type: "FOLDER", Name: name})
+	return &parent.Subnodes[len(parent.Subnodes)-1]
+}
+
+// newUUID returns a random identifier in the 32 hex digit form Traktor uses for playlists
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// collectionEntry returns the NML entry of a track, found by its primary key
+func (c *TraktorCollection) collectionEntry(track *Track) (*Entry, error) {
+	if c.nml == nil {
+		return nil, errors.New("collection has no NML data")
+	}
+	i, exists := c.entryIndex()[track.PrimaryKey]
+	if !exists {
+		return nil, fmt.Errorf("track %s is not in the collection", track.FilePath)
+	}
+	return &c.nml.Collection.Tracks[i], nil
+}
+
+// UpdateTrack copies the metadata of a track back into its collection entry,
+// so the next Save writes it. The track is found by its primary key; cue
+// points, analysis data and play history are left alone.
+func (c *TraktorCollection) UpdateTrack(track *Track) error {
+	entry, err := c.collectionEntry(track)
+	if err != nil {
+		return err
+	}
+	entry.Artist = track.Artist
+	entry.Title = track.Title
+	entry.Info.Genre = track.Genre
+	entry.Info.Label = track.Label
+	entry.Info.Comment = track.Comment
+	entry.Info.Remixer = track.Remixer
+	entry.Info.Producer = track.Producer
+	entry.Info.Key = track.Key
+	entry.Info.Ranking = track.Rating
+	entry.Info.ReleaseDate = track.ReleaseDate
+
+	if entry.Album != nil {
+		entry.Album.Title = track.Album
+	} else if track.Album != "" {
+		entry.Album = &Album{Title: track.Album}
+	}
+	if entry.Tempo != nil {
+		entry.Tempo.Bpm = track.BPM
+	} else if track.BPM > 0 {
+		entry.Tempo = &Tempo{Bpm: track.BPM, BpmQuality: 100}
+	}
+	if track.MusicalKey >= 0 && track.MusicalKey < len(keyNames) {
+		entry.MusicalKey = &MusicalKey{Value: track.MusicalKey}
+	}
+
+	if stored, exists := c.trackMap[track.PrimaryKey]; exists && stored != track {
+		*stored = convertEntryToTrack(*entry)
+	}
+	return nil
+}
+
+// AddCuePoints adds cue points to a track and its collection entry, so the
+// next Save writes them. The existing cue points are kept.
+func (c *TraktorCollection) AddCuePoints(track *Track, cues []CuePoint) error {
+	entry, err := c.collectionEntry(track)
+	if err != nil {
+		return err
+	}
+	entry.CuePoints = append(entry.CuePoints, cues...)
+	track.CuePoints = append([]CuePoint(nil), entry.CuePoints...)
+	if stored, exists := c.trackMap[track.PrimaryKey]; exists && stored != track {
+		stored.CuePoints = append([]CuePoint(nil), entry.CuePoints...)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package traktor
+
+import (
+	"strconv"
+	"strings"
+)
+
+// KeyNotation selects how a musical key is written
+type KeyNotation int
+
+const (
+	// NotationMusical writes keys as note names, e.g. "Am" or "F#"
+	NotationMusical KeyNotation = iota
+	// NotationOpenKey writes keys in Open Key notation, e.g. "1m"
+	NotationOpenKey
+	// NotationCamelot writes keys in Camelot notation, e.g. "8A"
+	NotationCamelot
+)
+
+// keyNames holds the note names for Traktor's MUSICAL_KEY values.
+// Values 0-11 are the major keys from C upwards, 12-23 the minor keys.
+var keyNames = [24]string{
+	"C", "Db", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B",
+	"Cm", "C#m", "Dm", "Ebm", "Em", "Fm", "F#m", "Gm", "G#m", "Am", "Bbm", "Bm",
+}
+
+// openKeyNumbers holds the Open Key number for each pitch class of major keys.
+// Minor keys use the number of their relative major.
+var openKeyNumbers = [12]int{1, 8, 3, 10, 5, 12, 7, 2, 9, 4, 11, 6}
+
+// noteNames maps note names, including enharmonic spellings, to pitch classes
+var noteNames = map[string]int{
+	"c": 0, "b#": 0, "c#": 1, "db": 1, "d": 2, "d#": 3, "eb": 3, "e": 4, "fb": 4,
+	"e#": 5, "f": 5, "f#": 6, "gb": 6, "g": 7, "g#": 8, "ab": 8, "a": 9,
+	"a#": 10, "bb": 10, "b": 11, "cb": 11,
+}
+
+// KeyValueToNotation converts a MUSICAL_KEY value into the given notation.
+// An empty string is returned for unknown values.
+func KeyValueToNotation(value int, notation KeyNotation) string {
+	if value < 0 || value >= len(keyNames) {
+		return ""
+	}
+	number, minor := OpenKey(value)
+
+	switch notation {
+	case NotationOpenKey:
+		if minor {
+			return strconv.Itoa(number) + "m"
+		}
+		return strconv.Itoa(number) + "d"
+	case NotationCamelot:
+		camelot := (number+6)%12 + 1
+		if minor {
+			return strconv.Itoa(camelot) + "A"
+		}
+		return strconv.Itoa(camelot) + "B"
+	default:
+		return keyNames[value]
+	}
+}
+
+// OpenKey returns the Open Key number (1-12) of a MUSICAL_KEY value and whether
+// the key is minor. The number is 0 for unknown values.
+func OpenKey(value int) (int, bool) {
+	if value < 0 || value >= len(keyNames) {
+		return 0, false
+	}
+	minor := value >= 12
+	pitch := value % 12
+	if minor {
+		// The relative major is three semitones above the minor key
+		pitch = (pitch + 3) % 12
+	}
+	return openKeyNumbers[pitch], minor
+}
+
+// ParseKey parses a key written in musical, Open Key or Camelot notation and
+// returns the matching MUSICAL_KEY value
+func ParseKey(text string) (int, bool) {
+	text = strings.TrimSpace(strings.ToLower(text))
+	if text == "" {
+		return -1, false
+	}
+
+	// Open Key (1d-12m) and Camelot (1A-12B)
+	if n := strings.IndexFunc(text, func(r rune) bool { return r < '0' || r > '9' }); n > 0 {
+		number, err := strconv.Atoi(text[:n])
+		if err == nil && number >= 1 && number <= 12 {
+			var openKey int
+			var minor bool
+			switch text[n:] {
+			case "d":
+				openKey = number
+			case "m":
+				openKey, minor = number, true
+			case "b":
+				openKey = (number+4)%12 + 1
+			case "a":
+				openKey, minor = (number+4)%12+1, true
+			default:
+				return -1, false
+			}
+			for pitch, n := range openKeyNumbers {
+				if n != openKey {
+					continue
+				}
+				if minor {
+					return 12 + (pitch+9)%12, true
+				}
+				return pitch, true
+			}
+		}
+		return -1, false
+	}
+
+	// Musical notation: note name followed by an optional minor/major suffix
+	minor := false
+	for _, suffix := range []string{"minor", "min", "m"} {
+		if strings.HasSuffix(text, suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, suffix))
+			minor = true
+			break
+		}
+	}
+	if !minor {
+		for _, suffix := range []string{"major", "maj"} {
+			text = strings.TrimSpace(strings.TrimSuffix(text, suffix))
+		}
+	}
+	text = strings.ReplaceAll(text, "♯", "#")
+	text = strings.ReplaceAll(text, "♭", "b")
+	pitch, exists := noteNames[text]
+	if !exists {
+		return -1, false
+	}
+	if minor {
+		return 12 + pitch, true
+	}
+	return pitch, true
+}
+
+// TrackKeyValue returns the MUSICAL_KEY value of a track, falling back to the
+// key text when Traktor has not analyzed the key
+func TrackKeyValue(track *Track) (int, bool) {
+	if track.MusicalKey >= 0 && track.MusicalKey < len(keyNames) {
+		return track.MusicalKey, true
+	}
+	return ParseKey(track.Key)
+}
@@ -0,0 +1,436 @@
+package traktor
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ilmarkerm/djlibgo/fileutil"
+)
+
+// standaloneVersion is the NML version written when the collection has no NML data
+const standaloneVersion = "19"
+
+// LocationForPath converts a native file path into a Traktor location. Files
+// below /Volumes keep their volume name, other files use the system volume.
+func LocationForPath(path string) Location {
+	volume := filepath.VolumeName(path)
+	rest := filepath.ToSlash(strings.TrimPrefix(path, volume))
+	if volume == "" {
+		volume = "Macintosh HD"
+		if after, found := strings.CutPrefix(rest, "/Volumes/"); found {
+			if name, inner, ok := strings.Cut(after, "/"); ok {
+				volume, rest = name, "/"+inner
+			}
+		}
+	}
+	return splitLocation(volume, rest)
+}
+
+// VolumeLocation converts a path relative to the root of a drive into a
+// location on the named volume, the way Traktor stores files on removable
+// drives
+func VolumeLocation(volume, path string) Location {
+	return splitLocation(volume, "/"+strings.TrimPrefix(filepath.ToSlash(path), "/"))
+}
+
+// RelativeLocation converts a "/" separated path relative to an NML file into
+// a location without a volume. Only files written by this package use these.
+func RelativeLocation(path string) Location {
+	return splitLocation("", "/"+strings.TrimPrefix(filepath.ToSlash(path), "/"))
+}
+
+// splitLocation builds a location from a volume and a "/" separated path
+func splitLocation(volume, path string) Location {
+	dir, file := "/", path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		dir, file = path[:i+1], path[i+1:]
+	}
+	return Location{
+		Dir:    strings.ReplaceAll(dir, "/", "/:"),
+		File:   file,
+		Volume: volume,
+	}
+}
+
+// entryForTrack returns the collection entry of a track. Tracks that did not
+// come from an NML collection get an entry built from their fields.
+func (c *TraktorCollection) entryForTrack(track *Track, index map[string]int) Entry {
+	if i, exists := index[track.PrimaryKey]; exists {
+		return c.nml.Collection.Tracks[i]
+	}
+	return entryFromTrack(track)
+}
+
+// entryIndex maps the primary keys of the NML entries to their position. The
+// map is built on first use and rebuilt by relink when entries are appended.
+func (c *TraktorCollection) entryIndex() map[string]int {
+	if c.entries != nil {
+		return c.entries
+	}
+	c.entries = make(map[string]int)
+	if c.nml == nil {
+		return c.entries
+	}
+	for i, entry := range c.nml.Collection.Tracks {
+		c.entries[buildPrimaryKey(entry.Location)] = i
+	}
+	return c.entries
+}
+
+// entryFromTrack builds a collection entry from the fields of a track
+func entryFromTrack(track *Track) Entry {
+	entry := Entry{
+		Artist:   track.Artist,
+		Title:    track.Title,
+		Location: LocationForPath(track.FilePath),
+		Info: Info{
+			Bitrate:       track.Bitrate,
+			Genre:         track.Genre,
+			Label:         track.Label,
+			Comment:       track.Comment,
+			CoverArtID:    track.CoverArtID,
+			Key:           track.Key,
+			PlayCount:     track.PlayCount,
+			PlayTime:      int(track.Duration),
+			PlayTimeFloat: track.Duration,
+			ImportDate:    track.ImportDate,
+			LastPlayed:    track.LastPlayed,
+			Ranking:       track.Rating,
+			ReleaseDate:   track.ReleaseDate,
+			Remixer:       track.Remixer,
+			Producer:      track.Producer,
+			FileSize:      track.FileSize / 1024,
+		},
+		CuePoints: append([]CuePoint(nil), track.CuePoints...),
+	}
+	if track.Album != "" {
+		entry.Album = &Album{Title: track.Album}
+	}
+	if track.BPM > 0 {
+		entry.Tempo = &Tempo{Bpm: track.BPM, BpmQuality: 100}
+	}
+	if track.MusicalKey >= 0 {
+		entry.MusicalKey = &MusicalKey{Value: track.MusicalKey}
+	}
+	if track.PeakDb != 0 || track.PerceivedDb != 0 {
+		entry.Loudness = &Loudness{PeakDb: track.PeakDb, PerceivedDb: track.PerceivedDb}
+	}
+	return entry
+}
+
+// WritePlaylistsNML writes the playlists and the full entries of their tracks
+// as a standalone NML file, keeping the playlist folders. locate returns the
+// location written for a track; nil keeps the location from the collection.
+func (c *TraktorCollection) WritePlaylistsNML(path string, playlists []*Playlist, locate func(track *Track) Location) error {
+	version := standaloneVersion
+	if c.nml != nil && c.nml.Version != "" {
+		version = c.nml.Version
+	}
+	standalone := &TraktorCollection{
+		trackMap: make(map[string]*Track),
+		nml: &NML{
+			Version: version,
+			Head: &RawElement{
+				XMLName: xml.Name{Local: "HEAD"},
+				Attrs: []xml.Attr{
+					{Name: xml.Name{Local: "COMPANY"}, Value: "www.native-instruments.com"},
+					{Name: xml.Name{Local: "PROGRAM"}, Value: "Traktor"},
+				},
+			},
+			MusicFolders: &RawElement{XMLName: xml.Name{Local: "MUSICFOLDERS"}},
+			Sets: &RawElement{
+				XMLName: xml.Name{Local: "SETS"},
+				Attrs:   []xml.Attr{{Name: xml.Name{Local: "ENTRIES"}, Value: "0"}},
+			},
+			Playlists: Playlists{Node: Node{Type: "FOLDER", Name: "$ROOT"}},
+		},
+	}
+
+	index := c.entryIndex()
+	keys := make(map[*Track]string)
+	for _, playlist := range playlists {
+		var playlistKeys []string
+		for _, track := range playlist.Tracks {
+			key, exists := keys[track]
+			if !exists {
+				entry := c.entryForTrack(track, index)
+				if locate != nil {
+					entry.Location = locate(track)
+				}
+				key = buildPrimaryKey(entry.Location)
+				keys[track] = key
+				if _, duplicate := standalone.trackMap[key]; !duplicate {
+					standalone.nml.Collection.Tracks = append(standalone.nml.Collection.Tracks, entry)
+					standalone.trackMap[key] = track
+				}
+			}
+			playlistKeys = append(playlistKeys, key)
+		}
+
+		folder := strings.TrimSuffix(strings.TrimSuffix(playlist.Path, playlist.Name), "/")
+		if _, err := standalone.AddPlaylist(folder, playlist.Name, playlistKeys); err != nil {
+			return err
+		}
+	}
+	return writeNML(path, standalone.nml, false)
+}
+
+// ExportPlaylistNML writes a playlist as a standalone NML file into dir, the
+// way Traktor exports a single playlist. With copyFiles the audio files are
+// copied into a folder next to the NML file and referenced by relative
+// locations, so the folder can be handed on as a whole. Returns the NML path.
+func (c *TraktorCollection) ExportPlaylistNML(playlist *Playlist, dir string, copyFiles bool) (string, error) {
+	name := fileutil.SanitizeFileName(playlist.Name)
+	path := filepath.Join(dir, name+".nml")
+	// The playlist goes to the root of the file, without its folders
+	single := *playlist
+	single.Path = playlist.Name
+	if !copyFiles {
+		return path, c.WritePlaylistsNML(path, []*Playlist{&single}, nil)
+	}
+
+	audioDir := filepath.Join(dir, name)
+	if err := os.MkdirAll(audioDir, 0755); err != nil {
+		return "", err
+	}
+	copied := make(map[*Track]string)
+	used := make(map[string]bool)
+	for _, track := range playlist.Tracks {
+		if _, exists := copied[track]; exists {
+			continue
+		}
+		file := fileutil.UniqueFileName(filepath.Base(track.FilePath), used)
+		if _, err := fileutil.SyncFile(track.FilePath, filepath.Join(audioDir, file)); err != nil {
+			return "", err
+		}
+		copied[track] = name + "/" + file
+	}
+
+	err := c.WritePlaylistsNML(path, []*Playlist{&single}, func(track *Track) Location {
+		return RelativeLocation(copied[track])
+	})
+	return path, err
+}
+
+// NMLImportOptions controls how a received playlist NML is merged
+type NMLImportOptions struct {
+	// Folder is the playlist folder the received playlists are created in,
+	// empty for the root
+	Folder string
+	// AddMissing adds entries whose audio file exists but is not yet in the
+	// collection. Relative locations are resolved against the NML file.
+	AddMissing bool
+}
+
+// NMLImportResult reports what an import changed
+type NMLImportResult struct {
+	Playlists []string
+	Merged    int
+	Added     int
+	Unmatched int
+}
+
+// ImportPlaylistNML merges a standalone playlist NML into the collection.
+// Received entries are matched by location, then by audio ID, then by file
+// name and size. Matched entries take the received beat grid and tempo, and
+// received cues are added where the collection has none at that position.
+// The received playlists are created as new playlists. Call Save to keep
+// the changes.
+func (c *TraktorCollection) ImportPlaylistNML(path string, opts NMLImportOptions) (*NMLImportResult, error) {
+	if c.nml == nil {
+		return nil, errors.New("collection has no NML data")
+	}
+	received, err := ParseCollectionFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	index := c.entryIndex()
+	byAudioID := make(map[string]int)
+	byFile := make(map[string]int)
+	for i, entry := range c.nml.Collection.Tracks {
+		if entry.AudioID != "" {
+			byAudioID[entry.AudioID] = i
+		}
+		byFile[fileIdentity(entry)] = i
+	}
+
+	result := &NMLImportResult{}
+	keys := make(map[string]string)
+	addedKeys := make(map[string]bool)
+	var additions []Entry
+	for _, entry := range received.nml.Collection.Tracks {
+		receivedKey := buildPrimaryKey(entry.Location)
+		filePath := buildFilePath(entry.Location)
+		if entry.Location.Volume == "" {
+			filePath = filepath.Join(filepath.Dir(path), filePath)
+		}
+		location := LocationForPath(filePath)
+
+		i, found := index[buildPrimaryKey(location)]
+		if !found {
+			i, found = index[receivedKey]
+		}
+		if !found && entry.AudioID != "" {
+			i, found = byAudioID[entry.AudioID]
+		}
+		if !found && entry.Info.FileSize > 0 {
+			i, found = byFile[fileIdentity(entry)]
+		}
+
+		switch {
+		case found:
+			local := &c.nml.Collection.Tracks[i]
+			mergeEntry(local, entry)
+			key := buildPrimaryKey(local.Location)
+			if track, exists := c.trackMap[key]; exists {
+				*track = convertEntryToTrack(*local)
+			}
+			keys[receivedKey] = key
+			result.Merged++
+		case opts.AddMissing && fileExists(filePath):
+			entry.Location = location
+			key := buildPrimaryKey(location)
+			if _, exists := addedKeys[key]; !exists {
+				addedKeys[key] = true
+				additions = append(additions, entry)
+			}
+			keys[receivedKey] = key
+			result.Added++
+		default:
+			result.Unmatched++
+		}
+	}
+	// Appending moves the tracks, so the added tracks go in after all merges
+	if len(additions) > 0 {
+		c.nml.Collection.Tracks = append(c.nml.Collection.Tracks, additions...)
+		for _, entry := range additions {
+			c.Tracks = append(c.Tracks, convertEntryToTrack(entry))
+		}
+		c.relink()
+	}
+
+	for _, playlist := range received.Playlists {
+		var playlistKeys []string
+		for _, key := range playlist.TrackKeys {
+			if local, exists := keys[key]; exists {
+				playlistKeys = append(playlistKeys, local)
+			}
+		}
+		folder := strings.TrimSuffix(strings.TrimSuffix(playlist.Path, playlist.Name), "/")
+		if opts.Folder != "" {
+			folder = strings.TrimSuffix(opts.Folder+"/"+folder, "/")
+		}
+		created, err := c.addUniquePlaylist(folder, playlist.Name, playlistKeys)
+		if err != nil {
+			return result, err
+		}
+		result.Playlists = append(result.Playlists, created.Path)
+	}
+	return result, nil
+}
+
+// addUniquePlaylist adds a playlist, numbering the name when it is taken
+func (c *TraktorCollection) addUniquePlaylist(folder, name string, keys []string) (*Playlist, error) {
+	candidate := name
+	for n := 2; ; n++ {
+		playlist, err := c.AddPlaylist(folder, candidate, keys)
+		if !errors.Is(err, ErrPlaylistExists) {
+			return playlist, err
+		}
+		candidate = fmt.Sprintf("%s (%d)", name, n)
+	}
+}
+
+// relink rebuilds the track pointers of the key map and the playlists, and
+// the entry index, after tracks were appended
+func (c *TraktorCollection) relink() {
+	c.entries = nil
+	c.entryIndex()
+	c.trackMap = make(map[string]*Track, len(c.Tracks))
+	for i := range c.Tracks {
+		c.trackMap[c.Tracks[i].PrimaryKey] = &c.Tracks[i]
+	}
+	for i := range c.Playlists {
+		playlist := &c.Playlists[i]
+		playlist.Tracks = make([]*Track, 0, len(playlist.TrackKeys))
+		for _, key := range playlist.TrackKeys {
+			if track, exists := c.trackMap[key]; exists {
+				playlist.Tracks = append(playlist.Tracks, track)
+			}
+		}
+		for j := range playlist.History {
+			playlist.History[j].Track = c.trackMap[playlist.History[j].Key]
+		}
+	}
+}
+
+// fileIdentity identifies an entry by file name and size, which survive
+// copying a file to another computer
+func fileIdentity(entry Entry) string {
+	return fmt.Sprintf("%s\x00%d", strings.ToLower(entry.Location.File), entry.Info.FileSize)
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// mergeEntry copies the tempo and beat grid of a received entry and adds its
+// cues. Cues at a position that already has a cue of the same type are kept
+// as they are, and received hot cues on a slot that is taken become memory cues.
+func mergeEntry(local *Entry, received Entry) {
+	if received.Tempo != nil {
+		tempo := *received.Tempo
+		local.Tempo = &tempo
+	}
+
+	var grids, cues []CuePoint
+	for _, cue := range received.CuePoints {
+		if cue.Type == CueTypeGrid {
+			grids = append(grids, cue)
+		} else {
+			cues = append(cues, cue)
+		}
+	}
+	if len(grids) > 0 {
+		kept := grids
+		for _, cue := range local.CuePoints {
+			if cue.Type != CueTypeGrid {
+				kept = append(kept, cue)
+			}
+		}
+		local.CuePoints = kept
+	}
+
+	usedHotCues := make(map[int]bool)
+	for _, cue := range local.CuePoints {
+		if cue.HotCue >= 0 {
+			usedHotCues[cue.HotCue] = true
+		}
+	}
+	for _, cue := range cues {
+		duplicate := false
+		for _, existing := range local.CuePoints {
+			if existing.Type == cue.Type && math.Abs(existing.Start-cue.Start) < 1 {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		if cue.HotCue >= 0 && usedHotCues[cue.HotCue] {
+			cue.HotCue = -1
+		}
+		if cue.HotCue >= 0 {
+			usedHotCues[cue.HotCue] = true
+		}
+		local.CuePoints = append(local.CuePoints, cue)
+	}
+}
@@ -0,0 +1,325 @@
+package traktor
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsFolder is the playlist folder statistics buckets are saved to
+const StatsFolder = "Statistics"
+
+// BPMBucketSize is the width of the BPM ranges used for statistics
+const BPMBucketSize = 5
+
+// StatsBucket is a named group of tracks with their combined play count
+type StatsBucket struct {
+	Name      string
+	PlayCount int
+	Tracks    []*Track
+}
+
+// Keys returns the primary keys of the tracks in the bucket
+func (b StatsBucket) Keys() []string {
+	keys := make([]string, len(b.Tracks))
+	for i, track := range b.Tracks {
+		keys[i] = track.PrimaryKey
+	}
+	return keys
+}
+
+// StatsSection is one statistics view, e.g. the most played artists
+type StatsSection struct {
+	Title   string
+	Buckets []StatsBucket
+}
+
+// Statistics holds all statistics sections computed for a collection
+type Statistics struct {
+	Sections []StatsSection
+}
+
+// StatsOptions controls how statistics are computed
+type StatsOptions struct {
+	// Limit is the number of entries in the "most played" sections
+	Limit int
+	// NotPlayedMonths lists tracks not played for this many months
+	NotPlayedMonths int
+	// Now is the reference time for the "not played" section, defaults to time.Now
+	Now time.Time
+}
+
+// ComputeStatistics aggregates play counts, ratings and history of the collection
+func (c *TraktorCollection) ComputeStatistics(opts StatsOptions) *Statistics {
+	if opts.Limit <= 0 {
+		opts.Limit = 50
+	}
+	if opts.NotPlayedMonths <= 0 {
+		opts.NotPlayedMonths = 12
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	tracks := make([]*Track, len(c.Tracks))
+	for i := range c.Tracks {
+		tracks[i] = &c.Tracks[i]
+	}
+
+	stats := &Statistics{}
+	stats.Sections = append(stats.Sections,
+		mostPlayedTracks(tracks, opts.Limit),
+		groupTracks("Most played artists", tracks, opts.Limit, func(t *Track) string { return t.Artist }),
+		groupTracks("Most played labels", tracks, opts.Limit, func(t *Track) string { return t.Label }),
+		neverPlayed(tracks),
+		notPlayedSince(tracks, opts.NotPlayedMonths, opts.Now),
+		ratingDistribution(tracks),
+		groupTracks("Play counts by genre", tracks, 0, func(t *Track) string { return t.Genre }),
+		groupTracks("Play counts by BPM", tracks, 0, bpmBucket),
+		c.playsOverTime("Plays by genre per month", func(t *Track) string { return t.Genre }),
+		c.playsOverTime("Plays by BPM per month", bpmBucket),
+	)
+	return stats
+}
+
+// Section returns the section with the given title, or nil
+func (s *Statistics) Section(title string) *StatsSection {
+	for i := range s.Sections {
+		if s.Sections[i].Title == title {
+			return &s.Sections[i]
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes all sections as CSV rows of section, bucket, play count and track count
+func (s *Statistics) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"Section", "Bucket", "Plays", "Tracks"}); err != nil {
+		return err
+	}
+	for _, section := range s.Sections {
+		for _, bucket := range section.Buckets {
+			record := []string{
+				section.Title,
+				bucket.Name,
+				strconv.Itoa(bucket.PlayCount),
+				strconv.Itoa(len(bucket.Tracks)),
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// SaveBucketAsPlaylist stores the tracks of a bucket as a playlist below the Statistics folder
+func (c *TraktorCollection) SaveBucketAsPlaylist(section string, bucket StatsBucket) (*Playlist, error) {
+	name := bucket.Name
+	if name == "" {
+		name = "(empty)"
+	}
+	// Playlist paths use "/" as separator, so keep it out of the names
+	folder := StatsFolder + "/" + strings.ReplaceAll(section, "/", "-")
+	return c.AddPlaylist(folder, strings.ReplaceAll(name, "/", "-"), bucket.Keys())
+}
+
+// trackLabel returns "Artist - Title" for display
+func trackLabel(t *Track) string {
+	if t.Artist == "" {
+		return t.Title
+	}
+	return t.Artist + " - " + t.Title
+}
+
+// bpmBucket returns the BPM range a track belongs to, e.g. "125-129"
+func bpmBucket(t *Track) string {
+	if t.BPM <= 0 {
+		return "Unknown"
+	}
+	low := int(t.BPM) / BPMBucketSize * BPMBucketSize
+	return fmt.Sprintf("%d-%d", low, low+BPMBucketSize-1)
+}
+
+func mostPlayedTracks(tracks []*Track, limit int) StatsSection {
+	section := StatsSection{Title: "Most played tracks"}
+	played := make([]*Track, 0, len(tracks))
+	for _, track := range tracks {
+		if track.PlayCount > 0 {
+			played = append(played, track)
+		}
+	}
+	sort.SliceStable(played, func(i, j int) bool {
+		return played[i].PlayCount > played[j].PlayCount
+	})
+	if len(played) > limit {
+		played = played[:limit]
+	}
+	for _, track := range played {
+		section.Buckets = append(section.Buckets, StatsBucket{
+			Name:      trackLabel(track),
+			PlayCount: track.PlayCount,
+			Tracks:    []*Track{track},
+		})
+	}
+	return section
+}
+
+// groupTracks groups tracks by the given key and sorts the groups by play count.
+// A limit of 0 keeps all groups.
+func groupTracks(title string, tracks []*Track, limit int, key func(*Track) string) StatsSection {
+	groups := make(map[string]*StatsBucket)
+	for _, track := range tracks {
+		name := key(track)
+		bucket, exists := groups[name]
+		if !exists {
+			bucket = &StatsBucket{Name: name}
+			groups[name] = bucket
+		}
+		bucket.PlayCount += track.PlayCount
+		bucket.Tracks = append(bucket.Tracks, track)
+	}
+
+	section := StatsSection{Title: title}
+	for _, bucket := range groups {
+		section.Buckets = append(section.Buckets, *bucket)
+	}
+	sort.Slice(section.Buckets, func(i, j int) bool {
+		a, b := section.Buckets[i], section.Buckets[j]
+		if a.PlayCount != b.PlayCount {
+			return a.PlayCount > b.PlayCount
+		}
+		return a.Name < b.Name
+	})
+	if limit > 0 && len(section.Buckets) > limit {
+		section.Buckets = section.Buckets[:limit]
+	}
+	return section
+}
+
+func neverPlayed(tracks []*Track) StatsSection {
+	bucket := StatsBucket{Name: "Never played"}
+	for _, track := range tracks {
+		if track.PlayCount == 0 && track.LastPlayed == "" {
+			bucket.Tracks = append(bucket.Tracks, track)
+		}
+	}
+	sortByImportDate(bucket.Tracks)
+	return StatsSection{Title: "Never played since import", Buckets: []StatsBucket{bucket}}
+}
+
+func notPlayedSince(tracks []*Track, months int, now time.Time) StatsSection {
+	cutoff := now.AddDate(0, -months, 0)
+	bucket := StatsBucket{Name: fmt.Sprintf("Not played in %d months", months)}
+	for _, track := range tracks {
+		lastPlayed, ok := ParseDate(track.LastPlayed)
+		if ok && lastPlayed.Before(cutoff) {
+			bucket.PlayCount += track.PlayCount
+			bucket.Tracks = append(bucket.Tracks, track)
+		}
+	}
+	sort.SliceStable(bucket.Tracks, func(i, j int) bool {
+		a, _ := ParseDate(bucket.Tracks[i].LastPlayed)
+		b, _ := ParseDate(bucket.Tracks[j].LastPlayed)
+		return a.Before(b)
+	})
+	return StatsSection{Title: "Not played recently", Buckets: []StatsBucket{bucket}}
+}
+
+func sortByImportDate(tracks []*Track) {
+	sort.SliceStable(tracks, func(i, j int) bool {
+		a, _ := ParseDate(tracks[i].ImportDate)
+		b, _ := ParseDate(tracks[j].ImportDate)
+		return a.Before(b)
+	})
+}
+
+// ratingDistribution groups tracks by star rating. Traktor stores ratings
+// as 0-255 in steps of 51 per star.
+func ratingDistribution(tracks []*Track) StatsSection {
+	buckets := make([]StatsBucket, 6)
+	for stars := range buckets {
+		if stars == 0 {
+			buckets[stars].Name = "Unrated"
+		} else {
+			buckets[stars].Name = strings.Repeat("*", stars)
+		}
+	}
+	for _, track := range tracks {
+		stars := RatingToStars(track.Rating)
+		buckets[stars].PlayCount += track.PlayCount
+		buckets[stars].Tracks = append(buckets[stars].Tracks, track)
+	}
+	return StatsSection{Title: "Rating distribution", Buckets: buckets}
+}
+
+// RatingToStars converts Traktor's 0-255 ranking into 0-5 stars
+func RatingToStars(ranking int) int {
+	stars := (ranking + 25) / 51
+	if stars < 0 {
+		return 0
+	}
+	if stars > 5 {
+		return 5
+	}
+	return stars
+}
+
+// playsOverTime counts plays per month from the history playlists, grouped by key
+func (c *TraktorCollection) playsOverTime(title string, key func(*Track) string) StatsSection {
+	type play struct {
+		key   string
+		start time.Time
+	}
+	seen := make(map[play]bool)
+	groups := make(map[string]*StatsBucket)
+	var names []string
+
+	for _, playlist := range c.Playlists {
+		for _, entry := range playlist.History {
+			if entry.Track == nil || entry.StartTime.IsZero() {
+				continue
+			}
+			// The same history entry may be present in more than one playlist
+			p := play{entry.Key, entry.StartTime}
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+
+			name := entry.StartTime.Format("2006-01") + " " + key(entry.Track)
+			bucket, exists := groups[name]
+			if !exists {
+				bucket = &StatsBucket{Name: name}
+				groups[name] = bucket
+				names = append(names, name)
+			}
+			bucket.PlayCount++
+			if !containsTrack(bucket.Tracks, entry.Track) {
+				bucket.Tracks = append(bucket.Tracks, entry.Track)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	section := StatsSection{Title: title}
+	for _, name := range names {
+		section.Buckets = append(section.Buckets, *groups[name])
+	}
+	return section
+}
+
+func containsTrack(tracks []*Track, track *Track) bool {
+	for _, t := range tracks {
+		if t == track {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,5 @@
+package virtualdj
+
+const Prefix = "virtualdj://"
+const PlaylistPrefix = "virtualdj://playlist"
+const CollectionPrefix = "virtualdj://collection"
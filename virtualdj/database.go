@@ -0,0 +1,151 @@
+package virtualdj
+
+import (
+	"encoding/xml"
+	"os"
+	"strconv"
+)
+
+// Database is the root element of a VirtualDJ database.xml
+type Database struct {
+	XMLName xml.Name   `xml:"VirtualDJ_Database"`
+	Version string     `xml:"Version,attr"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Songs   []*Song    `xml:"Song"`
+}
+
+// Song is a track entry. Elements this package does not know, like CustomMix
+// or Link, are kept so that writing the database back does not lose them.
+type Song struct {
+	FilePath string     `xml:"FilePath,attr"`
+	FileSize string     `xml:"FileSize,attr,omitempty"`
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Tags     *Tags      `xml:"Tags"`
+	Infos    *Infos     `xml:"Infos"`
+	Comment  string     `xml:"Comment,omitempty"`
+	Scan     *Scan      `xml:"Scan"`
+	Pois     []Poi      `xml:"Poi"`
+	Other    []element  `xml:",any"`
+}
+
+// Tags holds the file tags as VirtualDJ shows them
+type Tags struct {
+	Author   string     `xml:"Author,attr,omitempty"`
+	Title    string     `xml:"Title,attr,omitempty"`
+	Genre    string     `xml:"Genre,attr,omitempty"`
+	Album    string     `xml:"Album,attr,omitempty"`
+	Composer string     `xml:"Composer,attr,omitempty"`
+	Label    string     `xml:"Label,attr,omitempty"`
+	Remix    string     `xml:"Remix,attr,omitempty"`
+	Year     string     `xml:"Year,attr,omitempty"`
+	Bpm      string     `xml:"Bpm,attr,omitempty"`
+	Key      string     `xml:"Key,attr,omitempty"`
+	Stars    string     `xml:"Stars,attr,omitempty"`
+	Attrs    []xml.Attr `xml:",any,attr"`
+}
+
+// Infos holds file properties and play statistics. Times are Unix seconds.
+type Infos struct {
+	SongLength string     `xml:"SongLength,attr,omitempty"`
+	FirstSeen  string     `xml:"FirstSeen,attr,omitempty"`
+	LastPlay   string     `xml:"LastPlay,attr,omitempty"`
+	PlayCount  string     `xml:"PlayCount,attr,omitempty"`
+	Bitrate    string     `xml:"Bitrate,attr,omitempty"`
+	Attrs      []xml.Attr `xml:",any,attr"`
+}
+
+// Scan holds the analysis results. Bpm is the beat length in seconds.
+type Scan struct {
+	Version string     `xml:"Version,attr,omitempty"`
+	Bpm     string     `xml:"Bpm,attr,omitempty"`
+	Key     string     `xml:"Key,attr,omitempty"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+}
+
+// Poi is a point of interest: a cue, saved loop, beat grid anchor or automix
+// point. Pos and Size are in seconds and Num is the 1-based hot cue number.
+type Poi struct {
+	Name  string     `xml:"Name,attr,omitempty"`
+	Pos   string     `xml:"Pos,attr"`
+	Num   string     `xml:"Num,attr,omitempty"`
+	Size  string     `xml:"Size,attr,omitempty"`
+	Type  string     `xml:"Type,attr,omitempty"`
+	Point string     `xml:"Point,attr,omitempty"`
+	Attrs []xml.Attr `xml:",any,attr"`
+}
+
+// Poi types
+const (
+	PoiCue      = "cue"
+	PoiLoop     = "loop"
+	PoiBeatgrid = "beatgrid"
+	PoiAutomix  = "automix"
+)
+
+// Automix points used for the Traktor load, fade in and fade out markers
+const (
+	PointRealStart = "realStart"
+	PointCutStart  = "cutStart"
+	PointFadeStart = "fadeStart"
+)
+
+// element keeps an unknown element as it was read
+type element struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   []byte     `xml:",innerxml"`
+}
+
+// ReadDatabase reads a database.xml file
+func ReadDatabase(path string) (*Database, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	db := &Database{}
+	if err := xml.NewDecoder(file).Decode(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// WriteDatabase writes a database.xml file. The file is written next to the
+// destination first and renamed, so VirtualDJ never sees a partial database.
+func WriteDatabase(path string, db *Database) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(xml.Header); err != nil {
+		file.Close()
+		return err
+	}
+	encoder := xml.NewEncoder(file)
+	encoder.Indent("", " ")
+	if err := encoder.Encode(db); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.WriteString("\n"); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// parseFloat reads a numeric attribute, returning 0 for empty or invalid values
+func parseFloat(value string) float64 {
+	f, _ := strconv.ParseFloat(value, 64)
+	return f
+}
+
+// formatFloat writes a numeric attribute the way VirtualDJ does
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 6, 64)
+}
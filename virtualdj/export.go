@@ -0,0 +1,286 @@
+package virtualdj
+
+import (
+	"encoding/xml"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ilmarkerm/djlibgo/fileutil"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// databaseVersion is written into new databases
+const databaseVersion = "8.5"
+
+// ExportOptions controls what is written into the VirtualDJ database
+type ExportOptions struct {
+	// Playlists limits the export to the tracks of these playlists. When empty
+	// the whole collection is exported.
+	Playlists []*traktor.Playlist
+	// Cues replaces the cues, loops, beat grid anchor and automix points of
+	// the exported songs with the Traktor cue points
+	Cues bool
+	// Lists also writes the playlists as .vdjfolder files into MyLists
+	Lists bool
+}
+
+// ExportResult counts the songs written by an export
+type ExportResult struct {
+	Updated int
+	Added   int
+	Lists   []string
+}
+
+// Export writes Traktor tracks into a VirtualDJ database.xml. Existing songs
+// are matched by file path and updated, other songs are added. A missing
+// database is created. The previous database is kept as .bak. VirtualDJ must
+// not be running, as it rewrites the database when it exits.
+func Export(path string, collection *traktor.TraktorCollection, opts ExportOptions) (*ExportResult, error) {
+	playlists := opts.Playlists
+	var tracks []*traktor.Track
+	if len(playlists) == 0 {
+		for i := range collection.Tracks {
+			tracks = append(tracks, &collection.Tracks[i])
+		}
+		if opts.Lists {
+			for i := range collection.Playlists {
+				playlists = append(playlists, &collection.Playlists[i])
+			}
+		}
+	} else {
+		seen := make(map[*traktor.Track]bool)
+		for _, playlist := range playlists {
+			for _, track := range playlist.Tracks {
+				if !seen[track] {
+					seen[track] = true
+					tracks = append(tracks, track)
+				}
+			}
+		}
+	}
+
+	db, err := ReadDatabase(path)
+	switch {
+	case os.IsNotExist(err):
+		db = &Database{Version: databaseVersion}
+	case err != nil:
+		return nil, err
+	default:
+		if err := fileutil.Backup(path); err != nil {
+			return nil, err
+		}
+	}
+
+	exact := make(map[string]*Song, len(db.Songs))
+	folded := make(map[string]*Song, len(db.Songs))
+	for _, song := range db.Songs {
+		exact[song.FilePath] = song
+		folded[strings.ToLower(song.FilePath)] = song
+	}
+
+	result := &ExportResult{}
+	for _, track := range tracks {
+		location := filepath.FromSlash(track.FilePath)
+		song, exists := exact[location]
+		if !exists {
+			song, exists = folded[strings.ToLower(location)]
+		}
+		if exists {
+			result.Updated++
+		} else {
+			song = &Song{FilePath: location}
+			db.Songs = append(db.Songs, song)
+			exact[location] = song
+			folded[strings.ToLower(location)] = song
+			result.Added++
+		}
+		updateSong(song, track, opts.Cues)
+	}
+	if err := WriteDatabase(path, db); err != nil {
+		return nil, err
+	}
+
+	if opts.Lists {
+		dir := filepath.Join(filepath.Dir(path), ListsFolder)
+		for _, playlist := range playlists {
+			written, err := writeFolder(dir, playlist)
+			if err != nil {
+				return result, err
+			}
+			result.Lists = append(result.Lists, written)
+		}
+	}
+	return result, nil
+}
+
+// updateSong copies the Traktor metadata into a song. Empty Traktor values
+// leave the VirtualDJ values alone.
+func updateSong(song *Song, track *traktor.Track, cues bool) {
+	if song.Tags == nil {
+		song.Tags = &Tags{}
+	}
+	if song.Infos == nil {
+		song.Infos = &Infos{}
+	}
+	if song.Scan == nil {
+		song.Scan = &Scan{}
+	}
+	set := func(field *string, value string) {
+		if value != "" {
+			*field = value
+		}
+	}
+
+	tags := song.Tags
+	set(&tags.Author, track.Artist)
+	set(&tags.Title, track.Title)
+	set(&tags.Genre, track.Genre)
+	set(&tags.Album, track.Album)
+	set(&tags.Composer, track.Producer)
+	set(&tags.Label, track.Label)
+	set(&tags.Remix, track.Remixer)
+	if date, ok := traktor.ParseDate(track.ReleaseDate); ok {
+		tags.Year = strconv.Itoa(date.Year())
+	}
+	if track.Rating > 0 {
+		tags.Stars = strconv.Itoa(traktor.RatingToStars(track.Rating))
+	}
+	key := track.Key
+	if value, ok := traktor.TrackKeyValue(track); ok {
+		key = traktor.KeyValueToNotation(value, traktor.NotationMusical)
+	}
+	set(&tags.Key, key)
+	set(&song.Scan.Key, key)
+	set(&song.Comment, track.Comment)
+	// Traktor only knows the size in KB, VirtualDJ wants bytes
+	if info, err := os.Stat(track.FilePath); err == nil {
+		song.FileSize = strconv.FormatInt(info.Size(), 10)
+	}
+
+	infos := song.Infos
+	if track.Duration > 0 {
+		infos.SongLength = formatFloat(track.Duration)
+	}
+	if track.Bitrate > 0 {
+		infos.Bitrate = strconv.Itoa(track.Bitrate / 1000)
+	}
+	if track.PlayCount > 0 {
+		infos.PlayCount = strconv.Itoa(track.PlayCount)
+	}
+	if infos.FirstSeen == "" {
+		added := time.Now()
+		if date, ok := traktor.ParseDate(track.ImportDate); ok {
+			added = date
+		}
+		infos.FirstSeen = strconv.FormatInt(added.Unix(), 10)
+	}
+
+	// The Traktor tempo becomes the scanned beat length
+	if track.BPM > 0 {
+		song.Scan.Bpm = formatFloat(60 / track.BPM)
+		if tags.Bpm != "" {
+			tags.Bpm = song.Scan.Bpm
+		}
+	}
+
+	if cues && len(track.CuePoints) > 0 {
+		song.Pois = append(keptPois(song.Pois), poisFromCues(track.CuePoints)...)
+	}
+}
+
+// keptPois returns the points of interest the Traktor cues do not replace
+func keptPois(pois []Poi) []Poi {
+	var kept []Poi
+	for _, poi := range pois {
+		switch poi.Type {
+		case PoiCue, PoiLoop, PoiBeatgrid, "":
+			continue
+		case PoiAutomix:
+			if poi.Point == PointRealStart || poi.Point == PointCutStart || poi.Point == PointFadeStart {
+				continue
+			}
+		}
+		kept = append(kept, poi)
+	}
+	return kept
+}
+
+// poisFromCues converts Traktor cue points. Hot cues keep their button as Num,
+// memory cues are numbered after the eight hot cue buttons.
+func poisFromCues(cues []traktor.CuePoint) []Poi {
+	var pois []Poi
+	next := 9
+	number := func(hotcue int) string {
+		if hotcue >= 0 && hotcue <= 7 {
+			return strconv.Itoa(hotcue + 1)
+		}
+		next++
+		return strconv.Itoa(next - 1)
+	}
+	seconds := func(ms float64) string { return formatFloat(math.Max(ms, 0) / 1000) }
+
+	for _, cue := range cues {
+		switch cue.Type {
+		case traktor.CueTypeGrid:
+			pois = append(pois, Poi{Pos: seconds(cue.Start), Type: PoiBeatgrid})
+		case traktor.CueTypeCue:
+			pois = append(pois, Poi{Name: cue.Name, Pos: seconds(cue.Start), Num: number(cue.HotCue), Type: PoiCue})
+		case traktor.CueTypeLoop:
+			if cue.Len <= 0 {
+				continue
+			}
+			pois = append(pois, Poi{Name: cue.Name, Pos: seconds(cue.Start), Num: number(cue.HotCue),
+				Size: seconds(cue.Len), Type: PoiLoop})
+		case traktor.CueTypeLoad, traktor.CueTypeFadeIn, traktor.CueTypeFadeOut:
+			point := PointRealStart
+			if cue.Type == traktor.CueTypeFadeIn {
+				point = PointCutStart
+			} else if cue.Type == traktor.CueTypeFadeOut {
+				point = PointFadeStart
+			}
+			pois = append(pois, Poi{Pos: seconds(cue.Start), Type: PoiAutomix, Point: point})
+			// Markers on a hot cue button stay reachable as a cue
+			if cue.HotCue >= 0 && cue.HotCue <= 7 {
+				pois = append(pois, Poi{Name: cue.Name, Pos: seconds(cue.Start), Num: number(cue.HotCue), Type: PoiCue})
+			}
+		}
+	}
+	return pois
+}
+
+// writeFolder writes a playlist as a .vdjfolder file below dir, keeping the
+// Traktor folder structure
+func writeFolder(dir string, playlist *traktor.Playlist) (string, error) {
+	path := playlist.Path
+	if path == "" {
+		path = playlist.Name
+	}
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		parts[i] = fileutil.SanitizeFileName(part)
+	}
+	file := filepath.Join(append([]string{dir}, parts...)...) + ".vdjfolder"
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return "", err
+	}
+
+	folder := VirtualFolder{}
+	for i, track := range playlist.Tracks {
+		folder.Songs = append(folder.Songs, FolderSong{
+			Path:   filepath.FromSlash(track.FilePath),
+			Artist: track.Artist,
+			Title:  track.Title,
+			Index:  i,
+		})
+	}
+	data, err := xml.MarshalIndent(folder, "", " ")
+	if err != nil {
+		return "", err
+	}
+	data = append([]byte(xml.Header), data...)
+	return file, os.WriteFile(file, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,84 @@
+package virtualdj
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+var library *traktor.TraktorCollection
+var libraryPath string
+var libraryLoaded bool = false
+var libraryErr error
+
+// SetLibraryPath sets the database.xml file to browse and discards the loaded library
+func SetLibraryPath(path string) {
+	libraryPath = path
+	library = nil
+	libraryErr = nil
+	libraryLoaded = false
+}
+
+// IsAvailable checks if a VirtualDJ database has been configured
+func IsAvailable() bool {
+	if libraryPath == "" {
+		return false
+	}
+	_, err := os.Stat(libraryPath)
+	return err == nil
+}
+
+// GetLibrary returns the parsed VirtualDJ library, or nil if it could not be
+// loaded. LoadError tells why.
+func GetLibrary() *traktor.TraktorCollection {
+	if !libraryLoaded {
+		library, libraryErr = ParseLibrary(libraryPath)
+		libraryLoaded = true
+	}
+	return library
+}
+
+// LoadError returns the error from loading the library, or nil
+func LoadError() error {
+	GetLibrary()
+	return libraryErr
+}
+
+// GetSortedPlaylistNames returns a sorted list of playlist paths like
+// "MyLists/Warmup". Lists in different folders may share a name.
+func GetSortedPlaylistNames() []string {
+	lib := GetLibrary()
+	if lib == nil {
+		return nil
+	}
+	names := make([]string, len(lib.Playlists))
+	for i, playlist := range lib.Playlists {
+		names[i] = playlist.Path
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetPlaylistByName finds a playlist by the path returned from GetSortedPlaylistNames
+func GetPlaylistByName(name string) *traktor.Playlist {
+	lib := GetLibrary()
+	if lib == nil {
+		return nil
+	}
+	return lib.GetPlaylistByPath(name)
+}
+
+// DefaultDatabasePath returns where VirtualDJ keeps its database on this system
+func DefaultDatabasePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS == "darwin" {
+		return filepath.Join(home, "Library", "Application Support", "VirtualDJ", "database.xml")
+	}
+	return filepath.Join(home, "Documents", "VirtualDJ", "database.xml")
+}
@@ -0,0 +1,273 @@
+package virtualdj
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ilmarkerm/djlibgo/playlistfile"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// Folders of the VirtualDJ home folder the playlists are read from
+const (
+	ListsFolder     = "MyLists"
+	PlaylistsFolder = "Playlists"
+)
+
+// VirtualFolder is a .vdjfolder list of songs
+type VirtualFolder struct {
+	XMLName xml.Name     `xml:"VirtualFolder"`
+	Attrs   []xml.Attr   `xml:",any,attr"`
+	Songs   []FolderSong `xml:"song"`
+}
+
+// FolderSong is an entry of a .vdjfolder list
+type FolderSong struct {
+	Path   string `xml:"path,attr"`
+	Artist string `xml:"artist,attr,omitempty"`
+	Title  string `xml:"title,attr,omitempty"`
+	Index  int    `xml:"idx,attr"`
+}
+
+// ParseLibrary reads a database.xml and the lists of the VirtualDJ folder it
+// is in. MyLists .vdjfolder files and Playlists .m3u files become playlists
+// named by their path below those folders. Songs only referenced by a list are
+// added with their file name. Playlists that cannot be read are left out and
+// their errors returned with the library.
+func ParseLibrary(path string) (*traktor.TraktorCollection, error) {
+	db, err := ReadDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := make([]traktor.Track, 0, len(db.Songs))
+	known := make(map[string]bool, len(db.Songs))
+	for _, song := range db.Songs {
+		track := convertSong(song)
+		if known[track.PrimaryKey] {
+			continue
+		}
+		known[track.PrimaryKey] = true
+		tracks = append(tracks, track)
+	}
+
+	addTrack := func(location string) string {
+		if !known[location] {
+			tracks = append(tracks, traktor.Track{
+				Title:      strings.TrimSuffix(filepath.Base(location), filepath.Ext(location)),
+				FilePath:   location,
+				FileName:   filepath.Base(location),
+				PrimaryKey: location,
+				MusicalKey: -1,
+			})
+			known[location] = true
+		}
+		return location
+	}
+
+	home := filepath.Dir(path)
+	var playlists []traktor.Playlist
+	for _, list := range findLists(filepath.Join(home, ListsFolder), ".vdjfolder") {
+		folder, err := readFolder(list)
+		if err != nil {
+			// Filter folders and other special folders have no song list
+			continue
+		}
+		playlist := newPlaylist(home, list)
+		for _, song := range folder.Songs {
+			playlist.TrackKeys = append(playlist.TrackKeys, addTrack(song.Path))
+		}
+		playlists = append(playlists, playlist)
+	}
+	var listErrs []error
+	for _, list := range findLists(filepath.Join(home, PlaylistsFolder), ".m3u", ".m3u8") {
+		items, err := playlistfile.ParseFile(list)
+		if err != nil {
+			listErrs = append(listErrs, fmt.Errorf("playlist %s: %w", filepath.Base(list), err))
+			continue
+		}
+		playlist := newPlaylist(home, list)
+		for _, item := range items {
+			playlist.TrackKeys = append(playlist.TrackKeys, addTrack(item.Location))
+		}
+		playlists = append(playlists, playlist)
+	}
+
+	version := "VirtualDJ"
+	if db.Version != "" {
+		version += " " + db.Version
+	}
+	return traktor.NewCollection(version, tracks, playlists), errors.Join(listErrs...)
+}
+
+// findLists returns the files with one of the extensions below dir, sorted
+func findLists(dir string, extensions ...string) []string {
+	var files []string
+	filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		for _, want := range extensions {
+			if ext == want {
+				files = append(files, path)
+				break
+			}
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+// newPlaylist names a playlist by its file path relative to the VirtualDJ folder
+func newPlaylist(home, file string) traktor.Playlist {
+	rel, err := filepath.Rel(home, file)
+	if err != nil {
+		rel = filepath.Base(file)
+	}
+	rel = filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)))
+	return traktor.Playlist{Name: filepath.Base(rel), Path: rel}
+}
+
+// readFolder reads a .vdjfolder file in song order
+func readFolder(path string) (*VirtualFolder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	folder := &VirtualFolder{}
+	if err := xml.Unmarshal(data, folder); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(folder.Songs, func(i, j int) bool { return folder.Songs[i].Index < folder.Songs[j].Index })
+	return folder, nil
+}
+
+// convertSong converts a Song element into a track
+func convertSong(song *Song) traktor.Track {
+	track := traktor.Track{
+		FilePath:   song.FilePath,
+		FileName:   filepath.Base(song.FilePath),
+		PrimaryKey: song.FilePath,
+		MusicalKey: -1,
+		Comment:    song.Comment,
+	}
+	track.FileSize, _ = strconv.Atoi(song.FileSize)
+
+	if tags := song.Tags; tags != nil {
+		track.Artist = tags.Author
+		track.Title = tags.Title
+		track.Genre = tags.Genre
+		track.Album = tags.Album
+		track.Producer = tags.Composer
+		track.Label = tags.Label
+		track.Remixer = tags.Remix
+		track.Key = tags.Key
+		track.Rating = int(parseFloat(tags.Stars)) * 51
+		if len(tags.Year) >= 4 {
+			track.ReleaseDate = tags.Year[:4] + "/1/1"
+		}
+		track.BPM = bpmFromValue(tags.Bpm)
+	}
+	if infos := song.Infos; infos != nil {
+		track.Duration = parseFloat(infos.SongLength)
+		track.Bitrate = int(parseFloat(infos.Bitrate)) * 1000
+		track.PlayCount = int(parseFloat(infos.PlayCount))
+		if seconds := int64(parseFloat(infos.FirstSeen)); seconds > 0 {
+			track.ImportDate = time.Unix(seconds, 0).Format("2006/1/2")
+		}
+		if seconds := int64(parseFloat(infos.LastPlay)); seconds > 0 {
+			track.LastPlayed = time.Unix(seconds, 0).Format("2006/1/2")
+		}
+	}
+	if scan := song.Scan; scan != nil {
+		if bpm := bpmFromValue(scan.Bpm); bpm > 0 {
+			track.BPM = bpm
+		}
+		if track.Key == "" {
+			track.Key = scan.Key
+		}
+	}
+	if key, ok := traktor.ParseKey(track.Key); ok {
+		track.MusicalKey = key
+	}
+	track.CuePoints = convertPois(song.Pois, track.BPM)
+	return track
+}
+
+// bpmFromValue reads a Bpm attribute. VirtualDJ stores the beat length in
+// seconds, while older databases and user edited tags may hold the tempo.
+func bpmFromValue(value string) float64 {
+	f := parseFloat(value)
+	switch {
+	case f <= 0:
+		return 0
+	case f < 10:
+		return 60 / f
+	default:
+		return f
+	}
+}
+
+// convertPois turns the cues, loops, beat grid anchor and automix points into
+// Traktor cue points
+func convertPois(pois []Poi, bpm float64) []traktor.CuePoint {
+	var points []traktor.CuePoint
+	for _, poi := range pois {
+		cue := traktor.CuePoint{
+			Name:    poi.Name,
+			Start:   parseFloat(poi.Pos) * 1000,
+			Repeats: -1,
+			HotCue:  -1,
+		}
+		if num := int(parseFloat(poi.Num)); num >= 1 && num <= 8 {
+			cue.HotCue = num - 1
+		}
+		switch poi.Type {
+		case PoiCue, "":
+			cue.Type = traktor.CueTypeCue
+		case PoiLoop:
+			cue.Type = traktor.CueTypeLoop
+			cue.Len = parseFloat(poi.Size) * 1000
+			if cue.Len <= 0 {
+				continue
+			}
+		case PoiBeatgrid:
+			if bpm <= 0 {
+				continue
+			}
+			cue = traktor.CuePoint{
+				Name:    "AutoGrid",
+				Type:    traktor.CueTypeGrid,
+				Start:   cue.Start,
+				Repeats: -1,
+				HotCue:  -1,
+				Grid:    &traktor.Grid{Bpm: bpm},
+			}
+		case PoiAutomix:
+			switch poi.Point {
+			case PointRealStart:
+				cue.Type = traktor.CueTypeLoad
+			case PointCutStart:
+				cue.Type = traktor.CueTypeFadeIn
+			case PointFadeStart:
+				cue.Type = traktor.CueTypeFadeOut
+			default:
+				continue
+			}
+			cue.HotCue = -1
+		default:
+			continue
+		}
+		points = append(points, cue)
+	}
+	return points
+}
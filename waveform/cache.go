@@ -0,0 +1,119 @@
+package waveform
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/ilmarkerm/djlibgo/fileutil"
+)
+
+// fileVersion changes whenever the overview does, which drops old files
+const fileVersion = 1
+
+// fileMagic starts every cached overview
+var fileMagic = []byte("DJWF")
+
+// errBadFile is returned for cache files that cannot be read
+var errBadFile = errors.New("not a waveform cache file")
+
+// Cache stores overviews as small binary files, so each file is only
+// decoded once
+type Cache struct {
+	dir string
+}
+
+// NewCache returns a cache that keeps its overviews in dir
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// DefaultCache returns a cache in the user's cache folder
+func DefaultCache() *Cache {
+	return NewCache(fileutil.CachePath("waveforms"))
+}
+
+// Overview returns the overview of an audio file, computing and storing it
+// when needed. The overviews of earlier versions of the file are removed.
+func (c *Cache) Overview(ctx context.Context, path string) (*Overview, error) {
+	item, version, err := cacheKey(path)
+	if err != nil {
+		return nil, err
+	}
+	file := filepath.Join(c.dir, item[:2], item+"-"+version+".wf")
+	if data, err := os.ReadFile(file); err == nil {
+		if overview, err := decodeOverview(data); err == nil {
+			return overview, nil
+		}
+	}
+
+	overview, err := Compute(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	err = fileutil.WriteAtomic(file, func(w io.Writer) error {
+		_, err := w.Write(encodeOverview(overview))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	fileutil.PruneCache(filepath.Dir(file), item+"-", filepath.Base(file))
+	return overview, nil
+}
+
+// cacheKey identifies an audio file by its path, and the version of its
+// overview by the file size and modification time, so changed files get a
+// new overview
+func cacheKey(path string) (string, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", "", err
+	}
+	item := sha1.Sum([]byte(path))
+	version := sha1.New()
+	fmt.Fprintf(version, "%d\x00%d\x00%d", fileVersion, info.Size(), info.ModTime().UnixNano())
+	return hex.EncodeToString(item[:]), hex.EncodeToString(version.Sum(nil)), nil
+}
+
+// encodeOverview writes the magic, version, duration and column count
+// followed by three bytes per column
+func encodeOverview(overview *Overview) []byte {
+	var b bytes.Buffer
+	b.Write(fileMagic)
+	binary.Write(&b, binary.LittleEndian, uint32(fileVersion))
+	binary.Write(&b, binary.LittleEndian, math.Float64bits(overview.Duration))
+	binary.Write(&b, binary.LittleEndian, uint32(len(overview.Columns)))
+	for _, column := range overview.Columns {
+		b.Write([]byte{column.Low, column.Mid, column.High})
+	}
+	return b.Bytes()
+}
+
+// decodeOverview reads a file written by encodeOverview
+func decodeOverview(data []byte) (*Overview, error) {
+	const header = 4 + 4 + 8 + 4
+	if len(data) < header || !bytes.Equal(data[:4], fileMagic) ||
+		binary.LittleEndian.Uint32(data[4:]) != fileVersion {
+		return nil, errBadFile
+	}
+	overview := &Overview{Duration: math.Float64frombits(binary.LittleEndian.Uint64(data[8:]))}
+	count := int(binary.LittleEndian.Uint32(data[16:]))
+	columns := data[header:]
+	if len(columns) != count*3 {
+		return nil, errBadFile
+	}
+	overview.Columns = make([]Column, count)
+	for i := range overview.Columns {
+		overview.Columns[i] = Column{Low: columns[i*3], Mid: columns[i*3+1], High: columns[i*3+2]}
+	}
+	return overview, nil
+}
@@ -0,0 +1,123 @@
+// Package waveform computes colour-coded waveform overviews of audio files
+// and keeps them in an on-disk cache.
+package waveform
+
+import (
+	"context"
+	"io"
+	"math"
+
+	"github.com/ilmarkerm/djlibgo/audio"
+)
+
+// ColumnsPerSecond is the time resolution of an overview
+const ColumnsPerSecond = 20
+
+// Band edges in Hz between the low, mid and high bands
+const (
+	lowEdge  = 200.0
+	highEdge = 2500.0
+)
+
+// Column is the peak level of each band in one slice of the track, 255
+// being full scale
+type Column struct {
+	Low, Mid, High uint8
+}
+
+// Overview is the band levels of a whole track
+type Overview struct {
+	// Duration is the decoded length in seconds
+	Duration float64
+	Columns  []Column
+}
+
+// Peak returns the highest band level of the overview
+func (o *Overview) Peak() uint8 {
+	var peak uint8
+	for _, column := range o.Columns {
+		peak = max(peak, column.Low, column.Mid, column.High)
+	}
+	return peak
+}
+
+// lowPass is a one pole low pass filter
+type lowPass struct {
+	alpha float64
+	y     float64
+}
+
+func newLowPass(cutoff, rate float64) lowPass {
+	return lowPass{alpha: 1 - math.Exp(-2*math.Pi*cutoff/rate)}
+}
+
+func (f *lowPass) process(x float64) float64 {
+	f.y += f.alpha * (x - f.y)
+	return f.y
+}
+
+// Compute decodes a file and measures its band levels. It returns
+// ctx.Err() when ctx is cancelled first.
+func Compute(ctx context.Context, path string) (*Overview, error) {
+	dec, err := audio.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+
+	format := dec.Format()
+	channels := format.Channels
+	rate := float64(format.SampleRate)
+	frames := max(format.SampleRate/ColumnsPerSecond, 1)
+	low, mid := newLowPass(lowEdge, rate), newLowPass(highEdge, rate)
+	overview := &Overview{}
+	var peaks [3]float64
+	count, total := 0, int64(0)
+	buf := make([]float32, 4096*channels)
+	for block := 0; ; block++ {
+		if block%64 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		n, err := dec.Read(buf)
+		for i := 0; i < n; i++ {
+			var x float64
+			for _, sample := range buf[i*channels : (i+1)*channels] {
+				x += float64(sample)
+			}
+			x /= float64(channels)
+			// The bands are the differences of two low passes, so they add
+			// up to the signal
+			lows := low.process(x)
+			belowHigh := mid.process(x)
+			peaks[0] = math.Max(peaks[0], math.Abs(lows))
+			peaks[1] = math.Max(peaks[1], math.Abs(belowHigh-lows))
+			peaks[2] = math.Max(peaks[2], math.Abs(x-belowHigh))
+			count++
+			if count == frames {
+				overview.Columns = append(overview.Columns, column(peaks))
+				peaks, count = [3]float64{}, 0
+			}
+		}
+		total += int64(n)
+		if err == io.EOF {
+			if count > 0 {
+				overview.Columns = append(overview.Columns, column(peaks))
+			}
+			overview.Duration = float64(total) / rate
+			return overview, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// column converts band peaks to a column
+func column(peaks [3]float64) Column {
+	level := func(peak float64) uint8 {
+		return uint8(math.Min(peak, 1)*255 + 0.5)
+	}
+	return Column{Low: level(peaks[0]), Mid: level(peaks[1]), High: level(peaks[2])}
+}
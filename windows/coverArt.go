@@ -0,0 +1,168 @@
+package windows
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/coverart"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// coverCache holds the thumbnails shown in the file table and Details panel
+var coverCache = coverart.DefaultCache()
+
+// thumbnailSlots limits how many covers are decoded at the same time
+var thumbnailSlots = make(chan struct{}, 4)
+
+// coverSource returns where to look for the cover of a file table row
+func coverSource(file FileItem) coverart.Source {
+	source := coverart.Source{AudioFile: file.Path}
+	if file.CoverArtID != "" {
+		if collection := traktor.GetCollection(); collection != nil {
+			source.CoverArtFile = collection.CoverArtPath(file.CoverArtID)
+		}
+	}
+	return source
+}
+
+// rowThumbnail returns the thumbnail file of a table row, or "" while it is
+// loading or when the track has no cover. Missing thumbnails are created in
+// the background and the row is refreshed once they are ready.
+func (s *AppState) rowThumbnail(row int) string {
+	file := s.files[row]
+	if thumbnail, done := s.thumbnails[file.Path]; done {
+		return thumbnail
+	}
+	if s.pendingThumbnails[file.Path] {
+		return ""
+	}
+	s.pendingThumbnails[file.Path] = true
+	source := coverSource(file)
+	go func() {
+		thumbnailSlots <- struct{}{}
+		thumbnail, _ := coverCache.Thumbnail(source, coverart.SizeRow)
+		<-thumbnailSlots
+		fyne.Do(func() {
+			delete(s.pendingThumbnails, file.Path)
+			s.thumbnails[file.Path] = thumbnail
+			if s.fileTable == nil {
+				return
+			}
+			for i := range s.files {
+				if s.files[i].Path == file.Path {
+					s.fileTable.RefreshItem(widget.TableCellID{Row: i, Col: 0})
+				}
+			}
+		})
+	}()
+	return ""
+}
+
+// newDetailsPanel builds the cover, text and waveform of the Details panel
+func (s *AppState) newDetailsPanel() fyne.CanvasObject {
+	s.detailsImage = canvas.NewImageFromResource(nil)
+	s.detailsImage.FillMode = canvas.ImageFillContain
+	s.detailsImage.SetMinSize(fyne.NewSize(160, 160))
+	s.detailsText = widget.NewLabel("")
+	s.detailsText.Wrapping = fyne.TextWrapWord
+	s.detailsMarker = widget.NewLabel("")
+	s.detailsWaveform = newWaveformView()
+	s.detailsWaveform.OnMarkerTapped = func(cue traktor.CuePoint) {
+		s.detailsMarker.SetText(markerDescription(cue))
+	}
+	waveformPanel := container.NewBorder(nil, s.detailsMarker, nil, nil, s.detailsWaveform)
+	return container.NewBorder(nil, waveformPanel, s.detailsImage, nil, s.detailsText)
+}
+
+// markerDescription names a cue point with its type and position
+func markerDescription(cue traktor.CuePoint) string {
+	name := cue.Name
+	if name == "" || name == "n.n." {
+		name = "Unnamed"
+	}
+	text := fmt.Sprintf("%s (%s) at %s", name, traktor.CuePointTypeToString(cue.Type), traktor.FormatDuration(cue.Start/1000))
+	if cue.Type == traktor.CueTypeLoop && cue.Len > 0 {
+		text += fmt.Sprintf(", %.1f s long", cue.Len/1000)
+	}
+	if cue.HotCue >= 0 {
+		text += fmt.Sprintf(", hot cue %d", cue.HotCue+1)
+	}
+	return text
+}
+
+// showDetails shows the cover and tags of a file table row. The cover is
+// loaded in the background and dropped when another row was selected meanwhile.
+func (s *AppState) showDetails(row int) {
+	if s.detailsImage == nil || row < 0 || row >= len(s.files) {
+		return
+	}
+	file := s.files[row]
+	var lines []string
+	if file.Artist != "" || file.Title != "" {
+		lines = append(lines, strings.TrimSpace(file.Artist+" - "+file.Title))
+	}
+	if file.Label != "" {
+		lines = append(lines, file.Label)
+	}
+	var facts []string
+	if file.Year > 0 {
+		facts = append(facts, fmt.Sprint(file.Year))
+	}
+	if file.BPM > 0 {
+		facts = append(facts, formatBPM(file.BPM)+" BPM")
+	}
+	if file.Key != "" {
+		facts = append(facts, file.Key)
+	}
+	if file.Duration > 0 {
+		facts = append(facts, traktor.FormatDuration(file.Duration))
+	}
+	if len(facts) > 0 {
+		lines = append(lines, strings.Join(facts, " · "))
+	}
+	lines = append(lines, file.Path)
+	s.detailsText.SetText(strings.Join(lines, "\n"))
+
+	s.detailsPath = file.Path
+	s.showWaveform(file)
+	s.detailsImage.File = ""
+	s.detailsImage.Refresh()
+	source := coverSource(file)
+	go func() {
+		thumbnail, err := coverCache.Thumbnail(source, coverart.SizeDetails)
+		fyne.Do(func() {
+			if s.detailsPath != file.Path || err != nil {
+				return
+			}
+			s.detailsImage.File = thumbnail
+			s.detailsImage.Refresh()
+		})
+	}()
+}
+
+// showWaveform shows the markers of a file table row right away and its
+// overview once it is computed. Computing the overview of the previous row
+// is stopped.
+func (s *AppState) showWaveform(file FileItem) {
+	if s.stopWaveform != nil {
+		s.stopWaveform()
+	}
+	s.detailsMarker.SetText("")
+	s.detailsWaveform.SetTrack(file.CuePoints, file.Duration)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopWaveform = cancel
+	go func() {
+		overview, err := waveformCache.Overview(ctx, file.Path)
+		fyne.Do(func() {
+			if s.detailsPath != file.Path || err != nil {
+				return
+			}
+			s.detailsWaveform.SetOverview(overview)
+		})
+	}()
+}
@@ -0,0 +1,81 @@
+package windows
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/drivesync"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// showDriveSyncDialog copies the chosen Traktor playlists onto a USB stick
+func showDriveSyncDialog(state *AppState) {
+	collection := traktor.GetCollection()
+	if collection == nil || len(collection.Playlists) == 0 {
+		dialog.ShowError(errors.New("Traktor collection has no playlists"), state.window)
+		return
+	}
+
+	paths := make([]string, len(collection.Playlists))
+	for i, playlist := range collection.Playlists {
+		paths[i] = playlist.Path
+	}
+	playlistChecks := widget.NewCheckGroup(paths, nil)
+	if playlist := state.selectedPlaylist(); playlist != nil {
+		playlistChecks.SetSelected([]string{playlist.Path})
+	}
+	playlistScroll := container.NewVScroll(playlistChecks)
+	playlistScroll.SetMinSize(fyne.NewSize(350, 250))
+
+	preferences := fyne.CurrentApp().Preferences()
+	layoutEntry := widget.NewSelectEntry(drivesync.Layouts)
+	layoutEntry.SetText(preferences.StringWithFallback("driveSyncLayout", drivesync.LayoutArtistAlbum))
+	musicEntry := widget.NewEntry()
+	musicEntry.SetText(preferences.StringWithFallback("driveSyncMusicFolder", "Music"))
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Playlists", playlistScroll),
+		widget.NewFormItem("Layout", layoutEntry),
+		widget.NewFormItem("Music folder", musicEntry),
+	}
+
+	dialog.ShowForm("Sync playlists to drive", "Choose drive", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		opts := drivesync.Options{
+			Layout:      layoutEntry.Text,
+			MusicFolder: musicEntry.Text,
+		}
+		for _, path := range playlistChecks.Selected {
+			if playlist := collection.GetPlaylistByPath(path); playlist != nil {
+				opts.Playlists = append(opts.Playlists, playlist)
+			}
+		}
+		preferences.SetString("driveSyncLayout", opts.Layout)
+		preferences.SetString("driveSyncMusicFolder", opts.MusicFolder)
+
+		dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err != nil || dir == nil {
+				return
+			}
+			result, err := drivesync.Sync(dir.Path(), collection, opts)
+			if err != nil {
+				dialog.ShowError(err, state.window)
+				return
+			}
+			message := fmt.Sprintf("Copied %d files, %d unchanged, removed %d, wrote %d playlists",
+				result.Copied, result.Skipped, result.Removed, len(result.Playlists))
+			if len(result.Missing) > 0 {
+				missing := result.Missing[:min(len(result.Missing), 10)]
+				message += fmt.Sprintf("\n\n%d files not found:\n%s", len(result.Missing), strings.Join(missing, "\n"))
+			}
+			dialog.ShowInformation("Sync playlists to drive", message, state.window)
+		}, state.window)
+	}, state.window)
+}
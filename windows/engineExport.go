@@ -0,0 +1,57 @@
+package windows
+
+import (
+	"errors"
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/engine"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// showEngineExportDialog writes the selected playlist, or the whole collection
+// when no playlist is selected, into the Engine DJ library on a drive and
+// reads it back to check it
+func showEngineExportDialog(state *AppState) {
+	collection := traktor.GetCollection()
+	if collection == nil {
+		dialog.ShowError(errors.New("Traktor collection is not available"), state.window)
+		return
+	}
+	opts := engine.ExportOptions{}
+	if playlist := state.selectedPlaylist(); playlist != nil {
+		opts.Playlists = []*traktor.Playlist{playlist}
+	}
+
+	copyCheck := widget.NewCheck("Copy audio files to the drive", nil)
+	copyCheck.SetChecked(true)
+	items := []*widget.FormItem{
+		widget.NewFormItem("Files", copyCheck),
+	}
+
+	dialog.ShowForm("Export Engine DJ library", "Choose drive", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		opts.CopyFiles = copyCheck.Checked
+
+		dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err != nil || dir == nil {
+				return
+			}
+			if err := engine.Export(dir.Path(), collection, opts); err != nil {
+				dialog.ShowError(err, state.window)
+				return
+			}
+			// Read the library back to make sure the players will see the export
+			if err := engine.Verify(dir.Path(), collection, opts); err != nil {
+				dialog.ShowError(err, state.window)
+				return
+			}
+			dialog.ShowInformation("Export Engine DJ library",
+				fmt.Sprintf("Wrote and checked %s", engine.DatabasePath(dir.Path())), state.window)
+		}, state.window)
+	}, state.window)
+}
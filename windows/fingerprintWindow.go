@@ -0,0 +1,124 @@
+package windows
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/analysis"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// indexCollection brings the fingerprint index of the collection up to date
+// behind a progress dialog that can stop it. done gets the index on the UI
+// thread unless indexing was stopped.
+func indexCollection(state *AppState, title string, done func(collection *traktor.TraktorCollection, index *analysis.FingerprintIndex)) {
+	collection := traktor.GetCollection()
+	if collection == nil {
+		dialog.ShowError(errors.New("Traktor collection is not available"), state.window)
+		return
+	}
+	index, err := analysis.OpenFingerprintIndex(analysis.FingerprintIndexPath(collection))
+	if err != nil {
+		dialog.ShowError(err, state.window)
+		return
+	}
+
+	bar := widget.NewProgressBar()
+	status := widget.NewLabel("Fingerprinting new and changed tracks")
+	ctx, cancel := context.WithCancel(context.Background())
+	progress := dialog.NewCustom(title, "Stop", container.NewVBox(status, bar), state.window)
+	progress.SetOnClosed(cancel)
+	progress.Resize(fyne.NewSize(400, 0))
+	progress.Show()
+
+	go func() {
+		_, err := index.Update(ctx, analysis.CollectionPaths(collection), 0, func(finished, total int) {
+			fyne.Do(func() {
+				bar.Max = float64(total)
+				bar.SetValue(float64(finished))
+			})
+		})
+		saveErr := index.Save()
+		fyne.Do(func() {
+			progress.Hide()
+			if err != nil {
+				return
+			}
+			if saveErr != nil {
+				dialog.ShowError(saveErr, state.window)
+				return
+			}
+			done(collection, index)
+		})
+	}()
+}
+
+// showDuplicatesDialog lists the collection tracks that have the same audio,
+// such as copies of a track in other formats or bitrates
+func showDuplicatesDialog(state *AppState) {
+	indexCollection(state, "Find duplicate audio", func(collection *traktor.TraktorCollection, index *analysis.FingerprintIndex) {
+		groups := analysis.FindDuplicateTracks(collection, index)
+		if len(groups) == 0 {
+			dialog.ShowInformation("Find duplicate audio", fmt.Sprintf("No duplicates among %d tracks", index.Len()), state.window)
+			return
+		}
+		var lines []string
+		for _, group := range groups {
+			for _, track := range group {
+				lines = append(lines, fmt.Sprintf("%s  %s", analysis.TrackName(track), track.FilePath))
+			}
+			lines = append(lines, "")
+		}
+		showTextReport(state, "Find duplicate audio", fmt.Sprintf("%d groups of tracks with the same audio", len(groups)), strings.Join(lines, "\n"))
+	})
+}
+
+// showAudioSearchDialog asks for an audio file and lists the collection
+// tracks with the same audio, whatever its tags say
+func showAudioSearchDialog(state *AppState) {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		path := reader.URI().Path()
+		reader.Close()
+
+		indexCollection(state, "Find tracks by audio", func(collection *traktor.TraktorCollection, index *analysis.FingerprintIndex) {
+			go func() {
+				matches, err := analysis.FindMatchingTracks(context.Background(), collection, index, path)
+				fyne.Do(func() {
+					if err != nil {
+						dialog.ShowError(err, state.window)
+						return
+					}
+					if len(matches) == 0 {
+						dialog.ShowInformation("Find tracks by audio", "No collection track has the audio of "+path, state.window)
+						return
+					}
+					var lines []string
+					for _, match := range matches {
+						lines = append(lines, fmt.Sprintf("%s (%.0f%%, from %s)  %s", analysis.TrackName(match.Track),
+							match.Score*100, traktor.FormatDuration(match.Offset), match.Track.FilePath))
+					}
+					showTextReport(state, "Find tracks by audio", fmt.Sprintf("%d tracks match %s", len(matches), path), strings.Join(lines, "\n"))
+				})
+			}()
+		})
+	}, state.window)
+}
+
+// showTextReport shows a summary above a scrolling text
+func showTextReport(state *AppState, title, summary, text string) {
+	report := widget.NewTextGrid()
+	report.SetText(text)
+	scroll := container.NewScroll(report)
+	scroll.SetMinSize(fyne.NewSize(900, 400))
+	content := container.NewBorder(widget.NewLabel(summary), nil, nil, nil, scroll)
+	dialog.ShowCustom(title, "Close", content, state.window)
+}
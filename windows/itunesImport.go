@@ -0,0 +1,74 @@
+package windows
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/itunes"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// copyITunesPlaylists copies the iTunes playlist or playlist folder selected in
+// the tree, or all iTunes playlists, into the Traktor collection
+func copyITunesPlaylists(state *AppState) {
+	collection := traktor.GetCollection()
+	if collection == nil {
+		dialog.ShowError(errors.New("Traktor collection is not available"), state.window)
+		return
+	}
+	if !itunes.IsAvailable() {
+		dialog.ShowError(errors.New("select an iTunes Library.xml in the tree first"), state.window)
+		return
+	}
+	library := itunes.GetLibrary()
+	if library == nil {
+		dialog.ShowError(fmt.Errorf("could not read iTunes library: %w", itunes.LoadError()), state.window)
+		return
+	}
+
+	var playlists []*traktor.Playlist
+	folder := strings.TrimPrefix(strings.TrimPrefix(state.selectedPath, itunes.PlaylistPrefix), "/")
+	if !strings.HasPrefix(state.selectedPath, itunes.PlaylistPrefix) {
+		folder = ""
+	}
+	for i := range library.Playlists {
+		playlist := &library.Playlists[i]
+		if folder == "" || playlist.Path == folder || strings.HasPrefix(playlist.Path, folder+"/") {
+			playlists = append(playlists, playlist)
+		}
+	}
+	if len(playlists) == 0 {
+		dialog.ShowError(errors.New("no iTunes playlists to copy"), state.window)
+		return
+	}
+
+	message := fmt.Sprintf("Copy %d iTunes playlists into the Traktor folder %s?", len(playlists), itunes.ImportFolder)
+	dialog.ShowConfirm("Copy iTunes playlists", message, func(ok bool) {
+		if !ok {
+			return
+		}
+		result, err := itunes.CopyPlaylists(collection, playlists)
+		if err == nil && len(result.Created) > 0 {
+			err = collection.Save()
+		}
+		if err != nil {
+			dialog.ShowError(err, state.window)
+			return
+		}
+		state.refreshPlaylists()
+
+		summary := widget.NewLabel(fmt.Sprintf("Created %d playlists, %d already existed, %d tracks not in the collection",
+			len(result.Created), len(result.Existing), len(result.Unmatched)))
+		unmatched := widget.NewMultiLineEntry()
+		unmatched.SetText(strings.Join(result.Unmatched, "\n"))
+		unmatched.Wrapping = fyne.TextWrapOff
+		d := dialog.NewCustom("Copy iTunes playlists", "Close", container.NewBorder(summary, nil, nil, nil, unmatched), state.window)
+		d.Resize(fyne.NewSize(700, 400))
+		d.Show()
+	}, state.window)
+}
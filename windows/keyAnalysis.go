@@ -0,0 +1,159 @@
+package windows
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/analysis"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// acceptConfidence is the key confidence from which a detected key is
+// preselected for writing
+const acceptConfidence = 0.5
+
+// showKeyCheckDialog detects the key of the selected playlist, or the whole
+// collection, and lists the tracks where it disagrees with Traktor. The
+// detected keys of the checked tracks can be written to the collection or
+// the file tags.
+func showKeyCheckDialog(state *AppState) {
+	analyseSelectedTracks(state, "Check keys", func(collection *traktor.TraktorCollection, analysed []trackAnalysis, total int) {
+		var checks []analysis.KeyCheck
+		for _, a := range analysed {
+			if check := analysis.CheckKey(a.track, a.result, a.err); check.Disagrees() {
+				checks = append(checks, check)
+			}
+		}
+		if len(checks) == 0 {
+			dialog.ShowInformation("Check keys", analysisSummary(0, len(analysed), total), state.window)
+			return
+		}
+		showKeyReport(state, collection, checks, analysisSummary(len(checks), len(analysed), total))
+	})
+}
+
+// showKeyReport lists the disagreeing keys with a check box for each track
+// whose detected key can be accepted
+func showKeyReport(state *AppState, collection *traktor.TraktorCollection, checks []analysis.KeyCheck, summary string) {
+	preferences := fyne.CurrentApp().Preferences()
+	notation := traktor.KeyNotation(preferences.IntWithFallback("tagSyncNotation", int(traktor.NotationCamelot)))
+	selected := make([]bool, len(checks))
+	for i, check := range checks {
+		selected[i] = check.Acceptable() && check.Detected.Confidence >= acceptConfidence
+	}
+
+	list := widget.NewList(
+		func() int { return len(checks) },
+		func() fyne.CanvasObject { return widget.NewCheck("", nil) },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			box := item.(*widget.Check)
+			box.OnChanged = nil
+			box.SetText(keyCheckLine(checks[id], notation))
+			box.SetChecked(selected[id])
+			if checks[id].Acceptable() {
+				box.Enable()
+			} else {
+				box.Disable()
+			}
+			box.OnChanged = func(checked bool) {
+				selected[id] = checked
+			}
+		},
+	)
+	notationSelect := widget.NewSelect(keyNotations, nil)
+	notationSelect.SetSelectedIndex(int(notation))
+	notationSelect.OnChanged = func(string) {
+		notation = traktor.KeyNotation(notationSelect.SelectedIndex())
+		preferences.SetInt("tagSyncNotation", int(notation))
+		list.Refresh()
+	}
+
+	// accepted returns the checks selected for writing
+	accepted := func() []analysis.KeyCheck {
+		var result []analysis.KeyCheck
+		for i, check := range checks {
+			if selected[i] && check.Acceptable() {
+				result = append(result, check)
+			}
+		}
+		return result
+	}
+	var report dialog.Dialog
+	toCollection := widget.NewButton("Write to collection", func() {
+		failed := make(map[string]error)
+		written := 0
+		for _, check := range accepted() {
+			if err := analysis.AcceptKey(collection, check.Track, check.Detected.Value, notation); err != nil {
+				failed[check.Track.FilePath] = err
+				continue
+			}
+			written++
+		}
+		if written > 0 {
+			if err := collection.Save(); err != nil {
+				dialog.ShowError(err, state.window)
+				return
+			}
+			state.loadFilesForPath(state.selectedPath)
+		}
+		report.Hide()
+		showKeyWriteResult(state, written, failed)
+	})
+	toTags := widget.NewButton("Write to file tags", func() {
+		failed := make(map[string]error)
+		written := 0
+		for _, check := range accepted() {
+			if err := analysis.WriteKeyTag(check.Track.FilePath, check.Detected.Value, notation); err != nil {
+				failed[check.Track.FilePath] = err
+				continue
+			}
+			written++
+		}
+		report.Hide()
+		showKeyWriteResult(state, written, failed)
+	})
+
+	top := container.NewVBox(widget.NewLabel(summary),
+		container.NewHBox(widget.NewLabel("Key notation"), notationSelect))
+	bottom := container.NewHBox(toCollection, toTags)
+	content := container.NewBorder(top, bottom, nil, nil, list)
+	report = dialog.NewCustom("Check keys", "Close", content, state.window)
+	report.Resize(fyne.NewSize(900, 550))
+	report.Show()
+}
+
+// keyCheckLine describes a disagreeing key in one line
+func keyCheckLine(check analysis.KeyCheck, notation traktor.KeyNotation) string {
+	name := analysis.TrackName(check.Track)
+	library := traktor.KeyValueToNotation(check.Library, notation)
+	if library == "" {
+		library = "none"
+	}
+	if check.Err != nil {
+		return fmt.Sprintf("%s: Traktor %s, %v", name, library, check.Err)
+	}
+	line := fmt.Sprintf("%s: Traktor %s, detected %s (%.0f%%), %s", name, library,
+		traktor.KeyValueToNotation(check.Detected.Value, notation), check.Detected.Confidence*100, check.Verdict)
+	if check.TextDiffers() {
+		line += fmt.Sprintf(", key text %q", strings.TrimSpace(check.Track.Key))
+	}
+	return line
+}
+
+// showKeyWriteResult reports how many keys were written and which failed
+func showKeyWriteResult(state *AppState, written int, failed map[string]error) {
+	if len(failed) == 0 {
+		dialog.ShowInformation("Check keys", fmt.Sprintf("Wrote %d keys", written), state.window)
+		return
+	}
+	var lines []string
+	for path, err := range failed {
+		lines = append(lines, fmt.Sprintf("%s: %v", filepath.Base(path), err))
+	}
+	dialog.ShowError(fmt.Errorf("%d keys could not be written:\n%s", len(failed), strings.Join(lines, "\n")), state.window)
+}
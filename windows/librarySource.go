@@ -0,0 +1,225 @@
+package windows
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"github.com/ilmarkerm/djlibgo/itunes"
+	"github.com/ilmarkerm/djlibgo/mixxx"
+	"github.com/ilmarkerm/djlibgo/rekordbox"
+	"github.com/ilmarkerm/djlibgo/serato"
+	"github.com/ilmarkerm/djlibgo/traktor"
+	"github.com/ilmarkerm/djlibgo/virtualdj"
+)
+
+// librarySource is a library of another DJ application that is browsed in the
+// tree next to Traktor. The library location is kept in the preferences.
+type librarySource struct {
+	label            string
+	prefix           string
+	playlistPrefix   string
+	collectionPrefix string
+	preference       string
+	// folder is set when the library location is a folder instead of a file
+	folder bool
+	// defaultPath returns the usual library location when none is configured
+	defaultPath   func() string
+	setPath       func(string)
+	isAvailable   func() bool
+	library       func() *traktor.TraktorCollection
+	loadError     func() error
+	playlistNames func() []string
+	playlist      func(string) *traktor.Playlist
+}
+
+// librarySources lists the browsable libraries in tree order
+var librarySources = []*librarySource{
+	{
+		label:            "Rekordbox",
+		prefix:           rekordbox.Prefix,
+		playlistPrefix:   rekordbox.PlaylistPrefix,
+		collectionPrefix: rekordbox.CollectionPrefix,
+		preference:       "rekordboxXML",
+		setPath:          rekordbox.SetLibraryPath,
+		isAvailable:      rekordbox.IsAvailable,
+		library:          rekordbox.GetLibrary,
+		loadError:        rekordbox.LoadError,
+		playlistNames:    rekordbox.GetSortedPlaylistNames,
+		playlist:         rekordbox.GetPlaylistByName,
+	},
+	{
+		label:            "Serato",
+		prefix:           serato.Prefix,
+		playlistPrefix:   serato.PlaylistPrefix,
+		collectionPrefix: serato.CollectionPrefix,
+		preference:       "seratoFolder",
+		folder:           true,
+		setPath:          serato.SetLibraryPath,
+		isAvailable:      serato.IsAvailable,
+		library:          serato.GetLibrary,
+		loadError:        serato.LoadError,
+		playlistNames:    serato.GetSortedPlaylistNames,
+		playlist:         serato.GetPlaylistByName,
+	},
+	{
+		label:            "Mixxx",
+		prefix:           mixxx.Prefix,
+		playlistPrefix:   mixxx.PlaylistPrefix,
+		collectionPrefix: mixxx.CollectionPrefix,
+		preference:       "mixxxDatabase",
+		defaultPath:      mixxx.DefaultDatabasePath,
+		setPath:          mixxx.SetLibraryPath,
+		isAvailable:      mixxx.IsAvailable,
+		library:          mixxx.GetLibrary,
+		loadError:        mixxx.LoadError,
+		playlistNames:    mixxx.GetSortedPlaylistNames,
+		playlist:         mixxx.GetPlaylistByName,
+	},
+	{
+		label:            "VirtualDJ",
+		prefix:           virtualdj.Prefix,
+		playlistPrefix:   virtualdj.PlaylistPrefix,
+		collectionPrefix: virtualdj.CollectionPrefix,
+		preference:       "virtualdjDatabase",
+		defaultPath:      virtualdj.DefaultDatabasePath,
+		setPath:          virtualdj.SetLibraryPath,
+		isAvailable:      virtualdj.IsAvailable,
+		library:          virtualdj.GetLibrary,
+		loadError:        virtualdj.LoadError,
+		playlistNames:    virtualdj.GetSortedPlaylistNames,
+		playlist:         virtualdj.GetPlaylistByName,
+	},
+	{
+		label:            "iTunes",
+		prefix:           itunes.Prefix,
+		playlistPrefix:   itunes.PlaylistPrefix,
+		collectionPrefix: itunes.CollectionPrefix,
+		preference:       "itunesLibrary",
+		defaultPath:      itunes.DefaultLibraryPath,
+		setPath:          itunes.SetLibraryPath,
+		isAvailable:      itunes.IsAvailable,
+		library:          itunes.GetLibrary,
+		loadError:        itunes.LoadError,
+		playlistNames:    itunes.GetSortedPlaylistNames,
+		playlist:         itunes.GetPlaylistByName,
+	},
+}
+
+// sourceForPath returns the library source a tree path belongs to, or nil
+func sourceForPath(path string) *librarySource {
+	for _, source := range librarySources {
+		if strings.HasPrefix(path, source.prefix) {
+			return source
+		}
+	}
+	return nil
+}
+
+// loadLibrarySources restores the library locations from the preferences
+func loadLibrarySources(prefs fyne.Preferences) {
+	for _, source := range librarySources {
+		path := prefs.String(source.preference)
+		if path == "" && source.defaultPath != nil {
+			path = source.defaultPath()
+		}
+		source.setPath(path)
+	}
+}
+
+// configured reports whether a library location is kept in the preferences
+func (source *librarySource) configured() bool {
+	return fyne.CurrentApp().Preferences().String(source.preference) != ""
+}
+
+// playlistForPath returns the playlist of a playlist tree node, or nil
+func (source *librarySource) playlistForPath(path string) *traktor.Playlist {
+	if !strings.HasPrefix(path, source.playlistPrefix+"/") {
+		return nil
+	}
+	return source.playlist(strings.TrimPrefix(path, source.playlistPrefix+"/"))
+}
+
+// childNodes returns the playlists and playlist folders directly below the
+// playlists node or a playlist folder. Names containing "/" are nested.
+func (source *librarySource) childNodes(path string) []TreeNodeUID {
+	folder := strings.TrimPrefix(strings.TrimPrefix(path, source.playlistPrefix), "/")
+	if folder != "" {
+		folder += "/"
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range source.playlistNames() {
+		if !strings.HasPrefix(name, folder) {
+			continue
+		}
+		child, _, _ := strings.Cut(strings.TrimPrefix(name, folder), "/")
+		if !seen[child] {
+			seen[child] = true
+			names = append(names, child)
+		}
+	}
+	return playlistNodes(strings.TrimSuffix(source.playlistPrefix+"/"+folder, "/"), names)
+}
+
+// isPlaylistFolder checks if a node below the playlists node has playlists
+// nested below it
+func (source *librarySource) isPlaylistFolder(path string) bool {
+	if !strings.HasPrefix(path, source.playlistPrefix+"/") {
+		return false
+	}
+	folder := strings.TrimPrefix(path, source.playlistPrefix+"/") + "/"
+	for _, name := range source.playlistNames() {
+		if strings.HasPrefix(name, folder) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportLoadError shows why the library of the source could not be loaded.
+// Each error is shown once, not every time the tree asks for the library.
+func (s *AppState) reportLoadError(source *librarySource) {
+	err := source.loadError()
+	if err == nil || errors.Is(err, s.loadErrors[source]) {
+		return
+	}
+	s.loadErrors[source] = err
+	dialog.ShowError(fmt.Errorf("could not read %s library: %w", source.label, err), s.window)
+}
+
+// chooseLibrary asks for the location of the source's library
+func (s *AppState) chooseLibrary(source *librarySource) {
+	apply := func(path string) {
+		source.setPath(path)
+		if source.library() == nil {
+			s.reportLoadError(source)
+			return
+		}
+		fyne.CurrentApp().Preferences().SetString(source.preference, path)
+		delete(s.treeData, TreeNodeUID(source.prefix))
+		delete(s.treeData, TreeNodeUID(source.playlistPrefix))
+		s.tree.Refresh()
+		s.tree.OpenBranch(source.prefix)
+	}
+
+	if source.folder {
+		dialog.ShowFolderOpen(func(uri fyne.ListableURI, err error) {
+			if err != nil || uri == nil {
+				return
+			}
+			apply(uri.Path())
+		}, s.window)
+		return
+	}
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		path := reader.URI().Path()
+		reader.Close()
+		apply(path)
+	}, s.window)
+}
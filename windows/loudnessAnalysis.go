@@ -0,0 +1,104 @@
+package windows
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/analysis"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// loudnessTargets are the target loudness levels offered in the report
+var loudnessTargets = []struct {
+	name  string
+	level float64
+}{
+	{"-9 LUFS (club)", -9},
+	{"-14 LUFS (streaming)", -14},
+	{"-16 LUFS", -16},
+	{"-18 LUFS (ReplayGain)", analysis.ReplayGainReference},
+	{"-23 LUFS (EBU R128)", -23},
+}
+
+// showLoudnessDialog measures the loudness of the selected playlist, or the
+// whole collection, and lists the gain each track needs to reach a target
+// loudness. ReplayGain tags can be written with the tracks as one album.
+func showLoudnessDialog(state *AppState) {
+	analyseSelectedTracks(state, "Loudness", func(_ *traktor.TraktorCollection, analysed []trackAnalysis, total int) {
+		entries := make([]analysis.LoudnessEntry, len(analysed))
+		measured := 0
+		for i, a := range analysed {
+			if a.err == nil {
+				measured++
+			}
+			entries[i] = analysis.LoudnessEntry{
+				Name:     analysis.TrackName(a.track),
+				Path:     a.track.FilePath,
+				Loudness: a.result.Loudness,
+				Err:      a.err,
+			}
+		}
+
+		preferences := fyne.CurrentApp().Preferences()
+		target := preferences.FloatWithFallback("loudnessTarget", -14)
+		report := widget.NewTextGrid()
+		report.SetText(analysis.LoudnessReport(entries, target))
+
+		names := make([]string, len(loudnessTargets))
+		for i, option := range loudnessTargets {
+			names[i] = option.name
+		}
+		targetSelect := widget.NewSelect(names, func(name string) {
+			for _, option := range loudnessTargets {
+				if option.name == name {
+					target = option.level
+				}
+			}
+			preferences.SetFloat("loudnessTarget", target)
+			report.SetText(analysis.LoudnessReport(entries, target))
+		})
+		for _, option := range loudnessTargets {
+			if option.level == target {
+				targetSelect.SetSelected(option.name)
+			}
+		}
+
+		writeTags := widget.NewButton("Write ReplayGain tags", func() {
+			message := fmt.Sprintf("Write ReplayGain track and album tags to %d files? The album gain covers all of them.", measured)
+			dialog.ShowConfirm("Write ReplayGain tags", message, func(ok bool) {
+				if ok {
+					showReplayGainResult(state, measured, analysis.WriteReplayGain(entries))
+				}
+			}, state.window)
+		})
+
+		summary := fmt.Sprintf("%d of %d tracks measured", measured, len(analysed))
+		if len(analysed) < total {
+			summary += fmt.Sprintf(", stopped after %d of %d tracks", len(analysed), total)
+		}
+		scroll := container.NewScroll(report)
+		scroll.SetMinSize(fyne.NewSize(900, 400))
+		top := container.NewVBox(widget.NewLabel(summary),
+			container.NewHBox(widget.NewLabel("Target loudness"), targetSelect))
+		content := container.NewBorder(top, writeTags, nil, nil, scroll)
+		dialog.ShowCustom("Loudness", "Close", content, state.window)
+	})
+}
+
+// showReplayGainResult reports how many files were tagged and which failed
+func showReplayGainResult(state *AppState, measured int, failed map[string]error) {
+	if len(failed) == 0 {
+		dialog.ShowInformation("Loudness", fmt.Sprintf("Wrote ReplayGain tags to %d files", measured), state.window)
+		return
+	}
+	var lines []string
+	for path, err := range failed {
+		lines = append(lines, fmt.Sprintf("%s: %v", filepath.Base(path), err))
+	}
+	dialog.ShowError(fmt.Errorf("%d files could not be tagged:\n%s", len(failed), strings.Join(lines, "\n")), state.window)
+}
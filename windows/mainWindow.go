@@ -1,40 +1,80 @@
 package windows
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
+	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/coverart"
+	"github.com/ilmarkerm/djlibgo/tags"
 	"github.com/ilmarkerm/djlibgo/traktor"
 )
 
+// fileColumns are the columns of the file table. The first one shows the cover.
+var fileColumns = []string{"", "Artist", "Title", "Label", "Year", "BPM", "Key", "Length", "Size"}
+
 // TreeNodeUID represents a unique identifier for tree nodes
 type TreeNodeUID string
 
 // AppState holds the application state
 type AppState struct {
+	window       fyne.Window
 	selectedPath string
 	fileTable    *widget.Table
 	files        []FileItem
 	tree         *widget.Tree
 	treeData     map[TreeNodeUID][]TreeNodeUID
+	// loadGeneration changes with every loadFilesForPath call, so tag reads
+	// for a folder that is no longer shown are dropped
+	loadGeneration int
+	// stopFolderAnalysis cancels the analysis of the shown folder
+	stopFolderAnalysis context.CancelFunc
+	// thumbnails maps audio files to their row thumbnail, "" for no cover
+	thumbnails        map[string]string
+	pendingThumbnails map[string]bool
+	detailsImage      *canvas.Image
+	detailsText       *widget.Label
+	detailsPath       string
+	detailsWaveform   *waveformView
+	detailsMarker     *widget.Label
+	// stopWaveform cancels computing the overview of the previous row
+	stopWaveform context.CancelFunc
+	// loadErrors holds the library load error last shown for each source
+	loadErrors map[*librarySource]error
 }
 
 // FileItem represents a file in the file list
 type FileItem struct {
-	Artist string
-	Title  string
-	Label  string
-	Year   int
-	Path   string
-	Size   int64
+	Artist   string
+	Title    string
+	Label    string
+	Key      string
+	Year     int
+	BPM      float64
+	Duration float64
+	Path     string
+	Size     int64
+	// CoverArtID is the Traktor cover of collection tracks
+	CoverArtID string
+	// BPMDetected and KeyDetected mark values from the analysis rather
+	// than the tags
+	BPMDetected bool
+	KeyDetected bool
+	// CuePoints are the markers of collection tracks
+	CuePoints []traktor.CuePoint
 }
 
 // NewAppState creates a new application state
@@ -42,7 +82,10 @@ func NewAppState() *AppState {
 	return &AppState{
 		treeData: make(map[TreeNodeUID][]TreeNodeUID),
 		//treePaths: make(map[TreeNodeUID]string),
-		files: []FileItem{},
+		files:             []FileItem{},
+		thumbnails:        make(map[string]string),
+		pendingThumbnails: make(map[string]bool),
+		loadErrors:        make(map[*librarySource]error),
 	}
 }
 
@@ -51,7 +94,7 @@ func (s *AppState) getMusicTreeRoot() []TreeNodeUID {
 	var roots []TreeNodeUID
 
 	// Add special entries accounts
-	for _, name := range []string{"plex", "bandcamp", "traktor", "rekordbox"} {
+	for _, name := range []string{"plex", "bandcamp", "traktor"} {
 		if name == "traktor" && traktor.IsAvailable() {
 			uid := TreeNodeUID(traktor.Prefix)
 			//s.treePaths[uid] = traktorPrefix
@@ -63,6 +106,14 @@ func (s *AppState) getMusicTreeRoot() []TreeNodeUID {
 		}
 	}
 
+	// Libraries are listed when found or configured. Selecting one whose
+	// location is gone asks for it again.
+	for _, source := range librarySources {
+		if source.isAvailable() || source.configured() {
+			roots = append(roots, TreeNodeUID(source.prefix))
+		}
+	}
+
 	// Get user's home directory
 	homeDir, err := os.UserHomeDir()
 	if err == nil {
@@ -74,6 +125,25 @@ func (s *AppState) getMusicTreeRoot() []TreeNodeUID {
 	return roots
 }
 
+// refreshPlaylists reloads the Traktor playlist node after playlists were added
+func (s *AppState) refreshPlaylists() {
+	delete(s.treeData, TreeNodeUID(traktor.PlaylistPrefix))
+	if s.tree != nil {
+		s.tree.Refresh()
+	}
+}
+
+// selectedPlaylist returns the Traktor or library source playlist selected in the tree, or nil
+func (s *AppState) selectedPlaylist() *traktor.Playlist {
+	if strings.HasPrefix(s.selectedPath, traktor.PlaylistPrefix+"/") {
+		return traktor.GetPlaylistByPath(strings.TrimPrefix(s.selectedPath, traktor.PlaylistPrefix+"/"))
+	}
+	if source := sourceForPath(s.selectedPath); source != nil {
+		return source.playlistForPath(s.selectedPath)
+	}
+	return nil
+}
+
 // loadChildren loads children for a given tree node
 func (s *AppState) loadChildren(uid TreeNodeUID) []TreeNodeUID {
 	if children, exists := s.treeData[uid]; exists {
@@ -92,12 +162,18 @@ func (s *AppState) loadChildren(uid TreeNodeUID) []TreeNodeUID {
 			children = append(children, TreeNodeUID(traktor.PlaylistPrefix))
 			children = append(children, TreeNodeUID(traktor.CollectionPrefix))
 		} else if path == traktor.PlaylistPrefix {
-			for _, entry := range traktor.GetSortedPlaylistNames() {
-				if strings.HasPrefix(entry, "_") {
-					continue
-				}
-				children = append(children, TreeNodeUID(fmt.Sprintf("%s/%s", traktor.PlaylistPrefix, entry)))
-			}
+			children = playlistNodes(traktor.PlaylistPrefix, traktor.GetSortedPlaylistPaths())
+		}
+	} else if source := sourceForPath(path); source != nil {
+		if !source.isAvailable() {
+			return nil
+		}
+		if path == source.prefix {
+			children = append(children, TreeNodeUID(source.playlistPrefix))
+			children = append(children, TreeNodeUID(source.collectionPrefix))
+		} else if path == source.playlistPrefix || source.isPlaylistFolder(path) {
+			children = source.childNodes(path)
+			s.reportLoadError(source)
 		}
 	} else {
 		// File handling
@@ -127,6 +203,19 @@ func (s *AppState) loadChildren(uid TreeNodeUID) []TreeNodeUID {
 	return children
 }
 
+// playlistNodes returns the tree nodes for the playlist names below prefix
+func playlistNodes(prefix string, names []string) []TreeNodeUID {
+	var children []TreeNodeUID
+	for _, entry := range names {
+		// Hide internal playlists like _LOOPS and _RECORDINGS
+		if strings.HasPrefix(entry, "_") {
+			continue
+		}
+		children = append(children, TreeNodeUID(fmt.Sprintf("%s/%s", prefix, entry)))
+	}
+	return children
+}
+
 // getNodeLabel returns the display label for a tree node
 func (s *AppState) getNodeLabel(uid TreeNodeUID) string {
 	path := string(uid)
@@ -144,7 +233,19 @@ func (s *AppState) getNodeLabel(uid TreeNodeUID) string {
 		case traktor.CollectionPrefix:
 			return "Collection"
 		default:
-			parts := strings.Split(path, "/")
+			// Playlists are listed flat, so the folders tell same-named ones apart
+			return strings.TrimPrefix(path, traktor.PlaylistPrefix+"/")
+		}
+	} else if source := sourceForPath(path); source != nil {
+		switch path {
+		case source.prefix:
+			return source.label
+		case source.playlistPrefix:
+			return "Playlists"
+		case source.collectionPrefix:
+			return "Collection"
+		default:
+			parts := strings.Split(strings.TrimPrefix(path, source.playlistPrefix+"/"), "/")
 			return parts[len(parts)-1]
 		}
 	} else if strings.HasPrefix(path, "special://") {
@@ -162,6 +263,12 @@ func (s *AppState) getNodeLabel(uid TreeNodeUID) string {
 // loadFilesForPath loads files for the given directory path
 func (s *AppState) loadFilesForPath(dirPath string) {
 	s.files = []FileItem{}
+	s.loadGeneration++
+	if s.stopFolderAnalysis != nil {
+		s.stopFolderAnalysis()
+		s.stopFolderAnalysis = nil
+	}
+	readTags := false
 
 	if dirPath == "" {
 		if s.fileTable != nil {
@@ -171,18 +278,21 @@ func (s *AppState) loadFilesForPath(dirPath string) {
 	}
 
 	if strings.HasPrefix(dirPath, traktor.PlaylistPrefix) {
-		parts := strings.Split(dirPath, "/")
-		pl := traktor.GetPlaylistByName(parts[len(parts)-1])
+		pl := traktor.GetPlaylistByPath(strings.TrimPrefix(dirPath, traktor.PlaylistPrefix+"/"))
 		if pl != nil && pl.Tracks != nil {
-			for _, track := range pl.Tracks {
-				item := FileItem{
-					Artist: track.Artist,
-					Title:  track.Title,
-					Label:  track.Label,
-					Path:   track.FilePath,
-					Size:   int64(track.FileSize),
+			s.files = append(s.files, trackFileItems(pl.Tracks)...)
+		}
+	} else if source := sourceForPath(dirPath); source != nil {
+		s.reportLoadError(source)
+		if pl := source.playlistForPath(dirPath); pl != nil {
+			s.files = append(s.files, trackFileItems(pl.Tracks)...)
+		} else if dirPath == source.collectionPrefix {
+			if lib := source.library(); lib != nil {
+				tracks := make([]*traktor.Track, len(lib.Tracks))
+				for i := range lib.Tracks {
+					tracks[i] = &lib.Tracks[i]
 				}
-				s.files = append(s.files, item)
+				s.files = append(s.files, trackFileItems(tracks)...)
 			}
 		}
 	} else {
@@ -193,7 +303,7 @@ func (s *AppState) loadFilesForPath(dirPath string) {
 		}
 
 		for _, entry := range entries {
-			if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+			if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() || !tags.IsAudioFile(entry.Name()) {
 				continue
 			}
 
@@ -202,15 +312,15 @@ func (s *AppState) loadFilesForPath(dirPath string) {
 				continue
 			}
 
+			// The file name stands in for the title until the tags are read
 			item := FileItem{
-				Artist: entry.Name(),
-				Title:  "ttt",
-				Label:  "lll",
-				Path:   filepath.Join(dirPath, entry.Name()),
-				Size:   info.Size(),
+				Title: entry.Name(),
+				Path:  filepath.Join(dirPath, entry.Name()),
+				Size:  info.Size(),
 			}
 			s.files = append(s.files, item)
 		}
+		readTags = true
 	}
 
 	// Sort: directories first, then files, both alphabetically
@@ -221,6 +331,126 @@ func (s *AppState) loadFilesForPath(dirPath string) {
 	if s.fileTable != nil {
 		s.fileTable.Refresh()
 	}
+	if readTags {
+		s.readFileTags()
+	}
+}
+
+// readFileTags reads the tags of the listed files in the background. A few
+// workers read files in parallel and every finished row is shown right away,
+// so large folders list instantly and fill in while scrolling. Files without
+// a BPM or key tag are analysed afterwards.
+func (s *AppState) readFileTags() {
+	generation := s.loadGeneration
+	paths := make([]string, len(s.files))
+	for i, file := range s.files {
+		paths[i] = file.Path
+	}
+
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := range paths {
+			jobs <- i
+		}
+	}()
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.NumCPU(), 4); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				meta, err := tags.ReadMetadata(paths[i])
+				if err != nil {
+					continue
+				}
+				stale := false
+				fyne.DoAndWait(func() {
+					if s.loadGeneration != generation {
+						stale = true
+						return
+					}
+					s.applyMetadata(i, meta)
+				})
+				if stale {
+					// Drain the remaining jobs without reading them
+					for range jobs {
+					}
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		fyne.Do(func() {
+			if s.loadGeneration == generation {
+				s.analyseFolder()
+			}
+		})
+	}()
+}
+
+// applyMetadata fills a file row from its tags. Must run on the UI thread.
+func (s *AppState) applyMetadata(row int, meta *tags.Metadata) {
+	file := &s.files[row]
+	file.Artist = meta.Artist
+	if meta.Title != "" {
+		file.Title = meta.Title
+	}
+	file.Label = meta.Label
+	file.Key = meta.Key
+	file.Year = meta.Year
+	file.BPM = meta.BPM
+	file.Duration = meta.Duration
+	if s.fileTable != nil {
+		for col := 0; col < len(fileColumns); col++ {
+			s.fileTable.RefreshItem(widget.TableCellID{Row: row, Col: col})
+		}
+	}
+}
+
+// trackFileItems converts library tracks into file table rows
+func trackFileItems(tracks []*traktor.Track) []FileItem {
+	items := make([]FileItem, 0, len(tracks))
+	for _, track := range tracks {
+		item := FileItem{
+			Artist:   track.Artist,
+			Title:    track.Title,
+			Label:    track.Label,
+			BPM:      track.BPM,
+			Duration: track.Duration,
+			Path:     track.FilePath,
+			Size:     int64(track.FileSize),
+
+			CoverArtID: track.CoverArtID,
+			CuePoints:  track.CuePoints,
+		}
+		if value, ok := traktor.TrackKeyValue(track); ok {
+			item.Key = traktor.KeyValueToString(value)
+		}
+		if date, ok := traktor.ParseDate(track.ReleaseDate); ok {
+			item.Year = date.Year()
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// formatYear formats a year, leaving unknown years empty
+func formatYear(year int) string {
+	if year <= 0 {
+		return ""
+	}
+	return formatInt(int64(year))
+}
+
+// formatBPM formats a tempo with at most two decimals
+func formatBPM(bpm float64) string {
+	if bpm <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(math.Round(bpm*100)/100, 'f', -1, 64)
 }
 
 // formatSize formats file size in human-readable format
@@ -276,14 +506,17 @@ func formatInt(n int64) string {
 }
 
 func MainWindow() {
-	myApp := app.New()
+	myApp := app.NewWithID("com.github.ilmarkerm.djlibgo")
+	loadLibrarySources(myApp.Preferences())
 	myApp.Settings().SetTheme(&myTheme{})
 
 	window := myApp.NewWindow("DJ Library")
 	window.Resize(fyne.NewSize(1200, 800))
 
 	state := NewAppState()
+	state.window = window
 	state.getMusicTreeRoot()
+	window.SetMainMenu(buildMainMenu(state))
 
 	// Create the directory tree
 	tree := widget.NewTree(
@@ -308,6 +541,12 @@ func MainWindow() {
 			if path == traktor.PlaylistPrefix {
 				return true
 			}
+			if source := sourceForPath(path); source != nil {
+				if path == source.prefix {
+					return source.isAvailable()
+				}
+				return path == source.playlistPrefix || source.isPlaylistFolder(path)
+			}
 			info, err := os.Stat(path)
 			if err != nil {
 				return false
@@ -327,43 +566,80 @@ func MainWindow() {
 
 	tree.OnSelected = func(uid widget.TreeNodeID) {
 		path := string(uid)
+		if source := sourceForPath(path); source != nil && path == source.prefix && !source.isAvailable() {
+			state.chooseLibrary(source)
+		}
 		state.selectedPath = path
 		state.loadFilesForPath(path)
 	}
 
 	state.tree = tree
 
-	// Column headers for the table
-	columnHeaders := []string{"Artist", "Title", "Label", "Size"}
-
 	// Create the file table
 	fileTable := widget.NewTableWithHeaders(
 		// Length - returns rows and columns
 		func() (int, int) {
-			return len(state.files), len(columnHeaders)
+			return len(state.files), len(fileColumns)
 		},
-		// CreateCell - creates a cell widget
+		// CreateCell - creates a cell widget, a label or the cover thumbnail
 		func() fyne.CanvasObject {
-			return widget.NewLabel("Template")
+			cover := canvas.NewImageFromResource(nil)
+			cover.FillMode = canvas.ImageFillContain
+			cover.SetMinSize(fyne.NewSize(coverart.SizeRow, coverart.SizeRow))
+			return container.NewStack(widget.NewLabel("Template"), cover)
 		},
 		// UpdateCell - updates a cell with data
 		func(id widget.TableCellID, cell fyne.CanvasObject) {
-			label := cell.(*widget.Label)
+			stack := cell.(*fyne.Container)
+			label := stack.Objects[0].(*widget.Label)
+			cover := stack.Objects[1].(*canvas.Image)
 			if id.Row >= len(state.files) {
 				return
 			}
 
+			if id.Col == 0 {
+				label.Hide()
+				cover.Show()
+				if thumbnail := state.rowThumbnail(id.Row); thumbnail != cover.File {
+					cover.File = thumbnail
+					cover.Refresh()
+				}
+				return
+			}
+			cover.Hide()
+			label.Show()
+
 			file := state.files[id.Row]
+			// Numbers line up on the right
+			label.Alignment = fyne.TextAlignLeading
+			label.TextStyle = fyne.TextStyle{}
+			if id.Col >= 4 && id.Col != 6 {
+				label.Alignment = fyne.TextAlignTrailing
+			}
 			switch id.Col {
-			case 0:
-				label.SetText(file.Artist)
 			case 1:
-				label.SetText(file.Title)
+				label.SetText(file.Artist)
 			case 2:
-				label.SetText(file.Label)
+				label.SetText(file.Title)
 			case 3:
+				label.SetText(file.Label)
+			case 4:
+				label.SetText(formatYear(file.Year))
+			case 5:
+				// Detected values are set apart from tagged ones
+				label.TextStyle.Italic = file.BPMDetected
+				label.SetText(formatBPM(file.BPM))
+			case 6:
+				label.TextStyle.Italic = file.KeyDetected
+				label.SetText(file.Key)
+			case 7:
+				if file.Duration > 0 {
+					label.SetText(traktor.FormatDuration(file.Duration))
+				} else {
+					label.SetText("")
+				}
+			case 8:
 				label.SetText(formatSize(file.Size))
-				label.Alignment = fyne.TextAlignTrailing
 			}
 		},
 	)
@@ -374,23 +650,25 @@ func MainWindow() {
 	}
 	fileTable.UpdateHeader = func(id widget.TableCellID, cell fyne.CanvasObject) {
 		label := cell.(*widget.Label)
-		if id.Row == -1 && id.Col >= 0 && id.Col < len(columnHeaders) {
-			label.SetText(columnHeaders[id.Col])
+		if id.Row == -1 && id.Col >= 0 && id.Col < len(fileColumns) {
+			label.SetText(fileColumns[id.Col])
 			label.TextStyle = fyne.TextStyle{Bold: true}
 		}
 	}
 
 	// Set column widths
-	fileTable.SetColumnWidth(0, 200) // Artist
-	fileTable.SetColumnWidth(1, 250) // Title
-	fileTable.SetColumnWidth(2, 150) // Label
-	fileTable.SetColumnWidth(3, 100) // Size
+	fileTable.SetColumnWidth(0, 40)  // Cover
+	fileTable.SetColumnWidth(1, 200) // Artist
+	fileTable.SetColumnWidth(2, 250) // Title
+	fileTable.SetColumnWidth(3, 150) // Label
+	fileTable.SetColumnWidth(4, 60)  // Year
+	fileTable.SetColumnWidth(5, 70)  // BPM
+	fileTable.SetColumnWidth(6, 60)  // Key
+	fileTable.SetColumnWidth(7, 70)  // Length
+	fileTable.SetColumnWidth(8, 100) // Size
 
 	fileTable.OnSelected = func(id widget.TableCellID) {
-		if id.Row < len(state.files) {
-			// File selected - could be used for future functionality
-			_ = state.files[id.Row]
-		}
+		state.showDetails(id.Row)
 	}
 
 	state.fileTable = fileTable
@@ -405,6 +683,18 @@ func MainWindow() {
 		// Cancel functionality to be implemented
 	})
 
+	tracklistButton := widget.NewButton("Tracklist", func() {
+		showTracklistWindow(state)
+	})
+
+	exportButton := widget.NewButton("Export", func() {
+		showPlaylistExportDialog(state)
+	})
+
+	importButton := widget.NewButton("Import", func() {
+		showPlaylistImportDialog(state)
+	})
+
 	// Layout the panels
 	// Left panel: Tree view with scroll
 	leftPanel := container.NewBorder(
@@ -413,17 +703,20 @@ func MainWindow() {
 		container.NewScroll(tree),
 	)
 
-	// Top panel: Empty for now
+	// Top panel: Cover and tags of the selected track
 	topPanel := container.NewBorder(
 		widget.NewLabel("Details"),
 		nil, nil, nil,
-		widget.NewLabel(""), // Empty content
+		state.newDetailsPanel(),
 	)
 
 	// Middle panel: Buttons
 	buttonContainer := container.NewHBox(
 		saveButton,
 		cancelButton,
+		tracklistButton,
+		exportButton,
+		importButton,
 	)
 	middlePanel := container.NewCenter(buttonContainer)
 
@@ -454,6 +747,10 @@ func MainWindow() {
 		widget.NewToolbarAction(theme.DocumentSaveIcon(), func() {
 			// Save functionality - to be implemented
 		}),
+		widget.NewToolbarSeparator(),
+		widget.NewToolbarAction(theme.InfoIcon(), func() {
+			showStatisticsWindow(state)
+		}),
 	)
 
 	// Main content with toolbar at top
@@ -0,0 +1,194 @@
+package windows
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"github.com/ilmarkerm/djlibgo/rekordbox"
+	"github.com/ilmarkerm/djlibgo/serato"
+	"github.com/ilmarkerm/djlibgo/tagsync"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// buildMainMenu creates the application menu with the import, export, tag
+// and analysis actions
+func buildMainMenu(state *AppState) *fyne.MainMenu {
+	exportMenu := fyne.NewMenu("Export",
+		fyne.NewMenuItem("Playlist files...", func() {
+			showPlaylistExportDialog(state)
+		}),
+		fyne.NewMenuItem("Tracks as CSV, JSON or YAML...", func() {
+			showTrackDumpDialog(state)
+		}),
+		fyne.NewMenuItem("Traktor playlist NML...", func() {
+			showPlaylistNMLExportDialog(state)
+		}),
+		fyne.NewMenuItem("Rekordbox XML...", func() {
+			exportRekordboxXML(state)
+		}),
+		fyne.NewMenuItem("Sync playlists to drive...", func() {
+			showDriveSyncDialog(state)
+		}),
+		fyne.NewMenuItem("Rekordbox USB drive...", func() {
+			showRekordboxDeviceExportDialog(state)
+		}),
+		fyne.NewMenuItem("Engine DJ drive...", func() {
+			showEngineExportDialog(state)
+		}),
+		fyne.NewMenuItem("Serato crates...", func() {
+			exportSeratoCrates(state)
+		}),
+		fyne.NewMenuItem("Serato cue markers", func() {
+			writeSeratoMarkers(state)
+		}),
+		fyne.NewMenuItem("Mixxx library...", func() {
+			showMixxxExportDialog(state)
+		}),
+		fyne.NewMenuItem("VirtualDJ database...", func() {
+			showVirtualDJExportDialog(state)
+		}),
+	)
+
+	importMenu := fyne.NewMenu("Import",
+		fyne.NewMenuItem("Playlist file...", func() {
+			showPlaylistImportDialog(state)
+		}),
+		fyne.NewMenuItem("Traktor playlist NML...", func() {
+			showPlaylistNMLImportDialog(state)
+		}),
+		fyne.NewMenuItem("iTunes playlists to Traktor...", func() {
+			copyITunesPlaylists(state)
+		}),
+	)
+
+	tagsMenu := fyne.NewMenu("Tags",
+		fyne.NewMenuItem("Write collection to file tags...", func() {
+			showTagSyncDialog(state, tagsync.ToFiles)
+		}),
+		fyne.NewMenuItem("Fill collection from file tags...", func() {
+			showTagSyncDialog(state, tagsync.ToCollection)
+		}),
+	)
+
+	preferences := fyne.CurrentApp().Preferences()
+	detectItem := fyne.NewMenuItem("Detect BPM and key in file browser", nil)
+	detectItem.Checked = preferences.BoolWithFallback(analyseFolderPreference, true)
+	analysisMenu := fyne.NewMenu("Analysis",
+		fyne.NewMenuItem("Check BPMs...", func() {
+			showTempoCheckDialog(state)
+		}),
+		fyne.NewMenuItem("Check keys...", func() {
+			showKeyCheckDialog(state)
+		}),
+		fyne.NewMenuItem("Loudness...", func() {
+			showLoudnessDialog(state)
+		}),
+		fyne.NewMenuItem("Find duplicate audio...", func() {
+			showDuplicatesDialog(state)
+		}),
+		fyne.NewMenuItem("Find tracks by audio...", func() {
+			showAudioSearchDialog(state)
+		}),
+		fyne.NewMenuItem("Cues from silence...", func() {
+			showSilenceCueDialog(state)
+		}),
+		detectItem,
+	)
+	detectItem.Action = func() {
+		detectItem.Checked = !detectItem.Checked
+		preferences.SetBool(analyseFolderPreference, detectItem.Checked)
+		analysisMenu.Refresh()
+	}
+
+	return fyne.NewMainMenu(importMenu, exportMenu, tagsMenu, analysisMenu)
+}
+
+// exportRekordboxXML writes the selected playlist, or the whole collection when
+// no playlist is selected, as a rekordbox XML library
+func exportRekordboxXML(state *AppState) {
+	collection := traktor.GetCollection()
+	if collection == nil {
+		dialog.ShowError(errors.New("Traktor collection is not available"), state.window)
+		return
+	}
+	opts := rekordbox.ExportOptions{MemoryCues: true}
+	if playlist := state.selectedPlaylist(); playlist != nil {
+		opts.Playlists = []*traktor.Playlist{playlist}
+	}
+
+	save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil || writer == nil {
+			return
+		}
+		defer writer.Close()
+		if err := rekordbox.Export(writer, collection, opts); err != nil {
+			dialog.ShowError(err, state.window)
+		}
+	}, state.window)
+	save.SetFileName("rekordbox.xml")
+	save.Show()
+}
+
+// exportSeratoCrates writes the selected playlist, or all Traktor playlists when
+// no playlist is selected, as crates into a _Serato_ folder
+func exportSeratoCrates(state *AppState) {
+	var playlists []*traktor.Playlist
+	if playlist := state.selectedPlaylist(); playlist != nil {
+		playlists = append(playlists, playlist)
+	} else if collection := traktor.GetCollection(); collection != nil {
+		for i := range collection.Playlists {
+			playlists = append(playlists, &collection.Playlists[i])
+		}
+	}
+	if len(playlists) == 0 {
+		dialog.ShowError(errors.New("no playlists to export"), state.window)
+		return
+	}
+
+	dialog.ShowFolderOpen(func(uri fyne.ListableURI, err error) {
+		if err != nil || uri == nil {
+			return
+		}
+		// Accept both the _Serato_ folder and the folder containing it
+		dir := uri.Path()
+		if filepath.Base(dir) != "_Serato_" {
+			dir = filepath.Join(dir, "_Serato_")
+		}
+		written, err := serato.ExportCrates(playlists, dir)
+		if err != nil {
+			dialog.ShowError(err, state.window)
+			return
+		}
+		dialog.ShowInformation("Serato crates", fmt.Sprintf("Wrote %d crates to %s", len(written), dir), state.window)
+	}, state.window)
+}
+
+// writeSeratoMarkers writes the hot cues and loops of the selected playlist's
+// tracks into the audio files after confirmation
+func writeSeratoMarkers(state *AppState) {
+	playlist := state.selectedPlaylist()
+	if playlist == nil {
+		dialog.ShowError(errors.New("select a playlist first"), state.window)
+		return
+	}
+	message := fmt.Sprintf("Write the hot cues and loops of %d tracks in %s into their audio files?", len(playlist.Tracks), playlist.Name)
+	dialog.ShowConfirm("Serato cue markers", message, func(ok bool) {
+		if !ok {
+			return
+		}
+		failed := serato.WritePlaylistMarkers(playlist)
+		if len(failed) == 0 {
+			dialog.ShowInformation("Serato cue markers", fmt.Sprintf("Updated %d tracks", len(playlist.Tracks)), state.window)
+			return
+		}
+		var lines []string
+		for path, err := range failed {
+			lines = append(lines, fmt.Sprintf("%s: %v", filepath.Base(path), err))
+		}
+		dialog.ShowError(fmt.Errorf("%d tracks could not be updated:\n%s", len(failed), strings.Join(lines, "\n")), state.window)
+	}, state.window)
+}
@@ -0,0 +1,76 @@
+package windows
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/mixxx"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// showMixxxExportDialog writes the selected playlist, or all Traktor playlists
+// when no playlist is selected, as crates into the Mixxx database
+func showMixxxExportDialog(state *AppState) {
+	collection := traktor.GetCollection()
+	if collection == nil {
+		dialog.ShowError(errors.New("Traktor collection is not available"), state.window)
+		return
+	}
+	opts := mixxx.ExportOptions{}
+	if playlist := state.selectedPlaylist(); playlist != nil {
+		opts.Playlists = []*traktor.Playlist{playlist}
+	}
+
+	prefs := fyne.CurrentApp().Preferences()
+	pathEntry := widget.NewEntry()
+	pathEntry.SetText(prefs.StringWithFallback("mixxxDatabase", mixxx.DefaultDatabasePath()))
+	cuesCheck := widget.NewCheck("Replace hot cues, loops and main cue", nil)
+	cuesCheck.SetChecked(true)
+	gridCheck := widget.NewCheck("Overwrite existing beat grids", nil)
+	addCheck := widget.NewCheck("Add tracks missing from the Mixxx library", nil)
+	items := []*widget.FormItem{
+		widget.NewFormItem("Database", pathEntry),
+		widget.NewFormItem("Cues", cuesCheck),
+		widget.NewFormItem("Beat grids", gridCheck),
+		widget.NewFormItem("Tracks", addCheck),
+	}
+
+	dialog.ShowForm("Export to Mixxx", "Export", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		opts.Cues = cuesCheck.Checked
+		opts.Beatgrids = gridCheck.Checked
+		opts.AddMissing = addCheck.Checked
+
+		path := pathEntry.Text
+		result, err := mixxx.Export(path, collection, opts)
+		if err != nil {
+			dialog.ShowError(err, state.window)
+			return
+		}
+		prefs.SetString("mixxxDatabase", path)
+		mixxx.SetLibraryPath(path)
+
+		message := fmt.Sprintf("Wrote %d crates with %d matched and %d added tracks",
+			result.Crates, result.Matched, result.Added)
+		if len(result.Unmatched) > 0 {
+			var names []string
+			for i, file := range result.Unmatched {
+				if i == 10 {
+					names = append(names, fmt.Sprintf("and %d more", len(result.Unmatched)-i))
+					break
+				}
+				names = append(names, filepath.Base(file))
+			}
+			message += fmt.Sprintf("\n\n%d tracks are not in the Mixxx library:\n%s",
+				len(result.Unmatched), strings.Join(names, "\n"))
+		}
+		dialog.ShowInformation("Export to Mixxx", message, state.window)
+	}, state.window)
+}
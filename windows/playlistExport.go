@@ -0,0 +1,76 @@
+package windows
+
+import (
+	"errors"
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/playlistfile"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// showPlaylistExportDialog exports the selected playlist, or all playlists when
+// the Playlists node is selected, to M3U8, PLS or XSPF files
+func showPlaylistExportDialog(state *AppState) {
+	collection := traktor.GetCollection()
+	playlist := state.selectedPlaylist()
+	exportAll := state.selectedPath == traktor.PlaylistPrefix
+	if collection == nil || (playlist == nil && !exportAll) {
+		dialog.ShowError(errors.New("select a Traktor playlist or the Playlists folder first"), state.window)
+		return
+	}
+
+	formatNames := make([]string, len(playlistfile.Formats))
+	for i, f := range playlistfile.Formats {
+		formatNames[i] = string(f)
+	}
+	formatSelect := widget.NewSelect(formatNames, nil)
+	formatSelect.SetSelectedIndex(0)
+
+	pathModes := []string{"Absolute", "Relative"}
+	pathRadio := widget.NewRadioGroup(pathModes, nil)
+	pathRadio.SetSelected(pathModes[0])
+
+	baseEntry := widget.NewEntry()
+	baseEntry.SetPlaceHolder("Playlist directory")
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Format", formatSelect),
+		widget.NewFormItem("Paths", pathRadio),
+		widget.NewFormItem("Relative to", baseEntry),
+	}
+
+	dialog.ShowForm("Export playlists", "Choose folder", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		opts := playlistfile.Options{
+			Format:  playlistfile.Format(formatSelect.Selected),
+			BaseDir: baseEntry.Text,
+		}
+		if pathRadio.Selected == "Relative" {
+			opts.PathMode = playlistfile.PathRelative
+		}
+
+		dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err != nil || dir == nil {
+				return
+			}
+			var written []string
+			if exportAll {
+				written, err = playlistfile.ExportFolder(collection, "", dir.Path(), opts)
+			} else {
+				var path string
+				path, err = playlistfile.ExportPlaylist(playlist, dir.Path(), opts)
+				written = append(written, path)
+			}
+			if err != nil {
+				dialog.ShowError(err, state.window)
+				return
+			}
+			dialog.ShowInformation("Export playlists", fmt.Sprintf("Wrote %d playlist files", len(written)), state.window)
+		}, state.window)
+	}, state.window)
+}
@@ -0,0 +1,81 @@
+package windows
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/playlistfile"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// showPlaylistImportDialog imports an M3U, PLS or XSPF file as a Traktor playlist
+func showPlaylistImportDialog(state *AppState) {
+	collection := traktor.GetCollection()
+	if collection == nil {
+		dialog.ShowError(errors.New("Traktor collection is not available"), state.window)
+		return
+	}
+
+	fromEntry := widget.NewEntry()
+	fromEntry.SetPlaceHolder(`e.g. D:\Music`)
+	toEntry := widget.NewEntry()
+	toEntry.SetPlaceHolder("e.g. /Users/dj/Music")
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Replace path prefix", fromEntry),
+		widget.NewFormItem("With", toEntry),
+	}
+
+	dialog.ShowForm("Import playlist", "Choose file", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		opts := playlistfile.ImportOptions{}
+		if fromEntry.Text != "" {
+			opts.Mappings = append(opts.Mappings, playlistfile.PathMapping{From: fromEntry.Text, To: toEntry.Text})
+		}
+
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			path := reader.URI().Path()
+			reader.Close()
+
+			result, err := playlistfile.ImportFile(collection, path, opts)
+			if err == nil {
+				err = collection.Save()
+			}
+			if err != nil {
+				dialog.ShowError(err, state.window)
+				return
+			}
+			state.refreshPlaylists()
+			showImportResult(state, result)
+		}, state.window)
+	}, state.window)
+}
+
+// showImportResult lists how many entries were matched and which were not
+func showImportResult(state *AppState, result *playlistfile.ImportResult) {
+	summary := widget.NewLabel(fmt.Sprintf("Created %s with %d tracks, %d entries not found",
+		result.Playlist.Path, len(result.Matched), len(result.Unmatched)))
+
+	var lines []string
+	for _, item := range result.Unmatched {
+		lines = append(lines, item.Location)
+	}
+	unmatched := widget.NewMultiLineEntry()
+	unmatched.SetText(strings.Join(lines, "\n"))
+	unmatched.Wrapping = fyne.TextWrapOff
+
+	content := container.NewBorder(summary, nil, nil, nil, unmatched)
+	d := dialog.NewCustom("Import playlist", "Close", content, state.window)
+	d.Resize(fyne.NewSize(700, 400))
+	d.Show()
+}
@@ -0,0 +1,96 @@
+package windows
+
+import (
+	"errors"
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// showPlaylistNMLExportDialog writes the selected playlist as a standalone
+// Traktor NML file, optionally with copies of its audio files
+func showPlaylistNMLExportDialog(state *AppState) {
+	playlist := state.selectedPlaylist()
+	if playlist == nil {
+		dialog.ShowError(errors.New("select a playlist first"), state.window)
+		return
+	}
+	collection := traktor.GetCollection()
+	if collection == nil {
+		// Playlists of other libraries are written from their track fields
+		collection = traktor.NewCollection("", nil, nil)
+	}
+
+	copyCheck := widget.NewCheck("Copy audio files next to the NML file", nil)
+	items := []*widget.FormItem{
+		widget.NewFormItem("Files", copyCheck),
+	}
+
+	dialog.ShowForm("Export playlist NML", "Choose folder", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err != nil || dir == nil {
+				return
+			}
+			path, err := collection.ExportPlaylistNML(playlist, dir.Path(), copyCheck.Checked)
+			if err != nil {
+				dialog.ShowError(err, state.window)
+				return
+			}
+			dialog.ShowInformation("Export playlist NML", fmt.Sprintf("Wrote %s", path), state.window)
+		}, state.window)
+	}, state.window)
+}
+
+// showPlaylistNMLImportDialog merges a playlist NML received from another
+// Traktor user into the collection
+func showPlaylistNMLImportDialog(state *AppState) {
+	collection := traktor.GetCollection()
+	if collection == nil {
+		dialog.ShowError(errors.New("Traktor collection is not available"), state.window)
+		return
+	}
+
+	folderEntry := widget.NewEntry()
+	folderEntry.SetText("Received")
+	addCheck := widget.NewCheck("Add tracks that are not in the collection", nil)
+	addCheck.SetChecked(true)
+	items := []*widget.FormItem{
+		widget.NewFormItem("Folder", folderEntry),
+		widget.NewFormItem("Tracks", addCheck),
+	}
+
+	dialog.ShowForm("Import playlist NML", "Choose file", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			path := reader.URI().Path()
+			reader.Close()
+
+			result, err := collection.ImportPlaylistNML(path, traktor.NMLImportOptions{
+				Folder:     folderEntry.Text,
+				AddMissing: addCheck.Checked,
+			})
+			if err == nil {
+				err = collection.Save()
+			}
+			if err != nil {
+				dialog.ShowError(err, state.window)
+				return
+			}
+			state.refreshPlaylists()
+			dialog.ShowInformation("Import playlist NML",
+				fmt.Sprintf("Created %d playlists, merged %d tracks, added %d, %d not found",
+					len(result.Playlists), result.Merged, result.Added, result.Unmatched), state.window)
+		}, state.window)
+	}, state.window)
+}
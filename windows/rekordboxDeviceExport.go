@@ -0,0 +1,56 @@
+package windows
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"github.com/ilmarkerm/djlibgo/rekordbox"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// showRekordboxDeviceExportDialog writes the selected playlist, or the whole
+// collection when no playlist is selected, onto a drive for Pioneer players.
+// A rekordbox library already on the drive is only replaced after asking.
+func showRekordboxDeviceExportDialog(state *AppState) {
+	collection := traktor.GetCollection()
+	if collection == nil {
+		dialog.ShowError(errors.New("Traktor collection is not available"), state.window)
+		return
+	}
+	opts := rekordbox.DeviceExportOptions{}
+	if playlist := state.selectedPlaylist(); playlist != nil {
+		opts.Playlists = []*traktor.Playlist{playlist}
+	}
+
+	dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+		if err != nil || dir == nil {
+			return
+		}
+		root := dir.Path()
+		if _, err := os.Stat(rekordbox.PDBPath(root)); err != nil {
+			exportDevice(state, root, collection, opts)
+			return
+		}
+		// The export does not merge with the library already on the drive
+		message := "The drive already has a rekordbox library. It will be replaced by this export.\n" +
+			"Tracks that earlier exports from here copied and this one does not use are removed."
+		dialog.ShowConfirm("Replace rekordbox library", message, func(replace bool) {
+			if replace {
+				exportDevice(state, root, collection, opts)
+			}
+		}, state.window)
+	}, state.window)
+}
+
+// exportDevice writes the export onto the drive and reports the result
+func exportDevice(state *AppState, root string, collection *traktor.TraktorCollection, opts rekordbox.DeviceExportOptions) {
+	if err := rekordbox.ExportDevice(root, collection, opts); err != nil {
+		dialog.ShowError(err, state.window)
+		return
+	}
+	dialog.ShowInformation("Export rekordbox USB drive",
+		fmt.Sprintf("Wrote %s", rekordbox.PDBPath(root)), state.window)
+}
@@ -0,0 +1,146 @@
+package windows
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/analysis"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// silenceThresholdPreference keeps the last silence threshold in dBFS
+const silenceThresholdPreference = "silenceThreshold"
+
+// showSilenceCueDialog asks for the silence threshold, detects the leading
+// and trailing silence of the selected playlist, or the whole collection,
+// and previews the Load, Fade In and Fade Out cues it proposes before they
+// are added. Cue types a track already has are never replaced.
+func showSilenceCueDialog(state *AppState) {
+	collection := traktor.GetCollection()
+	if collection == nil {
+		dialog.ShowError(errors.New("Traktor collection is not available"), state.window)
+		return
+	}
+	tracks := state.selectedTracks(collection)
+	if len(tracks) == 0 {
+		dialog.ShowInformation("Cues from silence", "No tracks to analyse", state.window)
+		return
+	}
+
+	preferences := fyne.CurrentApp().Preferences()
+	thresholdEntry := widget.NewEntry()
+	thresholdEntry.SetText(strconv.FormatFloat(preferences.FloatWithFallback(silenceThresholdPreference, analysis.DefaultSilenceThreshold), 'f', -1, 64))
+	thresholdEntry.Validator = func(text string) error {
+		if value, err := strconv.ParseFloat(strings.TrimSpace(text), 64); err != nil || value >= 0 {
+			return errors.New("enter a level below 0 dBFS")
+		}
+		return nil
+	}
+	items := []*widget.FormItem{
+		widget.NewFormItem("Silence below (dBFS)", thresholdEntry),
+	}
+	title := fmt.Sprintf("Cues from silence for %d tracks", len(tracks))
+	dialog.ShowForm(title, "Analyse", "Cancel", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		threshold, _ := strconv.ParseFloat(strings.TrimSpace(thresholdEntry.Text), 64)
+		preferences.SetFloat(silenceThresholdPreference, threshold)
+		detectSilence(state, collection, tracks, threshold)
+	}, state.window)
+}
+
+// detectSilence analyses the tracks behind a progress dialog that can stop
+// the analysis, then shows the proposed cues
+func detectSilence(state *AppState, collection *traktor.TraktorCollection, tracks []*traktor.Track, threshold float64) {
+	bar := widget.NewProgressBar()
+	status := widget.NewLabel(fmt.Sprintf("Analysing %d tracks", len(tracks)))
+	ctx, cancel := context.WithCancel(context.Background())
+	progress := dialog.NewCustom("Cues from silence", "Stop", container.NewVBox(status, bar), state.window)
+	progress.SetOnClosed(cancel)
+	progress.Resize(fyne.NewSize(400, 0))
+	progress.Show()
+
+	go func() {
+		checks, _ := analysis.CheckSilence(ctx, tracks, threshold, 0, func(finished, total int) {
+			fyne.Do(func() {
+				bar.Max = float64(total)
+				bar.SetValue(float64(finished))
+			})
+		})
+		fyne.Do(func() {
+			progress.Hide()
+			var proposals []analysis.SilenceCheck
+			for _, check := range checks {
+				if len(check.Cues) > 0 {
+					proposals = append(proposals, check)
+				}
+			}
+			summary := fmt.Sprintf("Cues proposed for %d of %d tracks", len(proposals), len(checks))
+			if len(checks) < len(tracks) {
+				summary += fmt.Sprintf(", stopped after %d of %d tracks", len(checks), len(tracks))
+			}
+			if len(proposals) == 0 {
+				dialog.ShowInformation("Cues from silence", summary, state.window)
+				return
+			}
+			showSilenceCuePreview(state, collection, proposals, summary)
+		})
+	}()
+}
+
+// showSilenceCuePreview lists the proposed cues with a check box for each
+// track and adds the cues of the checked tracks to the collection
+func showSilenceCuePreview(state *AppState, collection *traktor.TraktorCollection, proposals []analysis.SilenceCheck, summary string) {
+	selected := make([]bool, len(proposals))
+	for i := range selected {
+		selected[i] = true
+	}
+	list := widget.NewList(
+		func() int { return len(proposals) },
+		func() fyne.CanvasObject { return widget.NewCheck("", nil) },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			box := item.(*widget.Check)
+			box.OnChanged = nil
+			check := proposals[id]
+			box.SetText(fmt.Sprintf("%s: %s", analysis.TrackName(check.Track), strings.TrimSpace(analysis.SilenceLine(check))))
+			box.SetChecked(selected[id])
+			box.OnChanged = func(checked bool) {
+				selected[id] = checked
+			}
+		},
+	)
+
+	var preview dialog.Dialog
+	addButton := widget.NewButton("Add cues to collection", func() {
+		var accepted []analysis.SilenceCheck
+		for i, check := range proposals {
+			if selected[i] {
+				accepted = append(accepted, check)
+			}
+		}
+		changed, err := analysis.ApplySilenceCues(collection, accepted)
+		if err == nil && changed > 0 {
+			err = collection.Save()
+		}
+		if err != nil {
+			dialog.ShowError(err, state.window)
+			return
+		}
+		preview.Hide()
+		state.loadFilesForPath(state.selectedPath)
+		dialog.ShowInformation("Cues from silence", fmt.Sprintf("Added cues to %d tracks", changed), state.window)
+	})
+
+	content := container.NewBorder(widget.NewLabel(summary), addButton, nil, nil, list)
+	preview = dialog.NewCustom("Cues from silence", "Close", content, state.window)
+	preview.Resize(fyne.NewSize(900, 550))
+	preview.Show()
+}
@@ -0,0 +1,143 @@
+package windows
+
+import (
+	"errors"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// showStatisticsWindow opens the play statistics view for the Traktor collection
+func showStatisticsWindow(state *AppState) {
+	collection := traktor.GetCollection()
+	if collection == nil {
+		dialog.ShowError(errors.New("Traktor collection is not available"), state.window)
+		return
+	}
+
+	window := fyne.CurrentApp().NewWindow("Statistics")
+	window.Resize(fyne.NewSize(800, 600))
+
+	opts := traktor.StatsOptions{}
+	stats := collection.ComputeStatistics(opts)
+	var section *traktor.StatsSection
+	selectedRow := -1
+
+	columnHeaders := []string{"Bucket", "Plays", "Tracks"}
+	table := widget.NewTableWithHeaders(
+		func() (int, int) {
+			if section == nil {
+				return 0, len(columnHeaders)
+			}
+			return len(section.Buckets), len(columnHeaders)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("Template")
+		},
+		func(id widget.TableCellID, cell fyne.CanvasObject) {
+			label := cell.(*widget.Label)
+			if section == nil || id.Row >= len(section.Buckets) {
+				return
+			}
+			bucket := section.Buckets[id.Row]
+			switch id.Col {
+			case 0:
+				label.SetText(bucket.Name)
+			case 1:
+				label.SetText(strconv.Itoa(bucket.PlayCount))
+				label.Alignment = fyne.TextAlignTrailing
+			case 2:
+				label.SetText(strconv.Itoa(len(bucket.Tracks)))
+				label.Alignment = fyne.TextAlignTrailing
+			}
+		},
+	)
+	table.CreateHeader = func() fyne.CanvasObject {
+		return widget.NewLabel("")
+	}
+	table.UpdateHeader = func(id widget.TableCellID, cell fyne.CanvasObject) {
+		label := cell.(*widget.Label)
+		if id.Row == -1 && id.Col >= 0 && id.Col < len(columnHeaders) {
+			label.SetText(columnHeaders[id.Col])
+			label.TextStyle = fyne.TextStyle{Bold: true}
+		}
+	}
+	table.SetColumnWidth(0, 450)
+	table.SetColumnWidth(1, 100)
+	table.SetColumnWidth(2, 100)
+	table.OnSelected = func(id widget.TableCellID) {
+		selectedRow = id.Row
+	}
+
+	titles := make([]string, len(stats.Sections))
+	for i, s := range stats.Sections {
+		titles[i] = s.Title
+	}
+	sectionSelect := widget.NewSelect(titles, func(title string) {
+		section = stats.Section(title)
+		selectedRow = -1
+		table.UnselectAll()
+		table.Refresh()
+	})
+
+	monthsEntry := widget.NewEntry()
+	monthsEntry.SetText("12")
+	monthsEntry.OnSubmitted = func(text string) {
+		months, err := strconv.Atoi(text)
+		if err != nil || months <= 0 {
+			dialog.ShowError(errors.New("number of months must be a positive number"), window)
+			return
+		}
+		opts.NotPlayedMonths = months
+		stats = collection.ComputeStatistics(opts)
+		sectionSelect.OnChanged(sectionSelect.Selected)
+	}
+
+	playlistButton := widget.NewButton("Create playlist", func() {
+		if section == nil || selectedRow < 0 || selectedRow >= len(section.Buckets) {
+			dialog.ShowInformation("Create playlist", "Select a bucket first", window)
+			return
+		}
+		playlist, err := collection.SaveBucketAsPlaylist(section.Title, section.Buckets[selectedRow])
+		if err == nil {
+			err = collection.Save()
+		}
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		state.refreshPlaylists()
+		dialog.ShowInformation("Create playlist", "Created playlist "+playlist.Path, window)
+	})
+	playlistButton.Importance = widget.HighImportance
+
+	exportButton := widget.NewButton("Export CSV", func() {
+		dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil || writer == nil {
+				return
+			}
+			defer writer.Close()
+			if err := stats.WriteCSV(writer); err != nil {
+				dialog.ShowError(err, window)
+			}
+		}, window)
+	})
+
+	sectionSelect.SetSelectedIndex(0)
+
+	toolbar := container.NewHBox(
+		widget.NewLabel("Section"),
+		sectionSelect,
+		widget.NewLabel("Not played in months"),
+		monthsEntry,
+		playlistButton,
+		exportButton,
+	)
+
+	window.SetContent(container.NewBorder(toolbar, nil, nil, nil, table))
+	window.Show()
+}
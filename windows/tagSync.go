@@ -0,0 +1,137 @@
+package windows
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/tags"
+	"github.com/ilmarkerm/djlibgo/tagsync"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// keyNotations are the key notations offered for tags, in KeyNotation order
+var keyNotations = []string{"Musical (Am)", "Open Key (1m)", "Camelot (8A)"}
+
+// showTagSyncDialog writes collection metadata into the file tags of the
+// selected playlist, or the whole collection, or fills empty collection
+// fields from the tags. The changes are previewed before anything is written.
+func showTagSyncDialog(state *AppState, direction tagsync.Direction) {
+	collection := traktor.GetCollection()
+	if collection == nil {
+		dialog.ShowError(errors.New("Traktor collection is not available"), state.window)
+		return
+	}
+	var tracks []*traktor.Track
+	scope := "the whole collection"
+	if playlist := state.selectedPlaylist(); playlist != nil {
+		tracks = playlist.Tracks
+		scope = playlist.Name
+	} else {
+		for i := range collection.Tracks {
+			tracks = append(tracks, &collection.Tracks[i])
+		}
+	}
+
+	preferences := fyne.CurrentApp().Preferences()
+	names := make([]string, len(tags.AllFields))
+	for i, field := range tags.AllFields {
+		names[i] = string(field)
+	}
+	fieldChecks := widget.NewCheckGroup(names, nil)
+	fieldChecks.SetSelected(preferences.StringListWithFallback("tagSyncFields", names))
+	notationSelect := widget.NewSelect(keyNotations, nil)
+	notationSelect.SetSelectedIndex(preferences.IntWithFallback("tagSyncNotation", int(traktor.NotationCamelot)))
+
+	title := "Write file tags"
+	items := []*widget.FormItem{
+		widget.NewFormItem("Tracks", widget.NewLabel(scope)),
+		widget.NewFormItem("Fields", fieldChecks),
+	}
+	if direction == tagsync.ToFiles {
+		items = append(items, widget.NewFormItem("Key notation", notationSelect))
+	} else {
+		title = "Fill collection from file tags"
+	}
+
+	dialog.ShowForm(title, "Preview", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		opts := tagsync.Options{
+			Direction: direction,
+			Notation:  traktor.KeyNotation(notationSelect.SelectedIndex()),
+		}
+		for _, field := range tags.AllFields {
+			for _, selected := range fieldChecks.Selected {
+				if string(field) == selected {
+					opts.Fields = append(opts.Fields, field)
+				}
+			}
+		}
+		if len(opts.Fields) == 0 {
+			dialog.ShowError(errors.New("select at least one field"), state.window)
+			return
+		}
+		preferences.SetStringList("tagSyncFields", fieldChecks.Selected)
+		preferences.SetInt("tagSyncNotation", int(opts.Notation))
+
+		// Reading the tags of a large collection takes a while
+		progress := dialog.NewCustomWithoutButtons(title, widget.NewProgressBarInfinite(), state.window)
+		progress.Show()
+		go func() {
+			plan := tagsync.NewPlan(tracks, opts)
+			fyne.Do(func() {
+				progress.Hide()
+				showTagSyncPreview(state, collection, title, plan)
+			})
+		}()
+	}, state.window)
+}
+
+// showTagSyncPreview shows the planned changes and applies them on confirmation
+func showTagSyncPreview(state *AppState, collection *traktor.TraktorCollection, title string, plan *tagsync.Plan) {
+	if len(plan.Changes) == 0 {
+		message := "Nothing to change"
+		if len(plan.Failed) > 0 {
+			message += fmt.Sprintf(", %d files could not be read", len(plan.Failed))
+		}
+		dialog.ShowInformation(title, message, state.window)
+		return
+	}
+
+	diff := widget.NewTextGrid()
+	diff.SetText(plan.Diff())
+	scroll := container.NewScroll(diff)
+	scroll.SetMinSize(fyne.NewSize(700, 400))
+	summary := widget.NewLabel(fmt.Sprintf("%d changes in %d tracks", len(plan.Changes), plan.Files()))
+	content := container.NewBorder(summary, nil, nil, nil, scroll)
+
+	dialog.ShowCustomConfirm(title, "Apply", "Cancel", content, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		failed := plan.Apply(collection)
+		if plan.Direction == tagsync.ToCollection {
+			if err := collection.Save(); err != nil {
+				dialog.ShowError(err, state.window)
+				return
+			}
+			state.loadFilesForPath(state.selectedPath)
+		}
+		if len(failed) == 0 {
+			dialog.ShowInformation(title, fmt.Sprintf("Updated %d tracks", plan.Files()), state.window)
+			return
+		}
+		var lines []string
+		for path, err := range failed {
+			lines = append(lines, fmt.Sprintf("%s: %v", filepath.Base(path), err))
+		}
+		dialog.ShowError(fmt.Errorf("%d tracks could not be updated:\n%s", len(failed), strings.Join(lines, "\n")), state.window)
+	}, state.window)
+}
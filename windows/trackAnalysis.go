@@ -0,0 +1,180 @@
+package windows
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/analysis"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// analysisCache keeps analysis results between runs and sessions
+var analysisCache = analysis.DefaultCache()
+
+// analyseFolderPreference turns the analysis in the file browser on and off
+const analyseFolderPreference = "analyseFolder"
+
+// trackAnalysis is the analysis of one collection track
+type trackAnalysis struct {
+	track  *traktor.Track
+	result analysis.Result
+	err    error
+}
+
+// analyseFolder detects the tempo and key of the listed files that
+// have no BPM or key tag, in the background and with two workers so the
+// browser stays responsive. Must run on the UI thread.
+func (s *AppState) analyseFolder() {
+	if !fyne.CurrentApp().Preferences().BoolWithFallback(analyseFolderPreference, true) {
+		return
+	}
+	rows := make(map[string]int)
+	var paths []string
+	for i, file := range s.files {
+		if file.BPM == 0 || file.Key == "" {
+			rows[file.Path] = i
+			paths = append(paths, file.Path)
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopFolderAnalysis = cancel
+	generation := s.loadGeneration
+	notation := traktor.KeyNotation(fyne.CurrentApp().Preferences().IntWithFallback("tagSyncNotation", int(traktor.NotationCamelot)))
+	go analysis.Run(ctx, paths, 2, analysisCache, func(path string, result analysis.Result, err error) {
+		if err != nil {
+			return
+		}
+		fyne.Do(func() {
+			if s.loadGeneration != generation {
+				return
+			}
+			row := rows[path]
+			file := &s.files[row]
+			if file.BPM == 0 && result.Tempo.BPM > 0 {
+				file.BPM = result.Tempo.BPM
+				file.BPMDetected = true
+			}
+			if file.Key == "" && result.Key.Value >= 0 {
+				file.Key = traktor.KeyValueToNotation(result.Key.Value, notation)
+				file.KeyDetected = true
+			}
+			if s.fileTable != nil {
+				s.fileTable.RefreshItem(widget.TableCellID{Row: row, Col: 5})
+				s.fileTable.RefreshItem(widget.TableCellID{Row: row, Col: 6})
+			}
+		})
+	})
+}
+
+// analyseSelectedTracks analyses the selected playlist, or the whole
+// collection, behind a progress dialog that can stop the analysis. done
+// gets the tracks finished so far in playlist order, on the UI thread.
+func analyseSelectedTracks(state *AppState, title string, done func(collection *traktor.TraktorCollection, analysed []trackAnalysis, total int)) {
+	collection := traktor.GetCollection()
+	if collection == nil {
+		dialog.ShowError(errors.New("Traktor collection is not available"), state.window)
+		return
+	}
+	tracks := state.selectedTracks(collection)
+	if len(tracks) == 0 {
+		dialog.ShowInformation(title, "No tracks to analyse", state.window)
+		return
+	}
+
+	byPath := make(map[string]int)
+	paths := make([]string, len(tracks))
+	for i, track := range tracks {
+		paths[i] = track.FilePath
+		byPath[track.FilePath] = i
+	}
+	results := make([]trackAnalysis, len(tracks))
+
+	bar := widget.NewProgressBar()
+	bar.Max = float64(len(tracks))
+	status := widget.NewLabel(fmt.Sprintf("Analysing %d tracks", len(tracks)))
+	ctx, cancel := context.WithCancel(context.Background())
+	progress := dialog.NewCustom(title, "Stop", container.NewVBox(status, bar), state.window)
+	progress.SetOnClosed(cancel)
+	progress.Resize(fyne.NewSize(400, 0))
+	progress.Show()
+
+	go func() {
+		finished := 0
+		analysis.Run(ctx, paths, 0, analysisCache, func(path string, result analysis.Result, err error) {
+			i := byPath[path]
+			results[i] = trackAnalysis{track: tracks[i], result: result, err: err}
+			finished++
+			count := finished
+			fyne.Do(func() {
+				bar.SetValue(float64(count))
+			})
+		})
+		fyne.Do(func() {
+			progress.Hide()
+			var analysed []trackAnalysis
+			for _, result := range results {
+				if result.track != nil {
+					analysed = append(analysed, result)
+				}
+			}
+			done(collection, analysed, len(tracks))
+		})
+	}()
+}
+
+// selectedTracks returns the tracks of the selected playlist, or of the
+// whole collection when no playlist is selected
+func (s *AppState) selectedTracks(collection *traktor.TraktorCollection) []*traktor.Track {
+	if playlist := s.selectedPlaylist(); playlist != nil {
+		return playlist.Tracks
+	}
+	tracks := make([]*traktor.Track, len(collection.Tracks))
+	for i := range collection.Tracks {
+		tracks[i] = &collection.Tracks[i]
+	}
+	return tracks
+}
+
+// analysisSummary describes how many tracks disagree and whether the
+// analysis was stopped early
+func analysisSummary(disagreements, analysed, total int) string {
+	summary := fmt.Sprintf("%d of %d tracks disagree with the collection", disagreements, analysed)
+	if analysed < total {
+		summary += fmt.Sprintf(", stopped after %d of %d tracks", analysed, total)
+	}
+	return summary
+}
+
+// showTempoCheckDialog detects the tempo of the selected playlist, or the
+// whole collection, and lists the tracks where it disagrees with Traktor
+func showTempoCheckDialog(state *AppState) {
+	analyseSelectedTracks(state, "Check BPMs", func(_ *traktor.TraktorCollection, analysed []trackAnalysis, total int) {
+		checks := make([]analysis.TempoCheck, len(analysed))
+		disagreements := 0
+		for i, a := range analysed {
+			checks[i] = analysis.CheckTempo(a.track, a.result, a.err)
+			if checks[i].Disagrees() {
+				disagreements++
+			}
+		}
+
+		report := widget.NewTextGrid()
+		report.SetText(analysis.TempoReport(checks, false))
+		showAll := widget.NewCheck("Show matching tracks", func(all bool) {
+			report.SetText(analysis.TempoReport(checks, all))
+		})
+		scroll := container.NewScroll(report)
+		scroll.SetMinSize(fyne.NewSize(900, 400))
+		summary := widget.NewLabel(analysisSummary(disagreements, len(checks), total))
+		content := container.NewBorder(summary, showAll, nil, nil, scroll)
+		dialog.ShowCustom("Check BPMs", "Close", content, state.window)
+	})
+}
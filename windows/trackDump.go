@@ -0,0 +1,83 @@
+package windows
+
+import (
+	"errors"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/fileutil"
+	"github.com/ilmarkerm/djlibgo/trackdump"
+	"github.com/ilmarkerm/djlibgo/traktor"
+)
+
+// showTrackDumpDialog dumps the tracks of the selected playlist, or of the
+// whole Traktor collection when no playlist is selected, with chosen columns
+func showTrackDumpDialog(state *AppState) {
+	playlist := state.selectedPlaylist()
+	collection := traktor.GetCollection()
+	if playlist == nil && collection == nil {
+		dialog.ShowError(errors.New("Traktor collection is not available"), state.window)
+		return
+	}
+
+	formatNames := make([]string, len(trackdump.Formats))
+	for i, f := range trackdump.Formats {
+		formatNames[i] = string(f)
+	}
+	formatSelect := widget.NewSelect(formatNames, nil)
+	formatSelect.SetSelectedIndex(0)
+
+	columnChecks := widget.NewCheckGroup(trackdump.ColumnNames(), nil)
+	columnChecks.SetSelected(trackdump.DefaultColumns)
+	columnScroll := container.NewVScroll(columnChecks)
+	columnScroll.SetMinSize(fyne.NewSize(250, 300))
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Format", formatSelect),
+		widget.NewFormItem("Columns", columnScroll),
+	}
+
+	dialog.ShowForm("Dump tracks", "Save", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		// Keep the column order of trackdump.Columns rather than the click order
+		var names []string
+		for _, name := range trackdump.ColumnNames() {
+			for _, selected := range columnChecks.Selected {
+				if name == selected {
+					names = append(names, name)
+				}
+			}
+		}
+		columns, err := trackdump.ParseColumns(names)
+		if err != nil {
+			dialog.ShowError(err, state.window)
+			return
+		}
+		format := trackdump.Format(formatSelect.Selected)
+
+		name := "collection"
+		if playlist != nil {
+			name = fileutil.SanitizeFileName(playlist.Name)
+		}
+		save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil || writer == nil {
+				return
+			}
+			defer writer.Close()
+			if playlist != nil {
+				err = trackdump.WriteTracks(writer, format, columns, playlist.Tracks)
+			} else {
+				err = trackdump.WriteCollection(writer, format, columns, collection)
+			}
+			if err != nil {
+				dialog.ShowError(err, state.window)
+			}
+		}, state.window)
+		save.SetFileName(name + format.Extension())
+		save.Show()
+	}, state.window)
+}
@@ -0,0 +1,108 @@
+package windows
+
+import (
+	"errors"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/tracklist"
+)
+
+// showTracklistWindow opens the tracklist export for the selected history playlist
+func showTracklistWindow(state *AppState) {
+	playlist := state.selectedPlaylist()
+	if playlist == nil {
+		dialog.ShowError(errors.New("select a Traktor history playlist first"), state.window)
+		return
+	}
+
+	opts := tracklist.Options{}
+	entries, err := tracklist.Build(playlist, opts)
+	if err != nil {
+		dialog.ShowError(err, state.window)
+		return
+	}
+
+	window := fyne.CurrentApp().NewWindow("Tracklist - " + playlist.Name)
+	window.Resize(fyne.NewSize(700, 500))
+
+	format := tracklist.FormatText
+	preview := widget.NewMultiLineEntry()
+	preview.Wrapping = fyne.TextWrapOff
+
+	update := func() {
+		var err error
+		entries, err = tracklist.Build(playlist, opts)
+		if err == nil {
+			var text string
+			text, err = tracklist.String(format, entries, opts)
+			preview.SetText(text)
+		}
+		if err != nil {
+			dialog.ShowError(err, window)
+		}
+	}
+
+	formatNames := make([]string, len(tracklist.Formats))
+	for i, f := range tracklist.Formats {
+		formatNames[i] = string(f)
+	}
+	formatSelect := widget.NewSelect(formatNames, func(name string) {
+		format = tracklist.Format(name)
+		update()
+	})
+
+	separatorEntry := widget.NewEntry()
+	separatorEntry.SetText(" - ")
+	separatorEntry.OnChanged = func(text string) {
+		opts.Separator = text
+		update()
+	}
+
+	remixerCheck := widget.NewCheck("Remixer", func(checked bool) {
+		opts.Remixer = checked
+		update()
+	})
+	remixerFormat := widget.NewEntry()
+	remixerFormat.SetText(" (%s Remix)")
+	remixerFormat.OnChanged = func(text string) {
+		opts.RemixerFormat = text
+		update()
+	}
+
+	labelCheck := widget.NewCheck("Label", func(checked bool) {
+		opts.Label = checked
+		update()
+	})
+	labelFormat := widget.NewEntry()
+	labelFormat.SetText(" [%s]")
+	labelFormat.OnChanged = func(text string) {
+		opts.LabelFormat = text
+		update()
+	}
+
+	privateCheck := widget.NewCheck("Include headphone plays", func(checked bool) {
+		opts.IncludePrivate = checked
+		update()
+	})
+
+	copyButton := widget.NewButton("Copy to clipboard", func() {
+		fyne.CurrentApp().Clipboard().SetContent(preview.Text)
+	})
+	copyButton.Importance = widget.HighImportance
+
+	form := widget.NewForm(
+		widget.NewFormItem("Format", formatSelect),
+		widget.NewFormItem("Separator", separatorEntry),
+		widget.NewFormItem("", container.NewGridWithColumns(2, remixerCheck, remixerFormat)),
+		widget.NewFormItem("", container.NewGridWithColumns(2, labelCheck, labelFormat)),
+		widget.NewFormItem("", privateCheck),
+	)
+
+	formatSelect.SetSelected(string(format))
+
+	window.SetContent(container.NewBorder(form, copyButton, nil, nil, preview))
+	window.Show()
+}
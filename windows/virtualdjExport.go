@@ -0,0 +1,58 @@
+package windows
+
+import (
+	"errors"
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/traktor"
+	"github.com/ilmarkerm/djlibgo/virtualdj"
+)
+
+// showVirtualDJExportDialog writes the tracks of the selected playlist, or the
+// whole collection when no playlist is selected, into the VirtualDJ database
+func showVirtualDJExportDialog(state *AppState) {
+	collection := traktor.GetCollection()
+	if collection == nil {
+		dialog.ShowError(errors.New("Traktor collection is not available"), state.window)
+		return
+	}
+	opts := virtualdj.ExportOptions{}
+	if playlist := state.selectedPlaylist(); playlist != nil {
+		opts.Playlists = []*traktor.Playlist{playlist}
+	}
+
+	prefs := fyne.CurrentApp().Preferences()
+	pathEntry := widget.NewEntry()
+	pathEntry.SetText(prefs.StringWithFallback("virtualdjDatabase", virtualdj.DefaultDatabasePath()))
+	cuesCheck := widget.NewCheck("Replace cues, loops and beat grids", nil)
+	cuesCheck.SetChecked(true)
+	listsCheck := widget.NewCheck("Write playlists to My Lists", nil)
+	listsCheck.SetChecked(true)
+	items := []*widget.FormItem{
+		widget.NewFormItem("Database", pathEntry),
+		widget.NewFormItem("Cues", cuesCheck),
+		widget.NewFormItem("Playlists", listsCheck),
+	}
+
+	dialog.ShowForm("Export to VirtualDJ", "Export", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		opts.Cues = cuesCheck.Checked
+		opts.Lists = listsCheck.Checked
+
+		path := pathEntry.Text
+		result, err := virtualdj.Export(path, collection, opts)
+		if err != nil {
+			dialog.ShowError(err, state.window)
+			return
+		}
+		prefs.SetString("virtualdjDatabase", path)
+		virtualdj.SetLibraryPath(path)
+		dialog.ShowInformation("Export to VirtualDJ", fmt.Sprintf("Updated %d and added %d songs, wrote %d lists",
+			result.Updated, result.Added, len(result.Lists)), state.window)
+	}, state.window)
+}
@@ -0,0 +1,231 @@
+package windows
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ilmarkerm/djlibgo/traktor"
+	"github.com/ilmarkerm/djlibgo/waveform"
+)
+
+// waveformCache holds the overviews shown in the Details panel
+var waveformCache = waveform.DefaultCache()
+
+// Waveform band colours, drawn low to high on top of each other
+var (
+	colorLowBand  = color.RGBA{R: 0x20, G: 0x50, B: 0xd0, A: 0xff}
+	colorMidBand  = color.RGBA{R: 0xe0, G: 0x90, B: 0x20, A: 0xff}
+	colorHighBand = color.RGBA{R: 0xf0, G: 0xf0, B: 0xf0, A: 0xff}
+)
+
+// Marker colours by cue type
+var (
+	colorCueMarker  = color.RGBA{R: 0x30, G: 0x90, B: 0xff, A: 0xff}
+	colorFadeMarker = color.RGBA{R: 0xff, G: 0x50, B: 0x20, A: 0xff}
+	colorLoadMarker = color.RGBA{R: 0xff, G: 0xe0, B: 0x00, A: 0xff}
+	colorGridMarker = color.RGBA{R: 0xc0, G: 0xc0, B: 0xc0, A: 0xc0}
+	colorLoopMarker = color.RGBA{R: 0x00, G: 0xd0, B: 0x40, A: 0x50}
+)
+
+// markerTapDistance is how far from a marker a tap still selects it
+const markerTapDistance = 4
+
+// waveformView draws the overview of a track with its cue points, loops
+// and grid markers on top. Tapping a marker calls OnMarkerTapped.
+type waveformView struct {
+	widget.BaseWidget
+	overview *waveform.Overview
+	cues     []traktor.CuePoint
+	// duration places the markers while the overview is loading
+	duration       float64
+	OnMarkerTapped func(cue traktor.CuePoint)
+}
+
+// newWaveformView returns an empty waveform
+func newWaveformView() *waveformView {
+	view := &waveformView{}
+	view.ExtendBaseWidget(view)
+	return view
+}
+
+// SetTrack shows the markers of a track, the overview follows with SetOverview
+func (v *waveformView) SetTrack(cues []traktor.CuePoint, duration float64) {
+	v.overview = nil
+	v.cues = cues
+	v.duration = duration
+	v.Refresh()
+}
+
+// SetOverview shows the band levels of the track
+func (v *waveformView) SetOverview(overview *waveform.Overview) {
+	v.overview = overview
+	if overview.Duration > 0 {
+		v.duration = overview.Duration
+	}
+	v.Refresh()
+}
+
+// markerX returns the horizontal position of a track position in ms
+func (v *waveformView) markerX(position float64, width float32) float32 {
+	if v.duration <= 0 {
+		return 0
+	}
+	return float32(position/1000/v.duration) * width
+}
+
+// Tapped selects the closest marker near the tap, or the loop under it
+func (v *waveformView) Tapped(event *fyne.PointEvent) {
+	if v.OnMarkerTapped == nil {
+		return
+	}
+	width := v.Size().Width
+	best, bestDistance := -1, float32(markerTapDistance)
+	for i, cue := range v.cues {
+		distance := float32(math.Abs(float64(v.markerX(cue.Start, width) - event.Position.X)))
+		if distance <= bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+	if best < 0 {
+		for i, cue := range v.cues {
+			if cue.Type == traktor.CueTypeLoop && cue.Len > 0 &&
+				event.Position.X >= v.markerX(cue.Start, width) && event.Position.X <= v.markerX(cue.Start+cue.Len, width) {
+				best = i
+				break
+			}
+		}
+	}
+	if best >= 0 {
+		v.OnMarkerTapped(v.cues[best])
+	}
+}
+
+func (v *waveformView) CreateRenderer() fyne.WidgetRenderer {
+	r := &waveformRenderer{view: v}
+	r.raster = canvas.NewRaster(r.draw)
+	r.rebuild()
+	return r
+}
+
+// waveformRenderer draws the overview as a raster and the markers as rectangles
+type waveformRenderer struct {
+	view    *waveformView
+	raster  *canvas.Raster
+	markers []*canvas.Rectangle
+}
+
+// rebuild creates a rectangle for every marker, loops first so the point
+// markers stay visible on top
+func (r *waveformRenderer) rebuild() {
+	r.markers = r.markers[:0]
+	for _, loops := range []bool{true, false} {
+		for _, cue := range r.view.cues {
+			if (cue.Type == traktor.CueTypeLoop) == loops {
+				r.markers = append(r.markers, canvas.NewRectangle(markerColor(cue)))
+			}
+		}
+	}
+}
+
+// markerColor returns the colour of a cue by its type
+func markerColor(cue traktor.CuePoint) color.Color {
+	switch cue.Type {
+	case traktor.CueTypeFadeIn, traktor.CueTypeFadeOut:
+		return colorFadeMarker
+	case traktor.CueTypeLoad:
+		return colorLoadMarker
+	case traktor.CueTypeGrid:
+		return colorGridMarker
+	case traktor.CueTypeLoop:
+		return colorLoopMarker
+	default:
+		return colorCueMarker
+	}
+}
+
+func (r *waveformRenderer) Layout(size fyne.Size) {
+	r.raster.Resize(size)
+	r.raster.Move(fyne.NewPos(0, 0))
+	i := 0
+	for _, loops := range []bool{true, false} {
+		for _, cue := range r.view.cues {
+			if (cue.Type == traktor.CueTypeLoop) != loops {
+				continue
+			}
+			x := r.view.markerX(cue.Start, size.Width)
+			width := float32(2)
+			if loops {
+				width = max(r.view.markerX(cue.Start+cue.Len, size.Width)-x, 2)
+			}
+			r.markers[i].Move(fyne.NewPos(x-1, 0))
+			r.markers[i].Resize(fyne.NewSize(width, size.Height))
+			i++
+		}
+	}
+}
+
+func (r *waveformRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(200, 64)
+}
+
+func (r *waveformRenderer) Refresh() {
+	r.rebuild()
+	r.Layout(r.view.Size())
+	r.raster.Refresh()
+	for _, marker := range r.markers {
+		marker.Refresh()
+	}
+}
+
+func (r *waveformRenderer) Objects() []fyne.CanvasObject {
+	objects := []fyne.CanvasObject{r.raster}
+	for _, marker := range r.markers {
+		objects = append(objects, marker)
+	}
+	return objects
+}
+
+func (r *waveformRenderer) Destroy() {}
+
+// draw renders the overview mirrored around the centre line, every pixel
+// column showing the loudest overview columns it covers. The levels are
+// scaled so the loudest column fills the height.
+func (r *waveformRenderer) draw(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	overview := r.view.overview
+	if overview == nil || len(overview.Columns) == 0 || width == 0 {
+		return img
+	}
+	peak := float64(max(overview.Peak(), 1))
+	centre := height / 2
+	count := len(overview.Columns)
+	for x := 0; x < width; x++ {
+		from := x * count / width
+		to := max((x+1)*count/width, from+1)
+		var column waveform.Column
+		for _, c := range overview.Columns[from:min(to, count)] {
+			column.Low = max(column.Low, c.Low)
+			column.Mid = max(column.Mid, c.Mid)
+			column.High = max(column.High, c.High)
+		}
+		bands := []struct {
+			level uint8
+			color color.RGBA
+		}{
+			{column.Low, colorLowBand},
+			{column.Mid, colorMidBand},
+			{column.High, colorHighBand},
+		}
+		for _, band := range bands {
+			extent := int(float64(band.level) / peak * float64(centre))
+			for y := centre - extent; y <= centre+extent && y < height; y++ {
+				img.SetRGBA(x, y, band.color)
+			}
+		}
+	}
+	return img
+}